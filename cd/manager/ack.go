@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// AlertResponders returns the people who can acknowledge alerts for failed jobs, i.e. GitHub usernames or Discord user
+// IDs, if any have been configured
+func AlertResponders() []string {
+	responders := make([]string, 0)
+	for _, responder := range strings.Split(os.Getenv("ALERT_RESPONDERS"), ",") {
+		if responder = strings.TrimSpace(responder); len(responder) > 0 {
+			responders = append(responders, responder)
+		}
+	}
+	return responders
+}
+
+// IsAlertResponder returns true if the person is allowed to acknowledge alerts
+func IsAlertResponder(responderId string) bool {
+	for _, responder := range AlertResponders() {
+		// GitHub usernames are case-insensitive
+		if strings.EqualFold(responder, strings.TrimSpace(responderId)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AckExpiry returns when an alert for a failed job can no longer be acknowledged. Failed jobs can be acknowledged for as
+// long as they're cached.
+func AckExpiry(jobState job.JobState) time.Time {
+	return jobState.Ts.AddDate(0, 0, DefaultTtlDays)
+}
+
+// IsAcknowledged returns true if the alert for a failed job has been acknowledged
+func IsAcknowledged(jobState job.JobState) bool {
+	ackedBy, _ := jobState.Params[job.JobParam_AckedBy].(string)
+	return len(ackedBy) > 0
+}
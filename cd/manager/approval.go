@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const (
+	ApprovalAction_Approve = "approve"
+	ApprovalAction_Reject  = "reject"
+	ApprovalAction_Reset   = "reset"
+	// Acknowledging an alert for a failed job uses the same signed links as approvals
+	ApprovalAction_Acknowledge = "acknowledge"
+)
+
+// ApprovalTarget_DeployBreaker stands in for the job ID in tokens that authorize resetting the deploy circuit breaker
+const ApprovalTarget_DeployBreaker = "deploy-breaker"
+
+const approvalTokenSeparator = "."
+
+// Jobs that aren't approved or rejected within a day are canceled so that they don't hold up the queue indefinitely
+const defaultApprovalTimeout = 24 * time.Hour
+
+// ApprovalExpiry returns when a job waiting for approval will be canceled if it hasn't been approved or rejected. Jobs
+// are timestamped when they start waiting for approval.
+func ApprovalExpiry(jobState job.JobState) time.Time {
+	timeout := defaultApprovalTimeout
+	if t, err := time.ParseDuration(os.Getenv("APPROVAL_TIMEOUT")); (err == nil) && (t > 0) {
+		timeout = t
+	}
+	return jobState.Ts.Add(timeout)
+}
+
+// ApprovalToken signs an approval decision for a job on behalf of an approver. The token is only valid for the same
+// job, action, and approver, and only until it expires, so that a leaked approval link can't be reused for a different
+// job or decision.
+//
+// Tokens have the form `<expiry unix seconds>.<hex HMAC-SHA256>`.
+func ApprovalToken(key []byte, jobId, action, approverId string, expiry time.Time) string {
+	expiryStr := strconv.FormatInt(expiry.Unix(), 10)
+	return expiryStr + approvalTokenSeparator + approvalSignature(key, jobId, action, approverId, expiryStr)
+}
+
+// VerifyApprovalToken checks that a token was signed with the key for the specified job, action, and approver, and
+// that it hasn't expired.
+func VerifyApprovalToken(key []byte, token, jobId, action, approverId string, now time.Time) error {
+	if len(key) == 0 {
+		return fmt.Errorf("verifyApprovalToken: %w: no signing key", Error_InvalidApprovalToken)
+	}
+	expiryStr, signature, found := strings.Cut(token, approvalTokenSeparator)
+	if !found {
+		return fmt.Errorf("verifyApprovalToken: %w: malformed token", Error_InvalidApprovalToken)
+	}
+	expiry, err := strconv.ParseInt(expiryStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("verifyApprovalToken: %w: invalid expiry: %s", Error_InvalidApprovalToken, expiryStr)
+	}
+	// GitHub usernames are case-insensitive
+	expected := approvalSignature(key, jobId, action, strings.ToLower(strings.TrimSpace(approverId)), expiryStr)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return fmt.Errorf("verifyApprovalToken: %w: signature mismatch", Error_InvalidApprovalToken)
+	} else if now.After(time.Unix(expiry, 0)) {
+		return fmt.Errorf("verifyApprovalToken: %w: expired at %s", Error_InvalidApprovalToken, time.Unix(expiry, 0).UTC())
+	}
+	return nil
+}
+
+func approvalSignature(key []byte, jobId, action, approverId, expiryStr string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{jobId, action, strings.ToLower(strings.TrimSpace(approverId)), expiryStr}, "|")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
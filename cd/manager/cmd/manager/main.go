@@ -7,28 +7,39 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/joho/godotenv"
 
 	"github.com/3box/pipeline-tools/cd/manager"
 	"github.com/3box/pipeline-tools/cd/manager/common"
 	"github.com/3box/pipeline-tools/cd/manager/common/aws/apigw"
+	"github.com/3box/pipeline-tools/cd/manager/common/aws/backup"
+	"github.com/3box/pipeline-tools/cd/manager/common/aws/cdn"
 	"github.com/3box/pipeline-tools/cd/manager/common/aws/config"
 	"github.com/3box/pipeline-tools/cd/manager/common/aws/ddb"
 	"github.com/3box/pipeline-tools/cd/manager/common/aws/ecs"
+	"github.com/3box/pipeline-tools/cd/manager/common/aws/secrets"
 	"github.com/3box/pipeline-tools/cd/manager/jobmanager"
+	"github.com/3box/pipeline-tools/cd/manager/jobs"
+	"github.com/3box/pipeline-tools/cd/manager/metrics"
 	"github.com/3box/pipeline-tools/cd/manager/notifs"
 	"github.com/3box/pipeline-tools/cd/manager/repository"
 	"github.com/3box/pipeline-tools/cd/manager/server"
 )
 
+const notifFlushTimeout = 30 * time.Second
+
 func main() {
 	if err := godotenv.Load("env/.env"); err != nil {
 		log.Fatal("Error loading .env file")
 	}
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.Printf("config: %s", manager.ConfigJson())
 
 	waitGroup := new(sync.WaitGroup)
 	shutdownChan := make(chan bool)
@@ -77,18 +88,58 @@ func createJobQueue(waitGroup *sync.WaitGroup, shutdownCh chan bool) manager.Man
 		log.Fatalf("Failed to create AWS cfg: %q", err)
 	}
 	cache := common.NewJobCache()
-	db := ddb.NewDynamoDb(cfg, cache)
+	// Restore active jobs from the last cache snapshot, if available, before reconciling against the database.
+	snapshotPath := common.CacheSnapshotPath()
+	if len(snapshotPath) > 0 {
+		if numJobs, err := common.RestoreCache(cache, snapshotPath); err != nil {
+			log.Printf("failed to restore cache snapshot, falling back to database: %v", err)
+		} else {
+			log.Printf("restored %d jobs from cache snapshot", numJobs)
+		}
+	}
+	retentionPolicy, err := manager.ConfiguredRetentionPolicy()
+	if err != nil {
+		log.Fatalf("failed to configure job retention: %q", err)
+	}
+	db := ddb.NewDynamoDb(cfg, cache, retentionPolicy)
 	if err = db.InitializeJobs(); err != nil {
 		log.Fatalf("failed to populate jobs from database: %q", err)
 	}
+	if len(snapshotPath) > 0 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			common.SnapshotCachePeriodically(cache, snapshotPath, shutdownCh)
+		}()
+	}
+	// Prune old job history in the background so that the job table doesn't grow unbounded
+	if retentionPolicy != nil {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			common.PruneJobsPeriodically(db, *retentionPolicy, jobs.JobTypes(), shutdownCh)
+		}()
+	}
 	deployment := ecs.NewEcs(cfg)
+	// Create a deployment for each region used for staggered multi-region deployments
+	regionDeployments := make(map[string]manager.Deployment)
+	for _, region := range manager.DeployRegions() {
+		regionCfg := cfg.Copy()
+		regionCfg.Region = region
+		regionDeployments[region] = ecs.NewEcs(regionCfg)
+	}
 	apiGw := apigw.NewApiGw(cfg)
 	repo := repository.NewRepository()
-	n, err := notifs.NewJobNotifs(db, cache)
+	b := backup.NewBackup(cfg)
+	s := secrets.NewSecrets(cfg)
+	c := cdn.NewCloudFront(cfg)
+	p := metrics.NewPrometheus()
+	n, err := createNotifs(cfg, db, cache)
 	if err != nil {
 		log.Fatalf("failed to initialize notifications: %q", err)
 	}
-	jobManager, err := jobmanager.NewJobManager(cache, db, deployment, apiGw, repo, n)
+	// Record why jobs advance the way they do, if debugging
+	jobManager, err := jobmanager.NewJobManager(cache, db, deployment, apiGw, repo, n, b, s, c, p, regionDeployments, manager.NewDecisionLog())
 	if err != nil {
 		log.Fatalf("failed to create job queue: %q", err)
 	}
@@ -98,10 +149,55 @@ func createJobQueue(waitGroup *sync.WaitGroup, shutdownCh chan bool) manager.Man
 		log.Println("started job queue processing")
 		jobManager.ProcessJobs(shutdownCh)
 		log.Println("stopped job queue processing")
+		// Give notifications for the last processed jobs a chance to go out before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), notifFlushTimeout)
+		defer cancel()
+		if err := n.FlushPending(ctx); err != nil {
+			log.Printf("failed to flush pending notifications: %v", err)
+		}
 	}()
 	return jobManager
 }
 
+func createNotifs(cfg aws.Config, db manager.Database, cache manager.Cache) (manager.Notifs, error) {
+	sinkNotifs, err := notifs.NewSinkNotifs()
+	if err != nil {
+		return nil, err
+	}
+	sesNotifs, err := notifs.NewSesNotifs(cfg, db, cache)
+	if err != nil {
+		return nil, err
+	}
+	eventNotifs, err := notifs.NewEventNotifs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	allNotifs := make([]manager.Notifs, 0)
+	// Chat notifications can be turned off when events are only meant to go to a log pipeline
+	if sinkOnly, _ := strconv.ParseBool(os.Getenv("NOTIF_SINK_ONLY")); !sinkOnly || (sinkNotifs == nil) {
+		discordNotifs, err := notifs.NewJobNotifs(cfg, db, cache)
+		if err != nil {
+			return nil, err
+		}
+		// Send chat notifications first since they record message IDs in the job, which are then included in sink
+		// events.
+		allNotifs = append(allNotifs, discordNotifs)
+		if sesNotifs != nil {
+			allNotifs = append(allNotifs, sesNotifs)
+		}
+	}
+	if sinkNotifs != nil {
+		allNotifs = append(allNotifs, sinkNotifs)
+	}
+	if eventNotifs != nil {
+		allNotifs = append(allNotifs, eventNotifs)
+	}
+	if len(allNotifs) == 1 {
+		return allNotifs[0], nil
+	}
+	return notifs.NewCompositeNotifs(allNotifs...), nil
+}
+
 func shutdown(waitGroup *sync.WaitGroup, cleanup func() bool) {
 	interruptCh := make(chan os.Signal, 1)
 	signal.Notify(interruptCh, os.Interrupt)
@@ -0,0 +1,86 @@
+// Command replay re-runs the decisions recorded for a job against the job's state machine and reports, for each
+// decision, what the job decided when it was replayed and why.
+//
+// The job's history and decisions are read from the files saved from the manager's /jobs/{id}/history and
+// /jobs/{id}/decisions endpoints. Decisions are only recorded while the decision log is enabled.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+	"github.com/3box/pipeline-tools/cd/manager/replay"
+)
+
+func main() {
+	historyFile := flag.String("history", "", "file with the job's history")
+	decisionsFile := flag.String("decisions", "", "file with the job's decisions")
+	jsonOutput := flag.Bool("json", false, "print the replayed steps as JSON")
+	flag.Parse()
+	if (len(*historyFile) == 0) || (len(*decisionsFile) == 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var history []job.JobState
+	var decisions []manager.Decision
+	if err := readJson(*historyFile, &history); err != nil {
+		log.Fatalf("replay: error reading history: %v", err)
+	} else if err = readJson(*decisionsFile, &decisions); err != nil {
+		log.Fatalf("replay: error reading decisions: %v", err)
+	}
+	steps, err := replay.Replay(history, decisions)
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(steps); err != nil {
+			log.Fatalf("replay: error encoding steps: %v", err)
+		}
+		return
+	}
+	for _, step := range steps {
+		fmt.Println(formatStep(step))
+	}
+}
+
+func readJson(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func formatStep(step replay.Step) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s -> %s", step.Ts.Format("2006-01-02T15:04:05.000Z07:00"), step.Stage, step.Recorded.NextStage)
+	if len(step.Error) > 0 {
+		fmt.Fprintf(&b, ": not replayed: %s", step.Error)
+		return b.String()
+	}
+	if step.Matches {
+		b.WriteString(": reproduced")
+	} else {
+		fmt.Fprintf(&b, ": replayed -> %s", step.Replayed.NextStage)
+	}
+	for _, check := range step.Replayed.Checks {
+		fmt.Fprintf(&b, "\n    %s: %v", check.Name, check.Result)
+	}
+	if !step.Matches {
+		for _, check := range step.Recorded.Checks {
+			fmt.Fprintf(&b, "\n    recorded %s: %v", check.Name, check.Result)
+		}
+	}
+	if len(step.ReplayedReason) > 0 {
+		fmt.Fprintf(&b, "\n    failed: %s", step.ReplayedReason)
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/backup"
+	"github.com/aws/aws-sdk-go-v2/service/backup/types"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+const defaultBackupVault = "Default"
+
+type Backup struct {
+	client    *backup.Client
+	vaultName string
+	roleArn   string
+}
+
+func NewBackup(cfg aws.Config) manager.Backup {
+	vaultName := os.Getenv("BACKUP_VAULT_NAME")
+	if len(vaultName) == 0 {
+		vaultName = defaultBackupVault
+	}
+	return &Backup{backup.NewFromConfig(cfg), vaultName, os.Getenv("BACKUP_IAM_ROLE_ARN")}
+}
+
+func (b Backup) StartBackup(resourceArn string) (string, error) {
+	if len(b.roleArn) == 0 {
+		return "", fmt.Errorf("startBackup: backup role not configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	input := &backup.StartBackupJobInput{
+		BackupVaultName: aws.String(b.vaultName),
+		IamRoleArn:      aws.String(b.roleArn),
+		ResourceArn:     aws.String(resourceArn),
+	}
+	if output, err := b.client.StartBackupJob(ctx, input); err != nil {
+		log.Printf("startBackup: start backup job error: %s, %s, %v", b.vaultName, resourceArn, err)
+		return "", err
+	} else {
+		return *output.BackupJobId, nil
+	}
+}
+
+// CheckBackup returns true if the backup completed successfully and produced a recovery point, false if it is still
+// in progress, and an error if it did not complete successfully.
+func (b Backup) CheckBackup(backupId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	input := &backup.DescribeBackupJobInput{
+		BackupJobId: aws.String(backupId),
+	}
+	if output, err := b.client.DescribeBackupJob(ctx, input); err != nil {
+		log.Printf("checkBackup: describe backup job error: %s, %v", backupId, err)
+		return false, err
+	} else {
+		switch output.State {
+		case types.BackupJobStateCreated, types.BackupJobStatePending, types.BackupJobStateRunning:
+			return false, nil
+		case types.BackupJobStateCompleted:
+			// Don't trust the state alone, make sure that there's a recovery point we could restore from.
+			if (output.RecoveryPointArn == nil) || (len(*output.RecoveryPointArn) == 0) {
+				return false, fmt.Errorf("checkBackup: backup completed without a recovery point: %s", backupId)
+			}
+			return true, nil
+		default:
+			statusMessage := ""
+			if output.StatusMessage != nil {
+				statusMessage = *output.StatusMessage
+			}
+			return false, fmt.Errorf("checkBackup: backup did not complete: %s, %s, %s", backupId, output.State, statusMessage)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cdn
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+const invalidationStatus_Completed = "Completed"
+
+type CloudFront struct {
+	client *cloudfront.Client
+}
+
+func NewCloudFront(cfg aws.Config) manager.Cdn {
+	return &CloudFront{cloudfront.NewFromConfig(cfg)}
+}
+
+func (c CloudFront) CreateInvalidation(distributionId string, paths []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	input := &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(distributionId),
+		InvalidationBatch: &types.InvalidationBatch{
+			// The caller reference makes the request idempotent, so use the current time to always create a new one
+			CallerReference: aws.String(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &types.Paths{
+				Items:    paths,
+				Quantity: aws.Int32(int32(len(paths))),
+			},
+		},
+	}
+	if output, err := c.client.CreateInvalidation(ctx, input); err != nil {
+		log.Printf("createInvalidation: create invalidation error: %s, %v, %v", distributionId, paths, err)
+		return "", err
+	} else {
+		return *output.Invalidation.Id, nil
+	}
+}
+
+// CheckInvalidation returns true if the specified invalidation has completed
+func (c CloudFront) CheckInvalidation(distributionId, invalidationId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	input := &cloudfront.GetInvalidationInput{
+		DistributionId: aws.String(distributionId),
+		Id:             aws.String(invalidationId),
+	}
+	if output, err := c.client.GetInvalidation(ctx, input); err != nil {
+		log.Printf("checkInvalidation: get invalidation error: %s, %s, %v", distributionId, invalidationId, err)
+		return false, err
+	} else {
+		return aws.ToString(output.Invalidation.Status) == invalidationStatus_Completed, nil
+	}
+}
@@ -2,15 +2,17 @@ package ddb
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 
-	"github.com/mitchellh/mapstructure"
-
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -28,12 +30,20 @@ type DynamoDb struct {
 	client     *dynamodb.Client
 	jobTable   string
 	buildTable string
+	notifTable string
 	cache      manager.Cache
 	cursor     time.Time
+	retention  *manager.RetentionPolicy
 }
 
 const defaultJobStateTtl = 2 * 7 * 24 * time.Hour // Two weeks
 
+// DynamoDB limits batch writes to 25 items
+const maxBatchWriteItems = 25
+
+// Notifications that haven't been delivered within a day are no longer worth sending
+const defaultPendingNotifTtl = 24 * time.Hour
+
 // buildState represents build/deploy tag information. This information is maintained in a legacy DynamoDB table used by
 // our utility AWS Lambdas.
 type buildState struct {
@@ -46,7 +56,7 @@ type buildInfo struct {
 	BuildTag string `dynamodbav:"sha_tag"`
 }
 
-func NewDynamoDb(cfg aws.Config, cache manager.Cache) manager.Database {
+func NewDynamoDb(cfg aws.Config, cache manager.Cache, retention *manager.RetentionPolicy) manager.Database {
 	env := os.Getenv(manager.EnvVar_Env)
 	// Use override endpoint, if specified, so that we can store jobs locally, while hitting regular AWS endpoints for
 	// other operations. This allows local testing without affecting CD manager instances running in AWS.
@@ -61,13 +71,16 @@ func NewDynamoDb(cfg aws.Config, cache manager.Cache) manager.Database {
 	}
 	jobTable := "ceramic-" + env + "-ops"
 	buildTable := "ceramic-utils-" + env
+	notifTable := "ceramic-" + env + "-notifs"
 	dynamoDbClient := dynamodb.NewFromConfig(cfg)
 	db := &DynamoDb{
 		dynamoDbClient,
 		jobTable,
 		buildTable,
+		notifTable,
 		cache,
 		time.Unix(0, 0),
+		retention,
 	}
 	if err = db.createJobTable(); err != nil {
 		log.Fatalf("dynamodb: job table creation failed: %v", err)
@@ -75,11 +88,18 @@ func NewDynamoDb(cfg aws.Config, cache manager.Cache) manager.Database {
 	if err = db.createBuildTable(); err != nil {
 		log.Fatalf("dynamodb: build table creation failed: %v", err)
 	}
+	if err = db.createNotifTable(); err != nil {
+		log.Fatalf("dynamodb: notif table creation failed: %v", err)
+	}
 	return db
 }
 
 func (db DynamoDb) createJobTable() error {
-	return job.CreateJobTable(context.Background(), db.client, db.jobTable)
+	if err := job.CreateJobTable(context.Background(), db.client, db.jobTable); err != nil {
+		return err
+	}
+	// Tables created before child jobs were tracked won't have the parent index
+	return job.CreateParentTsIndex(context.Background(), db.client, db.jobTable)
 }
 
 func (db DynamoDb) createBuildTable() error {
@@ -106,6 +126,27 @@ func (db DynamoDb) createBuildTable() error {
 	return utils.CreateTable(context.Background(), db.client, &createTableInput)
 }
 
+func (db DynamoDb) createNotifTable() error {
+	// Create the table if it doesn't already exist
+	createTableInput := dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("id"),
+				AttributeType: "S",
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("id"),
+				KeyType:       "HASH",
+			},
+		},
+		TableName:   aws.String(db.notifTable),
+		BillingMode: types.BillingModePayPerRequest,
+	}
+	return utils.CreateTable(context.Background(), db.client, &createTableInput)
+}
+
 func (db DynamoDb) InitializeJobs() error {
 	ttlCursor := time.Now().AddDate(0, 0, -manager.DefaultTtlDays)
 	// Load all jobs in an advanced stage of processing (completed, failed, delayed, waiting, started, skipped), so that
@@ -122,6 +163,8 @@ func (db DynamoDb) InitializeJobs() error {
 		return err
 	} else if err = db.loadJobs(job.JobStage_Dequeued, ttlCursor); err != nil {
 		return err
+	} else if err = db.loadJobs(job.JobStage_PendingApproval, ttlCursor); err != nil {
+		return err
 	} else {
 		return db.loadJobs(job.JobStage_Skipped, ttlCursor)
 	}
@@ -210,14 +253,18 @@ func (db DynamoDb) IterateByType(jobType job.JobType, asc bool, iter func(job.Jo
 func (db DynamoDb) iterateByStage(jobStage job.JobStage, cursor time.Time, asc bool, iter func(job.JobState) bool) error {
 	// Only look for jobs up till the current time. This allows us to schedule jobs in the future (e.g. smoke tests to
 	// start a few minutes after a deployment is complete).
+	return db.iterateByStageRange(jobStage, cursor, time.Now(), asc, iter)
+}
+
+func (db DynamoDb) iterateByStageRange(jobStage job.JobStage, start, end time.Time, asc bool, iter func(job.JobState) bool) error {
 	return db.iterateEvents(&dynamodb.QueryInput{
 		TableName:              aws.String(db.jobTable),
 		IndexName:              aws.String(job.StageTsIndex),
-		KeyConditionExpression: aws.String("#stage = :stage and #ts between :ts and :now"),
+		KeyConditionExpression: aws.String("#stage = :stage and #ts between :start and :end"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":stage": &types.AttributeValueMemberS{Value: string(jobStage)},
-			":ts":    &types.AttributeValueMemberN{Value: strconv.FormatInt(cursor.UnixNano(), 10)},
-			":now":   &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UnixNano(), 10)},
+			":start": &types.AttributeValueMemberN{Value: strconv.FormatInt(start.UnixNano(), 10)},
+			":end":   &types.AttributeValueMemberN{Value: strconv.FormatInt(end.UnixNano(), 10)},
 		},
 		ExpressionAttributeNames: map[string]string{
 			"#stage": "stage",
@@ -247,6 +294,134 @@ func (db DynamoDb) iterateByType(jobType job.JobType, cursor time.Time, asc bool
 	}, iter)
 }
 
+// PaginatedGetJobs returns a page of job states, in no particular order, along with a cursor for the next page. An empty
+// cursor fetches the first page, and an empty next cursor is returned with the last page.
+func (db DynamoDb) PaginatedGetJobs(cursor string, limit int) ([]job.JobState, string, error) {
+	scanInput := &dynamodb.ScanInput{
+		TableName: aws.String(db.jobTable),
+		Limit:     aws.Int32(int32(limit)),
+	}
+	if len(cursor) > 0 {
+		if startKey, err := decodeCursor(cursor); err != nil {
+			return nil, "", err
+		} else {
+			scanInput.ExclusiveStartKey = startKey
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	scanOutput, err := db.client.Scan(ctx, scanInput)
+	if err != nil {
+		return nil, "", err
+	}
+	jobs, err := unmarshalJobs(scanOutput.Items)
+	if err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(scanOutput.LastEvaluatedKey) > 0 {
+		if nextCursor, err = encodeCursor(scanOutput.LastEvaluatedKey); err != nil {
+			return nil, "", err
+		}
+	}
+	return jobs, nextCursor, nil
+}
+
+// Cursors are opaque to callers, and are the base64-encoded JSON of the key of the last job state returned.
+func encodeCursor(key map[string]types.AttributeValue) (string, error) {
+	var keyValues map[string]string
+	if err := attributevalue.UnmarshalMap(key, &keyValues); err != nil {
+		return "", err
+	} else if keyJson, err := json.Marshal(keyValues); err != nil {
+		return "", err
+	} else {
+		return base64.RawURLEncoding.EncodeToString(keyJson), nil
+	}
+}
+
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	var keyValues map[string]string
+	if keyJson, err := base64.RawURLEncoding.DecodeString(cursor); err != nil {
+		return nil, manager.Error_InvalidCursor
+	} else if err = json.Unmarshal(keyJson, &keyValues); err != nil {
+		return nil, manager.Error_InvalidCursor
+	}
+	return attributevalue.MarshalMap(keyValues)
+}
+
+// GetChildJobs returns the latest state of each job created by the specified job, in the order they were created
+func (db DynamoDb) GetChildJobs(parentId string) ([]job.JobState, error) {
+	childJobs := make([]job.JobState, 0, 0)
+	childJobIdx := make(map[string]int)
+	if err := db.iterateEvents(&dynamodb.QueryInput{
+		TableName:              aws.String(db.jobTable),
+		IndexName:              aws.String(job.ParentTsIndex),
+		KeyConditionExpression: aws.String("#parent = :parent"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":parent": &types.AttributeValueMemberS{Value: parentId},
+		},
+		ExpressionAttributeNames: map[string]string{
+			"#parent": "parent",
+		},
+		ScanIndexForward: aws.Bool(true),
+	}, func(jobState job.JobState) bool {
+		// Every stage of a child job is returned in ascending order of timestamp, so keep overwriting the state of a
+		// child job to end up with its latest state.
+		if idx, found := childJobIdx[jobState.JobId]; found {
+			childJobs[idx] = jobState
+		} else {
+			childJobIdx[jobState.JobId] = len(childJobs)
+			childJobs = append(childJobs, jobState)
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return childJobs, nil
+}
+
+// GetJobsByDateRange returns the jobs that moved to any of the specified stages within a time range, e.g. jobs that
+// finished over the past day, ordered by the time of the transition.
+func (db DynamoDb) GetJobsByDateRange(start, end time.Time, stages ...job.JobStage) ([]job.JobState, error) {
+	jobs := make([]job.JobState, 0, 0)
+	for _, jobStage := range stages {
+		if err := db.iterateByStageRange(jobStage, start, end, true, func(jobState job.JobState) bool {
+			jobs = append(jobs, jobState)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Ts.Before(jobs[j].Ts)
+	})
+	return jobs, nil
+}
+
+// GetJobHistory returns every state recorded for a job, in ascending order of timestamp
+func (db DynamoDb) GetJobHistory(jobId string) ([]job.JobState, error) {
+	history := make([]job.JobState, 0, 0)
+	if err := db.iterateEvents(&dynamodb.QueryInput{
+		TableName:              aws.String(db.jobTable),
+		IndexName:              aws.String(job.JobTsIndex),
+		KeyConditionExpression: aws.String("#job = :job"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":job": &types.AttributeValueMemberS{Value: jobId},
+		},
+		ExpressionAttributeNames: map[string]string{
+			"#job": "job",
+		},
+		ScanIndexForward: aws.Bool(true),
+	}, func(jobState job.JobState) bool {
+		history = append(history, jobState)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
 func (db DynamoDb) iterateEvents(queryInput *dynamodb.QueryInput, iter func(job.JobState) bool) error {
 	p := dynamodb.NewQueryPaginator(db.client, queryInput)
 	for p.HasMorePages() {
@@ -258,28 +433,11 @@ func (db DynamoDb) iterateEvents(queryInput *dynamodb.QueryInput, iter func(job.
 			if err != nil {
 				return err
 			}
-			var jobsPage []job.JobState
-			err = attributevalue.UnmarshalListOfMapsWithOptions(page.Items, &jobsPage, func(options *attributevalue.DecoderOptions) {
-				options.DecodeTime = attributevalue.DecodeTimeAttributes{
-					S: utils.TsDecode,
-					N: utils.TsDecode,
-				}
-			})
+			jobsPage, err := unmarshalJobs(page.Items)
 			if err != nil {
-				log.Printf("initialize: unable to unmarshal jobState: %v", err)
 				return err
 			}
 			for _, jobState := range jobsPage {
-				if jobState.Type == job.JobType_Deploy {
-					// Marshal layout back into `Layout` structure
-					if layout, found := jobState.Params[job.DeployJobParam_Layout].(map[string]interface{}); found {
-						var marshaledLayout manager.Layout
-						if err = mapstructure.Decode(layout, &marshaledLayout); err != nil {
-							return err
-						}
-						jobState.Params[job.DeployJobParam_Layout] = marshaledLayout
-					}
-				}
 				if !iter(jobState) {
 					return nil
 				}
@@ -293,6 +451,25 @@ func (db DynamoDb) iterateEvents(queryInput *dynamodb.QueryInput, iter func(job.
 	return nil
 }
 
+func unmarshalJobs(items []map[string]types.AttributeValue) ([]job.JobState, error) {
+	var jobs []job.JobState
+	if err := attributevalue.UnmarshalListOfMapsWithOptions(items, &jobs, func(options *attributevalue.DecoderOptions) {
+		options.DecodeTime = attributevalue.DecodeTimeAttributes{
+			S: utils.TsDecode,
+			N: utils.TsDecode,
+		}
+	}); err != nil {
+		log.Printf("initialize: unable to unmarshal jobState: %v", err)
+		return nil, err
+	}
+	for _, jobState := range jobs {
+		if err := manager.DecodeLayout(jobState); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
 func (db DynamoDb) AdvanceJob(jobState job.JobState) error {
 	if err := db.WriteJob(jobState); err != nil {
 		return err
@@ -304,8 +481,12 @@ func (db DynamoDb) AdvanceJob(jobState job.JobState) error {
 func (db DynamoDb) WriteJob(jobState job.JobState) error {
 	// Generate a new UUID for every job update
 	jobState.Id = uuid.New().String()
-	// Set entry expiration
-	jobState.Ttl = time.Now().Add(defaultJobStateTtl)
+	// Set entry expiration, unless the retention policy limits this job type's history, in which case the job is kept
+	// until it is pruned.
+	retained := (db.retention != nil) && db.retention.Limits(jobState.Type)
+	if !retained {
+		jobState.Ttl = time.Now().Add(defaultJobStateTtl)
+	}
 	if attributeValues, err := attributevalue.MarshalMapWithOptions(jobState, func(options *attributevalue.EncoderOptions) {
 		options.EncodeTime = func(time time.Time) (types.AttributeValue, error) {
 			return &types.AttributeValueMemberN{Value: strconv.FormatInt(time.UnixNano(), 10)}, nil
@@ -313,6 +494,9 @@ func (db DynamoDb) WriteJob(jobState job.JobState) error {
 	}); err != nil {
 		return err
 	} else {
+		if retained {
+			delete(attributeValues, "ttl")
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
 		defer cancel()
 
@@ -324,6 +508,225 @@ func (db DynamoDb) WriteJob(jobState job.JobState) error {
 	}
 }
 
+// WriteNotif records a job notification that has not yet been delivered to all of its channels
+func (db DynamoDb) WriteNotif(notif manager.PendingNotif) error {
+	// Set entry expiration
+	notif.Ttl = time.Now().Add(defaultPendingNotifTtl)
+	if attributeValues, err := attributevalue.MarshalMapWithOptions(notif, func(options *attributevalue.EncoderOptions) {
+		options.EncodeTime = func(time time.Time) (types.AttributeValue, error) {
+			return &types.AttributeValueMemberN{Value: strconv.FormatInt(time.UnixNano(), 10)}, nil
+		}
+	}); err != nil {
+		return err
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+		defer cancel()
+
+		_, err = db.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(db.notifTable),
+			Item:      attributeValues,
+		})
+		return err
+	}
+}
+
+// PendingNotifs returns the job notifications that were not confirmed as delivered, in the order of their job timestamps
+func (db DynamoDb) PendingNotifs() ([]manager.PendingNotif, error) {
+	notifs := make([]manager.PendingNotif, 0, 0)
+	p := dynamodb.NewScanPaginator(db.client, &dynamodb.ScanInput{TableName: aws.String(db.notifTable)})
+	for p.HasMorePages() {
+		if err := func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+			defer cancel()
+
+			page, err := p.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+			var notifsPage []manager.PendingNotif
+			if err = attributevalue.UnmarshalListOfMapsWithOptions(page.Items, &notifsPage, func(options *attributevalue.DecoderOptions) {
+				options.DecodeTime = attributevalue.DecodeTimeAttributes{
+					S: utils.TsDecode,
+					N: utils.TsDecode,
+				}
+			}); err != nil {
+				return err
+			}
+			for _, notif := range notifsPage {
+				// Expired entries might not have been deleted by DynamoDB yet, so delete them here instead of waiting
+				if notif.Ttl.Before(time.Now()) {
+					if err = db.DeleteNotif(notif.Id); err != nil {
+						log.Printf("pendingNotifs: error deleting expired notification: %v, %s", err, notif.Id)
+					}
+					continue
+				}
+				if err = manager.DecodeLayout(notif.Job); err != nil {
+					return err
+				}
+				notifs = append(notifs, notif)
+			}
+			return nil
+		}(); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(notifs, func(i, j int) bool {
+		return notifs[i].Job.Ts.Before(notifs[j].Job.Ts)
+	})
+	return notifs, nil
+}
+
+// DeleteNotif removes the record of a job notification once it has been delivered to all of its channels
+func (db DynamoDb) DeleteNotif(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	_, err := db.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.notifTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	return err
+}
+
+// PruneJobs deletes the records of finished jobs of the specified type that the prune function selects. Only jobs that
+// finished before the specified time are considered. Finished jobs are passed to the function from the most to the
+// least recently finished, along with how many more recently finished jobs there are. Returns the number of jobs and
+// records pruned.
+//
+// Every job update is written as a new record, and finished jobs aren't updated, so only records read here are ever
+// deleted, and updates written while pruning are never lost.
+func (db DynamoDb) PruneJobs(jobType job.JobType, before time.Time, prune func(jobState job.JobState, rank int) bool) (int, int, error) {
+	// Jobs that finished since the cutoff aren't pruned, but still count towards the rank of older finished jobs
+	numNewer, err := db.countFinishedJobs(jobType, before)
+	if err != nil {
+		return 0, 0, err
+	}
+	recordIds := make(map[string][]string)
+	finishedJobs := make([]job.JobState, 0)
+	// Iterate over the job type's history before the cutoff, newest first, so that the terminal update of each finished
+	// job is seen before any of its other updates. The first record seen for jobs that finished after the cutoff isn't a
+	// terminal update, so they're skipped.
+	if err = db.iterateEvents(&dynamodb.QueryInput{
+		TableName:              aws.String(db.jobTable),
+		IndexName:              aws.String(job.TypeTsIndex),
+		KeyConditionExpression: aws.String("#type = :type and #ts < :before"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":type":   &types.AttributeValueMemberS{Value: string(jobType)},
+			":before": &types.AttributeValueMemberN{Value: strconv.FormatInt(before.UnixNano(), 10)},
+		},
+		ExpressionAttributeNames: map[string]string{
+			"#type": "type",
+			"#ts":   "ts",
+		},
+		ScanIndexForward: aws.Bool(false),
+	}, func(jobState job.JobState) bool {
+		if _, found := recordIds[jobState.JobId]; !found && job.IsFinishedJob(jobState) {
+			finishedJobs = append(finishedJobs, jobState)
+		}
+		recordIds[jobState.JobId] = append(recordIds[jobState.JobId], jobState.Id)
+		return true
+	}); err != nil {
+		return 0, 0, err
+	}
+	prunedIds := make([]string, 0)
+	numJobs := 0
+	for idx, finishedJob := range finishedJobs {
+		if prune(finishedJob, numNewer+idx) {
+			prunedIds = append(prunedIds, recordIds[finishedJob.JobId]...)
+			numJobs++
+		}
+	}
+	numRecords := 0
+	for start := 0; start < len(prunedIds); start += maxBatchWriteItems {
+		end := start + maxBatchWriteItems
+		if end > len(prunedIds) {
+			end = len(prunedIds)
+		}
+		if err := db.deleteJobRecords(prunedIds[start:end]); err != nil {
+			return numJobs, numRecords, err
+		}
+		numRecords += end - start
+	}
+	return numJobs, numRecords, nil
+}
+
+// countFinishedJobs returns the number of jobs of the specified type that finished since the specified time. Finished
+// jobs aren't updated, so each has exactly one terminal record.
+func (db DynamoDb) countFinishedJobs(jobType job.JobType, since time.Time) (int, error) {
+	p := dynamodb.NewQueryPaginator(db.client, &dynamodb.QueryInput{
+		TableName:              aws.String(db.jobTable),
+		IndexName:              aws.String(job.TypeTsIndex),
+		KeyConditionExpression: aws.String("#type = :type and #ts >= :since"),
+		FilterExpression:       aws.String("#stage in (:skipped, :canceled, :failed, :completed)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":type":      &types.AttributeValueMemberS{Value: string(jobType)},
+			":since":     &types.AttributeValueMemberN{Value: strconv.FormatInt(since.UnixNano(), 10)},
+			":skipped":   &types.AttributeValueMemberS{Value: string(job.JobStage_Skipped)},
+			":canceled":  &types.AttributeValueMemberS{Value: string(job.JobStage_Canceled)},
+			":failed":    &types.AttributeValueMemberS{Value: string(job.JobStage_Failed)},
+			":completed": &types.AttributeValueMemberS{Value: string(job.JobStage_Completed)},
+		},
+		ExpressionAttributeNames: map[string]string{
+			"#type":  "type",
+			"#ts":    "ts",
+			"#stage": "stage",
+		},
+		Select: types.SelectCount,
+	})
+	count := 0
+	for p.HasMorePages() {
+		if err := func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+			defer cancel()
+
+			page, err := p.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+			count += int(page.Count)
+			return nil
+		}(); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (db DynamoDb) deleteJobRecords(ids []string) error {
+	writeRequests := make([]types.WriteRequest, len(ids))
+	for idx, id := range ids {
+		writeRequests[idx] = types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: id},
+				},
+			},
+		}
+	}
+	requestItems := map[string][]types.WriteRequest{db.jobTable: writeRequests}
+	// Retry unprocessed deletes, e.g. when throttled, backing off a little more each time
+	for attempt := 0; attempt <= manager.DefaultHttpRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		output, err := func() (*dynamodb.BatchWriteItemOutput, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+			defer cancel()
+
+			return db.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: requestItems})
+		}()
+		if err != nil {
+			return err
+		} else if len(output.UnprocessedItems) == 0 {
+			return nil
+		}
+		requestItems = output.UnprocessedItems
+	}
+	return fmt.Errorf("deleteJobRecords: unprocessed deletes: %d", len(requestItems[db.jobTable]))
+}
+
 func (db DynamoDb) UpdateBuildTag(component manager.DeployComponent, buildTag string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
 	defer cancel()
@@ -389,6 +792,35 @@ func (db DynamoDb) GetDeployTags() (map[manager.DeployComponent]string, error) {
 	}
 }
 
+// GetDeployTagByComponent returns the deploy tag for a single component, or an empty string if the component has never
+// been deployed
+func (db DynamoDb) GetDeployTagByComponent(component manager.DeployComponent) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	if getItemOutput, err := db.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.buildTable),
+		Key: map[string]types.AttributeValue{
+			"key": &types.AttributeValueMemberS{Value: string(component)},
+		},
+		ProjectionExpression: aws.String("#key, #deployTag"),
+		ExpressionAttributeNames: map[string]string{
+			"#key":       "key",
+			"#deployTag": "deployTag",
+		},
+	}); err != nil {
+		return "", err
+	} else if getItemOutput.Item == nil {
+		return "", nil
+	} else {
+		var state buildState
+		if err = attributevalue.UnmarshalMap(getItemOutput.Item, &state); err != nil {
+			return "", err
+		}
+		return state.DeployTag, nil
+	}
+}
+
 func (db DynamoDb) getBuildStates() ([]buildState, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
 	defer cancel()
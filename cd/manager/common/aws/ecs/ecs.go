@@ -3,13 +3,22 @@ package ecs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrTypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	ecrPublicTypes "github.com/aws/aws-sdk-go-v2/service/ecrpublic/types"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
@@ -20,27 +29,125 @@ import (
 var _ manager.Deployment = &Ecs{}
 
 type Ecs struct {
-	ecsClient *ecs.Client
-	ssmClient *ssm.Client
-	env       manager.EnvType
-	ecrUri    string
+	ecsClient          *ecs.Client
+	ssmClient          *ssm.Client
+	ecrClient          *ecr.Client
+	ecrPublicClient    *ecrpublic.Client
+	logsClient         *cloudwatchlogs.Client
+	env                manager.EnvType
+	ecrUri             string
+	stoppedReasonRules []stoppedReasonRule
+	// Whether to check that the images referenced by new task definition revisions exist before deploying them
+	checkTaskDefs bool
+	// Only services whose names start with this prefix are listed, e.g. to skip services not managed by the pipeline
+	servicePrefix string
 }
 
 type ecsFailure struct {
 	arn, detail, reason string
 }
 
+type imageDetail struct {
+	digest string
+	tags   []string
+}
+
+// stoppedReasonRule maps ECS task/container stopped reasons matching a pattern to a friendlier message
+type stoppedReasonRule struct {
+	Pattern string `json:"pattern"`
+	Message string `json:"message"`
+	regex   *regexp.Regexp
+}
+
+// Built-in rules for common ECS failures. Rules configured via the environment are checked before these.
+var defaultStoppedReasonRules = []stoppedReasonRule{
+	{Pattern: "OutOfMemoryError", Message: "Task ran out of memory"},
+	{Pattern: "CannotPullContainerError", Message: "Container image could not be pulled"},
+	{Pattern: "ResourceInitializationError", Message: "Task resources (secrets, logs, network) could not be initialized"},
+	{Pattern: "CannotStartContainerError", Message: "Container could not be started"},
+	{Pattern: "failed (ELB|container) health checks", Message: "Task failed health checks"},
+	{Pattern: "(?i)spot interruption", Message: "Task was interrupted by a Spot capacity reclaim"},
+	{Pattern: "Scaling activity initiated by", Message: "Task was stopped by a scaling activity"},
+	{Pattern: "ECS is performing maintenance", Message: "Task was stopped for ECS maintenance"},
+	{Pattern: "Essential container in task exited", Message: "Essential container exited"},
+}
+
 const (
 	deployType_Service string = "service"
 	deployType_Task    string = "task"
 )
 
 const resourceTag = "Ceramic"
+
+const (
+	ecsFailureReason_Missing  = "MISSING"
+	ecsServiceStatus_Inactive = "INACTIVE"
+	ecsServiceStatus_Active   = "ACTIVE"
+)
+
+// ECS describes at most 10 services per request
+const ecsDescribeServicesBatchSize = 10
+
 const publicEcrUri = "public.ecr.aws/r5b3e0r5/3box/"
 
+// Public ECR repositories are namespaced under the registry alias, and the public ECR API is only available in us-east-1
+const publicEcrNamespace = "3box/"
+const publicEcrRegion = "us-east-1"
+
+// Options of the "awslogs" log driver, which sends container logs to CloudWatch Logs
+const (
+	awsLogsOption_Group        = "awslogs-group"
+	awsLogsOption_StreamPrefix = "awslogs-stream-prefix"
+)
+
+// Poll more frequently than the ECS waiter defaults since callers typically wait for short periods of time
+const taskWaiterMinDelay = 2 * time.Second
+const taskWaiterMaxDelay = 30 * time.Second
+
+// Number of log lines to return for tasks run to completion
+const taskLogTailLines = 20
+
 func NewEcs(cfg aws.Config) manager.Deployment {
 	ecrUri := os.Getenv("AWS_ACCOUNT_ID") + ".dkr.ecr." + os.Getenv("AWS_REGION") + ".amazonaws.com/"
-	return &Ecs{ecs.NewFromConfig(cfg), ssm.NewFromConfig(cfg), manager.EnvType(os.Getenv(manager.EnvVar_Env)), ecrUri}
+	stoppedReasonRules, err := parseStoppedReasonRules(os.Getenv("ECS_STOPPED_REASON_RULES"))
+	if err != nil {
+		log.Fatalf("newEcs: invalid stopped reason rules: %v", err)
+	}
+	checkTaskDefs, _ := strconv.ParseBool(os.Getenv("DEPLOY_TASK_DEF_CHECK"))
+	return &Ecs{
+		ecs.NewFromConfig(cfg),
+		ssm.NewFromConfig(cfg),
+		ecr.NewFromConfig(cfg),
+		ecrpublic.NewFromConfig(cfg, func(o *ecrpublic.Options) {
+			o.Region = publicEcrRegion
+		}),
+		cloudwatchlogs.NewFromConfig(cfg),
+		manager.EnvType(os.Getenv(manager.EnvVar_Env)),
+		ecrUri,
+		stoppedReasonRules,
+		checkTaskDefs,
+		os.Getenv("SERVICE_PREFIX"),
+	}
+}
+
+// parseStoppedReasonRules parses a JSON array of `{"pattern": "<regex>", "message": "<message>"}` rules and appends the
+// built-in rules.
+func parseStoppedReasonRules(rulesJson string) ([]stoppedReasonRule, error) {
+	rules := make([]stoppedReasonRule, 0, len(defaultStoppedReasonRules))
+	if len(rulesJson) > 0 {
+		if err := json.Unmarshal([]byte(rulesJson), &rules); err != nil {
+			return nil, err
+		}
+	}
+	rules = append(rules, defaultStoppedReasonRules...)
+	for idx, rule := range rules {
+		if regex, err := regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("%s: %w", rule.Pattern, err)
+		} else {
+			rules[idx].regex = regex
+		}
+	}
+	return rules, nil
 }
 
 func (e Ecs) LaunchServiceTask(cluster, service, family, container string, overrides map[string]string) (string, error) {
@@ -51,26 +158,122 @@ func (e Ecs) LaunchServiceTask(cluster, service, family, container string, overr
 	}
 }
 
-func (e Ecs) LaunchTask(cluster, family, container, vpcConfigParam string, overrides map[string]string) (string, error) {
+func (e Ecs) LaunchTask(cluster, family, container, vpcConfigParam string, networkConfig *manager.NetworkConfig, overrides map[string]string) (string, error) {
+	// An explicit network configuration takes precedence over the one in SSM
+	if networkConfig != nil {
+		if err := manager.ValidateNetworkConfig(*networkConfig); err != nil {
+			log.Printf("launchTask: invalid network config: %s, %s, %+v, %v", cluster, family, networkConfig, err)
+			return "", err
+		}
+		return e.runEcsTask(cluster, family, container, &types.NetworkConfiguration{AwsvpcConfiguration: awsVpcConfig(*networkConfig)}, overrides)
+	}
+	if vpcConfig, err := e.GetVpcConfig(vpcConfigParam); err != nil {
+		log.Printf("launchTask: get vpc config error: %s, %s, %s, %+v, %v", cluster, family, vpcConfigParam, overrides, err)
+		return "", err
+	} else {
+		return e.runEcsTask(cluster, family, container, &types.NetworkConfiguration{AwsvpcConfiguration: awsVpcConfig(vpcConfig)}, overrides)
+	}
+}
+
+// RunTaskAndWait launches a task, waits for it to stop, and returns its exit code and the tail of its logs. This is
+// meant for short tasks, e.g. health probes, and so the task is stopped if it doesn't finish within the timeout. If the
+// task exited with a non-zero exit code, the result is returned along with an error describing why the task stopped.
+func (e Ecs) RunTaskAndWait(cluster, family, container, vpcConfigParam string, networkConfig *manager.NetworkConfig, overrides map[string]string, timeout time.Duration) (manager.TaskResult, error) {
+	taskArn, err := e.LaunchTask(cluster, family, container, vpcConfigParam, networkConfig, overrides)
+	if err != nil {
+		return manager.TaskResult{}, err
+	}
+	result := manager.TaskResult{TaskId: taskArn, ExitCode: -1}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	exitCode, waitErr := e.WaitForTaskStopped(ctx, cluster, taskArn)
+	if errors.Is(waitErr, context.DeadlineExceeded) {
+		e.stopEcsTask(cluster, taskArn, "timed out")
+		return result, fmt.Errorf("runTaskAndWait: task did not stop within %s: %s, %w", timeout, taskArn, waitErr)
+	}
+	result.ExitCode = exitCode
+	// Logs are only for context, so don't fail if they can't be retrieved
+	if logs, err := e.GetTaskLogs(cluster, taskArn, container); err != nil {
+		log.Printf("runTaskAndWait: error getting task logs: %s, %s, %v", cluster, taskArn, err)
+	} else {
+		if len(logs) > taskLogTailLines {
+			logs = logs[len(logs)-taskLogTailLines:]
+		}
+		result.Logs = logs
+	}
+	return result, waitErr
+}
+
+// CreateService creates a service from the specified spec, e.g. when bootstrapping a new environment
+func (e Ecs) CreateService(cluster string, spec manager.ServiceSpec) error {
+	vpcConfig, err := e.GetVpcConfig(spec.NetworkConfigParam)
+	if err != nil {
+		log.Printf("createService: get vpc config error: %s, %+v, %v", cluster, spec, err)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	input := &ecs.CreateServiceInput{
+		ServiceName:          aws.String(spec.Name),
+		Cluster:              aws.String(cluster),
+		TaskDefinition:       aws.String(spec.TaskDefinition),
+		DesiredCount:         aws.Int32(spec.DesiredCount),
+		EnableExecuteCommand: true,
+		LaunchType:           "FARGATE",
+		NetworkConfiguration: &types.NetworkConfiguration{AwsvpcConfiguration: awsVpcConfig(vpcConfig)},
+		Tags:                 []types.Tag{{Key: aws.String(resourceTag), Value: aws.String(string(e.env))}},
+	}
+	if spec.LoadBalancer != nil {
+		input.LoadBalancers = []types.LoadBalancer{{
+			TargetGroupArn: aws.String(spec.LoadBalancer.TargetGroupArn),
+			ContainerName:  aws.String(spec.LoadBalancer.ContainerName),
+			ContainerPort:  aws.Int32(spec.LoadBalancer.ContainerPort),
+		}}
+	}
+	if _, err = e.ecsClient.CreateService(ctx, input); err != nil {
+		log.Printf("createService: %s, %+v, %v", cluster, spec, err)
+		return err
+	}
+	return nil
+}
+
+// GetVpcConfig reads a network configuration stored in SSM. The parameter holds an ECS `AwsVpcConfiguration` as JSON,
+// e.g. `{"subnets": ["subnet-..."], "securityGroups": ["sg-..."], "assignPublicIp": "ENABLED"}`.
+func (e Ecs) GetVpcConfig(paramPath string) (manager.NetworkConfig, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
 	defer cancel()
 
-	// Get the VPC configuration from SSM
 	input := &ssm.GetParameterInput{
-		Name:           aws.String(vpcConfigParam),
+		Name:           aws.String(paramPath),
 		WithDecryption: false,
 	}
 	output, err := e.ssmClient.GetParameter(ctx, input)
 	if err != nil {
-		log.Printf("launchTask: get vpc config error: %s, %s, %s, %+v, %v", cluster, family, vpcConfigParam, overrides, err)
-		return "", err
+		return manager.NetworkConfig{}, err
 	}
 	var vpcConfig types.AwsVpcConfiguration
 	if err = json.Unmarshal([]byte(*output.Parameter.Value), &vpcConfig); err != nil {
-		log.Printf("launchTask: error unmarshaling worker network configuration: %s, %s, %s, %+v, %v", cluster, family, vpcConfigParam, overrides, err)
-		return "", err
+		return manager.NetworkConfig{}, fmt.Errorf("error unmarshaling network configuration: %v", err)
+	}
+	return manager.NetworkConfig{
+		Subnets:        vpcConfig.Subnets,
+		SecurityGroups: vpcConfig.SecurityGroups,
+		AssignPublicIp: vpcConfig.AssignPublicIp == types.AssignPublicIpEnabled,
+	}, nil
+}
+
+func awsVpcConfig(networkConfig manager.NetworkConfig) *types.AwsVpcConfiguration {
+	assignPublicIp := types.AssignPublicIpDisabled
+	if networkConfig.AssignPublicIp {
+		assignPublicIp = types.AssignPublicIpEnabled
+	}
+	return &types.AwsVpcConfiguration{
+		Subnets:        networkConfig.Subnets,
+		SecurityGroups: networkConfig.SecurityGroups,
+		AssignPublicIp: assignPublicIp,
 	}
-	return e.runEcsTask(cluster, family, container, &types.NetworkConfiguration{AwsvpcConfiguration: &vpcConfig}, overrides)
 }
 
 func (e Ecs) CheckTask(cluster, taskDefId string, running, stable bool, taskIds ...string) (bool, *int32, error) {
@@ -122,6 +325,283 @@ func (e Ecs) CheckTask(cluster, taskDefId string, running, stable bool, taskIds
 	return tasksFound && tasksInState, exitCode, nil
 }
 
+// GetTaskDefinitionArn returns the ARN of the latest active revision of the specified task definition family
+func (e Ecs) GetTaskDefinitionArn(family string) (string, error) {
+	if taskDef, err := e.getEcsTaskDefinition(family); err != nil {
+		return "", err
+	} else {
+		return *taskDef.TaskDefinitionArn, nil
+	}
+}
+
+// GetServiceTaskDefinitionFamily returns the task definition family of the task definition a service is running
+func (e Ecs) GetServiceTaskDefinitionFamily(cluster, service string) (string, error) {
+	if ecsService, err := e.describeEcsService(cluster, service); err != nil {
+		return "", err
+	} else if len(ecsService.Services) == 0 {
+		return "", fmt.Errorf("getServiceTaskDefinitionFamily: service not found: %s, %s", cluster, service)
+	} else {
+		return e.taskFamilyFromArn(*ecsService.Services[0].TaskDefinition), nil
+	}
+}
+
+// CheckServiceExists returns true if the specified service exists and has not been deleted
+func (e Ecs) CheckServiceExists(cluster, service string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	input := &ecs.DescribeServicesInput{
+		Services: []string{service},
+		Cluster:  aws.String(cluster),
+	}
+	if output, err := e.ecsClient.DescribeServices(ctx, input); err != nil {
+		log.Printf("checkServiceExists: %s, %s, %v", service, cluster, err)
+		return false, err
+	} else {
+		for _, failure := range output.Failures {
+			// Services that were never created are reported as "MISSING" failures
+			if (failure.Reason != nil) && (*failure.Reason == ecsFailureReason_Missing) {
+				return false, nil
+			}
+		}
+		if len(output.Failures) > 0 {
+			ecsFailures := e.parseEcsFailures(output.Failures)
+			log.Printf("checkServiceExists: %s, %s, %v", service, cluster, ecsFailures)
+			return false, fmt.Errorf("%v", ecsFailures)
+		}
+		// Deleted services are still returned for a while, but as "INACTIVE".
+		for _, ecsService := range output.Services {
+			if (ecsService.Status != nil) && (*ecsService.Status != ecsServiceStatus_Inactive) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// CheckImageExists returns true if an image with the specified tag exists in the repository
+func (e Ecs) CheckImageExists(repo manager.Repo, tag string) (bool, error) {
+	if exists, err := e.imageExists(repo, tag, ""); err != nil {
+		log.Printf("checkImageExists: %s, %s, %v", repo.Name, tag, err)
+		return false, err
+	} else {
+		return exists, nil
+	}
+}
+
+// AssertTaskDefinitionHealthy returns an error if the image referenced by a container in the latest revision of a task
+// definition family doesn't exist in its repository. If an image is specified, e.g. the image that the container is
+// about to be updated to, that image is checked instead. Images from registries other than our ECR repositories can't
+// be checked, and are assumed to exist.
+func (e Ecs) AssertTaskDefinitionHealthy(family, container, image string) error {
+	taskDef, err := e.getEcsTaskDefinition(family)
+	if err != nil {
+		return err
+	}
+	containerFound := false
+	for _, containerDef := range taskDef.ContainerDefinitions {
+		if aws.ToString(containerDef.Name) == container {
+			if len(image) == 0 {
+				image = aws.ToString(containerDef.Image)
+			}
+			containerFound = true
+			break
+		}
+	}
+	if !containerFound {
+		return fmt.Errorf("assertTaskDefinitionHealthy: container not found: %s, %s", *taskDef.TaskDefinitionArn, container)
+	}
+	repo, tag, digest, found := e.parseImageUri(image)
+	if !found {
+		log.Printf("assertTaskDefinitionHealthy: skipping image check for non-ecr image: %s, %s", *taskDef.TaskDefinitionArn, image)
+		return nil
+	}
+	if exists, err := e.imageExists(repo, tag, digest); err != nil {
+		log.Printf("assertTaskDefinitionHealthy: %s, %s, %v", *taskDef.TaskDefinitionArn, image, err)
+		return err
+	} else if !exists {
+		return fmt.Errorf("assertTaskDefinitionHealthy: image not found: %s, %s, %s", *taskDef.TaskDefinitionArn, container, image)
+	}
+	return nil
+}
+
+// imageExists returns true if an image with the specified tag or digest exists in the repository
+func (e Ecs) imageExists(repo manager.Repo, tag, digest string) (bool, error) {
+	if image, err := e.describeImage(repo, tag, digest); err != nil {
+		return false, err
+	} else {
+		return image != nil, nil
+	}
+}
+
+// GetImageDigest returns the digest of the image with the specified tag
+func (e Ecs) GetImageDigest(repo manager.Repo, tag string) (string, error) {
+	if image, err := e.describeImage(repo, tag, ""); err != nil {
+		log.Printf("getImageDigest: %s, %s, %v", repo.Name, tag, err)
+		return "", err
+	} else if image == nil {
+		return "", fmt.Errorf("getImageDigest: image not found: %s:%s", repo.Name, tag)
+	} else {
+		return image.digest, nil
+	}
+}
+
+// GetECRImageTags returns the tags of the image tagged with the specified commit hash that start with the commit hash,
+// or none if no image was pushed for the commit
+func (e Ecs) GetECRImageTags(repo manager.Repo, sha string) ([]string, error) {
+	tags := make([]string, 0)
+	if image, err := e.describeImage(repo, sha, ""); err != nil {
+		log.Printf("getECRImageTags: %s, %s, %v", repo.Name, sha, err)
+		return nil, err
+	} else if image != nil {
+		for _, tag := range image.tags {
+			if strings.HasPrefix(tag, sha) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags, nil
+}
+
+// describeImage looks up the image with the specified tag or digest in the repository, and returns nil if it doesn't
+// exist
+func (e Ecs) describeImage(repo manager.Repo, tag, digest string) (*imageDetail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	var imageTag, imageDigest *string
+	if len(digest) > 0 {
+		imageDigest = aws.String(digest)
+	} else {
+		imageTag = aws.String(tag)
+	}
+	if repo.Public {
+		output, err := e.ecrPublicClient.DescribeImages(ctx, &ecrpublic.DescribeImagesInput{
+			RepositoryName: aws.String(publicEcrNamespace + repo.Name),
+			ImageIds:       []ecrPublicTypes.ImageIdentifier{{ImageTag: imageTag, ImageDigest: imageDigest}},
+		})
+		var imageNotFound *ecrPublicTypes.ImageNotFoundException
+		if errors.As(err, &imageNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		} else if len(output.ImageDetails) > 0 {
+			return &imageDetail{aws.ToString(output.ImageDetails[0].ImageDigest), output.ImageDetails[0].ImageTags}, nil
+		}
+	} else {
+		output, err := e.ecrClient.DescribeImages(ctx, &ecr.DescribeImagesInput{
+			RepositoryName: aws.String(repo.Name),
+			ImageIds:       []ecrTypes.ImageIdentifier{{ImageTag: imageTag, ImageDigest: imageDigest}},
+		})
+		var imageNotFound *ecrTypes.ImageNotFoundException
+		if errors.As(err, &imageNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		} else if len(output.ImageDetails) > 0 {
+			return &imageDetail{aws.ToString(output.ImageDetails[0].ImageDigest), output.ImageDetails[0].ImageTags}, nil
+		}
+	}
+	return nil, nil
+}
+
+// WaitForTaskRunning blocks until the specified task is running, the task stops, or the context is done. If the
+// context is done before the task is running, the context error is returned.
+func (e Ecs) WaitForTaskRunning(ctx context.Context, cluster, taskId string) error {
+	waiter := ecs.NewTasksRunningWaiter(e.ecsClient, func(options *ecs.TasksRunningWaiterOptions) {
+		options.MinDelay = taskWaiterMinDelay
+		options.MaxDelay = taskWaiterMaxDelay
+	})
+	input := &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   []string{taskId},
+	}
+	if err := waiter.Wait(ctx, input, e.waitDuration(ctx)); err != nil {
+		if e.waitTimedOut(ctx) {
+			return context.DeadlineExceeded
+		}
+		log.Printf("waitForTaskRunning: %s, %s, %v", cluster, taskId, err)
+		return err
+	}
+	return nil
+}
+
+// WaitForTaskStopped blocks until the specified task has stopped or the context is done, and returns the exit code of
+// the task's primary container. If the context is done before the task has stopped, the context error is returned. If
+// the task exited with a non-zero exit code, an error describing why the task stopped is also returned.
+func (e Ecs) WaitForTaskStopped(ctx context.Context, cluster, taskId string) (int, error) {
+	waiter := ecs.NewTasksStoppedWaiter(e.ecsClient, func(options *ecs.TasksStoppedWaiterOptions) {
+		options.MinDelay = taskWaiterMinDelay
+		options.MaxDelay = taskWaiterMaxDelay
+		// Consider a task that can no longer be found to have stopped, i.e. the task has already stopped and been
+		// removed from the list.
+		retryable := options.Retryable
+		options.Retryable = func(ctx context.Context, input *ecs.DescribeTasksInput, output *ecs.DescribeTasksOutput, err error) (bool, error) {
+			if (err == nil) && (len(output.Tasks) == 0) && (len(output.Failures) > 0) {
+				return false, nil
+			}
+			return retryable(ctx, input, output, err)
+		}
+	})
+	input := &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   []string{taskId},
+	}
+	output, err := waiter.WaitForOutput(ctx, input, e.waitDuration(ctx))
+	if err != nil {
+		if e.waitTimedOut(ctx) {
+			return -1, context.DeadlineExceeded
+		}
+		log.Printf("waitForTaskStopped: %s, %s, %v", cluster, taskId, err)
+		return -1, err
+	}
+	if len(output.Tasks) == 0 {
+		// There's no way to know how a task that was removed from the list exited, so assume that it was successful.
+		return 0, nil
+	}
+	return e.taskExitCode(output.Tasks[0])
+}
+
+// CheckTaskStopped checks once, without waiting, whether the specified task has stopped, and if so, returns the exit
+// code of the task's primary container. If the task exited with a non-zero exit code, an error describing why the task
+// stopped is also returned.
+func (e Ecs) CheckTaskStopped(cluster, taskId string) (bool, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	output, err := e.ecsClient.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   []string{taskId},
+	})
+	if err != nil {
+		log.Printf("checkTaskStopped: describe task error: %s, %s, %v", cluster, taskId, err)
+		return false, -1, err
+	}
+	if len(output.Tasks) == 0 {
+		// A task that can no longer be found has already stopped and been removed from the list. There's no way to know
+		// how it exited, so assume that it was successful.
+		return len(output.Failures) > 0, 0, nil
+	}
+	task := output.Tasks[0]
+	if aws.ToString(task.LastStatus) != string(types.DesiredStatusStopped) {
+		return false, -1, nil
+	}
+	exitCode, err := e.taskExitCode(task)
+	return true, exitCode, err
+}
+
+func (e Ecs) taskExitCode(task types.Task) (int, error) {
+	// We always configure the primary application in a task as the first container, so we only care about its exit
+	// code.
+	if (len(task.Containers) == 0) || (task.Containers[0].ExitCode == nil) {
+		return -1, fmt.Errorf("taskExitCode: task stopped without an exit code: %s", e.stoppedReason(task))
+	} else if exitCode := int(*task.Containers[0].ExitCode); exitCode != 0 {
+		return exitCode, fmt.Errorf("taskExitCode: task exited with code %d: %s", exitCode, e.stoppedReason(task))
+	} else {
+		return exitCode, nil
+	}
+}
+
 func (e Ecs) GetLayout(clusters []string) (*manager.Layout, error) {
 	// First validate and filter the list of clusters since not all clusters might be present in all envs.
 	if descClusterOutput, err := e.describeEcsClusters(clusters); err != nil {
@@ -132,20 +612,20 @@ func (e Ecs) GetLayout(clusters []string) (*manager.Layout, error) {
 		for _, cluster := range descClusterOutput.Clusters {
 			clusterName := *cluster.ClusterName
 			if clusterServices, err := e.listEcsServices(clusterName); err != nil {
-				log.Printf("getLayout: list services error: %s, %v", cluster, err)
+				log.Printf("getLayout: list services error: %s, %v", clusterName, err)
 				return nil, err
 			} else if len(clusterServices.ServiceArns) > 0 {
 				layout.Clusters[clusterName] = &manager.Cluster{ServiceTasks: &manager.TaskSet{Tasks: map[string]*manager.Task{}}}
 				for _, serviceArn := range clusterServices.ServiceArns {
 					service := e.serviceNameFromArn(serviceArn)
 					if ecsService, err := e.describeEcsService(clusterName, service); err != nil {
-						log.Printf("getLayout: describe service error: %s, %s, %v", cluster, service, err)
+						log.Printf("getLayout: describe service error: %s, %s, %v", clusterName, service, err)
 						return nil, err
 					} else {
 						taskDefArn := *ecsService.Services[0].TaskDefinition
 						containerDefNames := make([]string, 0, 1)
 						if taskDef, err := e.getEcsTaskDefinition(taskDefArn); err != nil {
-							log.Printf("getLayout: get task def error: %s, %s, %s, %v", taskDefArn, cluster, service, err)
+							log.Printf("getLayout: get task def error: %s, %s, %s, %v", taskDefArn, clusterName, service, err)
 							return nil, err
 						} else {
 							for _, containerDef := range taskDef.ContainerDefinitions {
@@ -162,13 +642,13 @@ func (e Ecs) GetLayout(clusters []string) (*manager.Layout, error) {
 	}
 }
 
-func (e Ecs) UpdateLayout(layout *manager.Layout, deployTag string) error {
+func (e Ecs) UpdateLayout(layout *manager.Layout, deployTag string, envVars map[string]string) error {
 	for clusterName, cluster := range layout.Clusters {
-		clusterRepo := e.getEcrRepo(*layout.Repo) // The main layout repo should never be null
+		clusterRepo := *layout.Repo // The main layout repo should never be null
 		if cluster.Repo != nil {
-			clusterRepo = e.getEcrRepo(*cluster.Repo)
+			clusterRepo = *cluster.Repo
 		}
-		if err := e.updateEnvCluster(cluster, clusterName, clusterRepo, deployTag); err != nil {
+		if err := e.updateEnvCluster(cluster, clusterName, clusterRepo, deployTag, layout.Digests, envVars); err != nil {
 			return err
 		}
 	}
@@ -186,6 +666,307 @@ func (e Ecs) CheckLayout(layout *manager.Layout) (bool, error) {
 	return true, nil
 }
 
+// GetRolloutProgress counts the running tasks from the ECS deployments using the new task definitions in the layout.
+// Only services are considered since standalone tasks are replaced all at once.
+func (e Ecs) GetRolloutProgress(layout *manager.Layout) (manager.RolloutProgress, error) {
+	progress := manager.RolloutProgress{}
+	for clusterName, cluster := range layout.Clusters {
+		if cluster.ServiceTasks != nil {
+			for service, task := range cluster.ServiceTasks.Tasks {
+				if descSvcOutput, err := e.describeEcsService(clusterName, service); err != nil {
+					log.Printf("getRolloutProgress: describe service error: %s, %s, %v", clusterName, service, err)
+					return manager.RolloutProgress{}, err
+				} else {
+					ecsService := descSvcOutput.Services[0]
+					progress.DesiredCount += ecsService.DesiredCount
+					for _, deployment := range ecsService.Deployments {
+						if aws.ToString(deployment.TaskDefinition) == task.Id {
+							progress.UpdatedCount += deployment.RunningCount
+						}
+					}
+				}
+			}
+		}
+	}
+	return progress, nil
+}
+
+// GetClusterList returns the names of all the clusters in the account/region
+func (e Ecs) GetClusterList() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	clusters := make([]string, 0)
+	paginator := ecs.NewListClustersPaginator(e.ecsClient, &ecs.ListClustersInput{})
+	for paginator.HasMorePages() {
+		if output, err := paginator.NextPage(ctx); err != nil {
+			log.Printf("getClusterList: list clusters error: %v", err)
+			return nil, err
+		} else {
+			for _, clusterArn := range output.ClusterArns {
+				clusters = append(clusters, e.clusterNameFromArn(clusterArn))
+			}
+		}
+	}
+	return clusters, nil
+}
+
+// ListServices returns the names of the active services in a cluster, in order, limited to those matching the
+// configured service prefix, if any
+func (e Ecs) ListServices(cluster string) ([]string, error) {
+	candidates := make([]string, 0)
+	paginator := ecs.NewListServicesPaginator(e.ecsClient, &ecs.ListServicesInput{Cluster: aws.String(cluster)})
+	for paginator.HasMorePages() {
+		if err := func() error {
+			// Give each page its own timeout so that clusters with many services can still be listed
+			ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+			defer cancel()
+
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+			for _, serviceArn := range output.ServiceArns {
+				if service := e.serviceNameFromArn(serviceArn); strings.HasPrefix(service, e.servicePrefix) {
+					candidates = append(candidates, service)
+				}
+			}
+			return nil
+		}(); err != nil {
+			log.Printf("listServices: list services error: %s, %v", cluster, err)
+			return nil, err
+		}
+	}
+	// Services that are being deleted are still listed while they drain, so only return the ones that are active.
+	services := make([]string, 0, len(candidates))
+	for start := 0; start < len(candidates); start += ecsDescribeServicesBatchSize {
+		end := start + ecsDescribeServicesBatchSize
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+		if activeServices, err := e.activeServices(cluster, candidates[start:end]); err != nil {
+			log.Printf("listServices: describe services error: %s, %v", cluster, err)
+			return nil, err
+		} else {
+			services = append(services, activeServices...)
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+func (e Ecs) activeServices(cluster string, services []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	output, err := e.ecsClient.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: services,
+	})
+	if err != nil {
+		return nil, err
+	}
+	activeServices := make([]string, 0, len(output.Services))
+	for _, ecsService := range output.Services {
+		if aws.ToString(ecsService.Status) == ecsServiceStatus_Active {
+			activeServices = append(activeServices, aws.ToString(ecsService.ServiceName))
+		}
+	}
+	return activeServices, nil
+}
+
+func (e Ecs) DescribeCluster(cluster string) (manager.ClusterInfo, error) {
+	if output, err := e.describeEcsClusters([]string{cluster}); err != nil {
+		return manager.ClusterInfo{}, err
+	} else if len(output.Failures) > 0 {
+		ecsFailures := e.parseEcsFailures(output.Failures)
+		log.Printf("describeCluster: %s, %v", cluster, ecsFailures)
+		return manager.ClusterInfo{}, fmt.Errorf("%v", ecsFailures)
+	} else if len(output.Clusters) == 0 {
+		return manager.ClusterInfo{}, fmt.Errorf("describeCluster: cluster not found: %s", cluster)
+	} else {
+		ecsCluster := output.Clusters[0]
+		return manager.ClusterInfo{
+			Status:              aws.ToString(ecsCluster.Status),
+			ActiveServicesCount: ecsCluster.ActiveServicesCount,
+			RunningTasksCount:   ecsCluster.RunningTasksCount,
+		}, nil
+	}
+}
+
+// UpdateServiceSecret points a secret in a service container at a new value, then restarts the service with the new
+// task definition. ECS replaces the tasks in a rolling fashion so that the service does not go down.
+func (e Ecs) UpdateServiceSecret(cluster, service, container, secretName, valueFrom string) (string, error) {
+	descSvcOutput, err := e.describeEcsService(cluster, service)
+	if err != nil {
+		log.Printf("updateServiceSecret: describe service error: %s, %s, %s, %v", cluster, service, secretName, err)
+		return "", err
+	}
+	secretFound := false
+	newTaskDefArn, err := e.registerEcsTaskDefinition(*descSvcOutput.Services[0].TaskDefinition, container, func(containerDef *types.ContainerDefinition) {
+		for idx, secret := range containerDef.Secrets {
+			if aws.ToString(secret.Name) == secretName {
+				containerDef.Secrets[idx].ValueFrom = aws.String(valueFrom)
+				secretFound = true
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("updateServiceSecret: update task def error: %s, %s, %s, %v", cluster, service, secretName, err)
+		return "", err
+	} else if !secretFound {
+		return "", fmt.Errorf("updateServiceSecret: secret not found: %s, %s, %s, %s", cluster, service, container, secretName)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	updateSvcInput := &ecs.UpdateServiceInput{
+		Service:              aws.String(service),
+		Cluster:              aws.String(cluster),
+		EnableExecuteCommand: aws.Bool(true),
+		ForceNewDeployment:   true,
+		TaskDefinition:       aws.String(newTaskDefArn),
+	}
+	if _, err = e.ecsClient.UpdateService(ctx, updateSvcInput); err != nil {
+		log.Printf("updateServiceSecret: update service error: %s, %s, %s, %v", cluster, service, newTaskDefArn, err)
+		return "", err
+	}
+	return newTaskDefArn, nil
+}
+
+// CheckServiceStable returns true once tasks using the specified task definition have been running for a few minutes
+func (e Ecs) CheckServiceStable(cluster, taskDefArn string) (bool, error) {
+	return e.checkEcsService(cluster, taskDefArn)
+}
+
+// GetTaskLogs returns the log messages written by a container of a task, in order. The container must use the "awslogs"
+// log driver with a stream prefix, which is how the log stream for the task can be found.
+func (e Ecs) GetTaskLogs(cluster, taskId, container string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	describeTasksOutput, err := e.ecsClient.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   []string{taskId},
+	})
+	if err != nil {
+		log.Printf("getTaskLogs: describe tasks error: %s, %s, %v", cluster, taskId, err)
+		return nil, err
+	} else if len(describeTasksOutput.Tasks) == 0 {
+		return nil, fmt.Errorf("getTaskLogs: task not found: %s, %s", cluster, taskId)
+	}
+	task := describeTasksOutput.Tasks[0]
+	taskDef, err := e.getEcsTaskDefinition(*task.TaskDefinitionArn)
+	if err != nil {
+		return nil, err
+	}
+	var logGroup, logStream string
+	for _, containerDef := range taskDef.ContainerDefinitions {
+		if (*containerDef.Name == container) && (containerDef.LogConfiguration != nil) {
+			logGroup = containerDef.LogConfiguration.Options[awsLogsOption_Group]
+			// Log streams are named "prefix/container/task-id"
+			if prefix, found := containerDef.LogConfiguration.Options[awsLogsOption_StreamPrefix]; found {
+				taskArnParts := strings.Split(*task.TaskArn, "/")
+				logStream = prefix + "/" + container + "/" + taskArnParts[len(taskArnParts)-1]
+			}
+		}
+	}
+	if (len(logGroup) == 0) || (len(logStream) == 0) {
+		return nil, fmt.Errorf("getTaskLogs: no log stream configured: %s, %s", *task.TaskDefinitionArn, container)
+	}
+	messages := make([]string, 0)
+	input := &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(logGroup),
+		LogStreamName: aws.String(logStream),
+		StartFromHead: aws.Bool(true),
+	}
+	for {
+		output, err := e.logsClient.GetLogEvents(ctx, input)
+		if err != nil {
+			log.Printf("getTaskLogs: get log events error: %s, %s, %v", logGroup, logStream, err)
+			return nil, err
+		}
+		for _, event := range output.Events {
+			messages = append(messages, aws.ToString(event.Message))
+		}
+		// The same token is returned once the end of the stream has been reached
+		if (len(output.Events) == 0) || (aws.ToString(output.NextForwardToken) == aws.ToString(input.NextToken)) {
+			return messages, nil
+		}
+		input.NextToken = output.NextForwardToken
+	}
+}
+
+// GetContainerImage returns the image of a container in the most recently started running task of a service
+func (e Ecs) GetContainerImage(cluster, service, container string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	listTasksOutput, err := e.ecsClient.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(cluster),
+		DesiredStatus: types.DesiredStatusRunning,
+		ServiceName:   aws.String(service),
+	})
+	if err != nil {
+		log.Printf("getContainerImage: list tasks error: %s, %s, %v", cluster, service, err)
+		return "", err
+	} else if len(listTasksOutput.TaskArns) == 0 {
+		return "", fmt.Errorf("getContainerImage: no running tasks: %s, %s", cluster, service)
+	}
+	describeTasksOutput, err := e.ecsClient.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   listTasksOutput.TaskArns,
+	})
+	if err != nil {
+		log.Printf("getContainerImage: describe tasks error: %s, %s, %v", cluster, service, err)
+		return "", err
+	}
+	// Tasks might be running different task definitions while a deployment is in progress, so use the latest one.
+	var latestTask *types.Task
+	for i, task := range describeTasksOutput.Tasks {
+		if (task.StartedAt != nil) && ((latestTask == nil) || task.StartedAt.After(*latestTask.StartedAt)) {
+			latestTask = &describeTasksOutput.Tasks[i]
+		}
+	}
+	if latestTask == nil {
+		return "", fmt.Errorf("getContainerImage: no started tasks: %s, %s", cluster, service)
+	}
+	taskDef, err := e.getEcsTaskDefinition(*latestTask.TaskDefinitionArn)
+	if err != nil {
+		return "", err
+	}
+	for _, containerDef := range taskDef.ContainerDefinitions {
+		if *containerDef.Name == container {
+			return aws.ToString(containerDef.Image), nil
+		}
+	}
+	return "", fmt.Errorf("getContainerImage: container not found: %s, %s", *latestTask.TaskDefinitionArn, container)
+}
+
+// GetServiceEvents returns the most recent events for a service, newest first, e.g. tasks failing to start or the
+// service failing to place tasks
+func (e Ecs) GetServiceEvents(cluster, service string, limit int) ([]manager.ServiceEvent, error) {
+	output, err := e.describeEcsService(cluster, service)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]manager.ServiceEvent, 0, limit)
+	for _, ecsService := range output.Services {
+		// ECS returns events newest first
+		for _, event := range ecsService.Events {
+			if len(events) == limit {
+				break
+			}
+			events = append(events, manager.ServiceEvent{
+				Id:        aws.ToString(event.Id),
+				CreatedAt: aws.ToTime(event.CreatedAt),
+				Message:   aws.ToString(event.Message),
+			})
+		}
+	}
+	return events, nil
+}
+
 func (e Ecs) describeEcsClusters(clusters []string) (*ecs.DescribeClustersOutput, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
 	defer cancel()
@@ -269,19 +1050,58 @@ func (e Ecs) runEcsTask(cluster, family, container string, networkConfig *types.
 	}
 }
 
-func (e Ecs) updateEcsTaskDefinition(taskDefArn, image, containerName string) (string, error) {
+func (e Ecs) updateEcsTaskDefinition(taskDefArn, image, containerName string, envVars map[string]string) (string, error) {
+	// Register a new task definition with an updated image and environment
+	return e.registerEcsTaskDefinition(taskDefArn, containerName, func(containerDef *types.ContainerDefinition) {
+		containerDef.Image = aws.String(image)
+		setContainerEnv(containerDef, envVars)
+	})
+}
+
+// setContainerEnv sets environment variables on a container, replacing any existing variables with the same names.
+// Secret values are referenced from SSM and only resolved by ECS when the container starts so that they never appear
+// in the task definition.
+func setContainerEnv(containerDef *types.ContainerDefinition, envVars map[string]string) {
+	if len(envVars) == 0 {
+		return
+	}
+	environment := make([]types.KeyValuePair, 0, len(containerDef.Environment))
+	for _, kv := range containerDef.Environment {
+		if _, found := envVars[aws.ToString(kv.Name)]; !found {
+			environment = append(environment, kv)
+		}
+	}
+	secrets := make([]types.Secret, 0, len(containerDef.Secrets))
+	for _, secret := range containerDef.Secrets {
+		if _, found := envVars[aws.ToString(secret.Name)]; !found {
+			secrets = append(secrets, secret)
+		}
+	}
+	for name, value := range envVars {
+		if param, isSecret := manager.SecretEnvVarParam(value); isSecret {
+			secrets = append(secrets, types.Secret{Name: aws.String(name), ValueFrom: aws.String(param)})
+		} else {
+			environment = append(environment, types.KeyValuePair{Name: aws.String(name), Value: aws.String(value)})
+		}
+	}
+	containerDef.Environment = environment
+	containerDef.Secrets = secrets
+}
+
+// registerEcsTaskDefinition registers a new revision of a task definition after applying the specified update to one of
+// its containers.
+func (e Ecs) registerEcsTaskDefinition(taskDefArn, containerName string, update func(*types.ContainerDefinition)) (string, error) {
 	taskDef, err := e.getEcsTaskDefinition(taskDefArn)
 	if err != nil {
-		log.Printf("updateEcsTaskDefinition: get task def error: %s, %s, %v", taskDefArn, image, err)
+		log.Printf("registerEcsTaskDefinition: get task def error: %s, %s, %v", taskDefArn, containerName, err)
 		return "", err
 	}
-	// Register a new task definition with an updated image
 	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
 	defer cancel()
 
 	for idx, containerDef := range taskDef.ContainerDefinitions {
 		if *containerDef.Name == containerName {
-			taskDef.ContainerDefinitions[idx].Image = aws.String(image)
+			update(&taskDef.ContainerDefinitions[idx])
 			regTaskDefInput := &ecs.RegisterTaskDefinitionInput{
 				ContainerDefinitions:    taskDef.ContainerDefinitions,
 				Family:                  taskDef.Family,
@@ -302,14 +1122,14 @@ func (e Ecs) updateEcsTaskDefinition(taskDefArn, image, containerName string) (s
 				Tags:                    []types.Tag{{Key: aws.String(resourceTag), Value: aws.String(string(e.env))}},
 			}
 			if regTaskDefOutput, err := e.ecsClient.RegisterTaskDefinition(ctx, regTaskDefInput); err != nil {
-				log.Printf("updateEcsTaskDefinition: register task def error: %s, %s, %s, %v", taskDefArn, image, containerName, err)
+				log.Printf("registerEcsTaskDefinition: register task def error: %s, %s, %v", taskDefArn, containerName, err)
 				return "", err
 			} else {
 				return *regTaskDefOutput.TaskDefinition.TaskDefinitionArn, nil
 			}
 		}
 	}
-	return "", fmt.Errorf("updateEcsTaskDefinition: container not found: %s, %s, %s", taskDefArn, image, containerName)
+	return "", fmt.Errorf("registerEcsTaskDefinition: container not found: %s, %s", taskDefArn, containerName)
 }
 
 func (e Ecs) getEcsTaskDefinition(taskDefArn string) (*types.TaskDefinition, error) {
@@ -327,7 +1147,7 @@ func (e Ecs) getEcsTaskDefinition(taskDefArn string) (*types.TaskDefinition, err
 	}
 }
 
-func (e Ecs) updateEcsService(cluster, service, image, containerName string, tempTask bool) (string, error) {
+func (e Ecs) updateEcsService(cluster, service, image, containerName string, tempTask bool, envVars map[string]string) (string, error) {
 	// Describe service to get task definition ARN
 	descSvcOutput, err := e.describeEcsService(cluster, service)
 	if err != nil {
@@ -335,10 +1155,12 @@ func (e Ecs) updateEcsService(cluster, service, image, containerName string, tem
 		return "", err
 	}
 	// Update task definition with new image
-	newTaskDefArn, err := e.updateEcsTaskDefinition(*descSvcOutput.Services[0].TaskDefinition, image, containerName)
+	newTaskDefArn, err := e.updateEcsTaskDefinition(*descSvcOutput.Services[0].TaskDefinition, image, containerName, envVars)
 	if err != nil {
 		log.Printf("updateEcsService: update task def error: %s, %s, %s, %v, %v", cluster, service, image, tempTask, err)
 		return "", err
+	} else if err = e.checkTaskDefinition(newTaskDefArn, containerName); err != nil {
+		return "", err
 	}
 	// Update the service to use the new task definition
 	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
@@ -367,13 +1189,15 @@ func (e Ecs) updateEcsService(cluster, service, image, containerName string, tem
 	return newTaskDefArn, nil
 }
 
-func (e Ecs) updateEcsTask(cluster, familyPfx, image, containerName string, tempTask bool) (string, error) {
+func (e Ecs) updateEcsTask(cluster, familyPfx, image, containerName string, tempTask bool, envVars map[string]string) (string, error) {
 	if prevTaskDefArn, err := e.getEcsTaskDefinitionArn(familyPfx); err != nil {
 		log.Printf("updateEcsTask: get task def error: %s, %s, %s, %v, %v", cluster, familyPfx, image, tempTask, err)
 		return "", err
-	} else if newTaskDefArn, err := e.updateEcsTaskDefinition(prevTaskDefArn, image, containerName); err != nil {
+	} else if newTaskDefArn, err := e.updateEcsTaskDefinition(prevTaskDefArn, image, containerName, envVars); err != nil {
 		log.Printf("updateEcsTask: update task def error: %s, %s, %s, %s, %v, %v", cluster, familyPfx, image, prevTaskDefArn, tempTask, err)
 		return "", err
+	} else if err = e.checkTaskDefinition(newTaskDefArn, containerName); err != nil {
+		return "", err
 	} else {
 		if !tempTask {
 			// Stop all permanently running tasks in the service. Since there is no deployment configuration for tasks,
@@ -387,6 +1211,15 @@ func (e Ecs) updateEcsTask(cluster, familyPfx, image, containerName string, temp
 	}
 }
 
+// checkTaskDefinition makes sure that a new task definition revision references an image that exists, if configured to
+// do so, so that a deployment fails before any running tasks are replaced instead of when new tasks can't pull the image.
+func (e Ecs) checkTaskDefinition(taskDefArn, containerName string) error {
+	if e.checkTaskDefs {
+		return e.AssertTaskDefinitionHealthy(e.taskFamilyFromArn(taskDefArn), containerName, "")
+	}
+	return nil
+}
+
 func (e Ecs) getEcsTaskDefinitionArn(familyPfx string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
 	defer cancel()
@@ -405,6 +1238,19 @@ func (e Ecs) getEcsTaskDefinitionArn(familyPfx string) (string, error) {
 	return output.TaskDefinitionArns[0], nil
 }
 
+func (e Ecs) stopEcsTask(cluster, taskArn, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	if _, err := e.ecsClient.StopTask(ctx, &ecs.StopTaskInput{
+		Cluster: aws.String(cluster),
+		Task:    aws.String(taskArn),
+		Reason:  aws.String(reason),
+	}); err != nil {
+		log.Printf("stopEcsTask: %s, %s, %v", cluster, taskArn, err)
+	}
+}
+
 func (e Ecs) stopEcsTasks(cluster, family string) error {
 	if taskArns, err := e.listEcsTasks(cluster, family); err != nil {
 		log.Printf("stopEcsTasks: list tasks error: %s, %s, %v", cluster, family, err)
@@ -462,29 +1308,29 @@ func (e Ecs) listEcsTasks(cluster, family string) ([]string, error) {
 	return listTasksOutput.TaskArns, nil
 }
 
-func (e Ecs) updateEnvCluster(cluster *manager.Cluster, clusterName, clusterRepo, deployTag string) error {
-	if err := e.updateEnvTaskSet(cluster.ServiceTasks, deployType_Service, clusterName, clusterRepo, deployTag); err != nil {
+func (e Ecs) updateEnvCluster(cluster *manager.Cluster, clusterName string, clusterRepo manager.Repo, deployTag string, digests, envVars map[string]string) error {
+	if err := e.updateEnvTaskSet(cluster.ServiceTasks, deployType_Service, clusterName, clusterRepo, deployTag, digests, envVars); err != nil {
 		return err
-	} else if err = e.updateEnvTaskSet(cluster.Tasks, deployType_Task, clusterName, clusterRepo, deployTag); err != nil {
+	} else if err = e.updateEnvTaskSet(cluster.Tasks, deployType_Task, clusterName, clusterRepo, deployTag, digests, envVars); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (e Ecs) updateEnvTaskSet(taskSet *manager.TaskSet, deployType string, cluster, clusterRepo, deployTag string) error {
+func (e Ecs) updateEnvTaskSet(taskSet *manager.TaskSet, deployType string, cluster string, clusterRepo manager.Repo, deployTag string, digests, envVars map[string]string) error {
 	if taskSet != nil {
 		for taskSetName, task := range taskSet.Tasks {
 			taskSetRepo := clusterRepo
 			if taskSet.Repo != nil {
-				taskSetRepo = e.getEcrRepo(*taskSet.Repo)
+				taskSetRepo = *taskSet.Repo
 			}
 			switch deployType {
 			case deployType_Service:
-				if err := e.updateEnvServiceTask(task, cluster, taskSetName, taskSetRepo, deployTag); err != nil {
+				if err := e.updateEnvServiceTask(task, cluster, taskSetName, taskSetRepo, deployTag, digests, envVars); err != nil {
 					return err
 				}
 			case deployType_Task:
-				if err := e.updateEnvTask(task, cluster, taskSetName, taskSetRepo, deployTag); err != nil {
+				if err := e.updateEnvTask(task, cluster, taskSetName, taskSetRepo, deployTag, digests, envVars); err != nil {
 					return err
 				}
 			default:
@@ -495,12 +1341,12 @@ func (e Ecs) updateEnvTaskSet(taskSet *manager.TaskSet, deployType string, clust
 	return nil
 }
 
-func (e Ecs) updateEnvServiceTask(task *manager.Task, cluster, service, taskSetRepo, deployTag string) error {
+func (e Ecs) updateEnvServiceTask(task *manager.Task, cluster, service string, taskSetRepo manager.Repo, deployTag string, digests, envVars map[string]string) error {
 	taskRepo := taskSetRepo
 	if task.Repo != nil {
-		taskRepo = e.getEcrRepo(*task.Repo)
+		taskRepo = *task.Repo
 	}
-	if id, err := e.updateEcsService(cluster, service, taskRepo+":"+deployTag, task.Name, task.Temp); err != nil {
+	if id, err := e.updateEcsService(cluster, service, e.imageUri(taskRepo, deployTag, digests), task.Name, task.Temp, envVars); err != nil {
 		return err
 	} else {
 		task.Id = id
@@ -508,12 +1354,12 @@ func (e Ecs) updateEnvServiceTask(task *manager.Task, cluster, service, taskSetR
 	}
 }
 
-func (e Ecs) updateEnvTask(task *manager.Task, cluster, taskName, taskSetRepo, deployTag string) error {
+func (e Ecs) updateEnvTask(task *manager.Task, cluster, taskName string, taskSetRepo manager.Repo, deployTag string, digests, envVars map[string]string) error {
 	taskRepo := taskSetRepo
 	if task.Repo != nil {
-		taskRepo = e.getEcrRepo(*task.Repo)
+		taskRepo = *task.Repo
 	}
-	if id, err := e.updateEcsTask(cluster, taskName, taskRepo+":"+deployTag, task.Name, task.Temp); err != nil {
+	if id, err := e.updateEcsTask(cluster, taskName, e.imageUri(taskRepo, deployTag, digests), task.Name, task.Temp, envVars); err != nil {
 		return err
 	} else {
 		task.Id = id
@@ -562,6 +1408,56 @@ func (e Ecs) checkEnvTaskSet(taskSet *manager.TaskSet, deployType string, cluste
 	return true, nil
 }
 
+func (e Ecs) waitDuration(ctx context.Context) time.Duration {
+	// Wait until the context deadline, if there is one, or for the default wait time otherwise.
+	if deadline, found := ctx.Deadline(); found {
+		return time.Until(deadline)
+	}
+	return manager.DefaultWaitTime
+}
+
+func (e Ecs) waitTimedOut(ctx context.Context) bool {
+	// ECS waiters give up as soon as there isn't enough time left for another attempt, which can be slightly before
+	// the context deadline.
+	if ctx.Err() != nil {
+		return true
+	} else if deadline, found := ctx.Deadline(); found {
+		return time.Until(deadline) < taskWaiterMinDelay
+	}
+	return false
+}
+
+// stoppedReason returns a friendly description of why a task stopped, falling back to the raw reason reported by ECS
+func (e Ecs) stoppedReason(task types.Task) string {
+	reasons := make([]string, 0, 2)
+	if task.StoppedReason != nil {
+		reasons = append(reasons, *task.StoppedReason)
+	}
+	// The container reason is usually more specific (e.g. "OutOfMemoryError: Container killed due to memory usage")
+	if (len(task.Containers) > 0) && (task.Containers[0].Reason != nil) {
+		reasons = append(reasons, *task.Containers[0].Reason)
+	}
+	rawReason := strings.Join(reasons, ", ")
+	// Apply the rules to the more specific container reason first
+	for i := len(reasons) - 1; i >= 0; i-- {
+		for _, rule := range e.stoppedReasonRules {
+			if rule.regex.MatchString(reasons[i]) {
+				return fmt.Sprintf("%s (%s)", rule.Message, rawReason)
+			}
+		}
+	}
+	return rawReason
+}
+
+// imageUri refers to an image by digest if one is known for the repository instead of a tag, e.g. for images that were
+// just built, so that exactly that image is deployed even if the tag is moved later.
+func (e Ecs) imageUri(repo manager.Repo, deployTag string, digests map[string]string) string {
+	if digest, found := digests[repo.Name]; found {
+		return e.getEcrRepo(repo) + "@" + digest
+	}
+	return e.getEcrRepo(repo) + ":" + deployTag
+}
+
 func (e Ecs) taskFamilyFromArn(taskArn string) string {
 	// Given our configuration, the task family is the same as the name of the task definition. For a task definition
 	// ARN like "arn:aws:ecs:us-east-2:967314784947:task-definition/ceramic-qa-ex-ipfs-nd-go-new-peer:18", we can get
@@ -575,6 +1471,13 @@ func (e Ecs) serviceNameFromArn(serviceArn string) string {
 	return strings.Split(serviceArn, "/")[2]
 }
 
+func (e Ecs) clusterNameFromArn(clusterArn string) string {
+	// For a cluster ARN like "arn:aws:ecs:us-east-2:967314784947:cluster/ceramic-dev", we can get the name by splitting
+	// around the "/", then taking the last part.
+	clusterArnParts := strings.Split(clusterArn, "/")
+	return clusterArnParts[len(clusterArnParts)-1]
+}
+
 func (e Ecs) parseEcsFailures(ecsFailures []types.Failure) []ecsFailure {
 	failures := make([]ecsFailure, len(ecsFailures))
 	for idx, f := range ecsFailures {
@@ -597,3 +1500,25 @@ func (e Ecs) getEcrRepo(repo manager.Repo) string {
 	}
 	return e.ecrUri + repo.Name
 }
+
+// parseImageUri splits an image URI from one of our ECR repositories into the repository and the tag or digest of the
+// image. Returns false for images from other registries.
+func (e Ecs) parseImageUri(image string) (manager.Repo, string, string, bool) {
+	var repo manager.Repo
+	if strings.HasPrefix(image, publicEcrUri) {
+		repo = manager.Repo{Name: strings.TrimPrefix(image, publicEcrUri), Public: true}
+	} else if strings.HasPrefix(image, e.ecrUri) {
+		repo = manager.Repo{Name: strings.TrimPrefix(image, e.ecrUri)}
+	} else {
+		return manager.Repo{}, "", "", false
+	}
+	// Images look like "<repo>@sha256:<digest>", "<repo>:<tag>", or "<repo>", which refers to the "latest" tag
+	if imageParts := strings.SplitN(repo.Name, "@", 2); len(imageParts) == 2 {
+		repo.Name = imageParts[0]
+		return repo, "", imageParts[1], true
+	} else if imageParts = strings.SplitN(repo.Name, ":", 2); len(imageParts) == 2 {
+		repo.Name = imageParts[0]
+		return repo, imageParts[1], "", true
+	}
+	return repo, "latest", "", true
+}
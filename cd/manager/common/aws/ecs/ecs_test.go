@@ -0,0 +1,121 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+const (
+	testVpcConfigParam = "/ceramic-dev-tests/network_configuration"
+	testTaskArn        = "arn:aws:ecs:us-east-2:000000000000:task/ceramic-dev-tests/task"
+)
+
+// testAwsApi serves the SSM and ECS calls made to launch a task, and records the network configuration the task was
+// launched with
+type testAwsApi struct {
+	mu            sync.Mutex
+	ssmLookups    int
+	networkConfig map[string]interface{}
+}
+
+func (a *testAwsApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSSM.GetParameter":
+		a.ssmLookups++
+		vpcConfig, _ := json.Marshal(map[string]interface{}{
+			"Subnets":        []string{"subnet-ssm"},
+			"SecurityGroups": []string{"sg-ssm"},
+			"AssignPublicIp": "DISABLED",
+		})
+		json.NewEncoder(w).Encode(map[string]interface{}{"Parameter": map[string]interface{}{"Value": string(vpcConfig)}})
+	case "AmazonEC2ContainerServiceV20141113.RunTask":
+		var input map[string]interface{}
+		json.Unmarshal(body, &input)
+		a.networkConfig, _ = input["networkConfiguration"].(map[string]interface{})["awsvpcConfiguration"].(map[string]interface{})
+		json.NewEncoder(w).Encode(map[string]interface{}{"tasks": []interface{}{map[string]interface{}{"taskArn": testTaskArn}}})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func testEcs(t *testing.T) (*Ecs, *testAwsApi) {
+	t.Helper()
+	api := new(testAwsApi)
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	cfg := aws.Config{
+		Region: "us-east-2",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}, nil
+		}),
+		EndpointResolverWithOptions: aws.EndpointResolverWithOptionsFunc(func(_, _ string, _ ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: server.URL}, nil
+		}),
+		Retryer: func() aws.Retryer { return aws.NopRetryer{} },
+	}
+	return &Ecs{ecsClient: ecs.NewFromConfig(cfg), ssmClient: ssm.NewFromConfig(cfg), env: manager.EnvType_Dev}, api
+}
+
+func TestLaunchTaskNetworkOverride(t *testing.T) {
+	e, api := testEcs(t)
+	taskArn, err := e.LaunchTask("ceramic-dev-tests", "ceramic-dev-tests-smoke", "smoke", testVpcConfigParam, &manager.NetworkConfig{
+		Subnets:        []string{"subnet-preview"},
+		SecurityGroups: []string{"sg-preview"},
+		AssignPublicIp: true,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if taskArn != testTaskArn {
+		t.Fatalf("unexpected task: %s", taskArn)
+	}
+	if api.ssmLookups != 0 {
+		t.Fatal("network configuration read from SSM despite the override")
+	}
+	if subnets := api.networkConfig["subnets"].([]interface{}); (len(subnets) != 1) || (subnets[0] != "subnet-preview") {
+		t.Fatalf("task not launched into the override subnets: %v", subnets)
+	} else if securityGroups := api.networkConfig["securityGroups"].([]interface{}); (len(securityGroups) != 1) || (securityGroups[0] != "sg-preview") {
+		t.Fatalf("task not launched with the override security groups: %v", securityGroups)
+	} else if api.networkConfig["assignPublicIp"] != "ENABLED" {
+		t.Fatalf("unexpected public IP assignment: %v", api.networkConfig["assignPublicIp"])
+	}
+}
+
+func TestLaunchTaskSsmNetworkConfig(t *testing.T) {
+	e, api := testEcs(t)
+	if _, err := e.LaunchTask("ceramic-dev-tests", "ceramic-dev-tests-smoke", "smoke", testVpcConfigParam, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if api.ssmLookups != 1 {
+		t.Fatalf("expected the network configuration to be read from SSM, got %d lookups", api.ssmLookups)
+	} else if subnets := api.networkConfig["subnets"].([]interface{}); (len(subnets) != 1) || (subnets[0] != "subnet-ssm") {
+		t.Fatalf("task not launched into the SSM subnets: %v", subnets)
+	}
+}
+
+func TestLaunchTaskInvalidNetworkOverride(t *testing.T) {
+	e, api := testEcs(t)
+	if _, err := e.LaunchTask("ceramic-dev-tests", "ceramic-dev-tests-smoke", "smoke", testVpcConfigParam, &manager.NetworkConfig{
+		Subnets:        []string{"preview"},
+		SecurityGroups: []string{"sg-preview"},
+	}, nil); err == nil {
+		t.Fatal("expected an invalid network configuration to be rejected")
+	}
+	if api.networkConfig != nil {
+		t.Fatal("task launched with an invalid network configuration")
+	}
+}
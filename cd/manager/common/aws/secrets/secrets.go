@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+const (
+	versionStage_Current  = "AWSCURRENT"
+	versionStage_Pending  = "AWSPENDING"
+	versionStage_Previous = "AWSPREVIOUS"
+)
+
+const secretLength = 32
+
+var _ manager.Secrets = &Secrets{}
+
+type Secrets struct {
+	client *secretsmanager.Client
+}
+
+func NewSecrets(cfg aws.Config) manager.Secrets {
+	return &Secrets{secretsmanager.NewFromConfig(cfg)}
+}
+
+// CreateSecretVersion generates a new random value for a secret and stores it as a pending version. The current version
+// remains in use until the new version is promoted.
+func (s Secrets) CreateSecretVersion(secretId string) (manager.SecretVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	descOutput, err := s.client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretId)})
+	if err != nil {
+		log.Printf("createSecretVersion: describe secret error: %s, %v", secretId, err)
+		return manager.SecretVersion{}, err
+	}
+	prevVersionId := ""
+	for versionId, stages := range descOutput.VersionIdsToStages {
+		for _, stage := range stages {
+			if stage == versionStage_Current {
+				prevVersionId = versionId
+			}
+		}
+	}
+	if len(prevVersionId) == 0 {
+		return manager.SecretVersion{}, fmt.Errorf("createSecretVersion: no current version: %s", secretId)
+	}
+	passwordOutput, err := s.client.GetRandomPassword(ctx, &secretsmanager.GetRandomPasswordInput{
+		PasswordLength:     aws.Int64(secretLength),
+		ExcludePunctuation: aws.Bool(true),
+	})
+	if err != nil {
+		log.Printf("createSecretVersion: get random password error: %s, %v", secretId, err)
+		return manager.SecretVersion{}, err
+	}
+	putOutput, err := s.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:      aws.String(secretId),
+		SecretString:  passwordOutput.RandomPassword,
+		VersionStages: []string{versionStage_Pending},
+	})
+	if err != nil {
+		log.Printf("createSecretVersion: put secret value error: %s, %v", secretId, err)
+		return manager.SecretVersion{}, err
+	}
+	return manager.SecretVersion{
+		Arn:           aws.ToString(putOutput.ARN),
+		VersionId:     aws.ToString(putOutput.VersionId),
+		PrevVersionId: prevVersionId,
+	}, nil
+}
+
+// PromoteSecretVersion makes a pending version the current version of a secret. The version that was current is then
+// labeled as the previous version.
+func (s Secrets) PromoteSecretVersion(secretId string, version manager.SecretVersion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	if _, err := s.client.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(secretId),
+		VersionStage:        aws.String(versionStage_Current),
+		MoveToVersionId:     aws.String(version.VersionId),
+		RemoveFromVersionId: aws.String(version.PrevVersionId),
+	}); err != nil {
+		log.Printf("promoteSecretVersion: update current stage error: %s, %+v, %v", secretId, version, err)
+		return err
+	}
+	if _, err := s.client.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(secretId),
+		VersionStage:        aws.String(versionStage_Pending),
+		RemoveFromVersionId: aws.String(version.VersionId),
+	}); err != nil {
+		log.Printf("promoteSecretVersion: update pending stage error: %s, %+v, %v", secretId, version, err)
+		return err
+	}
+	return nil
+}
+
+// DeactivateSecretVersion removes the "previous" label from a version of a secret so that it can no longer be retrieved
+// by label, and will eventually be deleted.
+func (s Secrets) DeactivateSecretVersion(secretId, versionId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	if _, err := s.client.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(secretId),
+		VersionStage:        aws.String(versionStage_Previous),
+		RemoveFromVersionId: aws.String(versionId),
+	}); err != nil {
+		log.Printf("deactivateSecretVersion: %s, %s, %v", secretId, versionId, err)
+		return err
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/3box/pipeline-tools/cd/manager"
@@ -11,25 +12,103 @@ var _ manager.Cache = &JobCache{}
 
 type JobCache struct {
 	jobs *sync.Map
+	// Index of job IDs by stage so that jobs in a particular stage can be found without scanning the whole cache. The
+	// mutex serializes writes so that the index stays consistent with the jobs.
+	stages map[job.JobStage]map[string]struct{}
+	// Fields set through UpdateJobField, by job ID, so that they survive a newer state for the job that doesn't carry
+	// them.
+	fields map[string]map[string]interface{}
+	mu     *sync.RWMutex
 }
 
 func NewJobCache() manager.Cache {
-	return &JobCache{new(sync.Map)}
+	return &JobCache{
+		new(sync.Map),
+		make(map[job.JobStage]map[string]struct{}),
+		make(map[string]map[string]interface{}),
+		new(sync.RWMutex),
+	}
 }
 
 func (c JobCache) WriteJob(jobState job.JobState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	// Don't overwrite a newer state with an earlier one.
-	if cachedJobState, found := c.JobById(jobState.JobId); found && cachedJobState.Ts.After(jobState.Ts) {
-		return
+	cachedJobState, found := c.JobById(jobState.JobId)
+	if found {
+		if cachedJobState.Ts.After(jobState.Ts) {
+			return
+		}
+		delete(c.stages[cachedJobState.Stage], jobState.JobId)
 	}
+	jobState = c.applyFields(jobState)
 	// Store a copy of the state, not a pointer to it.
 	c.jobs.Store(jobState.JobId, jobState)
+	if _, found = c.stages[jobState.Stage]; !found {
+		c.stages[jobState.Stage] = make(map[string]struct{})
+	}
+	c.stages[jobState.Stage][jobState.JobId] = struct{}{}
+}
+
+// UpdateJobField sets a single parameter of a cached job. The job's parameters are copied before being updated so that
+// copies of the job state already handed out, which share the original parameters, aren't modified underneath callers.
+func (c JobCache) UpdateJobField(jobId, field string, value interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cachedJobState, found := c.JobById(jobId)
+	if !found {
+		return fmt.Errorf("updateJobField: %w: %s", manager.Error_JobNotFound, jobId)
+	}
+	params := make(map[string]interface{}, len(cachedJobState.Params)+1)
+	for k, v := range cachedJobState.Params {
+		params[k] = v
+	}
+	params[field] = value
+	cachedJobState.Params = params
+	if _, found = c.fields[jobId]; !found {
+		c.fields[jobId] = make(map[string]interface{})
+	}
+	c.fields[jobId][field] = value
+	// The stage and timestamp are unchanged, so the stage index doesn't need to be updated.
+	c.jobs.Store(jobId, cachedJobState)
+	return nil
 }
 
 func (c JobCache) DeleteJob(jobId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cachedJobState, found := c.JobById(jobId); found {
+		delete(c.stages[cachedJobState.Stage], jobId)
+	}
+	delete(c.fields, jobId)
 	c.jobs.Delete(jobId)
 }
 
+// applyFields carries fields previously set through UpdateJobField over to a newer state for the job. A field that the
+// newer state sets itself takes precedence and is no longer carried over.
+func (c JobCache) applyFields(jobState job.JobState) job.JobState {
+	fields := c.fields[jobState.JobId]
+	if len(fields) == 0 {
+		return jobState
+	}
+	params := make(map[string]interface{}, len(jobState.Params)+len(fields))
+	for k, v := range jobState.Params {
+		params[k] = v
+	}
+	for field, value := range fields {
+		if _, found := jobState.Params[field]; found {
+			delete(fields, field)
+		} else {
+			params[field] = value
+		}
+	}
+	if len(fields) == 0 {
+		delete(c.fields, jobState.JobId)
+	}
+	jobState.Params = params
+	return jobState
+}
+
 func (c JobCache) JobById(jobId string) (job.JobState, bool) {
 	if j, found := c.jobs.Load(jobId); found {
 		return j.(job.JobState), true
@@ -48,3 +127,15 @@ func (c JobCache) JobsByMatcher(matcher func(jobStage job.JobState) bool) []job.
 	})
 	return jobs
 }
+
+func (c JobCache) JobsByStage(jobStage job.JobStage) []job.JobState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	jobs := make([]job.JobState, 0, len(c.stages[jobStage]))
+	for jobId := range c.stages[jobStage] {
+		if jobState, found := c.JobById(jobId); found {
+			jobs = append(jobs, jobState)
+		}
+	}
+	return jobs
+}
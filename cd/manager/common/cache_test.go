@@ -0,0 +1,103 @@
+package common
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var testStages = []job.JobStage{
+	job.JobStage_Queued,
+	job.JobStage_Dequeued,
+	job.JobStage_Started,
+	job.JobStage_Waiting,
+	job.JobStage_Completed,
+	job.JobStage_Failed,
+	job.JobStage_Canceled,
+}
+
+func sortedJobIds(jobs []job.JobState) []string {
+	jobIds := make([]string, len(jobs))
+	for i, jobState := range jobs {
+		jobIds[i] = jobState.JobId
+	}
+	sort.Strings(jobIds)
+	return jobIds
+}
+
+// checkStageIndex makes sure that looking jobs up by stage returns the same jobs as scanning the whole cache
+func checkStageIndex(t *testing.T, cache manager.Cache) {
+	t.Helper()
+	for _, stage := range testStages {
+		indexed := sortedJobIds(cache.JobsByStage(stage))
+		scanned := sortedJobIds(cache.JobsByMatcher(func(js job.JobState) bool {
+			return js.Stage == stage
+		}))
+		if fmt.Sprint(indexed) != fmt.Sprint(scanned) {
+			t.Fatalf("stage index inconsistent for %s: indexed %v, scanned %v", stage, indexed, scanned)
+		}
+	}
+}
+
+func TestJobsByStage(t *testing.T) {
+	cache := NewJobCache()
+	now := time.Now()
+	cache.WriteJob(job.JobState{JobId: "a", Stage: job.JobStage_Started, Ts: now})
+	cache.WriteJob(job.JobState{JobId: "b", Stage: job.JobStage_Started, Ts: now})
+	cache.WriteJob(job.JobState{JobId: "c", Stage: job.JobStage_Waiting, Ts: now})
+	// Moving a job to a new stage removes it from its previous stage
+	cache.WriteJob(job.JobState{JobId: "a", Stage: job.JobStage_Waiting, Ts: now.Add(time.Second)})
+	// Earlier states don't overwrite newer ones
+	cache.WriteJob(job.JobState{JobId: "c", Stage: job.JobStage_Started, Ts: now.Add(-time.Second)})
+	if started := sortedJobIds(cache.JobsByStage(job.JobStage_Started)); fmt.Sprint(started) != "[b]" {
+		t.Fatalf("unexpected started jobs: %v", started)
+	} else if waiting := sortedJobIds(cache.JobsByStage(job.JobStage_Waiting)); fmt.Sprint(waiting) != "[a c]" {
+		t.Fatalf("unexpected waiting jobs: %v", waiting)
+	}
+	cache.DeleteJob("c")
+	if err := cache.UpdateJobField("a", "field", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if waiting := cache.JobsByStage(job.JobStage_Waiting); (len(waiting) != 1) || (waiting[0].Params["field"] != "value") {
+		t.Fatalf("unexpected waiting jobs: %v", waiting)
+	} else if completed := cache.JobsByStage(job.JobStage_Completed); len(completed) != 0 {
+		t.Fatalf("unexpected completed jobs: %v", completed)
+	}
+	checkStageIndex(t, cache)
+}
+
+func TestJobsByStageConsistentUnderConcurrentWrites(t *testing.T) {
+	cache := NewJobCache()
+	start := time.Now()
+	wg := new(sync.WaitGroup)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 1000; i++ {
+				jobId := fmt.Sprintf("job-%d", r.Intn(50))
+				switch r.Intn(10) {
+				case 0:
+					cache.DeleteJob(jobId)
+				case 1:
+					cache.UpdateJobField(jobId, "field", i)
+				default:
+					cache.WriteJob(job.JobState{
+						JobId: jobId,
+						Stage: testStages[r.Intn(len(testStages))],
+						Ts:    start.Add(time.Duration(r.Intn(100)) * time.Second),
+					})
+				}
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+	checkStageIndex(t, cache)
+}
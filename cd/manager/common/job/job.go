@@ -12,6 +12,8 @@ import (
 	"github.com/3box/pipeline-tools/cd/manager/common/aws/utils"
 )
 
+const defaultHttpWaitTime = 30 * time.Second
+
 func IsFinishedJob(jobState JobState) bool {
 	return (jobState.Stage == JobStage_Skipped) || (jobState.Stage == JobStage_Canceled) || (jobState.Stage == JobStage_Failed) || (jobState.Stage == JobStage_Completed)
 }
@@ -21,12 +23,17 @@ func IsActiveJob(jobState JobState) bool {
 }
 
 func IsTimedOut(jobState JobState, delay time.Duration) bool {
+	return IsTimedOutAt(jobState, delay, time.Now())
+}
+
+// IsTimedOutAt returns true if the job had timed out by the specified time
+func IsTimedOutAt(jobState JobState, delay time.Duration, now time.Time) bool {
 	// If no timestamp was stored, use the timestamp from the last update.
 	startTime := jobState.Ts
 	if s, found := jobState.Params[JobParam_Start].(float64); found {
 		startTime = time.Unix(0, int64(s))
 	}
-	return time.Now().Add(-delay).After(startTime)
+	return now.Add(-delay).After(startTime)
 }
 
 func CreateJobTable(ctx context.Context, client *dynamodb.Client, table string) error {
@@ -53,6 +60,10 @@ func CreateJobTable(ctx context.Context, client *dynamodb.Client, table string)
 				AttributeName: aws.String("ts"),
 				AttributeType: "N",
 			},
+			{
+				AttributeName: aws.String("parent"),
+				AttributeType: "S",
+			},
 		},
 		KeySchema: []types.KeySchemaElement{
 			{
@@ -94,6 +105,7 @@ func CreateJobTable(ctx context.Context, client *dynamodb.Client, table string)
 					ProjectionType: types.ProjectionTypeAll,
 				},
 			},
+			parentTsIndex(),
 			{
 				IndexName: aws.String(JobTsIndex),
 				KeySchema: []types.KeySchemaElement{
@@ -115,6 +127,66 @@ func CreateJobTable(ctx context.Context, client *dynamodb.Client, table string)
 	return utils.CreateTable(ctx, client, &createTableInput)
 }
 
+// CreateParentTsIndex adds the index used to look up child jobs to a job table created before the index existed
+func CreateParentTsIndex(ctx context.Context, client *dynamodb.Client, table string) error {
+	httpCtx, httpCancel := context.WithTimeout(ctx, defaultHttpWaitTime)
+	defer httpCancel()
+
+	if output, err := client.DescribeTable(httpCtx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}); err != nil {
+		return err
+	} else {
+		for _, index := range output.Table.GlobalSecondaryIndexes {
+			if *index.IndexName == ParentTsIndex {
+				return nil
+			}
+		}
+	}
+	index := parentTsIndex()
+	_, err := client.UpdateTable(httpCtx, &dynamodb.UpdateTableInput{
+		TableName: aws.String(table),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("parent"),
+				AttributeType: "S",
+			},
+			{
+				AttributeName: aws.String("ts"),
+				AttributeType: "N",
+			},
+		},
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  index.IndexName,
+					KeySchema:  index.KeySchema,
+					Projection: index.Projection,
+				},
+			},
+		},
+	})
+	return err
+}
+
+// parentTsIndex is a sparse index since only jobs created by other jobs have a parent
+func parentTsIndex() types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(ParentTsIndex),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("parent"),
+				KeyType:       "HASH",
+			},
+			{
+				AttributeName: aws.String("ts"),
+				KeyType:       "RANGE",
+			},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+	}
+}
+
 func CreateWorkflowJob(jobState JobState) (Workflow, error) {
 	if org, found := jobState.Params[WorkflowJobParam_Org].(string); !found {
 		return Workflow{}, fmt.Errorf("missing org")
@@ -145,3 +217,46 @@ func CreateWorkflowJob(jobState JobState) (Workflow, error) {
 		return Workflow{org, repo, workflow, ref, workflowInputs, workflowRunUrl, workflowRunId, workflowLabels}, nil
 	}
 }
+
+func CreateTaskSpec(jobState JobState) (TaskSpec, error) {
+	if name, found := jobState.Params[TaskJobParam_Name].(string); !found || (len(name) == 0) {
+		return TaskSpec{}, fmt.Errorf("missing name")
+	} else if cluster, found := jobState.Params[TaskJobParam_Cluster].(string); !found || (len(cluster) == 0) {
+		return TaskSpec{}, fmt.Errorf("missing cluster")
+	} else if family, found := jobState.Params[TaskJobParam_Family].(string); !found || (len(family) == 0) {
+		return TaskSpec{}, fmt.Errorf("missing family")
+	} else if container, found := jobState.Params[TaskJobParam_Container].(string); !found || (len(container) == 0) {
+		return TaskSpec{}, fmt.Errorf("missing container")
+	} else if networkConfig, found := jobState.Params[TaskJobParam_NetworkConfig].(string); !found || (len(networkConfig) == 0) {
+		return TaskSpec{}, fmt.Errorf("missing network config")
+	} else if startupTimeout, err := parseTaskTimeout(jobState, TaskJobParam_StartupTimeout); err != nil {
+		return TaskSpec{}, err
+	} else if completionTimeout, err := parseTaskTimeout(jobState, TaskJobParam_CompletionTimeout); err != nil {
+		return TaskSpec{}, err
+	} else {
+		var overrides map[string]string = nil
+		if paramOverrides, found := jobState.Params[TaskJobParam_Overrides].(map[string]interface{}); found {
+			overrides = make(map[string]string, len(paramOverrides))
+			for k, v := range paramOverrides {
+				if value, ok := v.(string); !ok {
+					return TaskSpec{}, fmt.Errorf("invalid override: %s", k)
+				} else {
+					overrides[k] = value
+				}
+			}
+		}
+		return TaskSpec{name, cluster, family, container, networkConfig, overrides, startupTimeout, completionTimeout}, nil
+	}
+}
+
+func parseTaskTimeout(jobState JobState, param string) (time.Duration, error) {
+	if timeout, found := jobState.Params[param].(string); !found {
+		return 0, fmt.Errorf("missing %s", param)
+	} else if parsedTimeout, err := time.ParseDuration(timeout); err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", param, err)
+	} else if parsedTimeout <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", param, timeout)
+	} else {
+		return parsedTimeout, nil
+	}
+}
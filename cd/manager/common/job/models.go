@@ -5,17 +5,29 @@ import "time"
 const StageTsIndex = "stage-ts-index"
 const TypeTsIndex = "type-ts-index"
 const JobTsIndex = "job-ts-index"
+const ParentTsIndex = "parent-ts-index"
 
 type JobType string
 
 // TODO: Clean up smoke/e2e test job types once the new GitHub test workflow is ready
 // Ref: https://linear.app/3boxlabs/issue/WS1-1298/clean-up-existing-smokee2e-test-cd-manager-job-types
 const (
-	JobType_Deploy    JobType = "deploy"
-	JobType_Anchor    JobType = "anchor"
-	JobType_TestE2E   JobType = "test_e2e"
-	JobType_TestSmoke JobType = "test_smoke"
-	JobType_Workflow  JobType = "workflow"
+	JobType_Deploy            JobType = "deploy"
+	JobType_Anchor            JobType = "anchor"
+	JobType_TestE2E           JobType = "test_e2e"
+	JobType_TestSmoke         JobType = "test_smoke"
+	JobType_Workflow          JobType = "workflow"
+	JobType_DataBackup        JobType = "data_backup"
+	JobType_Task              JobType = "task"
+	JobType_Bootstrap         JobType = "bootstrap"
+	JobType_EnvBootstrap      JobType = "env_bootstrap"
+	JobType_SecretsRotation   JobType = "secrets_rotation"
+	JobType_DockerBuild       JobType = "docker_build"
+	JobType_TerraformPlan     JobType = "terraform_plan"
+	JobType_CacheInvalidation JobType = "cache_invalidation"
+	JobType_SloCheck          JobType = "slo_check"
+	JobType_HealthGate        JobType = "health_gate"
+	JobType_Notification      JobType = "notification"
 )
 
 type JobStage string
@@ -29,6 +41,8 @@ const (
 	JobStage_Failed    JobStage = "failed"
 	JobStage_Canceled  JobStage = "canceled"
 	JobStage_Completed JobStage = "completed"
+	// Jobs waiting for one of their approvers to approve them before they can proceed
+	JobStage_PendingApproval JobStage = "pending_approval"
 )
 
 const (
@@ -37,6 +51,35 @@ const (
 	JobParam_WaitTime string = "waitTime"
 	JobParam_Start    string = "start"
 	JobParam_Source   string = "source"
+	// Skip the tests that would normally run after a deployment, e.g. for urgent hotfixes
+	JobParam_SkipTests string = "skipTests"
+	// Explicit network configuration for tasks launched by the job, overriding the configured one
+	JobParam_NetworkOverride string = "networkOverride"
+	// Environment variables to set on tasks launched by the job, in addition to those the job sets itself
+	JobParam_EnvOverrides string = "envOverrides"
+	// Map of Discord webhook ID to the ID of the message sent for this job to that webhook
+	JobParam_DiscordMessageId string = "discordMessageId"
+	// Name of a dedicated Discord channel to also send the job's notifications to, e.g. "cas" for `DISCORD_CAS_WEBHOOK`
+	JobParam_DiscordChannel string = "discordChannel"
+	// Name of the schedule that queued the job, if any
+	JobParam_Schedule string = "schedule"
+	// Digests of the images built for a commit, by repo name, so that deployments use immutable image references
+	// instead of tags
+	JobParam_ImageDigests string = "imageDigests"
+	// Don't send notifications for the job, e.g. for frequent housekeeping jobs. Updates are still recorded.
+	JobParam_Silent string = "silent"
+	// GitHub usernames or Discord user IDs of the people who can approve the job, and who approved it
+	JobParam_Approvers  string = "approvers"
+	JobParam_ApprovedBy string = "approvedBy"
+	// Who acknowledged the alert for a failed job, and when
+	JobParam_AckedBy string = "ackedBy"
+	JobParam_AckTs   string = "ackTs"
+	// Whether the job was triggered by an operator, as opposed to by the pipeline
+	JobParam_Manual string = "manual"
+	// GitHub Actions workflow run that triggered the job, if any
+	JobParam_WorkflowRunUrl string = "workflowRunUrl"
+	// Well-known cause of the job's error, if any, e.g. "completion timeout", so that the cause survives being stored
+	JobParam_ErrorCause string = "errorCause"
 )
 
 const (
@@ -48,6 +91,35 @@ const (
 	DeployJobParam_Manual    string = "manual"
 	DeployJobParam_Force     string = "force"
 	DeployJobParam_Rollback  string = "rollback"
+	DeployJobParam_Version   string = "version"
+	// When the deployment started baking, i.e. being monitored for a while before being marked complete
+	DeployJobParam_BakeStart string = "bakeStart"
+	// Environment variables to set on deployed containers, overriding the configured ones
+	DeployJobParam_EnvVars string = "envVars"
+	// Regions to deploy to, in order, for staggered multi-region deployments
+	DeployJobParam_Regions        string = "regions"
+	DeployJobParam_Region         string = "region"
+	DeployJobParam_RegionStart    string = "regionStart"
+	DeployJobParam_RegionProgress string = "regionProgress"
+	// Progress of the ECS rollout, i.e. how many tasks have been updated, and when that number last changed
+	DeployJobParam_RolloutUpdated string = "rolloutUpdated"
+	DeployJobParam_RolloutDesired string = "rolloutDesired"
+	DeployJobParam_RolloutTs      string = "rolloutTs"
+	// Whether deploys for the component were frozen when the deployment was started, and whether to deploy anyway
+	DeployJobParam_Frozen         string = "frozen"
+	DeployJobParam_FreezeOverride string = "freezeOverride"
+	// Most recent events reported for the deployed services, recorded when the deployment fails
+	DeployJobParam_ServiceEvents string = "serviceEvents"
+	// Parameters of a health gate to queue once the deployment completes
+	DeployJobParam_HealthGate string = "healthGate"
+)
+
+const (
+	DeployRegionStatus_Pending   string = "pending"
+	DeployRegionStatus_Deploying string = "deploying"
+	DeployRegionStatus_Baking    string = "baking"
+	DeployRegionStatus_Deployed  string = "deployed"
+	DeployRegionStatus_Failed    string = "failed"
 )
 
 const (
@@ -77,6 +149,116 @@ const (
 	WorkflowJobParam_Labels       string = "labels"
 )
 
+const (
+	// Number of times to relaunch smoke tests that fail, and the number of relaunches so far
+	SmokeTestJobParam_Retries string = "retries"
+	SmokeTestJobParam_Attempt string = "attempt"
+	// Exit code of the last failed attempt
+	SmokeTestJobParam_ExitCode string = "exitCode"
+	// Cluster the tests run on, if selected dynamically
+	SmokeTestJobParam_Cluster string = "cluster"
+	// Subset of tests to run, either selected directly or by the component to test, instead of the full suite
+	SmokeTestJobParam_Component    string = "component"
+	SmokeTestJobParam_TestSelector string = "test_selector"
+)
+
+const (
+	DataBackupJobParam_ResourceArn string = "resourceArn"
+)
+
+const (
+	TaskJobParam_Name              string = "name"
+	TaskJobParam_Cluster           string = "cluster"
+	TaskJobParam_Family            string = "family"
+	TaskJobParam_Container         string = "container"
+	TaskJobParam_NetworkConfig     string = "networkConfig"
+	TaskJobParam_Overrides         string = "overrides"
+	TaskJobParam_StartupTimeout    string = "startupTimeout"
+	TaskJobParam_CompletionTimeout string = "completionTimeout"
+)
+
+const (
+	BootstrapJobParam_Cluster  string = "cluster"
+	BootstrapJobParam_Services string = "services"
+)
+
+const (
+	// Workflow params (org, repo, workflow, ...) for provisioning infrastructure (e.g. SSM parameters, Route53 records)
+	EnvBootstrapJobParam_Infra      string = "infra"
+	EnvBootstrapJobParam_Cluster    string = "cluster"
+	EnvBootstrapJobParam_Services   string = "services"
+	EnvBootstrapJobParam_Components string = "components"
+	// Ordered child jobs, and the index of the one currently running
+	EnvBootstrapJobParam_Steps string = "steps"
+	EnvBootstrapJobParam_Step  string = "step"
+)
+
+const (
+	SecretsRotationJobParam_SecretId   string = "secretId"
+	SecretsRotationJobParam_Cluster    string = "cluster"
+	SecretsRotationJobParam_Service    string = "service"
+	SecretsRotationJobParam_Container  string = "container"
+	SecretsRotationJobParam_SecretName string = "secretName" // Name of the secret in the container definition
+	SecretsRotationJobParam_Version    string = "version"
+	SecretsRotationJobParam_TaskDefArn string = "taskDefArn"
+)
+
+const (
+	DockerBuildJobParam_Component string = "component"
+	DockerBuildJobParam_Sha       string = "sha"
+	// GitHub Actions workflow that builds and pushes the image, and the branch to run it from
+	DockerBuildJobParam_Workflow string = "workflow"
+	DockerBuildJobParam_Ref      string = "ref"
+	DockerBuildJobParam_Url      string = "url"
+	// ECR repos the workflow pushes images to, if not just the component's repo
+	DockerBuildJobParam_Repos string = "repos"
+	// Deploy the image once it has been built
+	DockerBuildJobParam_Deploy string = "deploy"
+)
+
+const (
+	// Environment variables for the plan task, e.g. the Terraform workspace or directory to plan
+	TerraformPlanJobParam_Overrides string = "overrides"
+	// Summary of the plan, i.e. the number of resources to add, change, and destroy
+	TerraformPlanJobParam_Add     string = "add"
+	TerraformPlanJobParam_Change  string = "change"
+	TerraformPlanJobParam_Destroy string = "destroy"
+)
+
+const (
+	// CloudFront distribution to invalidate, and the path patterns to invalidate, if not the configured ones
+	CacheInvalidationJobParam_DistributionId string = "distributionId"
+	CacheInvalidationJobParam_Paths          string = "paths"
+)
+
+const (
+	// SLO to check, and the highest error budget burn rate at which the check passes
+	SloCheckJobParam_Name        string = "name"
+	SloCheckJobParam_MaxBurnRate string = "maxBurnRate"
+	// Burn rate at the time of the check
+	SloCheckJobParam_BurnRate string = "burnRate"
+	// Parameters of a deployment to queue if the check passes
+	SloCheckJobParam_Deploy string = "deploy"
+)
+
+const (
+	// Endpoints that must all be healthy for the gate to pass, and how long to keep retrying them for, in seconds
+	HealthGateJobParam_Urls    string = "urls"
+	HealthGateJobParam_Timeout string = "timeout"
+	// Endpoints that were unhealthy at the last check
+	HealthGateJobParam_Failing string = "failing"
+)
+
+const (
+	// How far back to report on, in seconds
+	NotificationJobParam_Window string = "window"
+	// Number of jobs that finished in each stage, in total and per component (or job type, for jobs without one)
+	NotificationJobParam_Counts     string = "counts"
+	NotificationJobParam_Components string = "components"
+	// Release versions deployed for each component, in the order they were deployed
+	NotificationJobParam_Releases string = "releases"
+)
+
 const (
 	WorkflowJobLabel_Test   string = "test"
 	WorkflowJobLabel_Deploy string = "deploy"
@@ -84,13 +266,26 @@ const (
 
 // JobState represents the state of a job in the database
 type JobState struct {
-	JobId  string                 `dynamodbav:"job"` // Job ID, same for all stages of an individual Job
-	Stage  JobStage               `dynamodbav:"stage"`
-	Type   JobType                `dynamodbav:"type"`
-	Ts     time.Time              `dynamodbav:"ts"`
-	Params map[string]interface{} `dynamodbav:"params"`
-	Id     string                 `dynamodbav:"id" json:"-"`           // Globally unique ID for each job update
-	Ttl    time.Time              `dynamodbav:"ttl,unixtime" json:"-"` // Record expiration
+	JobId    string                 `dynamodbav:"job"` // Job ID, same for all stages of an individual Job
+	Stage    JobStage               `dynamodbav:"stage"`
+	Type     JobType                `dynamodbav:"type"`
+	Ts       time.Time              `dynamodbav:"ts"`
+	Params   map[string]interface{} `dynamodbav:"params"`
+	ParentId string                 `dynamodbav:"parent,omitempty"`      // ID of the job that created this job, if any
+	Id       string                 `dynamodbav:"id" json:"-"`           // Globally unique ID for each job update
+	Ttl      time.Time              `dynamodbav:"ttl,unixtime" json:"-"` // Record expiration
+}
+
+// TaskSpec describes a one-off task run by a generic task job
+type TaskSpec struct {
+	Name              string
+	Cluster           string
+	Family            string
+	Container         string
+	NetworkConfig     string
+	Overrides         map[string]string
+	StartupTimeout    time.Duration
+	CompletionTimeout time.Duration
 }
 
 type Workflow struct {
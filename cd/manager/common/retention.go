@@ -0,0 +1,42 @@
+package common
+
+import (
+	"log"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// PruneJobs prunes the history of each job type according to the retention policy
+func PruneJobs(db manager.Database, policy manager.RetentionPolicy, jobTypes []job.JobType) {
+	now := time.Now()
+	totalJobs, totalRecords := 0, 0
+	for _, jobType := range jobTypes {
+		numJobs, numRecords, err := db.PruneJobs(jobType, policy.PruneBefore(jobType, now), func(jobState job.JobState, rank int) bool {
+			return policy.ShouldPrune(jobState, rank, now)
+		})
+		if numRecords > 0 {
+			log.Printf("pruneJobs: pruned %d records of %d %s jobs", numRecords, numJobs, jobType)
+		}
+		if err != nil {
+			log.Printf("pruneJobs: error pruning %s jobs: %v", jobType, err)
+		}
+		totalJobs += numJobs
+		totalRecords += numRecords
+	}
+	log.Printf("pruneJobs: pruned %d records of %d jobs in %s", totalRecords, totalJobs, time.Since(now))
+}
+
+func PruneJobsPeriodically(db manager.Database, policy manager.RetentionPolicy, jobTypes []job.JobType, shutdownCh chan bool) {
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownCh:
+			return
+		case <-ticker.C:
+			PruneJobs(db, policy, jobTypes)
+		}
+	}
+}
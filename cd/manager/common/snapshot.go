@@ -0,0 +1,106 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Bump this whenever the snapshot format changes so that older snapshots are ignored instead of being misread
+const cacheSnapshotVersion = 1
+
+const cacheSnapshotInterval = 5 * time.Minute
+
+// cacheSnapshot is the on-disk representation of the active jobs in the cache. Snapshots only speed up warm starts, the
+// database remains the source of truth and is always loaded after a snapshot is restored.
+type cacheSnapshot struct {
+	Version int            `json:"version"`
+	Ts      time.Time      `json:"ts"`
+	Jobs    []job.JobState `json:"jobs"`
+}
+
+// CacheSnapshotPath returns the configured snapshot location, or an empty string if snapshots are disabled.
+func CacheSnapshotPath() string {
+	return os.Getenv("CACHE_SNAPSHOT_PATH")
+}
+
+// SnapshotCache writes the active jobs in the cache to the specified path. The snapshot is written to a temporary file
+// first and then renamed so that a crash mid-write never leaves a partial snapshot behind.
+func SnapshotCache(cache manager.Cache, path string) error {
+	snapshot := cacheSnapshot{cacheSnapshotVersion, time.Now(), cache.JobsByMatcher(job.IsActiveJob)}
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("snapshotCache: failed to marshal snapshot: %v", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("snapshotCache: failed to create snapshot file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err = tmpFile.Write(snapshotBytes); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("snapshotCache: failed to write snapshot: %v", err)
+	} else if err = tmpFile.Close(); err != nil {
+		return fmt.Errorf("snapshotCache: failed to close snapshot: %v", err)
+	} else if err = os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("snapshotCache: failed to save snapshot: %v", err)
+	}
+	return nil
+}
+
+// RestoreCache loads active jobs from the snapshot at the specified path into the cache. A missing snapshot is not an
+// error. Snapshots with an unknown version, from before the job TTL, or containing invalid jobs are rejected as a whole.
+func RestoreCache(cache manager.Cache, path string) (int, error) {
+	snapshotBytes, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("restoreCache: failed to read snapshot: %v", err)
+	}
+	snapshot := cacheSnapshot{}
+	if err = json.Unmarshal(snapshotBytes, &snapshot); err != nil {
+		return 0, fmt.Errorf("restoreCache: failed to unmarshal snapshot: %v", err)
+	} else if snapshot.Version != cacheSnapshotVersion {
+		return 0, fmt.Errorf("restoreCache: unsupported snapshot version %d", snapshot.Version)
+	} else if snapshot.Ts.Before(time.Now().AddDate(0, 0, -manager.DefaultTtlDays)) {
+		return 0, fmt.Errorf("restoreCache: snapshot from %s is too old", snapshot.Ts)
+	}
+	for _, jobState := range snapshot.Jobs {
+		if (len(jobState.JobId) == 0) || jobState.Ts.IsZero() || !job.IsActiveJob(jobState) {
+			return 0, fmt.Errorf("restoreCache: invalid job in snapshot: %v", jobState)
+		} else if err = manager.DecodeLayout(jobState); err != nil {
+			// Decode job params the same way as when reading jobs from the database
+			return 0, fmt.Errorf("restoreCache: invalid layout in snapshot: %v, %s", err, manager.PrintJob(jobState))
+		}
+	}
+	for _, jobState := range snapshot.Jobs {
+		cache.WriteJob(jobState)
+	}
+	return len(snapshot.Jobs), nil
+}
+
+// SnapshotCachePeriodically snapshots the cache at regular intervals, and one last time on shutdown.
+func SnapshotCachePeriodically(cache manager.Cache, path string, shutdownCh chan bool) {
+	ticker := time.NewTicker(cacheSnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shutdownCh:
+			if err := SnapshotCache(cache, path); err != nil {
+				log.Printf("snapshotCachePeriodically: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := SnapshotCache(cache, path); err != nil {
+				log.Printf("snapshotCachePeriodically: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+func TestRestoreCacheDecodesLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	layout := manager.Layout{
+		Clusters: map[string]*manager.Cluster{
+			"ceramic-dev-ex": {ServiceTasks: &manager.TaskSet{Tasks: map[string]*manager.Task{
+				"ceramic-dev-ex-node": {Id: "task", Name: "ceramic"},
+			}}},
+		},
+		Repo: &manager.Repo{Name: "ceramic-prod"},
+	}
+	cache := NewJobCache()
+	cache.WriteJob(job.JobState{JobId: "deploy", Type: job.JobType_Deploy, Stage: job.JobStage_Started, Ts: time.Now(), Params: map[string]interface{}{
+		job.DeployJobParam_Layout: layout,
+	}})
+	if err := SnapshotCache(cache, path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewJobCache()
+	if n, err := RestoreCache(restored, path); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("expected 1 restored job, got %d", n)
+	}
+	jobState, found := restored.JobById("deploy")
+	if !found {
+		t.Fatal("deploy job not restored")
+	}
+	restoredLayout, ok := jobState.Params[job.DeployJobParam_Layout].(manager.Layout)
+	if !ok {
+		t.Fatalf("layout not restored as a layout: %T", jobState.Params[job.DeployJobParam_Layout])
+	} else if task := restoredLayout.Clusters["ceramic-dev-ex"].ServiceTasks.Tasks["ceramic-dev-ex-node"]; (task == nil) || (task.Id != "task") || (task.Name != "ceramic") {
+		t.Fatalf("unexpected restored task: %+v", task)
+	} else if (restoredLayout.Repo == nil) || (restoredLayout.Repo.Name != "ceramic-prod") {
+		t.Fatalf("unexpected restored repo: %+v", restoredLayout.Repo)
+	}
+}
+
+func TestRestoreCacheMissingSnapshot(t *testing.T) {
+	if n, err := RestoreCache(NewJobCache(), filepath.Join(t.TempDir(), "missing.json")); (err != nil) || (n != 0) {
+		t.Fatalf("expected a missing snapshot to restore nothing, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+)
+
+const (
+	configValue_Set   = "set"
+	configValue_Unset = "unset"
+)
+
+// configVar is an environment variable used to configure the manager. Only whether secrets (e.g. webhook URLs, which
+// contain tokens) are set is ever reported, never their values.
+type configVar struct {
+	name   string
+	secret bool
+}
+
+var configVars = []configVar{
+	{EnvVar_Env, false},
+	{"AWS_REGION", false},
+	{"AWS_ACCOUNT_ID", false},
+	{"AWS_ENDPOINT", false},
+	{"DB_AWS_ENDPOINT", false},
+	{"SERVER_ADDR", false},
+	{"SERVER_PORT", false},
+	{"PAUSED", false},
+	{"MANAGER_VERSION", false},
+	{"NOTIFY_LIFECYCLE", false},
+	{"NOTIFY_SILENT_JOB_FAILURES", false},
+	{"JOB_SCHEDULES", false},
+	{"CAS_MAX_ANCHOR_WORKERS", false},
+	{"CAS_MIN_ANCHOR_WORKERS", false},
+	{"ECS_STOPPED_REASON_RULES", false},
+	{"CACHE_SNAPSHOT_PATH", false},
+	{"JOB_RETENTION_DAYS", false},
+	{"JOB_RETENTION_MAX_COUNT", false},
+	{"JOB_RETENTION_INTERVAL", false},
+	{"DEPLOY_RETENTION_DAYS", false},
+	{"DEPLOY_RETENTION_MAX_COUNT", false},
+	{"SMOKE_TEST_RETRIES", false},
+	{"SMOKE_TEST_CLUSTER_FILTER", false},
+	{"SMOKE_TEST_COMPONENT_SELECTION", false},
+	{"DEPLOY_REGIONS", false},
+	{"DEPLOY_REGION_BAKE_TIME", false},
+	{"DEPLOY_FROZEN_COMPONENTS", false},
+	{"APPROVAL_BASE_URL", false},
+	{"APPROVAL_SIGNING_KEY", true},
+	{"APPROVAL_TIMEOUT", false},
+	{"ALERT_RESPONDERS", false},
+	{"ALERT_ACK_TIMEOUT", false},
+	{"PAGERDUTY_ROUTING_KEY", true},
+	{"QUEUED_JOB_NOTIF_DELAY", false},
+	{"DEBUG_DECISION_LOG_SIZE", false},
+	{"PROMETHEUS_URL", false},
+	{"PROMETHEUS_BEARER_TOKEN", true},
+	{"SLO_BURN_RATE_QUERY", false},
+	{"SLO_MAX_BURN_RATE", false},
+	{"DEPLOY_BAKE_TIME", false},
+	{"DEPLOY_BAKE_TIME_CONFIG", false},
+	{"DEPLOY_REGION_ROLLBACK", false},
+	{"DEPLOY_IMAGE_CHECK", false},
+	{"DEPLOY_IMAGE_CHECK_CONFIG", false},
+	{"DEPLOY_TASK_DEF_CHECK", false},
+	{"SERVICE_PREFIX", false},
+	{"DEPLOY_BREAKER_THRESHOLD", false},
+	{"DEPLOY_BREAKER_WINDOW", false},
+	{"DEPLOY_BREAKER_COOLDOWN", false},
+	{"DEPLOY_ENV_VARS", true},
+	{"DEPLOY_ROLLOUT_STUCK_TIME", false},
+	{"DEPLOY_CANCEL_SUPERSEDED", false},
+	{"TERRAFORM_PLAN_CLUSTER", false},
+	{"TERRAFORM_PLAN_FAMILY", false},
+	{"TERRAFORM_PLAN_CONTAINER", false},
+	{"TERRAFORM_PLAN_NETWORK_CONFIG", false},
+	{"CLOUDFRONT_DISTRIBUTION_ID", false},
+	{"CLOUDFRONT_INVALIDATION_PATHS", false},
+	{"BACKUP_VAULT_NAME", false},
+	{"BACKUP_IAM_ROLE_ARN", false},
+	{"BACKUP_RESOURCE_ARN", false},
+	{"DISCORD_USERNAME_PREFIX", false},
+	{"DISCORD_PROXY_URL", true},
+	{"DISCORD_CA_FILE", false},
+	{"COMPONENT_DISPLAY_NAMES", false},
+	{"DISCORD_COMMUNITY_SUPPRESS_REPEATS", false},
+	{"DISCORD_TEST_MESSAGE_MAX_AGE", false},
+	{"DISCORD_HEARTBEAT_INTERVAL", false},
+	{"DISCORD_MAX_ACTIVE_JOBS", false},
+	{"DISCORD_COLOR_THEMES", false},
+	{"DISCORD_ONCALL_MENTION", false},
+	{"DISCORD_PAGE_POLICY", false},
+	{"DISCORD_BOT_TOKEN", true},
+	{"DISCORD_PIN_CHANNELS", false},
+	{"DISCORD_PIN_SEVERITIES", false},
+	{"ENV_COLOR_MAP_JSON", false},
+	{"ENV_DISPLAY_NAME_MAP_JSON", false},
+	{"FORMAT_TIME", false},
+	{"FORMAT_DURATION", false},
+	{"FORMAT_SHA", false},
+	{"NOTIF_SINK_ADDR", false},
+	{"NOTIF_SINK_PROTOCOL", false},
+	{"NOTIF_SINK_ONLY", false},
+	{"NOTIF_SUMMARY_BUCKET", false},
+	{"NOTIF_SUMMARY_BASE_URL", false},
+	{"NOTIF_SUMMARY_MAX_SIZE", false},
+	{"NOTIF_SUMMARY_MAX_FIELDS", false},
+	{"SES_FROM_ADDRESS", false},
+	{"SES_TO_ADDRESSES", false},
+	{"SES_REGION", false},
+	{"JOB_EVENTS_TARGET_ARN", false},
+	{"JOB_EVENTS_ALL_STAGES", false},
+	{"DISCORD_TEST_WEBHOOK", true},
+	{"DISCORD_TESTS_WEBHOOK", true},
+	{"DISCORD_TEST_FAILURES_WEBHOOK", true},
+	{"DISCORD_DEPLOYMENTS_WEBHOOK", true},
+	{"DISCORD_DEPLOYMENT_FAILURES_WEBHOOK", true},
+	{"DISCORD_COMMUNITY_NODES_WEBHOOK", true},
+	{"DISCORD_ALERT_WEBHOOK", true},
+	{"DISCORD_INFO_WEBHOOK", true},
+	{"DISCORD_SYSTEM_WEBHOOK", true},
+	{"DISCORD_INFRA_WEBHOOK", true},
+	{"DISCORD_OUTCOME_ROUTES_JSON", true},
+	{"DISCORD_CAS_WEBHOOK", true},
+	{"GITHUB_ACCESS_TOKEN", true},
+	{"BLOCKCHAIN_RPC_URL", true},
+	{"CERAMIC_NODE_PRIVATE_SEED_URL", true},
+	{"E2E_AWS_ACCESS_KEY_ID", true},
+	{"E2E_AWS_SECRET_ACCESS_KEY", true},
+}
+
+// ConfigJson returns the configuration in effect as JSON with secrets redacted. Keys are sorted so that the output is
+// stable and can be diffed across deployments of the manager.
+func ConfigJson() string {
+	config := map[string]string{
+		"tick":         DefaultTick.String(),
+		"ttlDays":      strconv.Itoa(DefaultTtlDays),
+		"httpWaitTime": DefaultHttpWaitTime.String(),
+		"waitTime":     DefaultWaitTime.String(),
+	}
+	for _, v := range configVars {
+		value, found := os.LookupEnv(v.name)
+		if v.secret || !found {
+			if found && (len(value) > 0) {
+				value = configValue_Set
+			} else {
+				value = configValue_Unset
+			}
+		}
+		config[v.name] = value
+	}
+	configBytes, _ := json.Marshal(config)
+	return string(configBytes)
+}
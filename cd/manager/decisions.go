@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Decisions for jobs that haven't been advanced for this long are dropped
+const decisionLogMaxAge = DefaultTtlDays * 24 * time.Hour
+
+const decisionLogPruneInterval = time.Hour
+
+// Decision records why a job's state machine did what it did when it was advanced, i.e. the stage it evaluated, the
+// checks it made along the way, and the stage it ended up in.
+type Decision struct {
+	Ts        time.Time
+	Stage     job.JobStage
+	Checks    []DecisionCheck `json:",omitempty"`
+	NextStage job.JobStage
+	Error     string `json:",omitempty"`
+	// Time spent advancing the job, in seconds
+	Elapsed float64
+}
+
+// Checks recorded while advancing jobs. Checks that observe the outside world, e.g. whether a task is running, are
+// what the replay harness feeds back to jobs. The others, e.g. timeouts, are derived from the job and the time.
+const (
+	DecisionCheck_TaskRunning           = "taskRunning"
+	DecisionCheck_TaskStopped           = "taskStopped"
+	DecisionCheck_StartupTimedOut       = "startupTimedOut"
+	DecisionCheck_CompletionTimedOut    = "completionTimedOut"
+	DecisionCheck_WorkerInExpectedState = "workerInExpectedState"
+	DecisionCheck_TestsInExpectedState  = "testsInExpectedState"
+	DecisionCheck_LayoutDeployed        = "layoutDeployed"
+)
+
+type DecisionCheck struct {
+	Name   string
+	Result interface{}
+}
+
+// DecisionLog keeps the most recent decisions made for each job in memory. The log is only kept while debugging, since
+// it records every check made while advancing jobs. A nil log records nothing, so that callers don't need to check
+// whether the log is enabled.
+type DecisionLog struct {
+	mu        *sync.Mutex
+	size      int
+	pending   map[string]*Decision
+	decisions map[string][]Decision
+	lastPrune time.Time
+}
+
+// NewDecisionLog returns nil unless the number of decisions to keep per job has been configured
+func NewDecisionLog() *DecisionLog {
+	if size, err := strconv.Atoi(os.Getenv("DEBUG_DECISION_LOG_SIZE")); (err == nil) && (size > 0) {
+		log.Printf("newDecisionLog: keeping the last %d decisions for each job", size)
+		return NewDecisionLogOfSize(size)
+	}
+	return nil
+}
+
+// NewDecisionLogOfSize returns a log that keeps the specified number of decisions per job, regardless of configuration
+func NewDecisionLogOfSize(size int) *DecisionLog {
+	return &DecisionLog{
+		new(sync.Mutex),
+		size,
+		make(map[string]*Decision),
+		make(map[string][]Decision),
+		time.Now(),
+	}
+}
+
+// Begin starts recording the decision made when advancing a job
+func (d *DecisionLog) Begin(jobState job.JobState) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending[jobState.JobId] = &Decision{Ts: time.Now(), Stage: jobState.Stage}
+}
+
+// RecordCheck records a check made while advancing a job, e.g. whether a task was running or whether the job timed out
+func (d *DecisionLog) RecordCheck(jobState job.JobState, name string, result interface{}) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if decision, found := d.pending[jobState.JobId]; found {
+		decision.Checks = append(decision.Checks, DecisionCheck{name, result})
+	}
+}
+
+// End records the outcome of advancing a job, and logs the whole decision
+func (d *DecisionLog) End(jobId string, nextStage job.JobStage, err error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	decision, found := d.pending[jobId]
+	if !found {
+		return
+	}
+	delete(d.pending, jobId)
+	decision.NextStage = nextStage
+	decision.Elapsed = time.Since(decision.Ts).Seconds()
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	if decisionJson, err := json.Marshal(decision); err != nil {
+		log.Printf("endDecision: error encoding decision: %v, %s", err, jobId)
+	} else {
+		log.Printf("endDecision: %s: %s", jobId, decisionJson)
+	}
+	jobDecisions := append(d.decisions[jobId], *decision)
+	if len(jobDecisions) > d.size {
+		jobDecisions = jobDecisions[len(jobDecisions)-d.size:]
+	}
+	d.decisions[jobId] = jobDecisions
+	d.prune()
+}
+
+// JobDecisions returns the most recent decisions made for a job, oldest first, and false if the log isn't enabled
+func (d *DecisionLog) JobDecisions(jobId string) ([]Decision, bool) {
+	if d == nil {
+		return nil, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	jobDecisions := make([]Decision, len(d.decisions[jobId]))
+	copy(jobDecisions, d.decisions[jobId])
+	return jobDecisions, true
+}
+
+// prune drops the decisions for jobs that haven't been advanced in a while, e.g. because they finished
+func (d *DecisionLog) prune() {
+	now := time.Now()
+	if now.Sub(d.lastPrune) < decisionLogPruneInterval {
+		return
+	}
+	d.lastPrune = now
+	for jobId, jobDecisions := range d.decisions {
+		if now.Sub(jobDecisions[len(jobDecisions)-1].Ts) > decisionLogMaxAge {
+			delete(d.decisions, jobId)
+		}
+	}
+}
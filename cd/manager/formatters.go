@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Formatters render field values for notifications and API responses. They are pure functions so that alternate
+// presentation styles can be selected through configuration without changing the code that uses them.
+type TimeFormatter func(t, now time.Time) string
+type DurationFormatter func(time.Duration) string
+type ShaFormatter func(repo DeployRepo, sha string) string
+
+const (
+	Formatter_Default  = "default"
+	Formatter_Relative = "relative"
+	Formatter_Rfc3339  = "rfc3339"
+	Formatter_Compact  = "compact"
+	Formatter_Seconds  = "seconds"
+	Formatter_Short    = "short"
+	Formatter_Full     = "full"
+)
+
+const shaTagLength = 12
+
+var timeFormatters = map[string]TimeFormatter{
+	Formatter_Default: func(t, _ time.Time) string {
+		return t.Format(time.RFC1123)
+	},
+	Formatter_Rfc3339: func(t, _ time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	Formatter_Relative: func(t, now time.Time) string {
+		if elapsed := now.Sub(t).Truncate(time.Second); elapsed >= time.Second {
+			return elapsed.String() + " ago"
+		} else if elapsed <= -time.Second {
+			return "in " + (-elapsed).String()
+		}
+		return "now"
+	},
+}
+
+var durationFormatters = map[string]DurationFormatter{
+	Formatter_Default: func(d time.Duration) string {
+		hours := int(d.Seconds() / 3600)
+		minutes := int(d.Seconds()/60) % 60
+		seconds := int(d.Seconds()) % 60
+		if (hours != 0) || (minutes != 0) || (seconds != 0) {
+			return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
+		}
+		return ""
+	},
+	Formatter_Compact: func(d time.Duration) string {
+		if d = d.Truncate(time.Second); d > 0 {
+			return d.String()
+		}
+		return ""
+	},
+	Formatter_Seconds: func(d time.Duration) string {
+		if seconds := int(d.Seconds()); seconds != 0 {
+			return fmt.Sprintf("%ds", seconds)
+		}
+		return ""
+	},
+}
+
+var shaFormatters = map[string]ShaFormatter{
+	Formatter_Default: func(repo DeployRepo, sha string) string {
+		return fmt.Sprintf("[%s (%s)](https://github.com/%s/%s/commit/%s)", repo.Name, sha[:shaTagLength], repo.Org, repo.Name, sha)
+	},
+	Formatter_Short: func(repo DeployRepo, sha string) string {
+		return fmt.Sprintf("%s (%s)", repo.Name, sha[:shaTagLength])
+	},
+	Formatter_Full: func(repo DeployRepo, sha string) string {
+		return fmt.Sprintf("%s (%s)", repo.Name, sha)
+	},
+}
+
+// The formatters are selected by name through the environment, falling back to the default formatter if the name is
+// missing or unknown.
+
+func ConfiguredTimeFormatter() TimeFormatter {
+	return timeFormatters[formatterName("FORMAT_TIME", timeFormatters)]
+}
+
+func ConfiguredDurationFormatter() DurationFormatter {
+	return durationFormatters[formatterName("FORMAT_DURATION", durationFormatters)]
+}
+
+func ConfiguredShaFormatter() ShaFormatter {
+	return shaFormatters[formatterName("FORMAT_SHA", shaFormatters)]
+}
+
+func formatterName[F any](formatterEnv string, formatters map[string]F) string {
+	if name, found := os.LookupEnv(formatterEnv); found {
+		if _, found = formatters[name]; found {
+			return name
+		}
+		log.Printf("formatterName: unknown formatter: %s, %s", formatterEnv, name)
+	}
+	return Formatter_Default
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+const testSha = "0123456789abcdef0123456789abcdef01234567"
+
+func TestDefaultFormattersMatchPreviousOutput(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if formatted := timeFormatters[Formatter_Default](ts, ts); formatted != "Tue, 02 Jan 2024 03:04:05 UTC" {
+		t.Fatalf("unexpected time: %s", formatted)
+	}
+	if formatted := durationFormatters[Formatter_Default](time.Hour + 2*time.Minute + 3*time.Second); formatted != "1h 2m 3s" {
+		t.Fatalf("unexpected duration: %s", formatted)
+	}
+	if formatted := durationFormatters[Formatter_Default](500 * time.Millisecond); formatted != "" {
+		t.Fatalf("expected durations under a second not to be shown, got %s", formatted)
+	}
+	repo := DeployRepo{Org: "ceramicnetwork", Name: "js-ceramic"}
+	if formatted := shaFormatters[Formatter_Default](repo, testSha); formatted != "[js-ceramic (0123456789ab)](https://github.com/ceramicnetwork/js-ceramic/commit/"+testSha+")" {
+		t.Fatalf("unexpected sha: %s", formatted)
+	}
+}
+
+func TestRelativeTimeFormatter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	relative := timeFormatters[Formatter_Relative]
+	for ts, expected := range map[time.Time]string{
+		now.Add(-5*time.Minute - 300*time.Millisecond): "5m0s ago",
+		now.Add(90 * time.Second):                      "in 1m30s",
+		now.Add(-300 * time.Millisecond):               "now",
+	} {
+		if formatted := relative(ts, now); formatted != expected {
+			t.Fatalf("expected %q, got %q", expected, formatted)
+		}
+	}
+}
+
+func TestAlternateFormatters(t *testing.T) {
+	if formatted := durationFormatters[Formatter_Compact](90*time.Second + 300*time.Millisecond); formatted != "1m30s" {
+		t.Fatalf("unexpected compact duration: %s", formatted)
+	}
+	if formatted := durationFormatters[Formatter_Seconds](90 * time.Second); formatted != "90s" {
+		t.Fatalf("unexpected duration in seconds: %s", formatted)
+	}
+	repo := DeployRepo{Org: "ceramicnetwork", Name: "js-ceramic"}
+	if formatted := shaFormatters[Formatter_Short](repo, testSha); formatted != "js-ceramic (0123456789ab)" {
+		t.Fatalf("unexpected short sha: %s", formatted)
+	}
+	if formatted := shaFormatters[Formatter_Full](repo, testSha); formatted != "js-ceramic ("+testSha+")" {
+		t.Fatalf("unexpected full sha: %s", formatted)
+	}
+}
+
+func TestConfiguredFormatters(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	t.Setenv("FORMAT_TIME", Formatter_Rfc3339)
+	if formatted := ConfiguredTimeFormatter()(now, now); formatted != "2024-01-02T03:04:05Z" {
+		t.Fatalf("configured formatter not used: %s", formatted)
+	}
+	// Unknown formatters fall back to the default
+	t.Setenv("FORMAT_DURATION", "fancy")
+	if formatted := ConfiguredDurationFormatter()(time.Minute); formatted != "0h 1m 0s" {
+		t.Fatalf("expected the default formatter, got %s", formatted)
+	}
+}
@@ -0,0 +1,212 @@
+package jobmanager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const defaultDeployBreakerWindow = time.Hour
+const defaultDeployBreakerCooldown = 30 * time.Minute
+
+// deployBreaker stops deployments from being started after too many of them have failed within a window, so that doomed
+// tasks aren't launched over and over during systemic failures. Once the cooldown has passed, a single deployment is let
+// through as a probe. The breaker closes if the probe succeeds, and opens again if it fails. Force deployments, which
+// are always manual or rollbacks, are never held.
+//
+// The breaker state is only kept in memory, and so a restart closes the breaker.
+type deployBreaker struct {
+	cache      manager.Cache
+	threshold  int
+	window     time.Duration
+	cooldown   time.Duration
+	mu         *sync.Mutex
+	failures   []time.Time
+	openedAt   time.Time
+	probeJobId string
+}
+
+// newDeployBreaker returns nil if no failure threshold has been configured
+func newDeployBreaker(cache manager.Cache) (*deployBreaker, error) {
+	thresholdStr, found := os.LookupEnv("DEPLOY_BREAKER_THRESHOLD")
+	if !found {
+		return nil, nil
+	}
+	threshold, err := strconv.Atoi(thresholdStr)
+	if (err != nil) || (threshold <= 0) {
+		return nil, fmt.Errorf("newDeployBreaker: invalid threshold: %s", thresholdStr)
+	}
+	window, err := breakerDuration("DEPLOY_BREAKER_WINDOW", defaultDeployBreakerWindow)
+	if err != nil {
+		return nil, err
+	}
+	cooldown, err := breakerDuration("DEPLOY_BREAKER_COOLDOWN", defaultDeployBreakerCooldown)
+	if err != nil {
+		return nil, err
+	}
+	return &deployBreaker{cache, threshold, window, cooldown, new(sync.Mutex), nil, time.Time{}, ""}, nil
+}
+
+func breakerDuration(durationEnv string, defaultDuration time.Duration) (time.Duration, error) {
+	durationStr, found := os.LookupEnv(durationEnv)
+	if !found {
+		return defaultDuration, nil
+	}
+	if duration, err := time.ParseDuration(durationStr); (err != nil) || (duration <= 0) {
+		return 0, fmt.Errorf("newDeployBreaker: invalid %s: %s", durationEnv, durationStr)
+	} else {
+		return duration, nil
+	}
+}
+
+// state must be called with the mutex held
+func (b *deployBreaker) state(now time.Time) manager.DeployBreakerState {
+	if b.openedAt.IsZero() {
+		return manager.DeployBreakerState_Closed
+	} else if now.Before(b.openedAt.Add(b.cooldown)) {
+		return manager.DeployBreakerState_Open
+	}
+	return manager.DeployBreakerState_HalfOpen
+}
+
+// allow returns whether a deployment can be started. While the breaker is half-open, only the first deployment to ask
+// is let through, as the probe. Deployments that someone explicitly asked for, i.e. forced, manual, or freeze override
+// deployments, are always let through so that the breaker can't block a fix.
+func (b *deployBreaker) allow(deployJob job.JobState) bool {
+	if b == nil {
+		return true
+	} else if force, _ := deployJob.Params[job.DeployJobParam_Force].(bool); force {
+		return true
+	} else if manual, _ := deployJob.Params[job.DeployJobParam_Manual].(bool); manual {
+		return true
+	} else if freezeOverride, _ := deployJob.Params[job.DeployJobParam_FreezeOverride].(bool); freezeOverride {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state(time.Now()) {
+	case manager.DeployBreakerState_Closed:
+		return true
+	case manager.DeployBreakerState_HalfOpen:
+		if (len(b.probeJobId) == 0) || !b.isProbing() {
+			log.Printf("allow: probing deployments: %s", manager.PrintJob(deployJob))
+			b.probeJobId = deployJob.JobId
+		}
+		return b.probeJobId == deployJob.JobId
+	default:
+		return false
+	}
+}
+
+// isProbing returns whether the probe deployment could still run to completion. Probes can end without an outcome being
+// recorded, e.g. when canceled by a force deployment, and shouldn't hold up other deployments when they do.
+// Must be called with the mutex held.
+func (b *deployBreaker) isProbing() bool {
+	if probeJob, found := b.cache.JobById(b.probeJobId); found {
+		return (probeJob.Stage == job.JobStage_Dequeued) || job.IsActiveJob(probeJob)
+	}
+	return false
+}
+
+// recordOutcome updates the breaker with the outcome of a finished deployment, and returns a system event describing
+// any change in the state of the breaker
+func (b *deployBreaker) recordOutcome(deployJob job.JobState) *manager.SystemEvent {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if deployJob.JobId == b.probeJobId {
+		switch deployJob.Stage {
+		case job.JobStage_Completed:
+			b.probeJobId = ""
+			b.openedAt = time.Time{}
+			return &manager.SystemEvent{
+				Kind:     manager.SystemEventKind_Deployment,
+				Message:  fmt.Sprintf("circuit closed: probe deployment succeeded, deployments resumed: %s", deployJob.JobId),
+				Severity: manager.SystemEventSeverity_Info,
+			}
+		case job.JobStage_Failed:
+			b.probeJobId = ""
+			b.openedAt = now
+			return &manager.SystemEvent{
+				Kind:     manager.SystemEventKind_Deployment,
+				Message:  fmt.Sprintf("circuit open: probe deployment failed, deployments held for another %s: %s", b.cooldown, deployJob.JobId),
+				Severity: manager.SystemEventSeverity_Critical,
+			}
+		case job.JobStage_Started, job.JobStage_Waiting:
+			// Still probing
+			return nil
+		default:
+			// The probe won't run to completion, e.g. it was skipped or is waiting for approval, so let another
+			// deployment probe.
+			b.probeJobId = ""
+			return nil
+		}
+	}
+	if (deployJob.Stage != job.JobStage_Failed) || (b.state(now) != manager.DeployBreakerState_Closed) {
+		return nil
+	}
+	b.failures = append(b.recentFailures(now), now)
+	if len(b.failures) < b.threshold {
+		return nil
+	}
+	b.failures = nil
+	b.openedAt = now
+	return &manager.SystemEvent{
+		Kind:     manager.SystemEventKind_Deployment,
+		Message:  fmt.Sprintf("circuit open: %d deployments failed within %s, deployments held for %s or until reset", b.threshold, b.window, b.cooldown),
+		Severity: manager.SystemEventSeverity_Critical,
+	}
+}
+
+// recentFailures must be called with the mutex held
+func (b *deployBreaker) recentFailures(now time.Time) []time.Time {
+	recent := make([]time.Time, 0, len(b.failures))
+	for _, failure := range b.failures {
+		if now.Sub(failure) < b.window {
+			recent = append(recent, failure)
+		}
+	}
+	return recent
+}
+
+func (b *deployBreaker) reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = nil
+	b.openedAt = time.Time{}
+	b.probeJobId = ""
+}
+
+func (b *deployBreaker) status() manager.DeployBreaker {
+	if b == nil {
+		return manager.DeployBreaker{State: manager.DeployBreakerState_Closed}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	status := manager.DeployBreaker{
+		Enabled:        true,
+		State:          b.state(now),
+		RecentFailures: len(b.recentFailures(now)),
+		ProbeJobId:     b.probeJobId,
+	}
+	if !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		probeAt := b.openedAt.Add(b.cooldown)
+		status.OpenedAt = &openedAt
+		status.ProbeAt = &probeAt
+	}
+	return status
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 
 	"github.com/google/uuid"
 
@@ -28,11 +29,34 @@ type JobManager struct {
 	apiGw         manager.ApiGw
 	repo          manager.Repository
 	notifs        manager.Notifs
+	b             manager.Backup
+	s             manager.Secrets
+	cdn           manager.Cdn
+	metrics       manager.Metrics
+	regionDeploys map[string]manager.Deployment
 	maxAnchorJobs int
 	minAnchorJobs int
 	paused        bool
 	env           manager.EnvType
 	waitGroup     *sync.WaitGroup
+	// Reasons why dequeued jobs could not be started, recorded during each processing iteration
+	pendingBlocks map[string][]manager.BlockReason
+	blocked       []manager.BlockedJob
+	blockedMu     *sync.Mutex
+	// Schedules fire relative to when the manager started until they have queued their first job
+	schedules      []*manager.JobSchedule
+	schedulesStart time.Time
+	schedulesMu    *sync.Mutex
+	// Approval decisions are serialized so that a job can't be both approved and rejected
+	approvalsMu *sync.Mutex
+	breaker     *deployBreaker
+	// Why jobs advance the way they do, if debugging
+	decisions *manager.DecisionLog
+	clock     manager.Clock
+	// How jobs of each type are created and scheduled
+	jobTypes []jobType
+	// How long a job can stay queued before a notification is sent for it
+	queuedNotifDelay time.Duration
 }
 
 const (
@@ -47,7 +71,10 @@ const (
 const defaultCasMaxAnchorWorkers = 1
 const defaultCasMinAnchorWorkers = 0
 
-func NewJobManager(cache manager.Cache, db manager.Database, d manager.Deployment, apiGw manager.ApiGw, repo manager.Repository, notifs manager.Notifs) (manager.Manager, error) {
+// Let people know when a job has been queued for a while, e.g. because it's blocked by other jobs
+const defaultQueuedNotifDelay = 10 * time.Minute
+
+func NewJobManager(cache manager.Cache, db manager.Database, d manager.Deployment, apiGw manager.ApiGw, repo manager.Repository, notifs manager.Notifs, b manager.Backup, s manager.Secrets, cdn manager.Cdn, metrics manager.Metrics, regionDeploys map[string]manager.Deployment, decisions *manager.DecisionLog) (manager.Manager, error) {
 	maxAnchorJobs := defaultCasMaxAnchorWorkers
 	if configMaxAnchorWorkers, found := os.LookupEnv("CAS_MAX_ANCHOR_WORKERS"); found {
 		if parsedMaxAnchorWorkers, err := strconv.Atoi(configMaxAnchorWorkers); err == nil {
@@ -63,8 +90,25 @@ func NewJobManager(cache manager.Cache, db manager.Database, d manager.Deploymen
 	if minAnchorJobs > maxAnchorJobs {
 		return nil, fmt.Errorf("newJobManager: invalid anchor worker config: %d, %d", minAnchorJobs, maxAnchorJobs)
 	}
+	schedules, err := manager.ConfiguredJobSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("newJobManager: %v", err)
+	}
+	breaker, err := newDeployBreaker(cache)
+	if err != nil {
+		return nil, fmt.Errorf("newJobManager: %v", err)
+	}
+	// A zero delay disables notifications for queued jobs
+	queuedNotifDelay := defaultQueuedNotifDelay
+	if configQueuedNotifDelay, found := os.LookupEnv("QUEUED_JOB_NOTIF_DELAY"); found {
+		if parsedQueuedNotifDelay, err := time.ParseDuration(configQueuedNotifDelay); (err != nil) || (parsedQueuedNotifDelay < 0) {
+			return nil, fmt.Errorf("newJobManager: invalid queued job notification delay: %s", configQueuedNotifDelay)
+		} else {
+			queuedNotifDelay = parsedQueuedNotifDelay
+		}
+	}
 	paused, _ := strconv.ParseBool(os.Getenv("PAUSED"))
-	return &JobManager{cache, db, d, apiGw, repo, notifs, maxAnchorJobs, minAnchorJobs, paused, manager.EnvType(os.Getenv(manager.EnvVar_Env)), new(sync.WaitGroup)}, nil
+	return &JobManager{cache, db, d, apiGw, repo, notifs, b, s, cdn, metrics, regionDeploys, maxAnchorJobs, minAnchorJobs, paused, manager.EnvType(os.Getenv(manager.EnvVar_Env)), new(sync.WaitGroup), nil, nil, new(sync.Mutex), schedules, time.Now(), new(sync.Mutex), new(sync.Mutex), breaker, decisions, manager.SystemClock{}, newJobTypes(), queuedNotifDelay}, nil
 }
 
 func (m *JobManager) NewJob(jobState job.JobState) (job.JobState, error) {
@@ -79,7 +123,42 @@ func (m *JobManager) NewJob(jobState job.JobState) (job.JobState, error) {
 	if jobState.Params == nil {
 		jobState.Params = make(map[string]interface{}, 0)
 	}
-	return jobState, m.db.QueueJob(jobState)
+	// Reject jobs with an invalid network configuration before they are queued
+	if _, err := manager.NetworkOverride(jobState); err != nil {
+		return jobState, fmt.Errorf("newJob: %v", err)
+	}
+	// Reject jobs that override reserved environment variables before they are queued
+	if _, err := manager.EnvOverrides(jobState); err != nil {
+		return jobState, fmt.Errorf("newJob: %v", err)
+	}
+	// Reject jobs with invalid approvers before they are queued
+	if _, err := manager.JobApprovers(jobState); err != nil {
+		return jobState, fmt.Errorf("newJob: %v", err)
+	}
+	// Reject jobs with an invalid workflow run link before they are queued
+	if _, err := manager.WorkflowRunUrl(jobState); err != nil {
+		return jobState, fmt.Errorf("newJob: %v", err)
+	}
+	// Reject deployments with an invalid release version before they are queued
+	if jobState.Type == job.JobType_Deploy {
+		if _, err := manager.DeployVersion(jobState); err != nil {
+			return jobState, fmt.Errorf("newJob: %v", err)
+		}
+	}
+	// Reject generic tasks with an invalid execution spec before they are queued
+	if jobState.Type == job.JobType_Task {
+		if _, err := job.CreateTaskSpec(jobState); err != nil {
+			return jobState, fmt.Errorf("newJob: invalid task spec: %v", err)
+		}
+	}
+	if err := m.db.QueueJob(jobState); err != nil {
+		return jobState, err
+	}
+	// The notification is canceled if the job moves on before the delay expires
+	if silent, _ := jobState.Params[job.JobParam_Silent].(bool); !silent && (m.queuedNotifDelay > 0) {
+		m.notifs.NotifyJobDeferred(m.queuedNotifDelay, jobState)
+	}
+	return jobState, nil
 }
 
 func (m *JobManager) CheckJob(jobId string) job.JobState {
@@ -89,12 +168,133 @@ func (m *JobManager) CheckJob(jobId string) job.JobState {
 	return job.JobState{}
 }
 
+func (m *JobManager) ChildJobs(jobId string) ([]job.JobState, error) {
+	return m.db.GetChildJobs(jobId)
+}
+
+func (m *JobManager) Jobs(cursor string, limit int) ([]job.JobState, string, error) {
+	return m.db.PaginatedGetJobs(cursor, limit)
+}
+
+// ComponentTaskDefinition returns the latest active revision of the task definition family used by a component's
+// primary service. Families aren't named after services, so the family is looked up from the running service.
+func (m *JobManager) ComponentTaskDefinition(component manager.DeployComponent) (string, error) {
+	if cluster, service, _, err := componentService(component, m.env); err != nil {
+		return "", err
+	} else if family, err := m.d.GetServiceTaskDefinitionFamily(cluster, service); err != nil {
+		return "", err
+	} else {
+		return m.d.GetTaskDefinitionArn(family)
+	}
+}
+
+func (m *JobManager) ComponentImage(component manager.DeployComponent) (string, error) {
+	if cluster, service, container, err := componentService(component, m.env); err != nil {
+		return "", err
+	} else {
+		return m.d.GetContainerImage(cluster, service, container)
+	}
+}
+
+// ClusterServices returns the active services managed by this environment in the specified cluster
+func (m *JobManager) ClusterServices(cluster string) ([]string, error) {
+	return m.d.ListServices(cluster)
+}
+
+func (m *JobManager) DeployBreaker() manager.DeployBreaker {
+	return m.breaker.status()
+}
+
+func (m *JobManager) ResetDeployBreaker() {
+	if m.breaker != nil {
+		log.Printf("resetDeployBreaker: circuit breaker reset")
+		m.breaker.reset()
+	}
+}
+
+// DeployStatus returns the components in this environment that are running the specified commit, and the deployments
+// of the commit that are in flight. Abbreviated commit hashes are matched by prefix.
+func (m *JobManager) DeployStatus(sha string) (manager.DeployStatus, error) {
+	sha = strings.ToLower(sha)
+	if !manager.IsValidShaPrefix(sha) {
+		return manager.DeployStatus{}, manager.Error_InvalidSha
+	}
+	status := manager.DeployStatus{
+		Sha:        sha,
+		Env:        m.env,
+		Components: make([]manager.DeployComponent, 0),
+		Jobs:       make([]job.JobState, 0),
+	}
+	deployTags, err := m.db.GetDeployTags()
+	if err != nil {
+		return manager.DeployStatus{}, err
+	}
+	for component, deployTag := range deployTags {
+		// Deploy tags are stored as "<tag>,<target>", where the tag is the commit hash unless a release was deployed
+		for _, tag := range strings.Split(deployTag, ",") {
+			if strings.HasPrefix(tag, sha) {
+				status.Components = append(status.Components, component)
+				break
+			}
+		}
+	}
+	slices.Sort(status.Components)
+	status.Jobs = m.cache.JobsByMatcher(func(js job.JobState) bool {
+		if (js.Type != job.JobType_Deploy) || job.IsFinishedJob(js) {
+			return false
+		}
+		for _, param := range []string{job.DeployJobParam_DeployTag, job.DeployJobParam_Sha} {
+			if tag, found := js.Params[param].(string); found && strings.HasPrefix(tag, sha) {
+				return true
+			}
+		}
+		return false
+	})
+	slices.SortFunc(status.Jobs, func(a, b job.JobState) bool {
+		return a.Ts.Before(b.Ts)
+	})
+	// A commit being deployed is reported as such even if some components are already running it, since it won't be
+	// fully live until the deployments are complete.
+	if len(status.Jobs) > 0 {
+		status.State = manager.DeployState_Deploying
+		status.Summary = fmt.Sprintf("deploying to %s", m.env)
+	} else if len(status.Components) > 0 {
+		status.State = manager.DeployState_Live
+		status.Summary = fmt.Sprintf("live in %s", m.env)
+	} else {
+		status.State = manager.DeployState_NotDeployed
+		status.Summary = fmt.Sprintf("not deployed to %s", m.env)
+	}
+	return status, nil
+}
+
+// componentService returns the cluster, service, and container of the primary service for a component. Services are
+// named after the cluster they belong to.
+func componentService(component manager.DeployComponent, env manager.EnvType) (string, string, string, error) {
+	switch component {
+	case manager.DeployComponent_Ceramic:
+		return "ceramic-" + string(env), "ceramic-" + string(env) + "-node", "ceramic_node", nil
+	case manager.DeployComponent_Ipfs:
+		return "ceramic-" + string(env), "ceramic-" + string(env) + "-ipfs-nd", "go-ipfs", nil
+	case manager.DeployComponent_Cas:
+		return "ceramic-" + string(env) + "-cas", "ceramic-" + string(env) + "-cas-api", "cas_api", nil
+	case manager.DeployComponent_CasV5:
+		return "app-cas-" + string(env), "app-cas-" + string(env) + "-scheduler", "scheduler", nil
+	case manager.DeployComponent_RustCeramic:
+		return "ceramic-" + string(env) + "-rust", "ceramic-" + string(env) + "-rust-ipfs-nd", "rust-ceramic", nil
+	default:
+		return "", "", "", fmt.Errorf("componentService: unknown component: %s", component)
+	}
+}
+
 func (m *JobManager) ProcessJobs(shutdownCh chan bool) {
 	// Create a ticker to poll the database for new jobs
 	tick := time.NewTicker(manager.DefaultTick)
 	// Only allow one run token to exist, and start with it available for the processing loop to start running.
 	runToken := make(chan bool, 1)
 	runToken <- true
+	// Jobs restored from the database (or a cache snapshot) are picked back up where they were left off
+	m.notifyLifecycle(fmt.Sprintf("started, resuming %d active jobs", len(m.cache.JobsByMatcher(job.IsActiveJob))))
 	for {
 		log.Println("manager: start processing jobs...")
 		for {
@@ -104,6 +304,7 @@ func (m *JobManager) ProcessJobs(shutdownCh chan bool) {
 				tick.Stop()
 				// Attempt to acquire the run token to ensure that no jobs are being processed while shutting down
 				<-runToken
+				m.notifyLifecycle(fmt.Sprintf("stopped, leaving %d active jobs", len(m.cache.JobsByMatcher(job.IsActiveJob))))
 				return
 			case <-tick.C:
 				// Acquire the run token so that no loop iterations can run in parallel (shouldn't happen), and so that
@@ -117,6 +318,22 @@ func (m *JobManager) ProcessJobs(shutdownCh chan bool) {
 	}
 }
 
+// notifyLifecycle sends a notification when the manager starts or stops, if configured to do so, so that gaps in
+// notifications can be correlated with restarts of the manager.
+func (m *JobManager) notifyLifecycle(status string) {
+	if notify, _ := strconv.ParseBool(os.Getenv("NOTIFY_LIFECYCLE")); notify {
+		processing := "processing jobs"
+		if m.paused {
+			processing = "paused"
+		}
+		m.notifs.NotifySystem(manager.SystemEvent{
+			Kind:     manager.SystemEventKind_Lifecycle,
+			Message:  fmt.Sprintf("%s %s %s (%s)\nVersion: %s", manager.ServiceName, m.env, status, processing, manager.Version()),
+			Severity: manager.SystemEventSeverity_Info,
+		})
+	}
+}
+
 func (m *JobManager) Pause() {
 	// Toggle paused status
 	m.paused = !m.paused
@@ -141,39 +358,323 @@ func (m *JobManager) processJobs() {
 			m.cache.DeleteJob(oldJob.JobId)
 		}
 	}
+	// Queue jobs for any schedules that have fired. Paused managers still queue these jobs, they just won't start until
+	// the manager is unpaused.
+	m.processJobSchedules(now)
+	// Cancel jobs that have been waiting for approval for too long
+	m.expirePendingApprovals(now)
 	// Find all jobs in progress and advance their state before looking for new jobs
 	m.advanceJobs(m.cache.JobsByMatcher(job.IsActiveJob))
+	m.pendingBlocks = make(map[string][]manager.BlockReason)
+	var dequeuedJobs []job.JobState
 	// Don't start any new jobs if the job manager is paused. Existing jobs will continue to be advanced.
 	if !m.paused {
 		// Advance each freshly discovered "queued" job to the "dequeued" stage
 		m.advanceJobs(m.db.QueuedJobs())
 		// Jobs in the "dequeued" stage are in the cache but haven't been "started" yet and can thus begin processing
-		dequeuedJobs := m.db.OrderedJobs(job.JobStage_Dequeued)
+		dequeuedJobs = m.db.OrderedJobs(job.JobStage_Dequeued)
+		// Cancel deployments that have been superseded by newer deployments of the same component, if configured.
+		if cancelSuperseded, _ := strconv.ParseBool(os.Getenv("DEPLOY_CANCEL_SUPERSEDED")); cancelSuperseded {
+			dequeuedJobs = m.cancelSupersededDeployJobs(dequeuedJobs)
+		}
 		if len(dequeuedJobs) > 0 {
-			// Try to start multiple jobs and collapse similar ones:
-			// - one deploy at a time (compatible with anchor jobs)
-			// - one smoke test at a time (compatible with non-deploy jobs)
-			// - one E2E test at a time (compatible with non-deploy jobs)
-			// - one workflow at a time (compatible with non-deploy jobs)
-			// - any number of anchor workers (compatible with any other type of job)
-			//
-			// Loop over compatible dequeued jobs until we find an incompatible one and need to wait for existing jobs
-			// to complete.
+			// Try to start multiple jobs and collapse similar ones, looping over compatible dequeued jobs until we find
+			// an incompatible one and need to wait for existing jobs to complete. See `newJobTypes` for which jobs are
+			// compatible with each other.
 			log.Printf("processJobs: dequeued %d jobs...", len(dequeuedJobs))
 			// Check for any deployment jobs - first for forcible deployments, then for regular deployments. Only look
-			// at the remaining jobs if no deployments were kicked off.
+			// at the remaining dependent jobs if no deployments were kicked off.
 			if !m.processForceDeployJobs(dequeuedJobs) &&
 				((dequeuedJobs[0].Type != job.JobType_Deploy) || !m.processDeployJobs(dequeuedJobs)) {
-				m.processTestJobs(dequeuedJobs)
-				m.processWorkflowJobs(dequeuedJobs)
+				for _, jt := range m.jobTypes {
+					if !jt.independent && (jt.process != nil) {
+						jt.process(m, dequeuedJobs)
+					}
+				}
+			}
+		}
+		// Independent jobs can be run regardless of deployments
+		for _, jt := range m.jobTypes {
+			if jt.independent && (jt.process != nil) {
+				jt.process(m, dequeuedJobs)
 			}
 		}
-		// Anchor jobs can be run independently of deployments and do not need any exclusion rules
-		m.processAnchorJobs(dequeuedJobs)
+	} else {
+		dequeuedJobs = m.db.OrderedJobs(job.JobStage_Dequeued)
+		m.blockJobs(dequeuedJobs, nil, manager.BlockReasonKind_Paused, "the job manager is paused", nil)
 	}
 	// Wait for all of this iteration's job advancement goroutines to finish before we iterate again. The ticker will
 	// automatically drop ticks then pick back up later if a round of processing takes longer than 1 tick.
 	m.waitGroup.Wait()
+	m.updateBlockedJobs(dequeuedJobs)
+}
+
+func (m *JobManager) BlockedJobs() []manager.BlockedJob {
+	m.blockedMu.Lock()
+	defer m.blockedMu.Unlock()
+	return m.blocked
+}
+
+func (m *JobManager) JobSchedules() []manager.JobSchedule {
+	m.schedulesMu.Lock()
+	defer m.schedulesMu.Unlock()
+	schedules := make([]manager.JobSchedule, 0, len(m.schedules))
+	for _, schedule := range m.schedules {
+		schedules = append(schedules, *schedule)
+	}
+	return schedules
+}
+
+func (m *JobManager) JobStateMachine(jobType job.JobType) (string, error) {
+	return jobs.StateMachineDiagram(jobType)
+}
+
+func (m *JobManager) JobTiming(jobId string) (manager.JobTiming, error) {
+	history, err := m.db.GetJobHistory(jobId)
+	if err != nil {
+		return manager.JobTiming{}, err
+	} else if len(history) == 0 {
+		return manager.JobTiming{}, fmt.Errorf("jobTiming: %w: %s", manager.Error_JobNotFound, jobId)
+	}
+	return manager.NewJobTiming(history, time.Now()), nil
+}
+
+// JobTimings aggregates the stage timings of the finished jobs of a particular type that were queued since the specified
+// time. Only the records within the time range are read.
+func (m *JobManager) JobTimings(jobType job.JobType, since time.Time) (manager.JobTimingSummary, error) {
+	// Jobs of the same type are returned in descending order of timestamp, so that iteration can stop at the start of
+	// the time range. Every job's history is therefore collected newest first.
+	histories := make(map[string][]job.JobState)
+	if err := m.db.IterateByType(jobType, false, func(jobState job.JobState) bool {
+		if jobState.Ts.Before(since) {
+			return false
+		}
+		histories[jobState.JobId] = append(histories[jobState.JobId], jobState)
+		return true
+	}); err != nil {
+		return manager.JobTimingSummary{}, err
+	}
+	now := time.Now()
+	timings := make([]manager.JobTiming, 0, len(histories))
+	for _, history := range histories {
+		// Skip jobs that were queued before the start of the time range, since only part of their history was read
+		if oldest := history[len(history)-1]; oldest.Stage != job.JobStage_Queued {
+			continue
+		}
+		for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+			history[i], history[j] = history[j], history[i]
+		}
+		timings = append(timings, manager.NewJobTiming(history, now))
+	}
+	return manager.SummarizeJobTimings(jobType, timings), nil
+}
+
+func (m *JobManager) JobDecisions(jobId string) ([]manager.Decision, error) {
+	if decisions, enabled := m.decisions.JobDecisions(jobId); !enabled {
+		return nil, manager.Error_DecisionLogDisabled
+	} else {
+		return decisions, nil
+	}
+}
+
+// JobHistory returns every state recorded for a job, oldest first
+func (m *JobManager) JobHistory(jobId string) ([]job.JobState, error) {
+	history, err := m.db.GetJobHistory(jobId)
+	if err != nil {
+		return nil, err
+	} else if len(history) == 0 {
+		return nil, fmt.Errorf("jobHistory: %w: %s", manager.Error_JobNotFound, jobId)
+	}
+	return history, nil
+}
+
+func (m *JobManager) TestNotification(channel string) error {
+	return m.notifs.NotifyTest(channel)
+}
+
+// ApproveJob moves a job waiting for approval back to the "dequeued" stage so that it can be started
+func (m *JobManager) ApproveJob(jobId, approverId string) error {
+	m.approvalsMu.Lock()
+	defer m.approvalsMu.Unlock()
+	jobState, err := m.pendingApprovalJob(jobId, approverId)
+	if err != nil {
+		return err
+	}
+	// Don't modify the cached job's parameters in case the update fails
+	jobState = manager.CopyJob(jobState)
+	jobState.Params[job.JobParam_ApprovedBy] = approverId
+	log.Printf("approveJob: job approved by %s: %s", approverId, manager.PrintJob(jobState))
+	return m.updateJobStage(jobState, job.JobStage_Dequeued, nil)
+}
+
+// RejectJob cancels a job waiting for approval
+func (m *JobManager) RejectJob(jobId, approverId string) error {
+	m.approvalsMu.Lock()
+	defer m.approvalsMu.Unlock()
+	jobState, err := m.pendingApprovalJob(jobId, approverId)
+	if err != nil {
+		return err
+	}
+	log.Printf("rejectJob: job rejected by %s: %s", approverId, manager.PrintJob(jobState))
+	return m.updateJobStage(manager.CopyJob(jobState), job.JobStage_Canceled, fmt.Errorf("%w by %s", manager.Error_Rejected, approverId))
+}
+
+// RecordRejectedApproval records an approval decision, or other authorized action, that was refused, e.g. because the
+// approver couldn't be authenticated. Refused attempts are sent as system events so that they're recorded by every
+// notifier, including the log sink, and not only in the manager's logs.
+func (m *JobManager) RecordRejectedApproval(target, approverId, action, source string, reason error) {
+	message := fmt.Sprintf("refused %s of %s by %s from %s: %v", action, target, approverId, source, reason)
+	log.Printf("recordRejectedApproval: %s", message)
+	m.notifs.NotifySystem(manager.SystemEvent{
+		Kind:     manager.SystemEventKind_Approval,
+		Message:  message,
+		Severity: manager.SystemEventSeverity_Warning,
+	})
+}
+
+// AcknowledgeJob records who acknowledged the alert for a failed job, and when. Failed jobs aren't updated again, so the
+// acknowledgement is set on the cached job, which stops the alert from being escalated, and recorded as a system event
+// so that every notifier, including the log sink, keeps a record of it.
+func (m *JobManager) AcknowledgeJob(jobId, responderId string) error {
+	if !manager.IsAlertResponder(responderId) {
+		return fmt.Errorf("acknowledgeJob: %w: %s", manager.Error_NotResponder, responderId)
+	}
+	// Acknowledgements are serialized like approval decisions so that an alert is only acknowledged once
+	m.approvalsMu.Lock()
+	defer m.approvalsMu.Unlock()
+	jobState, found := m.cache.JobById(jobId)
+	if !found {
+		return fmt.Errorf("acknowledgeJob: %w: %s", manager.Error_JobNotFound, jobId)
+	} else if jobState.Stage != job.JobStage_Failed {
+		return fmt.Errorf("acknowledgeJob: %w: %s", manager.Error_NotAcknowledgeable, manager.PrintJob(jobState))
+	} else if manager.IsAcknowledged(jobState) {
+		return fmt.Errorf("acknowledgeJob: %w: %s", manager.Error_AlreadyAcknowledged, manager.PrintJob(jobState))
+	}
+	now := time.Now()
+	if err := m.cache.UpdateJobField(jobId, job.JobParam_AckTs, float64(now.UnixNano())); err != nil {
+		return err
+	} else if err = m.cache.UpdateJobField(jobId, job.JobParam_AckedBy, responderId); err != nil {
+		return err
+	}
+	log.Printf("acknowledgeJob: alert acknowledged by %s: %s", responderId, manager.PrintJob(jobState))
+	m.notifs.NotifySystem(manager.SystemEvent{
+		Kind:     manager.SystemEventKind_Ack,
+		Message:  fmt.Sprintf("%s job %s acknowledged by %s after %s", jobState.Type, jobId, responderId, now.Sub(jobState.Ts).Round(time.Second)),
+		Severity: manager.SystemEventSeverity_Info,
+		JobId:    jobId,
+	})
+	return nil
+}
+
+// pendingApprovalJob returns the specified job if it is waiting for approval and the approver is allowed to approve it
+func (m *JobManager) pendingApprovalJob(jobId, approverId string) (job.JobState, error) {
+	jobState, found := m.cache.JobById(jobId)
+	if !found {
+		return job.JobState{}, fmt.Errorf("pendingApprovalJob: %w: %s", manager.Error_JobNotFound, jobId)
+	} else if jobState.Stage != job.JobStage_PendingApproval {
+		return job.JobState{}, fmt.Errorf("pendingApprovalJob: %w: %s", manager.Error_NotPendingApproval, manager.PrintJob(jobState))
+	} else if time.Now().After(manager.ApprovalExpiry(jobState)) {
+		// The job will be canceled in the next iteration, so don't let it be approved in the meantime
+		return job.JobState{}, fmt.Errorf("pendingApprovalJob: %w: %s", manager.Error_ApprovalExpired, manager.PrintJob(jobState))
+	}
+	approvers, err := manager.JobApprovers(jobState)
+	if err != nil {
+		return job.JobState{}, err
+	}
+	for _, approver := range approvers {
+		// GitHub usernames are case-insensitive
+		if strings.EqualFold(strings.TrimSpace(approver), strings.TrimSpace(approverId)) {
+			return jobState, nil
+		}
+	}
+	return job.JobState{}, fmt.Errorf("pendingApprovalJob: %w: %s, %s", manager.Error_NotApprover, approverId, manager.PrintJob(jobState))
+}
+
+// expirePendingApprovals cancels jobs that weren't approved or rejected in time
+func (m *JobManager) expirePendingApprovals(now time.Time) {
+	m.approvalsMu.Lock()
+	defer m.approvalsMu.Unlock()
+	for _, pendingJob := range m.cache.JobsByStage(job.JobStage_PendingApproval) {
+		if now.After(manager.ApprovalExpiry(pendingJob)) {
+			log.Printf("expirePendingApprovals: approval expired: %s", manager.PrintJob(pendingJob))
+			// Failed cancellations are retried in the next iteration
+			if err := m.updateJobStage(manager.CopyJob(pendingJob), job.JobStage_Canceled, manager.Error_ApprovalExpired); err != nil {
+				log.Printf("expirePendingApprovals: failed to cancel job: %v, %s", err, manager.PrintJob(pendingJob))
+			}
+		}
+	}
+}
+
+func (m *JobManager) processJobSchedules(now time.Time) {
+	m.schedulesMu.Lock()
+	defer m.schedulesMu.Unlock()
+	for _, schedule := range m.schedules {
+		lastRun := schedule.LastRun
+		if lastRun.IsZero() {
+			lastRun = m.schedulesStart
+		}
+		if !schedule.NextRun(lastRun).After(now) {
+			if newJob, err := m.NewJob(schedule.NewJob()); err != nil {
+				log.Printf("processJobSchedules: failed to queue scheduled job: %s, %v", schedule.Name, err)
+			} else {
+				log.Printf("processJobSchedules: queued scheduled job: %s, %s", schedule.Name, manager.PrintJob(newJob))
+				// Only fire once for any runs missed in the meantime, e.g. while the manager was busy
+				schedule.LastRun = now
+			}
+		}
+	}
+}
+
+// blockJobs records why dequeued jobs of the specified types (or all types, if none are specified) could not be started
+func (m *JobManager) blockJobs(dequeuedJobs []job.JobState, jobTypes []job.JobType, kind, message string, blockingJobs []job.JobState) {
+	blockingJobIds := make([]string, 0, len(blockingJobs))
+	for _, blockingJob := range blockingJobs {
+		blockingJobIds = append(blockingJobIds, blockingJob.JobId)
+	}
+	for _, dequeuedJob := range dequeuedJobs {
+		if (len(jobTypes) == 0) || slices.Contains(jobTypes, dequeuedJob.Type) {
+			m.pendingBlocks[dequeuedJob.JobId] = append(
+				m.pendingBlocks[dequeuedJob.JobId],
+				manager.BlockReason{Kind: kind, Message: message, BlockingJobIds: blockingJobIds},
+			)
+		}
+	}
+}
+
+// updateBlockedJobs publishes the reasons recorded for jobs that are still waiting to be started at the end of a
+// processing iteration. Jobs without a specific reason are waiting for jobs ahead of them in the queue.
+func (m *JobManager) updateBlockedJobs(dequeuedJobs []job.JobState) {
+	blocked := make([]manager.BlockedJob, 0)
+	aheadJobIds := make([]string, 0)
+	for _, dequeuedJob := range dequeuedJobs {
+		if cachedJob, found := m.cache.JobById(dequeuedJob.JobId); found && (cachedJob.Stage == job.JobStage_Dequeued) {
+			reasons := m.pendingBlocks[dequeuedJob.JobId]
+			if (len(reasons) == 0) && (len(aheadJobIds) > 0) {
+				reasons = []manager.BlockReason{{
+					Kind:           manager.BlockReasonKind_QueuedBehind,
+					Message:        "waiting for jobs ahead in the queue",
+					BlockingJobIds: slices.Clone(aheadJobIds),
+				}}
+			}
+			if len(reasons) > 0 {
+				blocked = append(blocked, manager.BlockedJob{Job: cachedJob, Reasons: reasons})
+			}
+			aheadJobIds = append(aheadJobIds, dequeuedJob.JobId)
+		}
+	}
+	// Jobs waiting for approval are skipped until they are approved or rejected
+	for _, pendingJob := range m.cache.JobsByMatcher(func(js job.JobState) bool {
+		return js.Stage == job.JobStage_PendingApproval
+	}) {
+		approvers, _ := manager.JobApprovers(pendingJob)
+		blocked = append(blocked, manager.BlockedJob{Job: pendingJob, Reasons: []manager.BlockReason{{
+			Kind:    manager.BlockReasonKind_PendingApproval,
+			Message: "waiting for approval from one of: " + strings.Join(approvers, ", "),
+		}}})
+	}
+	m.blockedMu.Lock()
+	defer m.blockedMu.Unlock()
+	m.blocked = blocked
 }
 
 func (m *JobManager) advanceJobs(jobs []job.JobState) {
@@ -261,10 +762,10 @@ func (m *JobManager) processForceDeployJobs(dequeuedJobs []job.JobState) bool {
 }
 
 func (m *JobManager) processDeployJobs(dequeuedJobs []job.JobState) bool {
-	// Check if there are any non-anchor jobs in progress. Deployments can run in parallel with anchor jobs but not with
-	// any other jobs.
-	activeNonAnchorJobs := m.getActiveNonAnchorJobs()
-	if len(activeNonAnchorJobs) == 0 {
+	// Check if there are any blocking jobs in progress. Deployments can run in parallel with anchor jobs but not with
+	// any other jobs that touch the environment.
+	activeBlockingJobs := m.getActiveBlockingJobs()
+	if len(activeBlockingJobs) == 0 {
 		// We know the first job is a deploy, so pick out the component for that job, collapse as many back-to-back jobs
 		// as possible for that component, then run the final job.
 		deployJob := dequeuedJobs[0]
@@ -272,8 +773,9 @@ func (m *JobManager) processDeployJobs(dequeuedJobs []job.JobState) bool {
 		// Collapse similar, back-to-back deployments into a single run and kick it off.
 		for i := 1; i < len(dequeuedJobs); i++ {
 			dequeuedJob := dequeuedJobs[i]
-			// Break out of the loop as soon as we find a test job - we don't want to collapse deploys across them.
-			if (dequeuedJob.Type == job.JobType_TestE2E) || (dequeuedJob.Type == job.JobType_TestSmoke) {
+			// Break out of the loop as soon as we find a job that can't run alongside deployments, e.g. a test - we don't
+			// want to collapse deploys across them.
+			if (dequeuedJob.Type != job.JobType_Deploy) && !m.isIndependent(dequeuedJob) {
 				break
 			} else if (dequeuedJob.Type == job.JobType_Deploy) && (dequeuedJob.Params[job.DeployJobParam_Component].(string) == deployComponent) {
 				// Skip the current deploy job, and replace it with a newer one.
@@ -285,14 +787,54 @@ func (m *JobManager) processDeployJobs(dequeuedJobs []job.JobState) bool {
 				deployJob = dequeuedJob
 			}
 		}
+		// Hold deployments while they are failing across the board
+		if !m.breaker.allow(deployJob) {
+			log.Printf("processDeployJobs: circuit breaker open")
+			m.blockJobs(dequeuedJobs, []job.JobType{job.JobType_Deploy}, manager.BlockReasonKind_CircuitOpen, "deployments are held because too many have failed recently", nil)
+			return false
+		}
 		m.advanceJob(deployJob)
 		return true
 	} else {
 		log.Printf("processDeployJobs: other jobs in progress")
+		m.blockJobs(dequeuedJobs, []job.JobType{job.JobType_Deploy}, manager.BlockReasonKind_JobsInProgress, "deployments cannot run alongside other jobs", activeBlockingJobs)
 	}
 	return false
 }
 
+// cancelSupersededDeployJobs cancels dequeued deployments for which a newer deployment of the same component, but for a
+// different commit, is also waiting to be started, and returns the remaining dequeued jobs. Unlike the collapsing of
+// back-to-back deployments, this applies across other jobs in the queue so that a stale build isn't deployed right
+// before the intended one. Only deployments that haven't been started yet are canceled, and rollbacks never are.
+func (m *JobManager) cancelSupersededDeployJobs(dequeuedJobs []job.JobState) []job.JobState {
+	// Dequeued jobs are ordered by time, so the last deployment seen for a component is the newest one.
+	newestDeploys := make(map[string]job.JobState)
+	for _, dequeuedJob := range dequeuedJobs {
+		if dequeuedJob.Type == job.JobType_Deploy {
+			newestDeploys[dequeuedJob.Params[job.DeployJobParam_Component].(string)] = dequeuedJob
+		}
+	}
+	remainingJobs := make([]job.JobState, 0, len(dequeuedJobs))
+	for _, dequeuedJob := range dequeuedJobs {
+		if dequeuedJob.Type == job.JobType_Deploy {
+			newestDeploy := newestDeploys[dequeuedJob.Params[job.DeployJobParam_Component].(string)]
+			rollback, _ := dequeuedJob.Params[job.DeployJobParam_Rollback].(bool)
+			deployTag, _ := dequeuedJob.Params[job.DeployJobParam_DeployTag].(string)
+			newestDeployTag, _ := newestDeploy.Params[job.DeployJobParam_DeployTag].(string)
+			if !rollback && (dequeuedJob.JobId != newestDeploy.JobId) && (deployTag != newestDeployTag) {
+				log.Printf("cancelSupersededDeployJobs: deploy superseded by %s: %s", newestDeploy.JobId, manager.PrintJob(dequeuedJob))
+				if err := m.updateJobStage(dequeuedJob, job.JobStage_Canceled, manager.Error_Superseded); err != nil {
+					// Keep the job around so that the cancellation can be retried in the next iteration
+					remainingJobs = append(remainingJobs, dequeuedJob)
+				}
+				continue
+			}
+		}
+		remainingJobs = append(remainingJobs, dequeuedJob)
+	}
+	return remainingJobs
+}
+
 func (m *JobManager) processAnchorJobs(dequeuedJobs []job.JobState) bool {
 	return m.processVxAnchorJobs(dequeuedJobs, true) || m.processVxAnchorJobs(dequeuedJobs, false)
 }
@@ -351,53 +893,6 @@ func (m *JobManager) processVxAnchorJobs(dequeuedJobs []job.JobState, processV5J
 	return numJobs > 0
 }
 
-func (m *JobManager) processTestJobs(dequeuedJobs []job.JobState) bool {
-	// Check if there are any deploy jobs in progress
-	if len(m.getActiveDeploys()) == 0 {
-		// - Collapse all smoke tests between deployments into a single run
-		// - Collapse all E2E tests between deployments into a single run
-		dequeuedTests := make(map[job.JobType]job.JobState)
-		for _, dequeuedJob := range dequeuedJobs {
-			// Break out of the loop as soon as we find a deploy job so that we don't collapse test jobs across deploys.
-			if dequeuedJob.Type == job.JobType_Deploy {
-				break
-			} else if (dequeuedJob.Type == job.JobType_TestE2E) || (dequeuedJob.Type == job.JobType_TestSmoke) {
-				// Update the cache and database for every skipped job
-				if jobToSkip, found := dequeuedTests[dequeuedJob.Type]; found {
-					if err := m.updateJobStage(jobToSkip, job.JobStage_Skipped, nil); err != nil {
-						// Return `true` from here so that no state is changed and the loop can restart cleanly. Any
-						// jobs already skipped won't be picked up again, which is ok.
-						return true
-					}
-				}
-				// Replace an existing test job with a newer one, or add a new job (hence a map).
-				dequeuedTests[dequeuedJob.Type] = dequeuedJob
-			}
-		}
-		m.advanceJobs(maps.Values(dequeuedTests))
-		return len(dequeuedTests) > 0
-	} else {
-		log.Printf("processTestJobs: deployment in progress")
-	}
-	return false
-}
-
-func (m *JobManager) processWorkflowJobs(dequeuedJobs []job.JobState) bool {
-	// Check if there are any non-anchor jobs in progress. Workflows can run in parallel with anchor jobs but not with
-	// any other jobs.
-	if len(m.getActiveNonAnchorJobs()) == 0 {
-		for _, dequeuedJob := range dequeuedJobs {
-			if dequeuedJob.Type == job.JobType_Workflow {
-				m.advanceJob(dequeuedJob)
-				return true
-			}
-		}
-	} else {
-		log.Printf("processWorkflowJobs: other jobs in progress")
-	}
-	return false
-}
-
 func (m *JobManager) advanceJob(jobState job.JobState) {
 	m.waitGroup.Add(1)
 	go func() {
@@ -415,40 +910,107 @@ func (m *JobManager) advanceJob(jobState job.JobState) {
 					fmt.Errorf("panic: %s", string(debug.Stack())[:1024]),
 				); err != nil {
 					log.Printf("advanceJob: job update failed after panic: %v, %s", err, manager.PrintJob(jobState))
+					m.notifs.NotifySystem(manager.SystemEvent{
+						Kind:     manager.SystemEventKind_Database,
+						Message:  fmt.Sprintf("failed to update job %s after panic: %v", jobState.JobId, err),
+						Severity: manager.SystemEventSeverity_Critical,
+					})
 				}
 			}
 		}()
 
-		currentJobStage := jobState.Stage
+		prevJobState := manager.CopyJob(jobState)
 		if jobSm, err := m.prepareJobSm(jobState); err != nil {
 			log.Printf("advanceJob: job generation failed: %v, %s", err, manager.PrintJob(jobState))
-		} else if newJobState, err := jobSm.Advance(); err != nil {
+		} else if newJobState, err := m.advanceJobSm(jobState, jobSm); err != nil {
 			// Advancing should automatically update the cache and database in case of failures
 			log.Printf("advanceJob: job advancement failed: %v, %s", err, manager.PrintJob(jobState))
-		} else if newJobState.Stage != currentJobStage {
+		} else if newJobState.Stage != prevJobState.Stage {
 			log.Printf("advanceJob: next job state: %s", manager.PrintJob(newJobState))
 			m.postProcessJob(newJobState)
+		} else if deltas := manager.Diff(
+			[]job.JobState{prevJobState},
+			[]job.JobState{newJobState},
+		); (len(deltas) > 0) && newJobState.Ts.Equal(prevJobState.Ts) {
+			// Jobs that advance send notifications as they do so, but jobs updated in place, e.g. to record progress,
+			// don't, so send notifications for them here.
+			m.notifs.NotifyJob(newJobState)
 		}
 	}()
 }
 
+// advanceJobSm advances a job, recording the decision made if the decision log is enabled
+func (m *JobManager) advanceJobSm(jobState job.JobState, jobSm manager.JobSm) (job.JobState, error) {
+	m.decisions.Begin(jobState)
+	newJobState, err := jobSm.Advance()
+	nextStage := newJobState.Stage
+	if err != nil {
+		// Advancing should have updated the job in case of failures, so record the stage it ended up in
+		if cachedJob, found := m.cache.JobById(jobState.JobId); found {
+			nextStage = cachedJob.Stage
+		}
+	}
+	m.decisions.End(jobState.JobId, nextStage, err)
+	return newJobState, err
+}
+
 func (m *JobManager) postProcessJob(jobState job.JobState) {
 	switch jobState.Type {
 	case job.JobType_Deploy:
 		{
+			if event := m.breaker.recordOutcome(jobState); event != nil {
+				m.notifs.NotifySystem(*event)
+			}
 			switch jobState.Stage {
 			// For completed ECS deployments, run smoke tests after 5 minutes to give the services time to stabilize.
 			case job.JobStage_Completed:
 				{
-					if _, err := m.NewJob(job.JobState{
-						Ts:   time.Now().Add(manager.DefaultWaitTime),
-						Type: job.JobType_TestSmoke,
-						Params: map[string]interface{}{
-							job.JobParam_Source: manager.ServiceName,
-						},
+					smokeTestParams := map[string]interface{}{
+						job.JobParam_Source: manager.ServiceName,
+					}
+					// Optionally only run the tests relevant to the component that was deployed
+					if selectByComponent, _ := strconv.ParseBool(os.Getenv("SMOKE_TEST_COMPONENT_SELECTION")); selectByComponent {
+						if component, found := jobState.Params[job.DeployJobParam_Component].(string); found {
+							smokeTestParams[job.SmokeTestJobParam_Component] = component
+						}
+					}
+					if skipTests, _ := jobState.Params[job.JobParam_SkipTests].(bool); skipTests {
+						log.Printf("postProcessJob: skipping tests after deploy: %s", manager.PrintJob(jobState))
+					} else if _, err := m.NewJob(job.JobState{
+						Ts:       time.Now().Add(manager.DefaultWaitTime),
+						Type:     job.JobType_TestSmoke,
+						Params:   smokeTestParams,
+						ParentId: jobState.JobId,
 					}); err != nil {
 						log.Printf("postProcessJob: failed to queue smoke tests after deploy: %v, %s", err, manager.PrintJob(jobState))
 					}
+					// Verify the health of the deployment's endpoints, if requested
+					if healthGateParams, found := jobState.Params[job.DeployJobParam_HealthGate].(map[string]interface{}); found {
+						params := make(map[string]interface{}, len(healthGateParams)+1)
+						for k, v := range healthGateParams {
+							params[k] = v
+						}
+						params[job.JobParam_Source] = manager.ServiceName
+						if _, err := m.NewJob(job.JobState{
+							Type:     job.JobType_HealthGate,
+							Params:   params,
+							ParentId: jobState.JobId,
+						}); err != nil {
+							log.Printf("postProcessJob: failed to queue health gate after deploy: %v, %s", err, manager.PrintJob(jobState))
+						}
+					}
+					// Invalidate CDN caches after Ceramic deployments, if configured, so that stale content isn't served
+					if component, _ := jobState.Params[job.DeployJobParam_Component].(string); (manager.DeployComponent(component) == manager.DeployComponent_Ceramic) && (len(os.Getenv("CLOUDFRONT_DISTRIBUTION_ID")) > 0) {
+						if _, err := m.NewJob(job.JobState{
+							Type: job.JobType_CacheInvalidation,
+							Params: map[string]interface{}{
+								job.JobParam_Source: manager.ServiceName,
+							},
+							ParentId: jobState.JobId,
+						}); err != nil {
+							log.Printf("postProcessJob: failed to queue cache invalidation after deploy: %v, %s", err, manager.PrintJob(jobState))
+						}
+					}
 				}
 			// For failed deployments, rollback to the previously deployed tag.
 			case job.JobStage_Failed:
@@ -457,13 +1019,12 @@ func (m *JobManager) postProcessJob(jobState job.JobState) {
 					if rollback, _ := jobState.Params[job.DeployJobParam_Rollback].(bool); !rollback {
 						if component, found := jobState.Params[job.DeployJobParam_Component].(string); !found {
 							log.Printf("postProcessJob: missing component (ceramic, ipfs, cas, casv5, rust-ceramic): %s", manager.PrintJob(jobState))
-						} else if deployTags, err := m.db.GetDeployTags(); err != nil { // Get latest deployed tag from database
-							log.Printf("postProcessJob: failed to retrieve deploy tags: %v, %s", err, manager.PrintJob(jobState))
-						} else if deployTag, found := deployTags[manager.DeployComponent(component)]; !found {
+						} else if deployTag, err := m.db.GetDeployTagByComponent(manager.DeployComponent(component)); err != nil { // Get latest deployed tag from database
+							log.Printf("postProcessJob: failed to retrieve deploy tag: %v, %s", err, manager.PrintJob(jobState))
+						} else if len(deployTag) == 0 {
 							log.Printf("postProcessJob: missing component build tag: %s, %s", component, manager.PrintJob(jobState))
-						} else if _, err := m.NewJob(job.JobState{
-							Type: job.JobType_Deploy,
-							Params: map[string]interface{}{
+						} else {
+							rollbackParams := map[string]interface{}{
 								job.DeployJobParam_Component: jobState.Params[job.DeployJobParam_Component],
 								job.DeployJobParam_Rollback:  true,
 								job.DeployJobParam_Sha:       job.DeployJobTarget_Rollback,
@@ -471,37 +1032,110 @@ func (m *JobManager) postProcessJob(jobState job.JobState) {
 								// No point in waiting for other jobs to complete before redeploying a working image
 								job.DeployJobParam_Force: true,
 								job.JobParam_Source:      manager.ServiceName,
-							},
-						}); err != nil {
-							log.Printf("postProcessJob: failed to queue rollback after failed deploy: %v, %s", err, manager.PrintJob(jobState))
+							}
+							// For staggered multi-region deployments, only rollback the regions that were touched
+							if regionProgress, found := jobState.Params[job.DeployJobParam_RegionProgress].(map[string]interface{}); found {
+								rollbackRegions := m.rollbackRegions(jobState, regionProgress)
+								if len(rollbackRegions) == 0 {
+									log.Printf("postProcessJob: no regions to rollback: %s", manager.PrintJob(jobState))
+									return
+								}
+								rollbackParams[job.DeployJobParam_Regions] = rollbackRegions
+							}
+							if _, err := m.NewJob(job.JobState{
+								Type:     job.JobType_Deploy,
+								Params:   rollbackParams,
+								ParentId: jobState.JobId,
+							}); err != nil {
+								log.Printf("postProcessJob: failed to queue rollback after failed deploy: %v, %s", err, manager.PrintJob(jobState))
+							}
 						}
 					}
 				}
 			}
 		}
+	case job.JobType_DockerBuild:
+		{
+			// Deploy the image that was just built, if requested, using its digest so that exactly that image is
+			// deployed.
+			if deploy, _ := jobState.Params[job.DockerBuildJobParam_Deploy].(bool); deploy && (jobState.Stage == job.JobStage_Completed) {
+				sha, _ := jobState.Params[job.DockerBuildJobParam_Sha].(string)
+				if _, err := m.NewJob(job.JobState{
+					Type: job.JobType_Deploy,
+					Params: map[string]interface{}{
+						job.DeployJobParam_Component: jobState.Params[job.DockerBuildJobParam_Component],
+						job.DeployJobParam_Sha:       sha,
+						job.DeployJobParam_ShaTag:    sha,
+						job.JobParam_ImageDigests:    jobState.Params[job.JobParam_ImageDigests],
+						job.JobParam_Source:          manager.ServiceName,
+					},
+					ParentId: jobState.JobId,
+				}); err != nil {
+					log.Printf("postProcessJob: failed to queue deploy after image build: %v, %s", err, manager.PrintJob(jobState))
+				}
+			}
+		}
+	case job.JobType_SloCheck:
+		{
+			// Deploy once the check passes, if requested. Failed checks block the deployment.
+			if deployParams, found := jobState.Params[job.SloCheckJobParam_Deploy].(map[string]interface{}); found && (jobState.Stage == job.JobStage_Completed) {
+				params := make(map[string]interface{}, len(deployParams)+1)
+				for k, v := range deployParams {
+					params[k] = v
+				}
+				params[job.JobParam_Source] = manager.ServiceName
+				if _, err := m.NewJob(job.JobState{
+					Type:     job.JobType_Deploy,
+					Params:   params,
+					ParentId: jobState.JobId,
+				}); err != nil {
+					log.Printf("postProcessJob: failed to queue deploy after slo check: %v, %s", err, manager.PrintJob(jobState))
+				}
+			}
+		}
+	}
+}
+
+// rollbackRegions returns the regions to rollback after a failed multi-region deployment, most recently deployed first.
+// The region that failed is always rolled back, while regions that had already been deployed are only rolled back if
+// configured.
+func (m *JobManager) rollbackRegions(jobState job.JobState, regionProgress map[string]interface{}) []interface{} {
+	rollbackCompleted, _ := strconv.ParseBool(os.Getenv("DEPLOY_REGION_ROLLBACK"))
+	rollbackRegions := make([]interface{}, 0)
+	if regions, found := jobState.Params[job.DeployJobParam_Regions].([]interface{}); found {
+		for i := len(regions) - 1; i >= 0; i-- {
+			if region, ok := regions[i].(string); ok {
+				switch regionProgress[region] {
+				case job.DeployRegionStatus_Pending:
+				case job.DeployRegionStatus_Deployed, job.DeployRegionStatus_Baking:
+					if rollbackCompleted {
+						rollbackRegions = append(rollbackRegions, region)
+					}
+				default:
+					rollbackRegions = append(rollbackRegions, region)
+				}
+			}
+		}
 	}
+	return rollbackRegions
 }
 
 func (m *JobManager) prepareJobSm(jobState job.JobState) (manager.JobSm, error) {
 	var jobSm manager.JobSm
 	var err error = nil
-	switch jobState.Type {
-	case job.JobType_Deploy:
-		jobSm, err = jobs.DeployJob(jobState, m.db, m.notifs, m.d, m.repo)
-	case job.JobType_Anchor:
-		jobSm = jobs.AnchorJob(jobState, m.db, m.notifs, m.d)
-	case job.JobType_TestE2E:
-		jobSm = jobs.E2eTestJob(jobState, m.db, m.notifs, m.d)
-	case job.JobType_TestSmoke:
-		jobSm = jobs.SmokeTestJob(jobState, m.db, m.notifs, m.d)
-	case job.JobType_Workflow:
-		jobSm, err = jobs.GitHubWorkflowJob(jobState, m.db, m.notifs, m.repo)
-	default:
+	if jt, found := m.lookupJobType(jobState.Type); found {
+		jobSm, err = jt.newJobSm(m, jobState)
+	} else {
 		err = fmt.Errorf("prepareJobSm: unknown job type: %s", manager.PrintJob(jobState))
 	}
 	if err != nil {
 		if err := m.updateJobStage(jobState, job.JobStage_Failed, err); err != nil {
 			log.Printf("prepareJobSm: job update failed: %v, %s", err, manager.PrintJob(jobState))
+			m.notifs.NotifySystem(manager.SystemEvent{
+				Kind:     manager.SystemEventKind_Database,
+				Message:  fmt.Sprintf("failed to update job %s: %v", jobState.JobId, err),
+				Severity: manager.SystemEventSeverity_Critical,
+			})
 		}
 	}
 	return jobSm, err
@@ -528,8 +1162,9 @@ func (m *JobManager) getActiveDeploys() []job.JobState {
 	})
 }
 
-func (m *JobManager) getActiveNonAnchorJobs() []job.JobState {
+// getActiveBlockingJobs returns the jobs in progress that block deployments and other jobs that can't run alongside them
+func (m *JobManager) getActiveBlockingJobs() []job.JobState {
 	return m.cache.JobsByMatcher(func(js job.JobState) bool {
-		return job.IsActiveJob(js) && (js.Type != job.JobType_Anchor)
+		return job.IsActiveJob(js) && m.isBlocking(js)
 	})
 }
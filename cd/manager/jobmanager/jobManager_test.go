@@ -0,0 +1,112 @@
+package jobmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// testDb only implements the database operations used to advance jobs
+type testDb struct {
+	manager.Database
+	advanced []job.JobState
+}
+
+func (db *testDb) AdvanceJob(jobState job.JobState) error {
+	db.advanced = append(db.advanced, jobState)
+	return nil
+}
+
+// testNotifs only records the job notifications that were sent
+type testNotifs struct {
+	manager.Notifs
+	notified []job.JobState
+}
+
+func (n *testNotifs) NotifyJob(jobs ...job.JobState) {
+	n.notified = append(n.notified, jobs...)
+}
+
+func newTestJobManager() (*JobManager, *testDb, *testNotifs) {
+	db := new(testDb)
+	notifs := new(testNotifs)
+	return &JobManager{
+		cache:     common.NewJobCache(),
+		db:        db,
+		notifs:    notifs,
+		env:       manager.EnvType_Dev,
+		decisions: manager.NewDecisionLog(),
+		clock:     manager.SystemClock{},
+	}, db, notifs
+}
+
+func testDeployJob(jobId string, component manager.DeployComponent, deployTag string, ts time.Time) job.JobState {
+	return job.JobState{JobId: jobId, Type: job.JobType_Deploy, Stage: job.JobStage_Dequeued, Ts: ts, Params: map[string]interface{}{
+		job.DeployJobParam_Component: string(component),
+		job.DeployJobParam_DeployTag: deployTag,
+	}}
+}
+
+func jobIds(jobs []job.JobState) []string {
+	ids := make([]string, len(jobs))
+	for i, jobState := range jobs {
+		ids[i] = jobState.JobId
+	}
+	return ids
+}
+
+func TestCancelSupersededDeployJobs(t *testing.T) {
+	m, db, notifs := newTestJobManager()
+	now := time.Now()
+	dequeuedJobs := []job.JobState{
+		testDeployJob("older", manager.DeployComponent_Ceramic, "sha1", now.Add(-3*time.Minute)),
+		{JobId: "anchor", Type: job.JobType_Anchor, Stage: job.JobStage_Dequeued, Ts: now.Add(-2 * time.Minute)},
+		testDeployJob("other", manager.DeployComponent_Cas, "sha3", now.Add(-time.Minute)),
+		testDeployJob("newer", manager.DeployComponent_Ceramic, "sha2", now),
+	}
+	remainingJobs := m.cancelSupersededDeployJobs(dequeuedJobs)
+	if ids := jobIds(remainingJobs); (len(ids) != 3) || (ids[0] != "anchor") || (ids[1] != "other") || (ids[2] != "newer") {
+		t.Fatalf("unexpected remaining jobs: %v", ids)
+	}
+	if len(db.advanced) != 1 {
+		t.Fatalf("expected 1 job to be canceled, got %d", len(db.advanced))
+	} else if canceled := db.advanced[0]; (canceled.JobId != "older") || (canceled.Stage != job.JobStage_Canceled) {
+		t.Fatalf("unexpected canceled job: %s", manager.PrintJob(canceled))
+	} else if canceled.Params[job.JobParam_Error] != manager.Error_Superseded.Error() {
+		t.Fatalf("unexpected cancellation reason: %v", canceled.Params[job.JobParam_Error])
+	}
+	if (len(notifs.notified) != 1) || (notifs.notified[0].Stage != job.JobStage_Canceled) {
+		t.Fatalf("expected a notification for the canceled job, got %v", jobIds(notifs.notified))
+	}
+}
+
+func TestCancelSupersededDeployJobsKeepsRollbacksAndSameTarget(t *testing.T) {
+	m, db, _ := newTestJobManager()
+	now := time.Now()
+	rollback := testDeployJob("rollback", manager.DeployComponent_Ceramic, "sha0", now.Add(-2*time.Minute))
+	rollback.Params[job.DeployJobParam_Rollback] = true
+	dequeuedJobs := []job.JobState{
+		rollback,
+		testDeployJob("same", manager.DeployComponent_Ceramic, "sha1", now.Add(-time.Minute)),
+		testDeployJob("newer", manager.DeployComponent_Ceramic, "sha1", now),
+	}
+	if remainingJobs := m.cancelSupersededDeployJobs(dequeuedJobs); len(remainingJobs) != 3 {
+		t.Fatalf("expected no jobs to be canceled, got %v", jobIds(remainingJobs))
+	} else if len(db.advanced) != 0 {
+		t.Fatalf("unexpected job updates: %v", jobIds(db.advanced))
+	}
+}
+
+func TestNewJobInvalidVersion(t *testing.T) {
+	m, _, _ := newTestJobManager()
+	for _, version := range []interface{}{"", "  ", 2.14} {
+		jobState := testDeployJob("deploy", manager.DeployComponent_Ceramic, "sha1", time.Now())
+		jobState.Params[job.DeployJobParam_Version] = version
+		if _, err := m.NewJob(jobState); err == nil {
+			t.Fatalf("expected an invalid version to be rejected before the job is queued: %v", version)
+		}
+	}
+}
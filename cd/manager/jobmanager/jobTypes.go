@@ -0,0 +1,317 @@
+package jobmanager
+
+import (
+	"log"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+	"github.com/3box/pipeline-tools/cd/manager/jobs"
+)
+
+// jobType describes how jobs of a particular type are created and scheduled relative to other jobs
+type jobType struct {
+	jobType  job.JobType
+	newJobSm func(m *JobManager, jobState job.JobState) (manager.JobSm, error)
+	// Active jobs that block deployments and other jobs that can't run alongside them
+	blocking bool
+	// Jobs that are started whether or not a deployment was started in the same iteration
+	independent bool
+	// Starts dequeued jobs of this type, returning true if any were started. Deployments are started separately since
+	// they decide whether any other dependent jobs can start.
+	process func(m *JobManager, dequeuedJobs []job.JobState) bool
+}
+
+// newJobTypes lists every type of job the manager can run, in the order in which dequeued jobs are started:
+//   - one deploy at a time (compatible with anchor jobs)
+//   - one smoke test at a time (compatible with non-deploy jobs)
+//   - one E2E test at a time (compatible with non-deploy jobs)
+//   - one workflow at a time (compatible with anchor jobs)
+//   - one backup per resource at a time (compatible with non-deploy jobs)
+//   - any number of generic tasks (compatible with non-deploy jobs)
+//   - one bootstrap at a time (compatible with anchor jobs)
+//   - one environment provisioning at a time (compatible with anchor jobs, and its own child jobs)
+//   - one secrets rotation at a time (compatible with anchor jobs)
+//   - any number of anchor workers (compatible with any other type of job)
+//   - any number of image builds (compatible with any other type of job)
+//   - one Terraform plan at a time (compatible with any other type of job)
+//   - any number of cache invalidations (compatible with any other type of job)
+//   - any number of SLO checks (compatible with any other type of job)
+//   - any number of health gates (compatible with any other type of job)
+//   - any number of reports (compatible with any other type of job)
+func newJobTypes() []jobType {
+	return []jobType{
+		{
+			jobType: job.JobType_Deploy,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.DeployJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d, m.repo, m.regionDeploys)
+			},
+			blocking: true,
+		},
+		{
+			jobType: job.JobType_TestSmoke,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.SmokeTestJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d), nil
+			},
+			blocking: true,
+			// Collapse all smoke tests between deployments into a single run
+			process: betweenDeploys(job.JobType_TestSmoke, "tests cannot run during deployments", collapseAll),
+		},
+		{
+			jobType: job.JobType_TestE2E,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.E2eTestJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d), nil
+			},
+			blocking: true,
+			// Collapse all E2E tests between deployments into a single run
+			process: betweenDeploys(job.JobType_TestE2E, "tests cannot run during deployments", collapseAll),
+		},
+		{
+			jobType: job.JobType_Workflow,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.GitHubWorkflowJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.repo)
+			},
+			blocking: true,
+			process:  exclusive(job.JobType_Workflow, "workflows cannot run alongside other jobs"),
+		},
+		{
+			jobType: job.JobType_DataBackup,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.DataBackupJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.b)
+			},
+			blocking: true,
+			// Collapse all backups of the same resource between deployments into a single run
+			process: betweenDeploys(job.JobType_DataBackup, "backups cannot run during deployments", func(jobState job.JobState) (string, bool) {
+				resourceArn, _ := jobState.Params[job.DataBackupJobParam_ResourceArn].(string)
+				return resourceArn, true
+			}),
+		},
+		{
+			jobType: job.JobType_Task,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.TaskJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d)
+			},
+			blocking: true,
+			process:  betweenDeploys(job.JobType_Task, "tasks cannot run during deployments", collapseNone),
+		},
+		{
+			jobType: job.JobType_Bootstrap,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.BootstrapJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d)
+			},
+			blocking: true,
+			// Other jobs might depend on the services being created
+			process: exclusive(job.JobType_Bootstrap, "bootstrapping cannot run alongside other jobs"),
+		},
+		{
+			jobType: job.JobType_EnvBootstrap,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.EnvBootstrapJob(jobState, m.db, m.notifs, m.decisions, m.clock)
+			},
+			// Environment provisioning only coordinates child jobs, which are scheduled like any other job, so it doesn't
+			// block other jobs, which would include its own child jobs. It should still not start while other jobs are in
+			// progress.
+			process: exclusive(job.JobType_EnvBootstrap, "environment provisioning cannot start alongside other jobs"),
+		},
+		{
+			jobType: job.JobType_SecretsRotation,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.SecretsRotationJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d, m.s)
+			},
+			blocking: true,
+			// Secrets rotations restart services
+			process: exclusive(job.JobType_SecretsRotation, "secrets rotations cannot run alongside other jobs"),
+		},
+		{
+			jobType: job.JobType_Anchor,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.AnchorJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d), nil
+			},
+			independent: true,
+			process: func(m *JobManager, dequeuedJobs []job.JobState) bool {
+				return m.processAnchorJobs(dequeuedJobs)
+			},
+		},
+		{
+			jobType: job.JobType_DockerBuild,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.DockerBuildJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d, m.repo)
+			},
+			independent: true,
+			// Images are built outside the environment
+			process: anyNumber(job.JobType_DockerBuild),
+		},
+		{
+			jobType: job.JobType_TerraformPlan,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.TerraformPlanJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.d)
+			},
+			independent: true,
+			// Plans are read-only, but only one plan can hold the Terraform state lock at a time
+			process: oneAtATime(job.JobType_TerraformPlan, "only one terraform plan can run at a time"),
+		},
+		{
+			jobType: job.JobType_CacheInvalidation,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.CacheInvalidationJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.cdn)
+			},
+			independent: true,
+			// Invalidations only touch CDN caches
+			process: anyNumber(job.JobType_CacheInvalidation),
+		},
+		{
+			jobType: job.JobType_SloCheck,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.SloCheckJob(jobState, m.db, m.notifs, m.decisions, m.clock, m.metrics)
+			},
+			independent: true,
+			// SLO checks only query metrics
+			process: anyNumber(job.JobType_SloCheck),
+		},
+		{
+			jobType: job.JobType_HealthGate,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.HealthGateJob(jobState, m.db, m.notifs, m.decisions, m.clock)
+			},
+			independent: true,
+			// Health gates only make HTTP requests to the endpoints being checked
+			process: anyNumber(job.JobType_HealthGate),
+		},
+		{
+			jobType: job.JobType_Notification,
+			newJobSm: func(m *JobManager, jobState job.JobState) (manager.JobSm, error) {
+				return jobs.NotificationJob(jobState, m.db, m.notifs, m.decisions, m.clock)
+			},
+			independent: true,
+			// Reports only read past jobs from the database
+			process: anyNumber(job.JobType_Notification),
+		},
+	}
+}
+
+// lookupJobType returns how jobs of a particular type are created and scheduled
+func (m *JobManager) lookupJobType(t job.JobType) (jobType, bool) {
+	for _, jt := range m.jobTypes {
+		if jt.jobType == t {
+			return jt, true
+		}
+	}
+	return jobType{}, false
+}
+
+// isBlocking returns true for jobs that block deployments and other jobs that can't run alongside them. Jobs of unknown
+// types are treated as blocking.
+func (m *JobManager) isBlocking(jobState job.JobState) bool {
+	if jt, found := m.lookupJobType(jobState.Type); found {
+		return jt.blocking
+	}
+	return true
+}
+
+// isIndependent returns true for jobs that are started whether or not a deployment was started
+func (m *JobManager) isIndependent(jobState job.JobState) bool {
+	jt, _ := m.lookupJobType(jobState.Type)
+	return jt.independent
+}
+
+// collapseAll collapses all jobs of a type into a single run
+func collapseAll(job.JobState) (string, bool) {
+	return "", true
+}
+
+// collapseNone runs every job of a type
+func collapseNone(job.JobState) (string, bool) {
+	return "", false
+}
+
+// betweenDeploys starts dequeued jobs that can't run during deployments, as long as no deployments are in progress. Jobs
+// are only started up to the next queued deployment so that they complete before it starts. Jobs for which the collapse
+// function returns the same key are collapsed into the newest one, and the others are skipped.
+func betweenDeploys(jobType job.JobType, blockMessage string, collapse func(job.JobState) (string, bool)) func(*JobManager, []job.JobState) bool {
+	return func(m *JobManager, dequeuedJobs []job.JobState) bool {
+		if activeDeploys := m.getActiveDeploys(); len(activeDeploys) > 0 {
+			log.Printf("processJobs: deployment in progress: %s", jobType)
+			m.blockJobs(dequeuedJobs, []job.JobType{jobType}, manager.BlockReasonKind_DeployInProgress, blockMessage, activeDeploys)
+			return false
+		}
+		collapsedJobs := make(map[string]job.JobState)
+		jobsToStart := make([]job.JobState, 0)
+		for _, dequeuedJob := range dequeuedJobs {
+			// Break out of the loop as soon as we find a deploy job so that we don't collapse jobs across deploys
+			if dequeuedJob.Type == job.JobType_Deploy {
+				break
+			} else if dequeuedJob.Type == jobType {
+				if key, found := collapse(dequeuedJob); !found {
+					jobsToStart = append(jobsToStart, dequeuedJob)
+				} else {
+					// Update the cache and database for every skipped job
+					if jobToSkip, found := collapsedJobs[key]; found {
+						if err := m.updateJobStage(jobToSkip, job.JobStage_Skipped, nil); err != nil {
+							// Return `true` from here so that no state is changed and the loop can restart cleanly. Any
+							// jobs already skipped won't be picked up again, which is ok.
+							return true
+						}
+					}
+					// Replace an existing job with a newer one, or add a new job (hence a map).
+					collapsedJobs[key] = dequeuedJob
+				}
+			}
+		}
+		jobsToStart = append(jobsToStart, maps.Values(collapsedJobs)...)
+		m.advanceJobs(jobsToStart)
+		return len(jobsToStart) > 0
+	}
+}
+
+// exclusive starts the first dequeued job of a type, as long as no other blocking jobs are in progress
+func exclusive(jobType job.JobType, blockMessage string) func(*JobManager, []job.JobState) bool {
+	return func(m *JobManager, dequeuedJobs []job.JobState) bool {
+		if activeJobs := m.getActiveBlockingJobs(); len(activeJobs) > 0 {
+			log.Printf("processJobs: other jobs in progress: %s", jobType)
+			m.blockJobs(dequeuedJobs, []job.JobType{jobType}, manager.BlockReasonKind_JobsInProgress, blockMessage, activeJobs)
+			return false
+		}
+		for _, dequeuedJob := range dequeuedJobs {
+			if dequeuedJob.Type == jobType {
+				m.advanceJob(dequeuedJob)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// oneAtATime starts the first dequeued job of a type, as long as no other job of the same type is in progress
+func oneAtATime(jobType job.JobType, blockMessage string) func(*JobManager, []job.JobState) bool {
+	return func(m *JobManager, dequeuedJobs []job.JobState) bool {
+		activeJobs := m.cache.JobsByMatcher(func(js job.JobState) bool {
+			return job.IsActiveJob(js) && (js.Type == jobType)
+		})
+		if len(activeJobs) > 0 {
+			m.blockJobs(dequeuedJobs, []job.JobType{jobType}, manager.BlockReasonKind_JobsInProgress, blockMessage, activeJobs)
+			return false
+		}
+		for _, dequeuedJob := range dequeuedJobs {
+			if dequeuedJob.Type == jobType {
+				m.advanceJob(dequeuedJob)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// anyNumber starts all dequeued jobs of a type, for jobs that don't interfere with any other jobs
+func anyNumber(jobType job.JobType) func(*JobManager, []job.JobState) bool {
+	return func(m *JobManager, dequeuedJobs []job.JobState) bool {
+		jobsToStart := make([]job.JobState, 0)
+		for _, dequeuedJob := range dequeuedJobs {
+			if dequeuedJob.Type == jobType {
+				jobsToStart = append(jobsToStart, dequeuedJob)
+			}
+		}
+		m.advanceJobs(jobsToStart)
+		return len(jobsToStart) > 0
+	}
+}
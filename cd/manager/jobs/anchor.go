@@ -20,12 +20,12 @@ type anchorJob struct {
 	d   manager.Deployment
 }
 
-func AnchorJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, d manager.Deployment) manager.JobSm {
-	return &anchorJob{baseJob{jobState, db, notifs}, os.Getenv(manager.EnvVar_Env), d}
+func AnchorJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) manager.JobSm {
+	return &anchorJob{baseJob{jobState, db, notifs, decisions, clock}, os.Getenv(manager.EnvVar_Env), d}
 }
 
 func (a anchorJob) Advance() (job.JobState, error) {
-	now := time.Now()
+	now := a.clock.Now()
 	switch a.state.Stage {
 	case job.JobStage_Queued:
 		{
@@ -42,7 +42,7 @@ func (a anchorJob) Advance() (job.JobState, error) {
 			} else {
 				// Record the worker task identifier and its start time
 				a.state.Params[job.JobParam_Id] = taskId
-				a.state.Params[job.JobParam_Start] = float64(time.Now().UnixNano())
+				a.state.Params[job.JobParam_Start] = float64(now.UnixNano())
 				return a.advance(job.JobStage_Started, now, nil)
 			}
 		}
@@ -63,11 +63,11 @@ func (a anchorJob) Advance() (job.JobState, error) {
 				return a.advance(job.JobStage_Failed, now, err)
 			} else if stopped {
 				return a.advance(job.JobStage_Completed, now, nil)
-			} else if delayed, _ := a.state.Params[job.AnchorJobParam_Delayed].(bool); !delayed && job.IsTimedOut(a.state, AnchorStalledTime/2) {
+			} else if delayed, _ := a.state.Params[job.AnchorJobParam_Delayed].(bool); !delayed && a.isTimedOut(AnchorStalledTime/2) {
 				// If the job has been running for > 1.5 hours, mark it "delayed".
 				a.state.Params[job.AnchorJobParam_Delayed] = true
 				return a.advance(job.JobStage_Waiting, now, nil)
-			} else if stalled, _ := a.state.Params[job.AnchorJobParam_Stalled].(bool); !stalled && job.IsTimedOut(a.state, AnchorStalledTime) {
+			} else if stalled, _ := a.state.Params[job.AnchorJobParam_Stalled].(bool); !stalled && a.isTimedOut(AnchorStalledTime) {
 				// If the job has been running for > 3 hours, mark it "stalled".
 				a.state.Params[job.AnchorJobParam_Stalled] = true
 				return a.advance(job.JobStage_Waiting, now, nil)
@@ -94,11 +94,19 @@ func (a anchorJob) launchWorker() (string, error) {
 			}
 		}
 	}
+	networkOverride, err := manager.NetworkOverride(a.state)
+	if err != nil {
+		return "", err
+	}
+	if overrides, err = manager.TaskOverrides(a.state, overrides); err != nil {
+		return "", err
+	}
 	if taskId, err := a.d.LaunchTask(
 		"ceramic-"+a.env+"-cas",
 		"ceramic-"+a.env+"-cas-anchor",
 		"cas_anchor",
 		"/ceramic-"+a.env+"-cas/anchor_network_configuration",
+		networkOverride,
 		overrides); err != nil {
 		return "", err
 	} else {
@@ -107,7 +115,9 @@ func (a anchorJob) launchWorker() (string, error) {
 }
 
 func (a anchorJob) checkWorker(expectedToBeRunning bool) (bool, error) {
-	if status, exitCode, err := a.d.CheckTask("ceramic-"+a.env+"-cas", "", expectedToBeRunning, false, a.state.Params[job.JobParam_Id].(string)); err != nil {
+	status, exitCode, err := a.d.CheckTask("ceramic-"+a.env+"-cas", "", expectedToBeRunning, false, a.state.Params[job.JobParam_Id].(string))
+	a.recordCheck(manager.DecisionCheck_WorkerInExpectedState, status)
+	if err != nil {
 		return false, err
 	} else if status {
 		// If a non-zero exit code was present, the worker failed to complete successfully.
@@ -115,7 +125,7 @@ func (a anchorJob) checkWorker(expectedToBeRunning bool) (bool, error) {
 			return false, fmt.Errorf("anchorJob: worker exited with code %d", *exitCode)
 		}
 		return true, nil
-	} else if expectedToBeRunning && job.IsTimedOut(a.state, manager.DefaultWaitTime) { // Worker did not start in time
+	} else if expectedToBeRunning && a.isTimedOut(manager.DefaultWaitTime) { // Worker did not start in time
 		return false, manager.Error_StartupTimeout
 	} else {
 		return false, nil
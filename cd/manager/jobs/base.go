@@ -8,11 +8,24 @@ import (
 )
 
 type baseJob struct {
-	state  job.JobState
-	db     manager.Database
-	notifs manager.Notifs
+	state     job.JobState
+	db        manager.Database
+	notifs    manager.Notifs
+	decisions *manager.DecisionLog
+	clock     manager.Clock
 }
 
 func (b baseJob) advance(jobStage job.JobStage, ts time.Time, err error) (job.JobState, error) {
+	checkTransition(b.state, jobStage)
 	return manager.AdvanceJob(b.state, jobStage, ts, err, b.db, b.notifs)
 }
+
+// recordCheck records a check made while advancing the job, if the decision log is enabled
+func (b baseJob) recordCheck(name string, result interface{}) {
+	b.decisions.RecordCheck(b.state, name, result)
+}
+
+// isTimedOut returns true if the job has timed out according to the job's clock
+func (b baseJob) isTimedOut(delay time.Duration) bool {
+	return job.IsTimedOutAt(b.state, delay, b.clock.Now())
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ manager.JobSm = &bootstrapJob{}
+
+// bootstrapJob creates the services for a new environment so that deployments can be run against it
+type bootstrapJob struct {
+	baseJob
+	cluster  string
+	services []manager.ServiceSpec
+	d        manager.Deployment
+}
+
+func BootstrapJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) (manager.JobSm, error) {
+	if cluster, found := jobState.Params[job.BootstrapJobParam_Cluster].(string); !found || (len(cluster) == 0) {
+		return nil, fmt.Errorf("bootstrapJob: missing cluster")
+	} else if paramServices, found := jobState.Params[job.BootstrapJobParam_Services]; !found {
+		return nil, fmt.Errorf("bootstrapJob: missing services")
+	} else {
+		var services []manager.ServiceSpec
+		if err := mapstructure.Decode(paramServices, &services); err != nil {
+			return nil, fmt.Errorf("bootstrapJob: invalid services: %w", err)
+		} else if len(services) == 0 {
+			return nil, fmt.Errorf("bootstrapJob: missing services")
+		}
+		for _, service := range services {
+			if (len(service.Name) == 0) || (len(service.TaskDefinition) == 0) || (len(service.NetworkConfigParam) == 0) {
+				return nil, fmt.Errorf("bootstrapJob: incomplete service spec: %+v", service)
+			}
+		}
+		return &bootstrapJob{baseJob{jobState, db, notifs, decisions, clock}, cluster, services, d}, nil
+	}
+}
+
+func (b bootstrapJob) Advance() (job.JobState, error) {
+	now := b.clock.Now()
+	switch b.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return b.advance(job.JobStage_Dequeued, b.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			if err := b.createServices(); err != nil {
+				return b.advance(job.JobStage_Failed, now, err)
+			} else {
+				b.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				return b.advance(job.JobStage_Started, now, nil)
+			}
+		}
+	case job.JobStage_Started:
+		{
+			if created, err := b.checkServices(); err != nil {
+				return b.advance(job.JobStage_Failed, now, err)
+			} else if created {
+				return b.advance(job.JobStage_Completed, now, nil)
+			} else if b.isTimedOut(manager.DefaultWaitTime) {
+				return b.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			} else {
+				// Return so we come back again to check
+				return b.state, nil
+			}
+		}
+	default:
+		{
+			return b.advance(job.JobStage_Failed, now, fmt.Errorf("bootstrapJob: unexpected state: %s", manager.PrintJob(b.state)))
+		}
+	}
+}
+
+func (b bootstrapJob) createServices() error {
+	for _, service := range b.services {
+		// Skip services that already exist so that bootstrapping can be safely rerun after a partial failure
+		if exists, err := b.d.CheckServiceExists(b.cluster, service.Name); err != nil {
+			return err
+		} else if !exists {
+			if err = b.d.CreateService(b.cluster, service); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b bootstrapJob) checkServices() (bool, error) {
+	for _, service := range b.services {
+		if exists, err := b.d.CheckServiceExists(b.cluster, service.Name); err != nil {
+			return false, err
+		} else if !exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
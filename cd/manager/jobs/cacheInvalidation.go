@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Allow up to 30 minutes for invalidations to complete
+const cacheInvalidationFailureTime = 30 * time.Minute
+
+var _ manager.JobSm = &cacheInvalidationJob{}
+
+// cacheInvalidationJob invalidates CDN caches, e.g. after a deployment, so that stale content isn't served
+type cacheInvalidationJob struct {
+	baseJob
+	distributionId string
+	paths          []string
+	cdn            manager.Cdn
+}
+
+func CacheInvalidationJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, cdn manager.Cdn) (manager.JobSm, error) {
+	// Use the configured distribution and paths if they weren't specified for this job
+	distributionId, _ := jobState.Params[job.CacheInvalidationJobParam_DistributionId].(string)
+	if len(distributionId) == 0 {
+		if distributionId = os.Getenv("CLOUDFRONT_DISTRIBUTION_ID"); len(distributionId) == 0 {
+			return nil, fmt.Errorf("cacheInvalidationJob: missing distribution")
+		}
+		jobState.Params[job.CacheInvalidationJobParam_DistributionId] = distributionId
+	}
+	paths := make([]string, 0)
+	if paramPaths, found := jobState.Params[job.CacheInvalidationJobParam_Paths].([]interface{}); found {
+		for _, paramPath := range paramPaths {
+			if path, ok := paramPath.(string); !ok {
+				return nil, fmt.Errorf("cacheInvalidationJob: invalid path: %v", paramPath)
+			} else {
+				paths = append(paths, path)
+			}
+		}
+	} else {
+		// Paths are configured as a comma-separated list of patterns, e.g. "/index.html,/static/*"
+		for _, path := range strings.Split(os.Getenv("CLOUDFRONT_INVALIDATION_PATHS"), ",") {
+			if path = strings.TrimSpace(path); len(path) > 0 {
+				paths = append(paths, path)
+			}
+		}
+		jobState.Params[job.CacheInvalidationJobParam_Paths] = paths
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("cacheInvalidationJob: missing paths")
+	}
+	return &cacheInvalidationJob{baseJob{jobState, db, notifs, decisions, clock}, distributionId, paths, cdn}, nil
+}
+
+func (c cacheInvalidationJob) Advance() (job.JobState, error) {
+	now := c.clock.Now()
+	switch c.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return c.advance(job.JobStage_Dequeued, c.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			if invalidationId, err := c.cdn.CreateInvalidation(c.distributionId, c.paths); err != nil {
+				return c.advance(job.JobStage_Failed, now, err)
+			} else {
+				// Record the invalidation identifier and its start time
+				c.state.Params[job.JobParam_Id] = invalidationId
+				c.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				return c.advance(job.JobStage_Started, now, nil)
+			}
+		}
+	case job.JobStage_Started, job.JobStage_Waiting:
+		{
+			if completed, err := c.cdn.CheckInvalidation(c.distributionId, c.state.Params[job.JobParam_Id].(string)); err != nil {
+				return c.advance(job.JobStage_Failed, now, err)
+			} else if completed {
+				return c.advance(job.JobStage_Completed, now, nil)
+			} else if c.isTimedOut(cacheInvalidationFailureTime) { // Invalidation did not complete in time
+				return c.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			} else if c.state.Stage == job.JobStage_Started {
+				// The invalidation was accepted and is in progress
+				return c.advance(job.JobStage_Waiting, now, nil)
+			} else {
+				// Return so we come back again to check
+				return c.state, nil
+			}
+		}
+	default:
+		{
+			return c.advance(job.JobStage_Failed, now, fmt.Errorf("cacheInvalidationJob: unexpected state: %s", manager.PrintJob(c.state)))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Allow up to 30 minutes for backups to complete
+const dataBackupFailureTime = 30 * time.Minute
+
+var _ manager.JobSm = &dataBackupJob{}
+
+type dataBackupJob struct {
+	baseJob
+	resourceArn string
+	b           manager.Backup
+}
+
+func DataBackupJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, b manager.Backup) (manager.JobSm, error) {
+	// Use the configured resource if one wasn't specified for this job
+	resourceArn, _ := jobState.Params[job.DataBackupJobParam_ResourceArn].(string)
+	if len(resourceArn) == 0 {
+		if resourceArn = os.Getenv("BACKUP_RESOURCE_ARN"); len(resourceArn) == 0 {
+			return nil, fmt.Errorf("dataBackupJob: missing resource")
+		}
+		jobState.Params[job.DataBackupJobParam_ResourceArn] = resourceArn
+	}
+	return &dataBackupJob{baseJob{jobState, db, notifs, decisions, clock}, resourceArn, b}, nil
+}
+
+func (b dataBackupJob) Advance() (job.JobState, error) {
+	now := b.clock.Now()
+	switch b.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return b.advance(job.JobStage_Dequeued, b.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			if backupId, err := b.b.StartBackup(b.resourceArn); err != nil {
+				return b.advance(job.JobStage_Failed, now, err)
+			} else {
+				// Record the backup identifier and its start time
+				b.state.Params[job.JobParam_Id] = backupId
+				b.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				return b.advance(job.JobStage_Started, now, nil)
+			}
+		}
+	case job.JobStage_Started:
+		{
+			if completed, err := b.b.CheckBackup(b.state.Params[job.JobParam_Id].(string)); err != nil {
+				return b.advance(job.JobStage_Failed, now, err)
+			} else if completed {
+				return b.advance(job.JobStage_Completed, now, nil)
+			} else {
+				// The backup was accepted and is in progress
+				return b.advance(job.JobStage_Waiting, now, nil)
+			}
+		}
+	case job.JobStage_Waiting:
+		{
+			if completed, err := b.b.CheckBackup(b.state.Params[job.JobParam_Id].(string)); err != nil {
+				return b.advance(job.JobStage_Failed, now, err)
+			} else if completed {
+				return b.advance(job.JobStage_Completed, now, nil)
+			} else if b.isTimedOut(dataBackupFailureTime) { // Backup did not finish in time
+				return b.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			} else {
+				// Return so we come back again to check
+				return b.state, nil
+			}
+		}
+	default:
+		{
+			return b.advance(job.JobStage_Failed, now, fmt.Errorf("dataBackupJob: unexpected state: %s", manager.PrintJob(b.state)))
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package jobs
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,9 +27,13 @@ type deployJob struct {
 	manual    bool
 	rollback  bool
 	force     bool
+	version   string
 	env       string
 	d         manager.Deployment
 	repo      manager.Repository
+	// Only used for staggered multi-region deployments
+	regions           []string
+	regionDeployments map[string]manager.Deployment
 }
 
 const (
@@ -56,34 +63,108 @@ const (
 
 const defaultFailureTime = 30 * time.Minute
 
-func DeployJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, d manager.Deployment, repo manager.Repository) (manager.JobSm, error) {
+// Fail deployments whose rollout has not made any progress for 10 minutes by default
+const defaultRolloutStuckTime = 10 * time.Minute
+
+// Number of recent service events to record when a deployment fails
+const deployServiceEventsLimit = 5
+
+// imageCheck overrides where the image for a component is looked up before it is deployed
+type imageCheck struct {
+	Repo   string `json:"repo"`
+	Public bool   `json:"public"`
+	Tag    string `json:"tag"` // "{tag}" is replaced by the deploy tag
+}
+
+const imageCheckTagPlaceholder = "{tag}"
+
+func DeployJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment, repo manager.Repository, regionDeployments map[string]manager.Deployment) (manager.JobSm, error) {
 	if component, found := jobState.Params[job.DeployJobParam_Component].(string); !found {
 		return nil, fmt.Errorf("deployJob: missing component (ceramic, ipfs, cas, casv5, rust-ceramic)")
 	} else if sha, found := jobState.Params[job.DeployJobParam_Sha].(string); !found {
 		return nil, fmt.Errorf("deployJob: missing target")
 	} else if shaTag, found := jobState.Params[job.DeployJobParam_ShaTag].(string); !found {
 		return nil, fmt.Errorf("deployJob: missing tag")
+	} else if version, err := manager.DeployVersion(jobState); err != nil {
+		return nil, fmt.Errorf("deployJob: %v", err)
 	} else {
 		deployTag, _ := jobState.Params[job.DeployJobParam_DeployTag].(string)
 		manual, _ := jobState.Params[job.DeployJobParam_Manual].(bool)
 		rollback, _ := jobState.Params[job.DeployJobParam_Rollback].(bool)
 		force, _ := jobState.Params[job.DeployJobParam_Force].(bool)
-		return &deployJob{baseJob{jobState, db, notifs}, manager.DeployComponent(component), sha, shaTag, deployTag, manual, rollback, force, os.Getenv(manager.EnvVar_Env), d, repo}, nil
+		regions := deployRegions(jobState)
+		if len(regions) > 0 {
+			for _, region := range regions {
+				if _, found := regionDeployments[region]; !found {
+					return nil, fmt.Errorf("deployJob: no deployment configured for region: %s", region)
+				}
+			}
+			// Use the deployment for the region currently being deployed
+			if region, found := jobState.Params[job.DeployJobParam_Region].(string); found {
+				d = regionDeployments[region]
+			} else {
+				d = regionDeployments[regions[0]]
+			}
+		}
+		return &deployJob{
+			baseJob{jobState, db, notifs, decisions, clock},
+			manager.DeployComponent(component),
+			sha,
+			shaTag,
+			deployTag,
+			manual,
+			rollback,
+			force,
+			version,
+			os.Getenv(manager.EnvVar_Env),
+			d,
+			repo,
+			regions,
+			regionDeployments,
+		}, nil
+	}
+}
+
+// checkFreeze returns true if deploys for the component are frozen and the deployment hasn't been told to go ahead
+// anyway. Whether the component was frozen is recorded in the job so that overridden freezes can be called out.
+func (d deployJob) checkFreeze() bool {
+	if !isFrozenComponent(d.component) {
+		return false
+	}
+	d.state.Params[job.DeployJobParam_Frozen] = true
+	if freezeOverride, _ := d.state.Params[job.DeployJobParam_FreezeOverride].(bool); freezeOverride {
+		log.Printf("deployJob: overriding freeze for component: %s", manager.PrintJob(d.state))
+		return false
 	}
+	return true
+}
+
+// isFrozenComponent checks whether deploys for a component are frozen. This is finer-grained than pausing the job
+// manager, and allows other components to be deployed while one is frozen.
+func isFrozenComponent(component manager.DeployComponent) bool {
+	for _, frozenComponent := range strings.Split(os.Getenv("DEPLOY_FROZEN_COMPONENTS"), ",") {
+		if manager.DeployComponent(strings.TrimSpace(frozenComponent)) == component {
+			return true
+		}
+	}
+	return false
 }
 
 func (d deployJob) Advance() (job.JobState, error) {
-	now := time.Now()
+	now := d.clock.Now()
 	switch d.state.Stage {
 	case job.JobStage_Queued:
 		{
-			if deployTags, err := d.db.GetDeployTags(); err != nil {
+			if deployedTag, err := d.db.GetDeployTagByComponent(d.component); err != nil {
 				return d.advance(job.JobStage_Failed, now, err)
 			} else if err = d.prepareJob(); err != nil {
 				return d.advance(job.JobStage_Failed, now, err)
+			} else if d.checkFreeze() {
+				log.Printf("deployJob: deploys frozen for component: %s", manager.PrintJob(d.state))
+				return d.advance(job.JobStage_Skipped, now, manager.Error_ComponentFrozen)
 			} else if deployTag, found := d.state.Params[job.DeployJobParam_DeployTag].(string); found &&
 				!d.manual && !d.force &&
-				(deployTag == strings.Split(deployTags[d.component], ",")[0]) {
+				(deployTag == strings.Split(deployedTag, ",")[0]) {
 				// Skip automated jobs if the tag being deployed is the same as the tag already deployed. We don't do
 				// this for manual jobs because deploying an already deployed tag might be intentional, or for force
 				// deploys/rollbacks because we WANT to push through such deployments.
@@ -93,6 +174,8 @@ func (d deployJob) Advance() (job.JobState, error) {
 				return d.advance(job.JobStage_Skipped, now, nil)
 			} else if envLayout, err := d.generateEnvLayout(d.component); err != nil {
 				return d.advance(job.JobStage_Failed, now, err)
+			} else if err = d.checkImage(*envLayout.Repo); err != nil {
+				return d.advance(job.JobStage_Failed, now, err)
 			} else {
 				d.state.Params[job.DeployJobParam_Layout] = *envLayout
 				// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on
@@ -102,10 +185,22 @@ func (d deployJob) Advance() (job.JobState, error) {
 		}
 	case job.JobStage_Dequeued:
 		{
-			if err := d.updateEnv(); err != nil {
+			// Wait for one of the approvers to approve the deployment before touching the environment
+			if manager.NeedsApproval(d.state) {
+				log.Printf("deployJob: waiting for approval: %s", manager.PrintJob(d.state))
+				return d.advance(job.JobStage_PendingApproval, now, nil)
+			}
+			// Make sure that we're deploying an actual commit before touching the environment
+			if err := d.checkDeployTag(); err != nil {
+				return d.advance(job.JobStage_Failed, now, err)
+			} else if err = d.updateEnv(); err != nil {
+				d.setRegionStatus(job.DeployRegionStatus_Failed)
 				return d.advance(job.JobStage_Failed, now, err)
 			} else {
-				d.state.Params[job.JobParam_Start] = float64(time.Now().UnixNano())
+				d.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				if d.isRegional() {
+					d.startRegion(now)
+				}
 				// For started deployments update the build tag in the DB
 				if err = d.db.UpdateBuildTag(d.component, d.deployTag); err != nil {
 					// This isn't an error big enough to fail the job, just report and move on.
@@ -117,21 +212,45 @@ func (d deployJob) Advance() (job.JobState, error) {
 	case job.JobStage_Started:
 		{
 			if deployed, err := d.checkEnv(); err != nil {
+				d.setRegionStatus(job.DeployRegionStatus_Failed)
 				return d.advance(job.JobStage_Failed, now, err)
+			} else if deployed && d.isRegional() && !d.isLastRegion() {
+				return d.regionDeployed(now)
 			} else if deployed {
-				// For completed deployments update the deployed tag in the DB, and append the deployment target.
-				if err = d.db.UpdateDeployTag(d.component, d.deployTag+","+d.sha); err != nil {
-					// This isn't an error big enough to fail the job, just report and move on.
-					log.Printf("deployJob: failed to update deploy tag: %v, %s", err, manager.PrintJob(d.state))
+				if bakeTime, err := d.deployBakeTime(); err != nil {
+					d.setRegionStatus(job.DeployRegionStatus_Failed)
+					return d.advance(job.JobStage_Failed, now, err)
+				} else if bakeTime > 0 {
+					// Keep monitoring the deployment for a while before declaring it complete
+					d.setRegionStatus(job.DeployRegionStatus_Baking)
+					d.state.Params[job.DeployJobParam_BakeStart] = float64(now.UnixNano())
+					return d.advance(job.JobStage_Waiting, now, nil)
 				}
-				return d.advance(job.JobStage_Completed, now, nil)
-			} else if job.IsTimedOut(d.state, defaultFailureTime) {
+				return d.completeDeploy(now)
+			} else if d.isTimedOut(defaultFailureTime) {
+				d.setRegionStatus(job.DeployRegionStatus_Failed)
 				return d.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			} else if progressed, err := d.checkRollout(now); err != nil {
+				d.setRegionStatus(job.DeployRegionStatus_Failed)
+				return d.advance(job.JobStage_Failed, now, err)
+			} else if progressed {
+				// Save the rollout progress without changing the stage of the job. The job manager will update the
+				// notification for the job so that the progress is visible.
+				return d.state, d.db.AdvanceJob(d.state)
 			} else {
 				// Return so we come back again to check
 				return d.state, nil
 			}
 		}
+	case job.JobStage_Waiting:
+		{
+			// Deployments wait while baking, either the whole deployment before it is marked complete, or, for staggered
+			// multi-region deployments, a region before moving on to the next one.
+			if _, found := d.state.Params[job.DeployJobParam_BakeStart]; found {
+				return d.bakeDeploy(now)
+			}
+			return d.bakeRegion(now)
+		}
 	default:
 		{
 			return d.advance(
@@ -143,6 +262,100 @@ func (d deployJob) Advance() (job.JobState, error) {
 	}
 }
 
+// advance records the most recent service events when a deployment fails after it was started, so that the failure
+// notification can show what ECS was doing with the deployed services at the time.
+func (d deployJob) advance(jobStage job.JobStage, ts time.Time, err error) (job.JobState, error) {
+	if (jobStage == job.JobStage_Failed) && ((d.state.Stage == job.JobStage_Started) || (d.state.Stage == job.JobStage_Waiting)) {
+		if serviceEvents := d.serviceEvents(); len(serviceEvents) > 0 {
+			d.state.Params[job.DeployJobParam_ServiceEvents] = serviceEvents
+		}
+	}
+	return d.baseJob.advance(jobStage, ts, err)
+}
+
+// serviceEvents returns the most recent events across all services in the layout, oldest first
+func (d deployJob) serviceEvents() []interface{} {
+	layout, _ := d.state.Params[job.DeployJobParam_Layout].(manager.Layout)
+	events := make([]manager.ServiceEvent, 0)
+	for clusterName, cluster := range layout.Clusters {
+		if cluster.ServiceTasks != nil {
+			for service := range cluster.ServiceTasks.Tasks {
+				if serviceEvents, err := d.d.GetServiceEvents(clusterName, service, deployServiceEventsLimit); err != nil {
+					// Missing events shouldn't get in the way of reporting the failure
+					log.Printf("deployJob: failed to get service events: %s, %s, %v, %s", clusterName, service, err, manager.PrintJob(d.state))
+				} else {
+					events = append(events, serviceEvents...)
+				}
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.After(events[j].CreatedAt)
+	})
+	if len(events) > deployServiceEventsLimit {
+		events = events[:deployServiceEventsLimit]
+	}
+	serviceEvents := make([]interface{}, len(events))
+	for i, event := range events {
+		serviceEvents[len(events)-1-i] = fmt.Sprintf("%s %s", event.CreatedAt.UTC().Format(time.RFC3339), event.Message)
+	}
+	return serviceEvents
+}
+
+func (d deployJob) completeDeploy(ts time.Time) (job.JobState, error) {
+	d.setRegionStatus(job.DeployRegionStatus_Deployed)
+	// For completed deployments update the deployed tag in the DB, and append the deployment target.
+	if err := d.db.UpdateDeployTag(d.component, d.deployTag+","+d.sha); err != nil {
+		// This isn't an error big enough to fail the job, just report and move on.
+		log.Printf("deployJob: failed to update deploy tag: %v, %s", err, manager.PrintJob(d.state))
+	}
+	return d.advance(job.JobStage_Completed, ts, nil)
+}
+
+// deployBakeTime returns how long to monitor a deployment after it is stable before marking it complete, which is zero
+// (i.e. no baking) unless configured. The bake time can be configured for all components, and overridden per component.
+func (d deployJob) deployBakeTime() (time.Duration, error) {
+	// Rollbacks need to get working images out as quickly as possible
+	if d.rollback {
+		return 0, nil
+	}
+	bakeTime := os.Getenv("DEPLOY_BAKE_TIME")
+	if bakeTimeConfig, found := os.LookupEnv("DEPLOY_BAKE_TIME_CONFIG"); found {
+		componentBakeTimes := make(map[manager.DeployComponent]string)
+		if err := json.Unmarshal([]byte(bakeTimeConfig), &componentBakeTimes); err != nil {
+			return 0, fmt.Errorf("deployJob: invalid bake time config: %w", err)
+		} else if componentBakeTime, found := componentBakeTimes[d.component]; found {
+			bakeTime = componentBakeTime
+		}
+	}
+	if len(bakeTime) == 0 {
+		return 0, nil
+	} else if parsedBakeTime, err := time.ParseDuration(bakeTime); err != nil {
+		return 0, fmt.Errorf("deployJob: invalid bake time: %w", err)
+	} else {
+		return parsedBakeTime, nil
+	}
+}
+
+// bakeDeploy makes sure that the deployment stays healthy until it has baked long enough to be marked complete. If the
+// deployment becomes unhealthy, the job fails, which triggers the usual rollback.
+func (d deployJob) bakeDeploy(ts time.Time) (job.JobState, error) {
+	if healthy, err := d.checkEnv(); err != nil {
+		d.setRegionStatus(job.DeployRegionStatus_Failed)
+		return d.advance(job.JobStage_Failed, ts, err)
+	} else if !healthy {
+		d.setRegionStatus(job.DeployRegionStatus_Failed)
+		return d.advance(job.JobStage_Failed, ts, fmt.Errorf("deployJob: deployment unhealthy while baking"))
+	} else if bakeTime, err := d.deployBakeTime(); err != nil {
+		d.setRegionStatus(job.DeployRegionStatus_Failed)
+		return d.advance(job.JobStage_Failed, ts, err)
+	} else if bakeStart, _ := d.state.Params[job.DeployJobParam_BakeStart].(float64); ts.Add(-bakeTime).After(time.Unix(0, int64(bakeStart))) {
+		return d.completeDeploy(ts)
+	}
+	// Return so we come back again to check
+	return d.state, nil
+}
+
 func (d deployJob) prepareJob() error {
 	deployTag := ""
 	// - If the specified deployment target is "latest", fetch the latest branch commit hash from GitHub.
@@ -158,6 +371,8 @@ func (d deployJob) prepareJob() error {
 			d.shaTag,
 		); err != nil {
 			return err
+		} else if !manager.IsValidSha(latestSha) {
+			return manager.Error_InvalidSha
 		} else {
 			deployTag = latestSha
 		}
@@ -166,22 +381,141 @@ func (d deployJob) prepareJob() error {
 	} else if manager.IsValidSha(d.sha) {
 		deployTag = d.sha
 	} else {
-		return fmt.Errorf("prepareJob: invalid deployment type")
+		return manager.Error_InvalidSha
 	}
 	d.state.Params[job.DeployJobParam_DeployTag] = deployTag
+	if d.isRegional() {
+		d.startRollout()
+	}
+	return nil
+}
+
+// checkDeployTag validates the tag determined while preparing the job. Release and rollback deployments use tags that
+// aren't commit hashes, but all other deployments must resolve to a valid commit hash, e.g. "latest" could otherwise
+// resolve to an empty hash.
+func (d deployJob) checkDeployTag() error {
+	if (d.sha == job.DeployJobTarget_Release) || (d.sha == job.DeployJobTarget_Rollback) {
+		if len(d.deployTag) == 0 {
+			return fmt.Errorf("deployJob: missing deployment tag")
+		}
+	} else if !manager.IsValidSha(d.deployTag) {
+		return manager.Error_InvalidSha
+	}
 	return nil
 }
 
 func (d deployJob) updateEnv() error {
 	// Layout should already be present
 	layout, _ := d.state.Params[job.DeployJobParam_Layout].(manager.Layout)
-	return d.d.UpdateLayout(&layout, d.deployTag)
+	if err := d.checkServices(&layout); err != nil {
+		return err
+	}
+	if envVars, err := d.envVars(); err != nil {
+		return err
+	} else {
+		// Deploy the exact images that were built for the commit, if known, instead of whatever images the tag refers to
+		if digests, found := d.state.Params[job.JobParam_ImageDigests].(map[string]interface{}); found {
+			layout.Digests = make(map[string]string, len(digests))
+			for repo, digest := range digests {
+				if digestStr, ok := digest.(string); ok {
+					layout.Digests[repo] = digestStr
+				}
+			}
+		}
+		return d.d.UpdateLayout(&layout, d.deployTag, envVars)
+	}
+}
+
+// envVars merges the environment variables configured for the component with those specified for this deployment,
+// which take precedence.
+func (d deployJob) envVars() (map[string]string, error) {
+	configEnvVars, err := manager.DeployEnvVars(d.component)
+	if err != nil {
+		return nil, err
+	}
+	envVars := make(map[string]string, len(configEnvVars))
+	for name, value := range configEnvVars {
+		envVars[name] = value
+	}
+	if jobEnvVars, found := d.state.Params[job.DeployJobParam_EnvVars].(map[string]interface{}); found {
+		for name, value := range jobEnvVars {
+			if v, ok := value.(string); !ok {
+				return nil, fmt.Errorf("deployJob: invalid value for environment variable: %s", name)
+			} else {
+				envVars[name] = v
+			}
+		}
+	}
+	return envVars, nil
+}
+
+// checkServices makes sure that all services in the layout still exist so that we can fail fast with a clear error,
+// instead of a generic one from the first service update.
+func (d deployJob) checkServices(layout *manager.Layout) error {
+	for clusterName, cluster := range layout.Clusters {
+		if cluster.ServiceTasks != nil {
+			for service := range cluster.ServiceTasks.Tasks {
+				if exists, err := d.d.CheckServiceExists(clusterName, service); err != nil {
+					return err
+				} else if !exists {
+					return fmt.Errorf("deployJob: service does not exist: %s, %s", clusterName, service)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkImage makes sure that the image being deployed exists so that we can fail fast instead of waiting for tasks to
+// fail to pull it. The repository and tag default to the ones that will be deployed, but can be configured per
+// component. When deploying a commit without a configured check, any image tagged with the commit hash will do.
+func (d deployJob) checkImage(repo manager.Repo) error {
+	if enabled, _ := strconv.ParseBool(os.Getenv("DEPLOY_IMAGE_CHECK")); !enabled {
+		return nil
+	} else if _, found := d.state.Params[job.JobParam_ImageDigests]; found {
+		// The digests were looked up from the repository after the images were built, so the images are known to exist.
+		return nil
+	}
+	// The deploy tag is only determined while preparing the job, so read it from the job parameters.
+	deployTag, _ := d.state.Params[job.DeployJobParam_DeployTag].(string)
+	tag := deployTag
+	configured := false
+	if imageCheckConfig, found := os.LookupEnv("DEPLOY_IMAGE_CHECK_CONFIG"); found {
+		imageChecks := make(map[manager.DeployComponent]imageCheck)
+		if err := json.Unmarshal([]byte(imageCheckConfig), &imageChecks); err != nil {
+			return fmt.Errorf("deployJob: invalid image check config: %w", err)
+		} else if check, found := imageChecks[d.component]; found {
+			configured = true
+			if len(check.Repo) > 0 {
+				repo = manager.Repo{Name: check.Repo, Public: check.Public}
+			}
+			if len(check.Tag) > 0 {
+				tag = strings.ReplaceAll(check.Tag, imageCheckTagPlaceholder, deployTag)
+			}
+		}
+	}
+	if !configured && ((d.sha == job.DeployJobTarget_Latest) || manager.IsValidSha(d.sha)) {
+		if tags, err := d.d.GetECRImageTags(repo, deployTag); err != nil {
+			return err
+		} else if len(tags) == 0 {
+			return fmt.Errorf("deployJob: no image found for commit: %s, %s", repo.Name, deployTag)
+		}
+		return nil
+	}
+	if exists, err := d.d.CheckImageExists(repo, tag); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("deployJob: image not found: %s:%s", repo.Name, tag)
+	}
+	return nil
 }
 
 func (d deployJob) checkEnv() (bool, error) {
 	// Layout should already be present
 	layout, _ := d.state.Params[job.DeployJobParam_Layout].(manager.Layout)
-	if deployed, err := d.d.CheckLayout(&layout); err != nil {
+	deployed, err := d.d.CheckLayout(&layout)
+	d.recordCheck(manager.DecisionCheck_LayoutDeployed, deployed)
+	if err != nil {
 		return false, err
 	} else if !deployed || ((d.component != manager.DeployComponent_Ipfs) && (d.component != manager.DeployComponent_RustCeramic)) {
 		return deployed, nil
@@ -199,6 +533,53 @@ func (d deployJob) checkEnv() (bool, error) {
 	}
 }
 
+// checkRollout records how many tasks have been updated so far, and returns whether that changed since the last check.
+// A rollout that hasn't made any progress for a while is most likely stuck (e.g. tasks failing health checks), and so
+// an error is returned instead of waiting out the full deployment timeout.
+func (d deployJob) checkRollout(ts time.Time) (bool, error) {
+	// Layout should already be present
+	layout, _ := d.state.Params[job.DeployJobParam_Layout].(manager.Layout)
+	progress, err := d.d.GetRolloutProgress(&layout)
+	if err != nil {
+		return false, err
+	}
+	prevUpdated, found := d.state.Params[job.DeployJobParam_RolloutUpdated].(float64)
+	prevDesired, _ := d.state.Params[job.DeployJobParam_RolloutDesired].(float64)
+	if !found || (int32(prevUpdated) != progress.UpdatedCount) || (int32(prevDesired) != progress.DesiredCount) {
+		d.state.Params[job.DeployJobParam_RolloutUpdated] = float64(progress.UpdatedCount)
+		d.state.Params[job.DeployJobParam_RolloutDesired] = float64(progress.DesiredCount)
+		d.state.Params[job.DeployJobParam_RolloutTs] = float64(ts.UnixNano())
+		return true, nil
+	}
+	// A fully updated rollout might still be waiting for its tasks to stabilize, which isn't considered stuck.
+	if progress.UpdatedCount < progress.DesiredCount {
+		if stuckTime, err := d.rolloutStuckTime(); err != nil {
+			return false, err
+		} else if rolloutTs, found := d.state.Params[job.DeployJobParam_RolloutTs].(float64); found {
+			if sinceProgress := ts.Sub(time.Unix(0, int64(rolloutTs))); sinceProgress > stuckTime {
+				return false, fmt.Errorf(
+					"deployJob: rollout stuck at %d of %d tasks updated for %s",
+					progress.UpdatedCount,
+					progress.DesiredCount,
+					sinceProgress.Round(time.Second),
+				)
+			}
+		}
+	}
+	return false, nil
+}
+
+func (d deployJob) rolloutStuckTime() (time.Duration, error) {
+	if stuckTime, found := os.LookupEnv("DEPLOY_ROLLOUT_STUCK_TIME"); found {
+		if parsedStuckTime, err := time.ParseDuration(stuckTime); err != nil {
+			return 0, fmt.Errorf("deployJob: invalid rollout stuck time: %w", err)
+		} else {
+			return parsedStuckTime, nil
+		}
+	}
+	return defaultRolloutStuckTime, nil
+}
+
 func (d deployJob) generateEnvLayout(component manager.DeployComponent) (*manager.Layout, error) {
 	privateCluster := "ceramic-" + d.env
 	publicCluster := "ceramic-" + d.env + "-ex"
@@ -206,7 +587,7 @@ func (d deployJob) generateEnvLayout(component manager.DeployComponent) (*manage
 	casV5Cluster := "app-cas-" + d.env
 	rustCluster := "ceramic-" + d.env + "-rust"
 	clusters := []string{privateCluster, publicCluster, casCluster, casV5Cluster, rustCluster}
-	if ecrRepo, err := d.componentEcrRepo(component); err != nil {
+	if ecrRepo, err := componentEcrRepo(component); err != nil {
 		return nil, err
 	} else
 	// Populate the service layout by retrieving the clusters/services from ECS
@@ -277,7 +658,7 @@ func (d deployJob) componentTask(component manager.DeployComponent, cluster, ser
 	return nil
 }
 
-func (d deployJob) componentEcrRepo(component manager.DeployComponent) (manager.Repo, error) {
+func componentEcrRepo(component manager.DeployComponent) (manager.Repo, error) {
 	switch component {
 	case manager.DeployComponent_Ceramic:
 		return manager.Repo{Name: "ceramic-prod"}, nil
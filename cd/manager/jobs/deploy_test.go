@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// testDb only implements the database operations used to prepare deployments
+type testDb struct {
+	manager.Database
+	advanced []job.JobState
+}
+
+func (db *testDb) GetDeployTagByComponent(manager.DeployComponent) (string, error) {
+	return "", nil
+}
+
+func (db *testDb) AdvanceJob(jobState job.JobState) error {
+	db.advanced = append(db.advanced, jobState)
+	return nil
+}
+
+type testNotifs struct {
+	manager.Notifs
+}
+
+func (n testNotifs) NotifyJob(...job.JobState) {}
+
+// testRepo returns a fixed commit hash for the latest commit
+type testRepo struct {
+	manager.Repository
+	latestSha string
+}
+
+func (r testRepo) GetLatestCommitHash(string, string, string, string) (string, error) {
+	return r.latestSha, nil
+}
+
+// testDeployment doesn't implement any deployment operations, so any attempt to update the environment panics
+type testDeployment struct {
+	manager.Deployment
+}
+
+const testSha = "0123456789abcdef0123456789abcdef01234567"
+
+func testDeployState(stage job.JobStage, sha string, params map[string]interface{}) job.JobState {
+	jobParams := map[string]interface{}{
+		job.DeployJobParam_Component: string(manager.DeployComponent_Ceramic),
+		job.DeployJobParam_Sha:       sha,
+		job.DeployJobParam_ShaTag:    sha,
+	}
+	for k, v := range params {
+		jobParams[k] = v
+	}
+	return job.JobState{JobId: "deploy", Type: job.JobType_Deploy, Stage: stage, Ts: time.Now(), Params: jobParams}
+}
+
+func advanceTestDeploy(t *testing.T, jobState job.JobState, repo manager.Repository) job.JobState {
+	t.Helper()
+	t.Setenv(manager.EnvVar_Env, string(manager.EnvType_Dev))
+	db := new(testDb)
+	d, err := DeployJob(jobState, db, testNotifs{}, manager.NewDecisionLog(), manager.SystemClock{}, testDeployment{}, repo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newState, err := d.Advance()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(db.advanced) != 1 {
+		t.Fatalf("expected the job to be advanced once, got %d", len(db.advanced))
+	}
+	return newState
+}
+
+func checkInvalidShaFailure(t *testing.T, jobState job.JobState) {
+	t.Helper()
+	if jobState.Stage != job.JobStage_Failed {
+		t.Fatalf("expected the deployment to fail, got %s", jobState.Stage)
+	} else if jobState.Params[job.JobParam_Error] != manager.Error_InvalidSha.Error() {
+		t.Fatalf("unexpected error: %v", jobState.Params[job.JobParam_Error])
+	}
+}
+
+func TestDeployJobInvalidSha(t *testing.T) {
+	for _, sha := range []string{"", "bogus", "0123456789abcdef"} {
+		checkInvalidShaFailure(t, advanceTestDeploy(t, testDeployState(job.JobStage_Queued, sha, nil), testRepo{}))
+	}
+}
+
+func TestDeployJobInvalidLatestSha(t *testing.T) {
+	checkInvalidShaFailure(t, advanceTestDeploy(t, testDeployState(job.JobStage_Queued, job.DeployJobTarget_Latest, nil), testRepo{}))
+}
+
+func TestDeployJobInvalidDeployTag(t *testing.T) {
+	// The deployment tag is checked again before the environment is updated
+	jobState := testDeployState(job.JobStage_Dequeued, job.DeployJobTarget_Latest, map[string]interface{}{
+		job.DeployJobParam_DeployTag: "bogus",
+	})
+	checkInvalidShaFailure(t, advanceTestDeploy(t, jobState, testRepo{}))
+}
+
+// testLayoutDeployment only implements the deployment operations used to prepare a deployment
+type testLayoutDeployment struct {
+	manager.Deployment
+}
+
+func (d testLayoutDeployment) GetLayout([]string) (*manager.Layout, error) {
+	return &manager.Layout{Clusters: map[string]*manager.Cluster{}}, nil
+}
+
+func TestDeployJobFrozenComponent(t *testing.T) {
+	t.Setenv(manager.EnvVar_Env, string(manager.EnvType_Dev))
+	t.Setenv("DEPLOY_FROZEN_COMPONENTS", "cas, ceramic")
+	advance := func(component manager.DeployComponent, params map[string]interface{}) job.JobState {
+		jobState := testDeployState(job.JobStage_Queued, testSha, params)
+		jobState.Params[job.DeployJobParam_Component] = string(component)
+		d, err := DeployJob(jobState, new(testDb), testNotifs{}, manager.NewDecisionLog(), manager.SystemClock{}, testLayoutDeployment{}, testRepo{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newState, err := d.Advance()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newState
+	}
+	if frozen := advance(manager.DeployComponent_Ceramic, nil); frozen.Stage != job.JobStage_Skipped {
+		t.Fatalf("expected the frozen component's deploy to be skipped, got %s", frozen.Stage)
+	} else if frozen.Params[job.JobParam_Error] != manager.Error_ComponentFrozen.Error() {
+		t.Fatalf("unexpected skip reason: %v", frozen.Params[job.JobParam_Error])
+	}
+	if unfrozen := advance(manager.DeployComponent_Ipfs, nil); unfrozen.Stage != job.JobStage_Dequeued {
+		t.Fatalf("expected the unfrozen component's deploy to proceed, got %s", unfrozen.Stage)
+	}
+	// The freeze can be overridden, which is recorded so that it can be called out in notifications
+	overridden := advance(manager.DeployComponent_Ceramic, map[string]interface{}{job.DeployJobParam_FreezeOverride: true})
+	if overridden.Stage != job.JobStage_Dequeued {
+		t.Fatalf("expected the overridden deploy to proceed, got %s", overridden.Stage)
+	} else if frozen, _ := overridden.Params[job.DeployJobParam_Frozen].(bool); !frozen {
+		t.Fatal("overridden freeze not recorded")
+	}
+}
+
+// testImageDeployment returns a fixed set of tags for the images pushed for a commit
+type testImageDeployment struct {
+	testLayoutDeployment
+	tags []string
+}
+
+func (d testImageDeployment) GetECRImageTags(manager.Repo, string) ([]string, error) {
+	return d.tags, nil
+}
+
+func TestDeployJobImageCheck(t *testing.T) {
+	t.Setenv(manager.EnvVar_Env, string(manager.EnvType_Dev))
+	advance := func(deployment manager.Deployment) job.JobState {
+		d, err := DeployJob(testDeployState(job.JobStage_Queued, testSha, nil), new(testDb), testNotifs{}, manager.NewDecisionLog(), manager.SystemClock{}, deployment, testRepo{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newState, err := d.Advance()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newState
+	}
+	// Images aren't looked up unless the check is enabled
+	if unchecked := advance(testLayoutDeployment{}); unchecked.Stage != job.JobStage_Dequeued {
+		t.Fatalf("expected the deploy to proceed without checking for the image, got %s", unchecked.Stage)
+	}
+	t.Setenv("DEPLOY_IMAGE_CHECK", "true")
+	if missing := advance(testImageDeployment{}); missing.Stage != job.JobStage_Failed {
+		t.Fatalf("expected the deploy of a commit without an image to fail, got %s", missing.Stage)
+	}
+	if found := advance(testImageDeployment{tags: []string{testSha}}); found.Stage != job.JobStage_Dequeued {
+		t.Fatalf("expected the deploy of a commit with an image to proceed, got %s", found.Stage)
+	}
+}
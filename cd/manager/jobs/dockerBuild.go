@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Allow up to 1 hour for an image to be built and pushed
+const dockerBuildFailureTime = 1 * time.Hour
+
+var _ manager.JobSm = &dockerBuildJob{}
+
+// dockerBuildJob builds and pushes the images for a commit of a component by running a GitHub Actions workflow in the
+// component's repository, then records the digests of the pushed images so that they can be deployed immutably.
+type dockerBuildJob struct {
+	githubWorkflowJob
+	component manager.DeployComponent
+	sha       string
+	repos     []manager.Repo
+	d         manager.Deployment
+}
+
+func DockerBuildJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment, r manager.Repository) (manager.JobSm, error) {
+	if component, found := jobState.Params[job.DockerBuildJobParam_Component].(string); !found {
+		return nil, fmt.Errorf("dockerBuildJob: missing component (ceramic, ipfs, cas, casv5, rust-ceramic)")
+	} else if repo, err := manager.ComponentRepo(manager.DeployComponent(component)); err != nil {
+		return nil, err
+	} else if sha, found := jobState.Params[job.DockerBuildJobParam_Sha].(string); !found || !manager.IsValidSha(sha) {
+		return nil, fmt.Errorf("dockerBuildJob: missing or invalid commit hash")
+	} else if workflow, found := jobState.Params[job.DockerBuildJobParam_Workflow].(string); !found {
+		return nil, fmt.Errorf("dockerBuildJob: missing workflow")
+	} else if ref, found := jobState.Params[job.DockerBuildJobParam_Ref].(string); !found {
+		return nil, fmt.Errorf("dockerBuildJob: missing ref")
+	} else if repos, err := buildRepos(jobState, manager.DeployComponent(component)); err != nil {
+		return nil, err
+	} else {
+		workflowRunUrl, _ := jobState.Params[job.DockerBuildJobParam_Url].(string)
+		workflowRunId, _ := jobState.Params[job.JobParam_Id].(float64)
+		return &dockerBuildJob{
+			githubWorkflowJob{
+				baseJob: baseJob{jobState, db, notifs, decisions, clock},
+				workflow: job.Workflow{
+					Org:      repo.Org,
+					Repo:     repo.Name,
+					Workflow: workflow,
+					Ref:      ref,
+					// Add the job ID to the inputs, so we can track the right workflow corresponding to this job.
+					Inputs: map[string]interface{}{
+						job.WorkflowJobParam_JobId:  jobState.JobId,
+						job.DockerBuildJobParam_Sha: sha,
+					},
+					Url: workflowRunUrl,
+					Id:  int64(workflowRunId),
+				},
+				r: r,
+			},
+			manager.DeployComponent(component),
+			sha,
+			repos,
+			d,
+		}, nil
+	}
+}
+
+func (b dockerBuildJob) Advance() (job.JobState, error) {
+	now := b.clock.Now()
+	switch b.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return b.advance(job.JobStage_Dequeued, b.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			return b.startWorkflow(now)
+		}
+	case job.JobStage_Started:
+		{
+			return b.findWorkflowRun(now)
+		}
+	case job.JobStage_Waiting:
+		{
+			return b.checkWorkflowRun(now, dockerBuildFailureTime, func() (job.JobState, error) {
+				if digests, err := b.imageDigests(); err != nil {
+					return b.advance(job.JobStage_Failed, now, err)
+				} else {
+					b.state.Params[job.JobParam_ImageDigests] = digests
+					return b.advance(job.JobStage_Completed, now, nil)
+				}
+			})
+		}
+	default:
+		{
+			return b.advance(job.JobStage_Failed, now, fmt.Errorf("dockerBuildJob: unexpected state: %s", manager.PrintJob(b.state)))
+		}
+	}
+}
+
+// buildRepos returns the repos that the build pushes images to, which default to the component's repo
+func buildRepos(jobState job.JobState, component manager.DeployComponent) ([]manager.Repo, error) {
+	paramRepos, found := jobState.Params[job.DockerBuildJobParam_Repos].([]interface{})
+	if !found {
+		if ecrRepo, err := componentEcrRepo(component); err != nil {
+			return nil, err
+		} else {
+			return []manager.Repo{ecrRepo}, nil
+		}
+	}
+	repos := make([]manager.Repo, 0, len(paramRepos))
+	for _, paramRepo := range paramRepos {
+		if repoName, ok := paramRepo.(string); !ok || (len(repoName) == 0) {
+			return nil, fmt.Errorf("dockerBuildJob: invalid repo: %v", paramRepo)
+		} else {
+			repos = append(repos, manager.Repo{Name: repoName})
+		}
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("dockerBuildJob: missing repos")
+	}
+	return repos, nil
+}
+
+// imageDigests looks up the digest of the image pushed to each repo, by repo name. Images are tagged with the commit
+// hash they were built from.
+func (b dockerBuildJob) imageDigests() (map[string]interface{}, error) {
+	digests := make(map[string]interface{}, len(b.repos))
+	for _, repo := range b.repos {
+		if digest, err := b.d.GetImageDigest(repo, b.sha); err != nil {
+			return nil, err
+		} else {
+			digests[repo.Name] = digest
+		}
+	}
+	return digests, nil
+}
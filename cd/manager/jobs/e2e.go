@@ -24,12 +24,12 @@ const (
 // Allow up to 4 hours for E2E tests to run
 const e2eFailureTime = 4 * time.Hour
 
-func E2eTestJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, d manager.Deployment) manager.JobSm {
-	return &e2eTestJob{baseJob{jobState, db, notifs}, d}
+func E2eTestJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) manager.JobSm {
+	return &e2eTestJob{baseJob{jobState, db, notifs, decisions, clock}, d}
 }
 
 func (e e2eTestJob) Advance() (job.JobState, error) {
-	now := time.Now()
+	now := e.clock.Now()
 	switch e.state.Stage {
 	case job.JobStage_Queued:
 		{
@@ -44,7 +44,7 @@ func (e e2eTestJob) Advance() (job.JobState, error) {
 			if err := e.startAllTests(); err != nil {
 				return e.advance(job.JobStage_Failed, now, err)
 			} else {
-				e.state.Params[job.JobParam_Start] = float64(time.Now().UnixNano())
+				e.state.Params[job.JobParam_Start] = float64(now.UnixNano())
 				return e.advance(job.JobStage_Started, now, nil)
 			}
 		}
@@ -54,7 +54,7 @@ func (e e2eTestJob) Advance() (job.JobState, error) {
 				return e.advance(job.JobStage_Failed, now, err)
 			} else if running {
 				return e.advance(job.JobStage_Waiting, now, nil)
-			} else if job.IsTimedOut(e.state, manager.DefaultWaitTime) { // Tests did not start in time
+			} else if e.isTimedOut(manager.DefaultWaitTime) { // Tests did not start in time
 				return e.advance(job.JobStage_Failed, now, manager.Error_StartupTimeout)
 			} else {
 				// Return so we come back again to check
@@ -67,7 +67,7 @@ func (e e2eTestJob) Advance() (job.JobState, error) {
 				return e.advance(job.JobStage_Failed, now, err)
 			} else if stopped {
 				return e.advance(job.JobStage_Completed, now, nil)
-			} else if job.IsTimedOut(e.state, e2eFailureTime) { // Tests did not finish in time
+			} else if e.isTimedOut(e2eFailureTime) { // Tests did not finish in time
 				return e.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
 			} else {
 				// Return so we come back again to check
@@ -92,19 +92,21 @@ func (e e2eTestJob) startAllTests() error {
 }
 
 func (e e2eTestJob) startTests(config string) error {
-	if id, err := e.d.LaunchServiceTask(
+	if overrides, err := manager.TaskOverrides(e.state, map[string]string{
+		"NODE_ENV":                      config,
+		"ETH_RPC_URL":                   os.Getenv("BLOCKCHAIN_RPC_URL"),
+		"AWS_ACCESS_KEY_ID":             os.Getenv("E2E_AWS_ACCESS_KEY_ID"),
+		"AWS_SECRET_ACCESS_KEY":         os.Getenv("E2E_AWS_SECRET_ACCESS_KEY"),
+		"AWS_REGION":                    os.Getenv("AWS_REGION"),
+		"CERAMIC_NODE_PRIVATE_SEED_URL": os.Getenv("CERAMIC_NODE_PRIVATE_SEED_URL"),
+	}); err != nil {
+		return err
+	} else if id, err := e.d.LaunchServiceTask(
 		"ceramic-qa-tests",
 		"ceramic-qa-tests-e2e_tests",
 		"ceramic-qa-tests-e2e_tests",
 		"e2e_tests",
-		map[string]string{
-			"NODE_ENV":                      config,
-			"ETH_RPC_URL":                   os.Getenv("BLOCKCHAIN_RPC_URL"),
-			"AWS_ACCESS_KEY_ID":             os.Getenv("E2E_AWS_ACCESS_KEY_ID"),
-			"AWS_SECRET_ACCESS_KEY":         os.Getenv("E2E_AWS_SECRET_ACCESS_KEY"),
-			"AWS_REGION":                    os.Getenv("AWS_REGION"),
-			"CERAMIC_NODE_PRIVATE_SEED_URL": os.Getenv("CERAMIC_NODE_PRIVATE_SEED_URL"),
-		}); err != nil {
+		overrides); err != nil {
 		return err
 	} else {
 		e.state.Params[config] = id
@@ -124,7 +126,9 @@ func (e e2eTestJob) checkAllTests(expectedToBeRunning bool) (bool, error) {
 }
 
 func (e e2eTestJob) checkTests(taskId string, expectedToBeRunning bool) (bool, error) {
-	if status, exitCode, err := e.d.CheckTask("ceramic-qa-tests", "", expectedToBeRunning, false, taskId); err != nil {
+	status, exitCode, err := e.d.CheckTask("ceramic-qa-tests", "", expectedToBeRunning, false, taskId)
+	e.recordCheck(manager.DecisionCheck_TestsInExpectedState, status)
+	if err != nil {
 		return false, err
 	} else if status {
 		// If a non-zero exit code was present, at least one of the test tasks failed to complete successfully.
@@ -132,9 +136,9 @@ func (e e2eTestJob) checkTests(taskId string, expectedToBeRunning bool) (bool, e
 			return false, fmt.Errorf("e2eTestJob: test exited with code %d", *exitCode)
 		}
 		return true, nil
-	} else if expectedToBeRunning && job.IsTimedOut(e.state, manager.DefaultWaitTime) { // Tests did not start in time
+	} else if expectedToBeRunning && e.isTimedOut(manager.DefaultWaitTime) { // Tests did not start in time
 		return false, manager.Error_StartupTimeout
-	} else if !expectedToBeRunning && job.IsTimedOut(e.state, e2eFailureTime) { // Tests did not finish in time
+	} else if !expectedToBeRunning && e.isTimedOut(e2eFailureTime) { // Tests did not finish in time
 		return false, manager.Error_CompletionTimeout
 	} else {
 		return false, nil
@@ -0,0 +1,208 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Allow enough time for infrastructure provisioning workflows as well as all the deployments that follow
+const envBootstrapFailureTime = 6 * time.Hour
+
+var _ manager.JobSm = &envBootstrapJob{}
+
+// envBootstrapJob provisions a new environment by running a sequence of child jobs, one at a time, in order:
+//   - A workflow for provisioning infrastructure (SSM parameters, Route53 records, etc.)
+//   - A bootstrap job for creating each service
+//   - A deployment for each component
+//
+// Each step is only queued once the previous one has finished so that the child jobs are coordinated with all other
+// jobs by the job manager, like any other job.
+type envBootstrapJob struct {
+	baseJob
+}
+
+// envBootstrapStep is a child job that will be (or has been) queued by an environment bootstrap job
+type envBootstrapStep struct {
+	JobId  string
+	Type   job.JobType
+	Params map[string]interface{}
+}
+
+func EnvBootstrapJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock) (manager.JobSm, error) {
+	_, hasInfra := jobState.Params[job.EnvBootstrapJobParam_Infra].(map[string]interface{})
+	services, hasServices := jobState.Params[job.EnvBootstrapJobParam_Services].([]interface{})
+	components, hasComponents := jobState.Params[job.EnvBootstrapJobParam_Components].([]interface{})
+	if !hasInfra && !hasServices && !hasComponents {
+		return nil, fmt.Errorf("envBootstrapJob: nothing to bootstrap")
+	} else if cluster, _ := jobState.Params[job.EnvBootstrapJobParam_Cluster].(string); hasServices && ((len(cluster) == 0) || (len(services) == 0)) {
+		return nil, fmt.Errorf("envBootstrapJob: missing cluster or services")
+	} else {
+		for _, component := range components {
+			if c, ok := component.(string); !ok {
+				return nil, fmt.Errorf("envBootstrapJob: invalid component: %v", component)
+			} else if _, err := manager.ComponentRepo(manager.DeployComponent(c)); err != nil {
+				return nil, fmt.Errorf("envBootstrapJob: invalid component: %w", err)
+			}
+		}
+		return &envBootstrapJob{baseJob{jobState, db, notifs, decisions, clock}}, nil
+	}
+}
+
+func (e envBootstrapJob) Advance() (job.JobState, error) {
+	now := e.clock.Now()
+	switch e.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// Plan all the steps up front so that the whole sequence is visible from the start
+			if steps, err := e.planSteps(); err != nil {
+				return e.advance(job.JobStage_Failed, now, err)
+			} else {
+				e.state.Params[job.EnvBootstrapJobParam_Steps] = steps
+				e.state.Params[job.EnvBootstrapJobParam_Step] = float64(0)
+				return e.advance(job.JobStage_Dequeued, now, nil)
+			}
+		}
+	case job.JobStage_Dequeued:
+		{
+			if err := e.queueStep(0); err != nil {
+				return e.advance(job.JobStage_Failed, now, err)
+			} else {
+				e.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				return e.advance(job.JobStage_Started, now, nil)
+			}
+		}
+	case job.JobStage_Started:
+		{
+			if stepFinished, err := e.checkStep(); err != nil {
+				return e.advance(job.JobStage_Failed, now, err)
+			} else if stepFinished {
+				nextStep := e.currentStep() + 1
+				if nextStep == len(e.steps()) {
+					return e.advance(job.JobStage_Completed, now, nil)
+				} else if err = e.queueStep(nextStep); err != nil {
+					return e.advance(job.JobStage_Failed, now, err)
+				}
+				e.state.Params[job.EnvBootstrapJobParam_Step] = float64(nextStep)
+				// Save the updated step without changing the stage of the job. The job manager will update the notification
+				// for the job so that the progress is visible.
+				return e.state, e.db.AdvanceJob(e.state)
+			} else if e.isTimedOut(envBootstrapFailureTime) {
+				return e.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			} else {
+				// Return so we come back again to check
+				return e.state, nil
+			}
+		}
+	default:
+		{
+			return e.advance(job.JobStage_Failed, now, fmt.Errorf("envBootstrapJob: unexpected state: %s", manager.PrintJob(e.state)))
+		}
+	}
+}
+
+func (e envBootstrapJob) planSteps() ([]interface{}, error) {
+	steps := make([]interface{}, 0)
+	addStep := func(jobType job.JobType, params map[string]interface{}) {
+		params[job.JobParam_Source] = manager.ServiceName
+		steps = append(steps, map[string]interface{}{
+			"JobId":  uuid.New().String(),
+			"Type":   string(jobType),
+			"Params": params,
+		})
+	}
+	if infra, found := e.state.Params[job.EnvBootstrapJobParam_Infra].(map[string]interface{}); found {
+		workflowParams := make(map[string]interface{}, len(infra))
+		for k, v := range infra {
+			workflowParams[k] = v
+		}
+		addStep(job.JobType_Workflow, workflowParams)
+	}
+	// Create each service with its own child job so that progress is tracked per service
+	if services, found := e.state.Params[job.EnvBootstrapJobParam_Services].([]interface{}); found {
+		for _, service := range services {
+			addStep(job.JobType_Bootstrap, map[string]interface{}{
+				job.BootstrapJobParam_Cluster:  e.state.Params[job.EnvBootstrapJobParam_Cluster],
+				job.BootstrapJobParam_Services: []interface{}{service},
+			})
+		}
+	}
+	if components, found := e.state.Params[job.EnvBootstrapJobParam_Components].([]interface{}); found && (len(components) > 0) {
+		buildTags, err := e.db.GetBuildTags()
+		if err != nil {
+			return nil, err
+		}
+		for _, component := range components {
+			// Deploy the latest commit, starting from the last one built for the component, if any.
+			addStep(job.JobType_Deploy, map[string]interface{}{
+				job.DeployJobParam_Component: component,
+				job.DeployJobParam_Sha:       job.DeployJobTarget_Latest,
+				job.DeployJobParam_ShaTag:    strings.Split(buildTags[manager.DeployComponent(component.(string))], ",")[0],
+			})
+		}
+	}
+	return steps, nil
+}
+
+func (e envBootstrapJob) steps() []envBootstrapStep {
+	var steps []envBootstrapStep
+	if err := mapstructure.Decode(e.state.Params[job.EnvBootstrapJobParam_Steps], &steps); err != nil {
+		return nil
+	}
+	return steps
+}
+
+func (e envBootstrapJob) currentStep() int {
+	step, _ := e.state.Params[job.EnvBootstrapJobParam_Step].(float64)
+	return int(step)
+}
+
+func (e envBootstrapJob) queueStep(stepIdx int) error {
+	steps := e.steps()
+	if stepIdx >= len(steps) {
+		return fmt.Errorf("envBootstrapJob: missing step %d", stepIdx)
+	}
+	step := steps[stepIdx]
+	return e.db.QueueJob(job.JobState{
+		JobId:    step.JobId,
+		Stage:    job.JobStage_Queued,
+		Type:     step.Type,
+		Ts:       e.clock.Now(),
+		Params:   step.Params,
+		ParentId: e.state.JobId,
+	})
+}
+
+// checkStep returns whether the child job for the current step finished successfully, or an error if it didn't
+func (e envBootstrapJob) checkStep() (bool, error) {
+	steps := e.steps()
+	stepIdx := e.currentStep()
+	if stepIdx >= len(steps) {
+		return false, fmt.Errorf("envBootstrapJob: missing step %d", stepIdx)
+	}
+	step := steps[stepIdx]
+	if childJobs, err := e.db.GetChildJobs(e.state.JobId); err != nil {
+		return false, err
+	} else {
+		for _, childJob := range childJobs {
+			if childJob.JobId == step.JobId {
+				switch childJob.Stage {
+				// A skipped child job was superseded by an equivalent job, e.g. a newer deployment of the same component
+				case job.JobStage_Completed, job.JobStage_Skipped:
+					return true, nil
+				case job.JobStage_Failed, job.JobStage_Canceled:
+					return false, fmt.Errorf("envBootstrapJob: %s step %d/%d %s: %s", step.Type, stepIdx+1, len(steps), childJob.Stage, childJob.JobId)
+				default:
+					return false, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
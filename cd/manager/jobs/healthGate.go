@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Keep retrying health checks for up to 5 minutes by default
+const defaultHealthGateTimeout = 5 * time.Minute
+
+// A healthy endpoint responds quickly, so treat a slow response as a failed check instead of holding up the processing
+// of other jobs. The gate keeps retrying failed checks on later processing iterations until it times out.
+const healthCheckTimeout = 2 * time.Second
+
+var _ manager.JobSm = &healthGateJob{}
+
+// healthGateJob makes sure that a set of HTTP endpoints are healthy, e.g. after a deployment, retrying them until they
+// all pass or the gate times out.
+type healthGateJob struct {
+	baseJob
+	urls    []string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func HealthGateJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock) (manager.JobSm, error) {
+	urls := make([]string, 0)
+	if paramUrls, found := jobState.Params[job.HealthGateJobParam_Urls].([]interface{}); found {
+		for _, paramUrl := range paramUrls {
+			if healthCheckUrl, ok := paramUrl.(string); !ok {
+				return nil, fmt.Errorf("healthGateJob: invalid url: %v", paramUrl)
+			} else if parsedUrl, err := url.Parse(healthCheckUrl); (err != nil) || ((parsedUrl.Scheme != "http") && (parsedUrl.Scheme != "https")) || (len(parsedUrl.Host) == 0) {
+				return nil, fmt.Errorf("healthGateJob: invalid url: %s", healthCheckUrl)
+			} else {
+				urls = append(urls, healthCheckUrl)
+			}
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("healthGateJob: missing urls")
+	}
+	timeout := defaultHealthGateTimeout
+	if timeoutSecs, found := jobState.Params[job.HealthGateJobParam_Timeout].(float64); found {
+		if timeoutSecs <= 0 {
+			return nil, fmt.Errorf("healthGateJob: invalid timeout: %f", timeoutSecs)
+		}
+		timeout = time.Duration(timeoutSecs * float64(time.Second))
+	}
+	return &healthGateJob{baseJob{jobState, db, notifs, decisions, clock}, urls, timeout, &http.Client{}}, nil
+}
+
+func (h healthGateJob) Advance() (job.JobState, error) {
+	now := h.clock.Now()
+	switch h.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return h.advance(job.JobStage_Dequeued, h.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			h.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+			return h.advance(job.JobStage_Started, now, nil)
+		}
+	case job.JobStage_Started:
+		{
+			failing := h.checkHealth()
+			if len(failing) == 0 {
+				delete(h.state.Params, job.HealthGateJobParam_Failing)
+				return h.advance(job.JobStage_Completed, now, nil)
+			}
+			prevFailing, _ := h.state.Params[job.HealthGateJobParam_Failing].([]interface{})
+			h.state.Params[job.HealthGateJobParam_Failing] = failing
+			if h.isTimedOut(h.timeout) {
+				return h.advance(job.JobStage_Failed, now, fmt.Errorf("healthGateJob: unhealthy endpoints: %s", strings.Join(h.failingUrls(failing), ", ")))
+			} else if fmt.Sprint(prevFailing) != fmt.Sprint(failing) {
+				// Save the endpoints that are failing without changing the stage of the job. The job manager will update
+				// the notification for the job so that they are visible.
+				return h.state, h.db.AdvanceJob(h.state)
+			}
+			// Return so we come back again to check
+			return h.state, nil
+		}
+	default:
+		{
+			return h.advance(job.JobStage_Failed, now, fmt.Errorf("healthGateJob: unexpected state: %s", manager.PrintJob(h.state)))
+		}
+	}
+}
+
+// checkHealth checks all endpoints in parallel and returns the ones that aren't healthy, in order
+func (h healthGateJob) checkHealth() []interface{} {
+	failingUrls := make([]string, 0)
+	mu := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, healthCheckUrl := range h.urls {
+		healthCheckUrl := healthCheckUrl
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !h.isHealthy(healthCheckUrl) {
+				mu.Lock()
+				defer mu.Unlock()
+				failingUrls = append(failingUrls, healthCheckUrl)
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Strings(failingUrls)
+	failing := make([]interface{}, len(failingUrls))
+	for i, failingUrl := range failingUrls {
+		failing[i] = failingUrl
+	}
+	return failing
+}
+
+// isHealthy returns true if the endpoint responds with a 2xx status
+func (h healthGateJob) isHealthy(healthCheckUrl string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthCheckUrl, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return (resp.StatusCode >= http.StatusOK) && (resp.StatusCode < http.StatusMultipleChoices)
+}
+
+func (h healthGateJob) failingUrls(failing []interface{}) []string {
+	failingUrls := make([]string, len(failing))
+	for i, failingUrl := range failing {
+		failingUrls[i] = fmt.Sprintf("%v", failingUrl)
+	}
+	return failingUrls
+}
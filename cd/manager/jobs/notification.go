@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Report on the past day by default, e.g. for a daily summary
+const defaultNotificationWindow = 24 * time.Hour
+
+// Stages of the jobs included in a report
+var notificationStages = []job.JobStage{job.JobStage_Completed, job.JobStage_Failed, job.JobStage_Skipped}
+
+var _ manager.JobSm = &notificationJob{}
+
+// notificationJob sends a report of the jobs that finished over a period of time, e.g. a daily summary of deployments
+// when run from a schedule.
+type notificationJob struct {
+	baseJob
+	window time.Duration
+}
+
+func NotificationJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock) (manager.JobSm, error) {
+	window := defaultNotificationWindow
+	if windowSecs, found := jobState.Params[job.NotificationJobParam_Window].(float64); found {
+		if windowSecs <= 0 {
+			return nil, fmt.Errorf("notificationJob: invalid window: %f", windowSecs)
+		}
+		window = time.Duration(windowSecs * float64(time.Second))
+	}
+	return &notificationJob{baseJob{jobState, db, notifs, decisions, clock}, window}, nil
+}
+
+func (n notificationJob) Advance() (job.JobState, error) {
+	now := n.clock.Now()
+	switch n.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return n.advance(job.JobStage_Dequeued, n.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			n.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+			return n.advance(job.JobStage_Started, now, nil)
+		}
+	case job.JobStage_Started:
+		{
+			if err := n.report(now); err != nil {
+				return n.advance(job.JobStage_Failed, now, err)
+			}
+			return n.advance(job.JobStage_Completed, now, nil)
+		}
+	default:
+		{
+			return n.advance(job.JobStage_Failed, now, fmt.Errorf("notificationJob: unexpected state: %s", manager.PrintJob(n.state)))
+		}
+	}
+}
+
+// report counts the jobs that finished within the window, in total and per component, so that the counts can be sent
+// with the job's notification.
+func (n notificationJob) report(now time.Time) error {
+	finishedJobs, err := n.db.GetJobsByDateRange(now.Add(-n.window), now, notificationStages...)
+	if err != nil {
+		return fmt.Errorf("notificationJob: error fetching jobs: %w", err)
+	}
+	// Counts are stored the same way they'll be read back from the database
+	counts := make(map[string]interface{})
+	components := make(map[string]interface{})
+	releases := make(map[string]interface{})
+	for _, finishedJob := range finishedJobs {
+		// Don't count previous reports
+		if finishedJob.Type == job.JobType_Notification {
+			continue
+		}
+		component, _ := finishedJob.Params[job.DeployJobParam_Component].(string)
+		if len(component) == 0 {
+			component = string(finishedJob.Type)
+		}
+		componentCounts, found := components[component].(map[string]interface{})
+		if !found {
+			componentCounts = make(map[string]interface{})
+			components[component] = componentCounts
+		}
+		stage := string(finishedJob.Stage)
+		counts[stage] = countOf(counts, stage) + 1
+		componentCounts[stage] = countOf(componentCounts, stage) + 1
+		// Only completed deployments released their version
+		if (finishedJob.Type == job.JobType_Deploy) && (finishedJob.Stage == job.JobStage_Completed) {
+			if version, _ := manager.DeployVersion(finishedJob); len(version) > 0 {
+				componentReleases, _ := releases[component].([]interface{})
+				releases[component] = append(componentReleases, version)
+			}
+		}
+	}
+	n.state.Params[job.NotificationJobParam_Counts] = counts
+	n.state.Params[job.NotificationJobParam_Components] = components
+	if len(releases) > 0 {
+		n.state.Params[job.NotificationJobParam_Releases] = releases
+	}
+	return nil
+}
+
+func countOf(counts map[string]interface{}, stage string) float64 {
+	count, _ := counts[stage].(float64)
+	return count
+}
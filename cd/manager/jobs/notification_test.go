@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// testHistoryDb returns a fixed set of finished jobs
+type testHistoryDb struct {
+	testDb
+	finished []job.JobState
+}
+
+func (db *testHistoryDb) GetJobsByDateRange(time.Time, time.Time, ...job.JobStage) ([]job.JobState, error) {
+	return db.finished, nil
+}
+
+func TestNotificationJobReportsReleases(t *testing.T) {
+	deploy := func(component manager.DeployComponent, stage job.JobStage, version string) job.JobState {
+		jobState := testDeployState(stage, testSha, nil)
+		jobState.Params[job.DeployJobParam_Component] = string(component)
+		if len(version) > 0 {
+			jobState.Params[job.DeployJobParam_Version] = version
+		}
+		return jobState
+	}
+	db := &testHistoryDb{finished: []job.JobState{
+		deploy(manager.DeployComponent_Ceramic, job.JobStage_Completed, "v2.14.0"),
+		deploy(manager.DeployComponent_Ceramic, job.JobStage_Failed, "v2.15.0"),
+		deploy(manager.DeployComponent_Ceramic, job.JobStage_Completed, "v2.15.1"),
+		deploy(manager.DeployComponent_Cas, job.JobStage_Completed, ""),
+	}}
+	jobState := job.JobState{JobId: "summary", Type: job.JobType_Notification, Stage: job.JobStage_Started, Ts: time.Now(), Params: map[string]interface{}{}}
+	n, err := NotificationJob(jobState, db, testNotifs{}, manager.NewDecisionLog(), manager.SystemClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported, err := n.Advance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only completed deployments with a version were released
+	releases, _ := reported.Params[job.NotificationJobParam_Releases].(map[string]interface{})
+	if (len(releases) != 1) || (fmt.Sprint(releases[string(manager.DeployComponent_Ceramic)]) != "[v2.14.0 v2.15.1]") {
+		t.Fatalf("unexpected releases: %v", releases)
+	}
+}
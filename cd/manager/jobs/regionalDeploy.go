@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Bake each region for 10 minutes by default before moving on to the next one
+const defaultRegionBakeTime = 10 * time.Minute
+
+// Staggered multi-region deployments roll a component out one region at a time. After a region is deployed, it is
+// baked for a while, during which it must remain healthy, before the next region is deployed. If any region fails, the
+// deployment halts and the usual rollback kicks in for the regions that were touched.
+//
+// The current region, its start time, and the status of each region are tracked in the job parameters, and the layout
+// parameter always holds the layout for the current region.
+
+func deployRegions(jobState job.JobState) []string {
+	regions := make([]string, 0)
+	switch paramRegions := jobState.Params[job.DeployJobParam_Regions].(type) {
+	case []interface{}:
+		for _, region := range paramRegions {
+			if r, ok := region.(string); ok {
+				regions = append(regions, r)
+			}
+		}
+	case []string:
+		regions = append(regions, paramRegions...)
+	default:
+		regions = manager.DeployRegions()
+	}
+	return regions
+}
+
+func (d deployJob) isRegional() bool {
+	return len(d.regions) > 0
+}
+
+func (d deployJob) currentRegion() string {
+	if region, found := d.state.Params[job.DeployJobParam_Region].(string); found {
+		return region
+	}
+	return d.regions[0]
+}
+
+func (d deployJob) startRollout() {
+	regions := make([]interface{}, len(d.regions))
+	regionProgress := make(map[string]interface{}, len(d.regions))
+	for i, region := range d.regions {
+		regions[i] = region
+		regionProgress[region] = job.DeployRegionStatus_Pending
+	}
+	d.state.Params[job.DeployJobParam_Regions] = regions
+	d.state.Params[job.DeployJobParam_Region] = d.regions[0]
+	d.state.Params[job.DeployJobParam_RegionProgress] = regionProgress
+}
+
+func (d deployJob) setRegionStatus(status string) {
+	if d.isRegional() {
+		if regionProgress, found := d.state.Params[job.DeployJobParam_RegionProgress].(map[string]interface{}); found {
+			regionProgress[d.currentRegion()] = status
+		}
+	}
+}
+
+func (d deployJob) startRegion(ts time.Time) {
+	d.setRegionStatus(job.DeployRegionStatus_Deploying)
+	d.state.Params[job.DeployJobParam_RegionStart] = float64(ts.UnixNano())
+	// Track the rollout progress for each region separately
+	delete(d.state.Params, job.DeployJobParam_RolloutUpdated)
+	delete(d.state.Params, job.DeployJobParam_RolloutDesired)
+	delete(d.state.Params, job.DeployJobParam_RolloutTs)
+}
+
+func (d deployJob) isLastRegion() bool {
+	return d.currentRegion() == d.regions[len(d.regions)-1]
+}
+
+// isTimedOut checks for timeouts for the current region when deploying to multiple regions, so that each region gets the
+// full amount of time to deploy.
+func (d deployJob) isTimedOut(delay time.Duration) bool {
+	if regionStart, found := d.state.Params[job.DeployJobParam_RegionStart].(float64); found && d.isRegional() {
+		return d.clock.Now().Add(-delay).After(time.Unix(0, int64(regionStart)))
+	}
+	return d.baseJob.isTimedOut(delay)
+}
+
+func (d deployJob) bakeTime() (time.Duration, error) {
+	// Rollbacks need to get working images out everywhere as quickly as possible
+	if d.rollback {
+		return 0, nil
+	}
+	if bakeTime, found := os.LookupEnv("DEPLOY_REGION_BAKE_TIME"); found {
+		if parsedBakeTime, err := time.ParseDuration(bakeTime); err != nil {
+			return 0, fmt.Errorf("deployJob: invalid region bake time: %w", err)
+		} else {
+			return parsedBakeTime, nil
+		}
+	}
+	return defaultRegionBakeTime, nil
+}
+
+// regionDeployed either starts baking the region that was just deployed, or moves on to the next region if there's
+// nothing to bake.
+func (d deployJob) regionDeployed(ts time.Time) (job.JobState, error) {
+	if bakeTime, err := d.bakeTime(); err != nil {
+		d.setRegionStatus(job.DeployRegionStatus_Failed)
+		return d.advance(job.JobStage_Failed, ts, err)
+	} else if bakeTime > 0 {
+		d.setRegionStatus(job.DeployRegionStatus_Baking)
+		d.state.Params[job.DeployJobParam_RegionStart] = float64(ts.UnixNano())
+		return d.advance(job.JobStage_Waiting, ts, nil)
+	}
+	return d.nextRegion(ts)
+}
+
+// bakeRegion makes sure that the current region stays healthy until it has baked long enough to move on
+func (d deployJob) bakeRegion(ts time.Time) (job.JobState, error) {
+	if !d.isRegional() {
+		return d.advance(job.JobStage_Failed, ts, fmt.Errorf("deployJob: unexpected state: %s", manager.PrintJob(d.state)))
+	} else if healthy, err := d.checkEnv(); err != nil {
+		d.setRegionStatus(job.DeployRegionStatus_Failed)
+		return d.advance(job.JobStage_Failed, ts, err)
+	} else if !healthy {
+		d.setRegionStatus(job.DeployRegionStatus_Failed)
+		return d.advance(job.JobStage_Failed, ts, fmt.Errorf("deployJob: region unhealthy while baking: %s", d.currentRegion()))
+	} else if bakeTime, err := d.bakeTime(); err != nil {
+		d.setRegionStatus(job.DeployRegionStatus_Failed)
+		return d.advance(job.JobStage_Failed, ts, err)
+	} else if d.isTimedOut(bakeTime) {
+		return d.nextRegion(ts)
+	}
+	// Return so we come back again to check
+	return d.state, nil
+}
+
+func (d deployJob) nextRegion(ts time.Time) (job.JobState, error) {
+	d.setRegionStatus(job.DeployRegionStatus_Deployed)
+	for i, region := range d.regions[:len(d.regions)-1] {
+		if region == d.currentRegion() {
+			nextRegion := d.regions[i+1]
+			d.state.Params[job.DeployJobParam_Region] = nextRegion
+			// Switch over to the deployment for the next region
+			next := d
+			next.d = d.regionDeployments[nextRegion]
+			if envLayout, err := next.generateEnvLayout(next.component); err != nil {
+				next.setRegionStatus(job.DeployRegionStatus_Failed)
+				return next.advance(job.JobStage_Failed, ts, err)
+			} else {
+				next.state.Params[job.DeployJobParam_Layout] = *envLayout
+				if err = next.updateEnv(); err != nil {
+					next.setRegionStatus(job.DeployRegionStatus_Failed)
+					return next.advance(job.JobStage_Failed, ts, err)
+				}
+				next.startRegion(ts)
+				return next.advance(job.JobStage_Started, ts, nil)
+			}
+		}
+	}
+	return d.advance(job.JobStage_Failed, ts, fmt.Errorf("deployJob: unknown region: %s", d.currentRegion()))
+}
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ manager.JobSm = &secretsRotationJob{}
+
+// secretsRotationJob rotates a secret used by a service without downtime:
+//   - A new version of the secret is generated, leaving the current version in place
+//   - The service is restarted with a task definition pinned to the new version
+//   - Once the restarted service is stable, the new version becomes current and the old version is deactivated
+//
+// Anything else that needs to accept the new secret (e.g. a database user's password) must be updated separately, e.g.
+// by a rotation function configured for the secret.
+type secretsRotationJob struct {
+	baseJob
+	secretId   string
+	cluster    string
+	service    string
+	container  string
+	secretName string
+	d          manager.Deployment
+	s          manager.Secrets
+}
+
+func SecretsRotationJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment, s manager.Secrets) (manager.JobSm, error) {
+	if secretId, found := jobState.Params[job.SecretsRotationJobParam_SecretId].(string); !found || (len(secretId) == 0) {
+		return nil, fmt.Errorf("secretsRotationJob: missing secret id")
+	} else if cluster, found := jobState.Params[job.SecretsRotationJobParam_Cluster].(string); !found || (len(cluster) == 0) {
+		return nil, fmt.Errorf("secretsRotationJob: missing cluster")
+	} else if service, found := jobState.Params[job.SecretsRotationJobParam_Service].(string); !found || (len(service) == 0) {
+		return nil, fmt.Errorf("secretsRotationJob: missing service")
+	} else if container, found := jobState.Params[job.SecretsRotationJobParam_Container].(string); !found || (len(container) == 0) {
+		return nil, fmt.Errorf("secretsRotationJob: missing container")
+	} else if secretName, found := jobState.Params[job.SecretsRotationJobParam_SecretName].(string); !found || (len(secretName) == 0) {
+		return nil, fmt.Errorf("secretsRotationJob: missing secret name")
+	} else {
+		return &secretsRotationJob{baseJob{jobState, db, notifs, decisions, clock}, secretId, cluster, service, container, secretName, d, s}, nil
+	}
+}
+
+func (s secretsRotationJob) Advance() (job.JobState, error) {
+	now := s.clock.Now()
+	switch s.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return s.advance(job.JobStage_Dequeued, s.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			if version, err := s.s.CreateSecretVersion(s.secretId); err != nil {
+				return s.advance(job.JobStage_Failed, now, err)
+			} else if taskDefArn, err := s.d.UpdateServiceSecret(
+				s.cluster,
+				s.service,
+				s.container,
+				s.secretName,
+				// Pin the new version so that the restarted service uses it even before it becomes current. The JSON
+				// key and version stage are left blank.
+				fmt.Sprintf("%s:::%s", version.Arn, version.VersionId),
+			); err != nil {
+				return s.advance(job.JobStage_Failed, now, err)
+			} else {
+				s.state.Params[job.SecretsRotationJobParam_Version] = map[string]interface{}{
+					"Arn":           version.Arn,
+					"VersionId":     version.VersionId,
+					"PrevVersionId": version.PrevVersionId,
+				}
+				s.state.Params[job.SecretsRotationJobParam_TaskDefArn] = taskDefArn
+				s.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				return s.advance(job.JobStage_Started, now, nil)
+			}
+		}
+	case job.JobStage_Started:
+		{
+			taskDefArn, _ := s.state.Params[job.SecretsRotationJobParam_TaskDefArn].(string)
+			if stable, err := s.d.CheckServiceStable(s.cluster, taskDefArn); err != nil {
+				return s.advance(job.JobStage_Failed, now, err)
+			} else if stable {
+				var version manager.SecretVersion
+				if err = mapstructure.Decode(s.state.Params[job.SecretsRotationJobParam_Version], &version); err != nil {
+					return s.advance(job.JobStage_Failed, now, err)
+				} else if err = s.s.PromoteSecretVersion(s.secretId, version); err != nil {
+					return s.advance(job.JobStage_Failed, now, err)
+				} else if err = s.s.DeactivateSecretVersion(s.secretId, version.PrevVersionId); err != nil {
+					return s.advance(job.JobStage_Failed, now, err)
+				}
+				return s.advance(job.JobStage_Completed, now, nil)
+			} else if s.isTimedOut(defaultFailureTime) {
+				// The old version is still current, so it can be used to restore the service if needed
+				return s.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			} else {
+				// Return so we come back again to check
+				return s.state, nil
+			}
+		}
+	default:
+		{
+			return s.advance(job.JobStage_Failed, now, fmt.Errorf("secretsRotationJob: unexpected state: %s", manager.PrintJob(s.state)))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// A burn rate of 1 means that the error budget is being used up exactly as fast as the SLO allows
+const defaultSloMaxBurnRate = 1.0
+
+var _ manager.JobSm = &sloCheckJob{}
+
+// sloCheckJob checks that an SLO's error budget isn't burning too fast, e.g. before deploying, so that changes aren't
+// made to an environment that is already having trouble.
+type sloCheckJob struct {
+	baseJob
+	name        string
+	maxBurnRate float64
+	metrics     manager.Metrics
+}
+
+func SloCheckJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, metrics manager.Metrics) (manager.JobSm, error) {
+	name, _ := jobState.Params[job.SloCheckJobParam_Name].(string)
+	if len(name) == 0 {
+		return nil, fmt.Errorf("sloCheckJob: missing slo name")
+	}
+	// Use the configured max burn rate if one wasn't specified for this job
+	maxBurnRate, found := jobState.Params[job.SloCheckJobParam_MaxBurnRate].(float64)
+	if !found {
+		maxBurnRate = defaultSloMaxBurnRate
+		if maxBurnRateStr, found := os.LookupEnv("SLO_MAX_BURN_RATE"); found {
+			var err error
+			if maxBurnRate, err = strconv.ParseFloat(maxBurnRateStr, 64); err != nil {
+				return nil, fmt.Errorf("sloCheckJob: invalid max burn rate: %s", maxBurnRateStr)
+			}
+		}
+		jobState.Params[job.SloCheckJobParam_MaxBurnRate] = maxBurnRate
+	}
+	if maxBurnRate <= 0 {
+		return nil, fmt.Errorf("sloCheckJob: invalid max burn rate: %f", maxBurnRate)
+	}
+	return &sloCheckJob{baseJob{jobState, db, notifs, decisions, clock}, name, maxBurnRate, metrics}, nil
+}
+
+func (s sloCheckJob) Advance() (job.JobState, error) {
+	now := s.clock.Now()
+	switch s.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return s.advance(job.JobStage_Dequeued, s.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			s.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+			return s.advance(job.JobStage_Started, now, nil)
+		}
+	case job.JobStage_Started:
+		{
+			if burnRate, err := s.metrics.BurnRate(s.name); err != nil {
+				return s.advance(job.JobStage_Failed, now, err)
+			} else {
+				s.state.Params[job.SloCheckJobParam_BurnRate] = burnRate
+				if burnRate > s.maxBurnRate {
+					return s.advance(job.JobStage_Failed, now, fmt.Errorf("sloCheckJob: burn rate too high: %.2f > %.2f", burnRate, s.maxBurnRate))
+				}
+				return s.advance(job.JobStage_Completed, now, nil)
+			}
+		}
+	default:
+		{
+			return s.advance(job.JobStage_Failed, now, fmt.Errorf("sloCheckJob: unexpected state: %s", manager.PrintJob(s.state)))
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package jobs
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/3box/pipeline-tools/cd/manager"
@@ -17,6 +23,9 @@ const FamilyPrefix = "ceramic-qa-tests-smoke--"
 const ContainerName = "ceramic-qa-tests-smoke"
 const NetworkConfigurationParameter = "/ceramic-qa-tests-smoke/network_configuration"
 
+// The test container runs the subset of tests selected by this environment variable, or the full suite if it isn't set
+const smokeTestSelectorEnvVar = "TEST_SELECTOR"
+
 var _ manager.JobSm = &smokeTestJob{}
 
 type smokeTestJob struct {
@@ -25,12 +34,12 @@ type smokeTestJob struct {
 	d   manager.Deployment
 }
 
-func SmokeTestJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, d manager.Deployment) manager.JobSm {
-	return &smokeTestJob{baseJob{jobState, db, notifs}, os.Getenv(manager.EnvVar_Env), d}
+func SmokeTestJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) manager.JobSm {
+	return &smokeTestJob{baseJob{jobState, db, notifs, decisions, clock}, os.Getenv(manager.EnvVar_Env), d}
 }
 
 func (s smokeTestJob) Advance() (job.JobState, error) {
-	now := time.Now()
+	now := s.clock.Now()
 	switch s.state.Stage {
 	case job.JobStage_Queued:
 		{
@@ -42,21 +51,32 @@ func (s smokeTestJob) Advance() (job.JobState, error) {
 		}
 	case job.JobStage_Dequeued:
 		{
-			if id, err := s.d.LaunchTask(ClusterName, FamilyPrefix+s.env, ContainerName, NetworkConfigurationParameter, nil); err != nil {
+			if cluster, err := s.selectCluster(); err != nil {
+				return s.advance(job.JobStage_Failed, now, err)
+			} else
+			// Make sure that the cluster can run tasks so that we fail with a clear error instead of a generic one
+			if clusterInfo, err := s.d.DescribeCluster(cluster); err != nil {
+				return s.advance(job.JobStage_Failed, now, err)
+			} else if clusterInfo.Status != manager.ClusterStatus_Active {
+				return s.advance(job.JobStage_Failed, now, fmt.Errorf("smokeTestJob: cluster %s is not active: %s", cluster, clusterInfo.Status))
+			} else if err = s.launchTests(); err != nil {
 				return s.advance(job.JobStage_Failed, now, err)
 			} else {
-				// Update the job stage and spawned task identifier
-				s.state.Params[job.JobParam_Id] = id
-				s.state.Params[job.JobParam_Start] = float64(time.Now().UnixNano())
 				return s.advance(job.JobStage_Started, now, nil)
 			}
 		}
 	case job.JobStage_Started:
 		{
-			if started, err := s.checkTests(true); err != nil {
-				return s.advance(job.JobStage_Failed, now, err)
-			} else if started {
+			cluster, taskId := s.cluster(), s.state.Params[job.JobParam_Id].(string)
+			result, done := taskWaits.check(s.state, taskId, manager.DefaultWaitTime, func(ctx context.Context) (int, error) {
+				return 0, waitForTaskStarted(ctx, s.d, cluster, taskId)
+			})
+			if done && (result.err == nil) {
 				return s.advance(job.JobStage_Waiting, now, nil)
+			} else if done && !errors.Is(result.err, context.DeadlineExceeded) {
+				return s.advance(job.JobStage_Failed, now, result.err)
+			} else if s.isTimedOut(manager.DefaultWaitTime) { // Tests did not start in time
+				return s.advance(job.JobStage_Failed, now, manager.Error_StartupTimeout)
 			} else {
 				// Return so we come back again to check
 				return s.state, nil
@@ -64,14 +84,32 @@ func (s smokeTestJob) Advance() (job.JobState, error) {
 		}
 	case job.JobStage_Waiting:
 		{
-			if stopped, err := s.checkTests(false); err != nil {
-				return s.advance(job.JobStage_Failed, now, err)
-			} else if stopped {
+			cluster, taskId := s.cluster(), s.state.Params[job.JobParam_Id].(string)
+			result, done := taskWaits.check(s.state, taskId, smokeTestFailureTime, func(ctx context.Context) (int, error) {
+				return s.d.WaitForTaskStopped(ctx, cluster, taskId)
+			})
+			if done && (result.err == nil) {
 				return s.advance(job.JobStage_Completed, now, nil)
-			} else {
-				// Return so we come back again to check
-				return s.state, nil
+			} else if done && (result.exitCode > 0) && s.canRetry() {
+				// The tests ran but failed, which could be due to flakiness, so try again. Infrastructure failures,
+				// where the tests never got to run to completion, are not retried.
+				attempt := s.attempt() + 1
+				log.Printf("smokeTestJob: warning: tests exited with code %d, retrying (%d/%d): %s", result.exitCode, attempt, s.retries(), manager.PrintJob(s.state))
+				s.state.Params[job.SmokeTestJobParam_Retries] = float64(s.retries())
+				s.state.Params[job.SmokeTestJobParam_Attempt] = float64(attempt)
+				s.state.Params[job.SmokeTestJobParam_ExitCode] = float64(result.exitCode)
+				if err := s.launchTests(); err != nil {
+					return s.advance(job.JobStage_Failed, now, err)
+				}
+				return s.advance(job.JobStage_Started, now, nil)
+			} else if done && !errors.Is(result.err, context.DeadlineExceeded) {
+				// The error will describe why the tests failed, including if they exited with a non-zero exit code.
+				return s.advance(job.JobStage_Failed, now, result.err)
+			} else if s.isTimedOut(smokeTestFailureTime) { // Tests did not finish in time
+				return s.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
 			}
+			// Return so we come back again to check
+			return s.state, nil
 		}
 	default:
 		{
@@ -80,20 +118,114 @@ func (s smokeTestJob) Advance() (job.JobState, error) {
 	}
 }
 
-func (s smokeTestJob) checkTests(expectedToBeRunning bool) (bool, error) {
-	if status, exitCode, err := s.d.CheckTask(ClusterName, "", expectedToBeRunning, false, s.state.Params[job.JobParam_Id].(string)); err != nil {
+// taskStarted checks, without waiting, whether a task has started so that we don't hold up the processing of other
+// jobs. A task that has already run to completion has also started, even if it was never seen running.
+func taskStarted(d manager.Deployment, cluster, taskId string) (bool, error) {
+	if running, _, err := d.CheckTask(cluster, "", true, false, taskId); err != nil {
 		return false, err
-	} else if status {
-		// If a non-zero exit code was present, the test failed to complete successfully.
-		if (exitCode != nil) && (*exitCode != 0) {
-			return false, fmt.Errorf("anchorJob: worker exited with code %d", *exitCode)
-		}
+	} else if running {
+		return true, nil
+	} else if stopped, _, err := d.CheckTaskStopped(cluster, taskId); stopped {
+		// How the task exited is checked once the job is waiting for the task to complete
 		return true, nil
-	} else if expectedToBeRunning && job.IsTimedOut(s.state, manager.DefaultWaitTime) { // Tests did not start in time
-		return false, manager.Error_StartupTimeout
-	} else if !expectedToBeRunning && job.IsTimedOut(s.state, smokeTestFailureTime) { // Tests did not finish in time
-		return false, manager.Error_CompletionTimeout
 	} else {
-		return false, nil
+		return false, err
+	}
+}
+
+// waitForTaskStarted waits for a task to start. A task that has already run to completion has also started, even if it
+// was never seen running.
+func waitForTaskStarted(ctx context.Context, d manager.Deployment, cluster, taskId string) error {
+	err := d.WaitForTaskRunning(ctx, cluster, taskId)
+	if (err != nil) && !errors.Is(err, context.DeadlineExceeded) {
+		// The waiter gives up on tasks that stop before they're seen running. How the task exited is checked once the
+		// job is waiting for the task to complete.
+		if stopped, _, _ := d.CheckTaskStopped(cluster, taskId); stopped {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s smokeTestJob) launchTests() error {
+	if networkOverride, err := manager.NetworkOverride(s.state); err != nil {
+		return err
+	} else if overrides, err := manager.TaskOverrides(s.state, s.testOverrides()); err != nil {
+		return err
+	} else if id, err := s.d.LaunchTask(s.cluster(), FamilyPrefix+s.env, ContainerName, NetworkConfigurationParameter, networkOverride, overrides); err != nil {
+		return err
+	} else {
+		// Update the spawned task identifier, and restart the clock for each attempt
+		s.state.Params[job.JobParam_Id] = id
+		s.state.Params[job.JobParam_Start] = float64(s.clock.Now().UnixNano())
+		return nil
+	}
+}
+
+// testOverrides selects the subset of tests to run, if any. A test selector takes precedence, otherwise the tests for the
+// specified component are run. The selection is recorded with the job so that notifications can show which tests ran.
+func (s smokeTestJob) testOverrides() map[string]string {
+	selector, _ := s.state.Params[job.SmokeTestJobParam_TestSelector].(string)
+	if len(selector) == 0 {
+		if component, found := s.state.Params[job.SmokeTestJobParam_Component].(string); found && (len(component) > 0) {
+			selector = component
+			s.state.Params[job.SmokeTestJobParam_TestSelector] = selector
+		}
+	}
+	if len(selector) > 0 {
+		return map[string]string{smokeTestSelectorEnvVar: selector}
+	}
+	return nil
+}
+
+// retries returns the number of times failed tests should be relaunched, which can be set per job or configured for all
+// jobs.
+func (s smokeTestJob) retries() int {
+	if retries, found := s.state.Params[job.SmokeTestJobParam_Retries].(float64); found {
+		return int(retries)
+	} else if retries, err := strconv.Atoi(os.Getenv("SMOKE_TEST_RETRIES")); err == nil {
+		return retries
+	}
+	return 0
+}
+
+func (s smokeTestJob) attempt() int {
+	attempt, _ := s.state.Params[job.SmokeTestJobParam_Attempt].(float64)
+	return int(attempt)
+}
+
+func (s smokeTestJob) canRetry() bool {
+	return s.attempt() < s.retries()
+}
+
+// selectCluster picks the cluster to run the tests on. If a filter is configured, the first matching cluster (in
+// alphabetical order) is used so that tests can run on newly provisioned clusters, otherwise the default cluster is used.
+func (s smokeTestJob) selectCluster() (string, error) {
+	clusterFilter, found := os.LookupEnv("SMOKE_TEST_CLUSTER_FILTER")
+	if !found {
+		return ClusterName, nil
+	}
+	clusterRegex, err := regexp.Compile(clusterFilter)
+	if err != nil {
+		return "", fmt.Errorf("smokeTestJob: invalid cluster filter: %w", err)
+	}
+	clusters, err := s.d.GetClusterList()
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		if clusterRegex.MatchString(cluster) {
+			s.state.Params[job.SmokeTestJobParam_Cluster] = cluster
+			return cluster, nil
+		}
+	}
+	return "", fmt.Errorf("smokeTestJob: no cluster matches filter: %s", clusterFilter)
+}
+
+func (s smokeTestJob) cluster() string {
+	if cluster, found := s.state.Params[job.SmokeTestJobParam_Cluster].(string); found {
+		return cluster
 	}
+	return ClusterName
 }
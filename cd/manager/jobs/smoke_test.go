@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// testTaskDeployment only implements the deployment operations used to wait for tasks, which block until released
+type testTaskDeployment struct {
+	manager.Deployment
+	running chan error
+	stopped chan taskResult
+}
+
+func (d testTaskDeployment) WaitForTaskRunning(ctx context.Context, _, _ string) error {
+	select {
+	case err := <-d.running:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d testTaskDeployment) WaitForTaskStopped(ctx context.Context, _, _ string) (int, error) {
+	select {
+	case result := <-d.stopped:
+		return result.exitCode, result.err
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+}
+
+func testSmokeState(jobId string, stage job.JobStage) job.JobState {
+	return job.JobState{JobId: jobId, Type: job.JobType_TestSmoke, Stage: stage, Ts: time.Now(), Params: map[string]interface{}{
+		job.JobParam_Id:    "task",
+		job.JobParam_Start: float64(time.Now().UnixNano()),
+	}}
+}
+
+// advanceUntil advances a job on every tick until it reaches the expected stage
+func advanceUntil(t *testing.T, sm manager.JobSm, stage job.JobStage) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if jobState, err := sm.Advance(); err != nil {
+			t.Fatal(err)
+		} else if jobState.Stage == stage {
+			return
+		}
+	}
+	t.Fatalf("job did not reach %s", stage)
+}
+
+func TestSmokeTestJobWaitsForTaskInBackground(t *testing.T) {
+	d := testTaskDeployment{running: make(chan error), stopped: make(chan taskResult)}
+	sm := SmokeTestJob(testSmokeState("smoke", job.JobStage_Started), new(testDb), testNotifs{}, manager.NewDecisionLog(), manager.SystemClock{}, d)
+	// Ticks don't wait for the task to start
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if jobState, err := sm.Advance(); err != nil {
+			t.Fatal(err)
+		} else if jobState.Stage != job.JobStage_Started {
+			t.Fatalf("job advanced before the task started: %s", jobState.Stage)
+		} else if time.Since(start) > 100*time.Millisecond {
+			t.Fatal("tick blocked on the task")
+		}
+	}
+	// The first tick after the task has started picks up the result
+	d.running <- nil
+	advanceUntil(t, sm, job.JobStage_Waiting)
+	// The same goes for waiting for the task to stop
+	sm = SmokeTestJob(testSmokeState("smoke", job.JobStage_Waiting), new(testDb), testNotifs{}, manager.NewDecisionLog(), manager.SystemClock{}, d)
+	if jobState, err := sm.Advance(); err != nil {
+		t.Fatal(err)
+	} else if jobState.Stage != job.JobStage_Waiting {
+		t.Fatalf("job advanced before the task stopped: %s", jobState.Stage)
+	}
+	d.stopped <- taskResult{0, nil}
+	advanceUntil(t, sm, job.JobStage_Completed)
+}
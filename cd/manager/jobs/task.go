@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ manager.JobSm = &taskJob{}
+
+// taskJob runs a one-off task described entirely by its job parameters, so that simple tasks don't each need their own
+// job type.
+type taskJob struct {
+	baseJob
+	spec job.TaskSpec
+	d    manager.Deployment
+}
+
+func TaskJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) (manager.JobSm, error) {
+	if spec, err := job.CreateTaskSpec(jobState); err != nil {
+		return nil, fmt.Errorf("taskJob: failed to create task spec: %w, %s", err, manager.PrintJob(jobState))
+	} else {
+		return &taskJob{baseJob{jobState, db, notifs, decisions, clock}, spec, d}, nil
+	}
+}
+
+func (t taskJob) Advance() (job.JobState, error) {
+	now := t.clock.Now()
+	switch t.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return t.advance(job.JobStage_Dequeued, t.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			if networkOverride, err := manager.NetworkOverride(t.state); err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else if overrides, err := manager.TaskOverrides(t.state, t.spec.Overrides); err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else if id, err := t.d.LaunchTask(t.spec.Cluster, t.spec.Family, t.spec.Container, t.spec.NetworkConfig, networkOverride, overrides); err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else {
+				// Update the job stage and spawned task identifier
+				t.state.Params[job.JobParam_Id] = id
+				t.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				return t.advance(job.JobStage_Started, now, nil)
+			}
+		}
+	case job.JobStage_Started:
+		{
+			started, err := taskStarted(t.d, t.spec.Cluster, t.state.Params[job.JobParam_Id].(string))
+			if err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			}
+			t.recordCheck(manager.DecisionCheck_TaskRunning, started)
+			if started {
+				return t.advance(job.JobStage_Waiting, now, nil)
+			}
+			timedOut := t.isTimedOut(t.spec.StartupTimeout)
+			t.recordCheck(manager.DecisionCheck_StartupTimedOut, timedOut)
+			if timedOut { // Task did not start in time
+				return t.advance(job.JobStage_Failed, now, manager.Error_StartupTimeout)
+			}
+			// Return so we come back again to check
+			return t.state, nil
+		}
+	case job.JobStage_Waiting:
+		{
+			stopped, _, err := t.d.CheckTaskStopped(t.spec.Cluster, t.state.Params[job.JobParam_Id].(string))
+			t.recordCheck(manager.DecisionCheck_TaskStopped, stopped)
+			if stopped && (err == nil) {
+				return t.advance(job.JobStage_Completed, now, nil)
+			} else if err != nil {
+				// The error will describe why the task failed, including if it exited with a non-zero exit code.
+				return t.advance(job.JobStage_Failed, now, err)
+			}
+			timedOut := t.isTimedOut(t.spec.CompletionTimeout)
+			t.recordCheck(manager.DecisionCheck_CompletionTimedOut, timedOut)
+			if timedOut { // Task did not finish in time
+				return t.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			}
+			// Return so we come back again to check
+			return t.state, nil
+		}
+	default:
+		{
+			return t.advance(job.JobStage_Failed, now, fmt.Errorf("taskJob: unexpected state: %s", manager.PrintJob(t.state)))
+		}
+	}
+}
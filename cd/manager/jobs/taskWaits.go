@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Waits that no job came back for, e.g. because the job was canceled, are forgotten this long after they time out
+const taskWaitRetention = time.Hour
+
+// taskWaits tracks waits for the tasks launched by jobs. Job state machines are rebuilt on every tick, so a wait is
+// started in the background the first time a job checks on its task, and its result is picked up by the first tick
+// after the wait completes. This lets the ECS waiters back off on their own schedule without holding up the processing
+// of other jobs.
+var taskWaits = newTaskWaiter()
+
+type taskResult struct {
+	exitCode int
+	err      error
+}
+
+type taskWait struct {
+	taskId   string
+	stage    job.JobStage
+	deadline time.Time
+	cancel   context.CancelFunc
+	done     chan taskResult
+}
+
+type taskWaiter struct {
+	mu    *sync.Mutex
+	waits map[string]*taskWait
+}
+
+func newTaskWaiter() *taskWaiter {
+	return &taskWaiter{
+		mu:    new(sync.Mutex),
+		waits: make(map[string]*taskWait),
+	}
+}
+
+// check returns the result of waiting for a job's task without blocking. If no wait is in progress for the task in the
+// job's current stage, one is started in the background by calling wait, and check returns false until it completes.
+// The result of a wait is only returned once.
+func (w *taskWaiter) check(jobState job.JobState, taskId string, timeout time.Duration, wait func(context.Context) (int, error)) (taskResult, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.prune()
+	tw, found := w.waits[jobState.JobId]
+	if found && ((tw.taskId != taskId) || (tw.stage != jobState.Stage)) {
+		// The job has moved on to a different task or stage since the wait was started
+		tw.cancel()
+		found = false
+	}
+	if !found {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		tw = &taskWait{taskId, jobState.Stage, time.Now().Add(timeout), cancel, make(chan taskResult, 1)}
+		w.waits[jobState.JobId] = tw
+		go func() {
+			defer cancel()
+			exitCode, err := wait(ctx)
+			tw.done <- taskResult{exitCode, err}
+		}()
+		return taskResult{}, false
+	}
+	select {
+	case result := <-tw.done:
+		delete(w.waits, jobState.JobId)
+		return result, true
+	default:
+		return taskResult{}, false
+	}
+}
+
+// prune forgets about waits that timed out long ago. Must be called with the mutex held.
+func (w *taskWaiter) prune() {
+	now := time.Now()
+	for jobId, tw := range w.waits {
+		if now.Sub(tw.deadline) > taskWaitRetention {
+			tw.cancel()
+			delete(w.waits, jobId)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Allow up to 30 minutes for a plan to be generated
+const terraformPlanFailureTime = 30 * time.Minute
+
+// `terraform plan -detailed-exitcode` exits with this code when the plan succeeded and there are changes to apply
+const terraformPlanExitCode_Changes = 2
+
+// Terraform summarizes plans as "Plan: 1 to add, 2 to change, 3 to destroy." or "No changes."
+var terraformPlanSummaryRegex = regexp.MustCompile(`Plan: (\d+) to add, (\d+) to change, (\d+) to destroy`)
+
+const terraformPlanNoChanges = "No changes."
+
+var _ manager.JobSm = &terraformPlanJob{}
+
+// terraformPlanJob generates a Terraform plan by running `terraform plan` as a task, then records a summary of the plan
+// from the task logs. Planning is a read-only operation, so there is nothing to roll back if it fails.
+type terraformPlanJob struct {
+	baseJob
+	cluster       string
+	family        string
+	container     string
+	networkConfig string
+	overrides     map[string]string
+	d             manager.Deployment
+}
+
+func TerraformPlanJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) (manager.JobSm, error) {
+	cluster := os.Getenv("TERRAFORM_PLAN_CLUSTER")
+	family := os.Getenv("TERRAFORM_PLAN_FAMILY")
+	container := os.Getenv("TERRAFORM_PLAN_CONTAINER")
+	networkConfig := os.Getenv("TERRAFORM_PLAN_NETWORK_CONFIG")
+	if (len(cluster) == 0) || (len(family) == 0) || (len(container) == 0) || (len(networkConfig) == 0) {
+		return nil, fmt.Errorf("terraformPlanJob: missing task configuration")
+	}
+	var overrides map[string]string = nil
+	if paramOverrides, found := jobState.Params[job.TerraformPlanJobParam_Overrides].(map[string]interface{}); found {
+		overrides = make(map[string]string, len(paramOverrides))
+		for k, v := range paramOverrides {
+			if value, ok := v.(string); !ok {
+				return nil, fmt.Errorf("terraformPlanJob: invalid override: %s", k)
+			} else {
+				overrides[k] = value
+			}
+		}
+	}
+	return &terraformPlanJob{baseJob{jobState, db, notifs, decisions, clock}, cluster, family, container, networkConfig, overrides, d}, nil
+}
+
+func (t terraformPlanJob) Advance() (job.JobState, error) {
+	now := t.clock.Now()
+	switch t.state.Stage {
+	case job.JobStage_Queued:
+		{
+			// No preparation needed so advance the job directly to "dequeued".
+			//
+			// Advance the timestamp by a tiny amount so that the "dequeued" event remains at the same position on the
+			// timeline as the "queued" event but still ahead of it.
+			return t.advance(job.JobStage_Dequeued, t.state.Ts.Add(time.Nanosecond), nil)
+		}
+	case job.JobStage_Dequeued:
+		{
+			if networkOverride, err := manager.NetworkOverride(t.state); err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else if overrides, err := manager.TaskOverrides(t.state, t.overrides); err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else if id, err := t.d.LaunchTask(t.cluster, t.family, t.container, t.networkConfig, networkOverride, overrides); err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else {
+				// Update the job stage and spawned task identifier
+				t.state.Params[job.JobParam_Id] = id
+				t.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+				return t.advance(job.JobStage_Started, now, nil)
+			}
+		}
+	case job.JobStage_Started:
+		{
+			if started, err := taskStarted(t.d, t.cluster, t.state.Params[job.JobParam_Id].(string)); err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else if started {
+				return t.advance(job.JobStage_Waiting, now, nil)
+			} else if t.isTimedOut(manager.DefaultWaitTime) { // Task did not start in time
+				return t.advance(job.JobStage_Failed, now, manager.Error_StartupTimeout)
+			} else {
+				// Return so we come back again to check
+				return t.state, nil
+			}
+		}
+	case job.JobStage_Waiting:
+		{
+			stopped, exitCode, err := t.d.CheckTaskStopped(t.cluster, t.state.Params[job.JobParam_Id].(string))
+			if stopped && ((err == nil) || (exitCode == terraformPlanExitCode_Changes)) {
+				if err = t.summarizePlan(); err != nil {
+					return t.advance(job.JobStage_Failed, now, err)
+				}
+				return t.advance(job.JobStage_Completed, now, nil)
+			} else if err != nil {
+				return t.advance(job.JobStage_Failed, now, err)
+			} else if t.isTimedOut(terraformPlanFailureTime) { // Plan did not finish in time
+				return t.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+			}
+			// Return so we come back again to check
+			return t.state, nil
+		}
+	default:
+		{
+			return t.advance(job.JobStage_Failed, now, fmt.Errorf("terraformPlanJob: unexpected state: %s", manager.PrintJob(t.state)))
+		}
+	}
+}
+
+// summarizePlan records the number of resources the plan would add, change, and destroy
+func (t terraformPlanJob) summarizePlan() error {
+	logs, err := t.d.GetTaskLogs(t.cluster, t.state.Params[job.JobParam_Id].(string), t.container)
+	if err != nil {
+		return err
+	}
+	// Look for the summary from the end of the logs, since that's where Terraform prints it
+	for i := len(logs) - 1; i >= 0; i-- {
+		if strings.Contains(logs[i], terraformPlanNoChanges) {
+			t.state.Params[job.TerraformPlanJobParam_Add] = float64(0)
+			t.state.Params[job.TerraformPlanJobParam_Change] = float64(0)
+			t.state.Params[job.TerraformPlanJobParam_Destroy] = float64(0)
+			return nil
+		} else if matches := terraformPlanSummaryRegex.FindStringSubmatch(logs[i]); matches != nil {
+			// The regex only matches digits, so parsing can't fail
+			add, _ := strconv.Atoi(matches[1])
+			change, _ := strconv.Atoi(matches[2])
+			destroy, _ := strconv.Atoi(matches[3])
+			t.state.Params[job.TerraformPlanJobParam_Add] = float64(add)
+			t.state.Params[job.TerraformPlanJobParam_Change] = float64(change)
+			t.state.Params[job.TerraformPlanJobParam_Destroy] = float64(destroy)
+			return nil
+		}
+	}
+	return fmt.Errorf("terraformPlanJob: plan summary not found in task logs")
+}
@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// All job stages, in the order in which they are displayed
+var jobStages = []job.JobStage{
+	job.JobStage_Queued,
+	job.JobStage_Dequeued,
+	job.JobStage_PendingApproval,
+	job.JobStage_Started,
+	job.JobStage_Waiting,
+	job.JobStage_Completed,
+	job.JobStage_Failed,
+	job.JobStage_Canceled,
+	job.JobStage_Skipped,
+}
+
+type stageTransitions map[job.JobStage][]job.JobStage
+
+// Transitions made by the job state machines, by job type. Any job can also fail from any non-terminal stage, e.g.
+// when it encounters an unexpected stage or panics, and so failures are only listed here when they're part of the
+// regular flow of the job.
+//
+// Transitions are checked as jobs advance, and undeclared ones are logged so that this table can be kept accurate.
+var jobTransitions = map[job.JobType]stageTransitions{
+	job.JobType_Deploy: {
+		// Jobs for tags that are already deployed are skipped
+		job.JobStage_Queued: {job.JobStage_Dequeued, job.JobStage_Skipped},
+		// Queued jobs for components being force deployed are skipped, superseded deployments are canceled, and
+		// deployments that require approval wait for it
+		job.JobStage_Dequeued: {job.JobStage_Started, job.JobStage_Skipped, job.JobStage_Canceled, job.JobStage_PendingApproval},
+		// Approved deployments go back in line with other dequeued jobs, and rejected deployments are canceled
+		job.JobStage_PendingApproval: {job.JobStage_Dequeued, job.JobStage_Canceled},
+		// Deployments complete once stable, or bake (or, for multi-region deployments, bake the last region deployed)
+		job.JobStage_Started: {job.JobStage_Waiting, job.JobStage_Completed, job.JobStage_Canceled},
+		// After baking a region, the deployment moves on to the next one
+		job.JobStage_Waiting: {job.JobStage_Started, job.JobStage_Completed, job.JobStage_Canceled},
+	},
+	job.JobType_Anchor:            waitingJobTransitions(),
+	job.JobType_TestE2E:           waitingJobTransitions(),
+	job.JobType_TestSmoke:         withTransitions(waitingJobTransitions(), job.JobStage_Waiting, job.JobStage_Started), // Relaunches failed tests
+	job.JobType_Workflow:          withTransitions(waitingJobTransitions(), job.JobStage_Waiting, job.JobStage_Canceled),
+	job.JobType_DataBackup:        withTransitions(waitingJobTransitions(), job.JobStage_Started, job.JobStage_Completed),
+	job.JobType_Task:              waitingJobTransitions(),
+	job.JobType_Bootstrap:         startedJobTransitions(),
+	job.JobType_EnvBootstrap:      startedJobTransitions(),
+	job.JobType_SecretsRotation:   startedJobTransitions(),
+	job.JobType_DockerBuild:       withTransitions(waitingJobTransitions(), job.JobStage_Waiting, job.JobStage_Canceled),
+	job.JobType_TerraformPlan:     waitingJobTransitions(),
+	job.JobType_CacheInvalidation: withTransitions(waitingJobTransitions(), job.JobStage_Started, job.JobStage_Completed),
+	job.JobType_SloCheck:          startedJobTransitions(),
+	job.JobType_HealthGate:        startedJobTransitions(),
+	job.JobType_Notification:      startedJobTransitions(),
+}
+
+// JobTypes returns all the job types that the manager processes
+func JobTypes() []job.JobType {
+	jobTypes := maps.Keys(jobTransitions)
+	slices.Sort(jobTypes)
+	return jobTypes
+}
+
+// startedJobTransitions are the transitions for jobs that complete directly after starting
+func startedJobTransitions() stageTransitions {
+	return stageTransitions{
+		job.JobStage_Queued: {job.JobStage_Dequeued},
+		// Queued jobs can be skipped by the manager, e.g. when superseded by equivalent jobs
+		job.JobStage_Dequeued: {job.JobStage_Started, job.JobStage_Skipped},
+		job.JobStage_Started:  {job.JobStage_Completed},
+	}
+}
+
+// waitingJobTransitions are the transitions for jobs that wait for something they started, e.g. a task or workflow
+func waitingJobTransitions() stageTransitions {
+	return stageTransitions{
+		job.JobStage_Queued:   {job.JobStage_Dequeued},
+		job.JobStage_Dequeued: {job.JobStage_Started, job.JobStage_Skipped},
+		job.JobStage_Started:  {job.JobStage_Waiting},
+		job.JobStage_Waiting:  {job.JobStage_Completed},
+	}
+}
+
+func withTransitions(transitions stageTransitions, from job.JobStage, to ...job.JobStage) stageTransitions {
+	transitions[from] = append(transitions[from], to...)
+	return transitions
+}
+
+func isDeclaredTransition(jobType job.JobType, from, to job.JobStage) bool {
+	// Updates within a stage, and failures, are always allowed
+	if (from == to) || (to == job.JobStage_Failed) {
+		return true
+	}
+	for _, stage := range jobTransitions[jobType][from] {
+		if stage == to {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTransition(jobState job.JobState, jobStage job.JobStage) {
+	if !isDeclaredTransition(jobState.Type, jobState.Stage, jobStage) {
+		log.Printf("advance: undeclared transition: %s -> %s, %s", jobState.Stage, jobStage, manager.PrintJob(jobState))
+	}
+}
+
+// StateMachineDiagram returns a Mermaid state diagram of the stages of a job type and the transitions between them
+func StateMachineDiagram(jobType job.JobType) (string, error) {
+	transitions, found := jobTransitions[jobType]
+	if !found {
+		return "", fmt.Errorf("stateMachineDiagram: unknown job type: %s", jobType)
+	}
+	var diagram strings.Builder
+	diagram.WriteString("stateDiagram-v2\n")
+	diagram.WriteString(fmt.Sprintf("    [*] --> %s\n", job.JobStage_Queued))
+	reachable := map[job.JobStage]bool{job.JobStage_Queued: true}
+	for _, from := range jobStages {
+		if job.IsFinishedJob(job.JobState{Stage: from}) {
+			continue
+		}
+		for _, to := range transitions[from] {
+			diagram.WriteString(fmt.Sprintf("    %s --> %s\n", from, to))
+			reachable[to] = true
+		}
+		if len(transitions[from]) > 0 {
+			diagram.WriteString(fmt.Sprintf("    %s --> %s\n", from, job.JobStage_Failed))
+			reachable[job.JobStage_Failed] = true
+		}
+	}
+	for _, stage := range jobStages {
+		if reachable[stage] && job.IsFinishedJob(job.JobState{Stage: stage}) {
+			diagram.WriteString(fmt.Sprintf("    %s --> [*]\n", stage))
+		}
+	}
+	return diagram.String(), nil
+}
@@ -29,7 +29,7 @@ type githubWorkflowJob struct {
 	r        manager.Repository
 }
 
-func GitHubWorkflowJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, r manager.Repository) (manager.JobSm, error) {
+func GitHubWorkflowJob(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, r manager.Repository) (manager.JobSm, error) {
 	if workflow, err := job.CreateWorkflowJob(jobState); err != nil {
 		return nil, err
 	} else {
@@ -52,12 +52,12 @@ func GitHubWorkflowJob(jobState job.JobState, db manager.Database, notifs manage
 			httpClient = oauth2.NewClient(context.Background(), ts)
 		}
 
-		return &githubWorkflowJob{baseJob{jobState, db, notifs}, workflow, env, github.NewClient(httpClient), r}, nil
+		return &githubWorkflowJob{baseJob{jobState, db, notifs, decisions, clock}, workflow, env, github.NewClient(httpClient), r}, nil
 	}
 }
 
 func (w githubWorkflowJob) Advance() (job.JobState, error) {
-	now := time.Now()
+	now := w.clock.Now()
 	switch w.state.Stage {
 	case job.JobStage_Queued:
 		{
@@ -69,54 +69,69 @@ func (w githubWorkflowJob) Advance() (job.JobState, error) {
 		}
 	case job.JobStage_Dequeued:
 		{
-			if err := w.r.StartWorkflow(w.workflow); err != nil {
-				return w.advance(job.JobStage_Failed, now, err)
-			} else {
-				w.state.Params[job.JobParam_Start] = float64(time.Now().UnixNano())
-				return w.advance(job.JobStage_Started, now, nil)
-			}
+			return w.startWorkflow(now)
 		}
 	case job.JobStage_Started:
 		{
-			// The start time should have been filled in by this point. Limit the search to runs after the start of the
-			// job (minus 30 seconds, so we avoid any races).
-			searchTime := time.Unix(0, int64(w.state.Params[job.JobParam_Start].(float64))).Add(-30 * time.Second)
-			if workflowRunId, workflowRunUrl, err := w.r.FindMatchingWorkflowRun(w.workflow, w.state.JobId, searchTime); err != nil {
-				return w.advance(job.JobStage_Failed, now, err)
-			} else if workflowRunId != -1 {
-				// Record workflow details and advance the job
-				w.state.Params[job.JobParam_Id] = float64(workflowRunId)
-				w.state.Params[job.WorkflowJobParam_Url] = workflowRunUrl
-				return w.advance(job.JobStage_Waiting, now, nil)
-			} else if job.IsTimedOut(w.state, manager.DefaultWaitTime) { // Workflow did not start in time
-				return w.advance(job.JobStage_Failed, now, manager.Error_StartupTimeout)
-			} else {
-				// Return so we come back again to check
-				return w.state, nil
-			}
+			return w.findWorkflowRun(now)
 		}
 	case job.JobStage_Waiting:
 		{
-			// The workflow run ID should have been filled in by this point
-			workflowRunId, _ := w.state.Params[job.JobParam_Id].(float64)
-			if status, err := w.r.CheckWorkflowStatus(w.workflow, int64(workflowRunId)); err != nil {
-				return w.advance(job.JobStage_Failed, now, err)
-			} else if status == manager.WorkflowStatus_Success {
+			return w.checkWorkflowRun(now, workflowFailureTime, func() (job.JobState, error) {
 				return w.advance(job.JobStage_Completed, now, nil)
-			} else if status == manager.WorkflowStatus_Failure {
-				return w.advance(job.JobStage_Failed, now, nil)
-			} else if status == manager.WorkflowStatus_Canceled {
-				return w.advance(job.JobStage_Canceled, now, nil)
-			} else if job.IsTimedOut(w.state, workflowFailureTime) { // Workflow did not finish in time
-				return w.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
-			} else {
-				// Return so we come back again to check
-				return w.state, nil
-			}
+			})
 		}
 	default:
 		{
-			return w.advance(job.JobStage_Failed, now, fmt.Errorf("githubWorkflowJob: unexpected state: %w", manager.PrintJob(w.state)))
+			return w.advance(job.JobStage_Failed, now, fmt.Errorf("githubWorkflowJob: unexpected state: %s", manager.PrintJob(w.state)))
 		}
 	}
 }
+
+func (w githubWorkflowJob) startWorkflow(now time.Time) (job.JobState, error) {
+	if err := w.r.StartWorkflow(w.workflow); err != nil {
+		return w.advance(job.JobStage_Failed, now, err)
+	} else {
+		w.state.Params[job.JobParam_Start] = float64(now.UnixNano())
+		return w.advance(job.JobStage_Started, now, nil)
+	}
+}
+
+func (w githubWorkflowJob) findWorkflowRun(now time.Time) (job.JobState, error) {
+	// The start time should have been filled in by this point. Limit the search to runs after the start of the job
+	// (minus 30 seconds, so we avoid any races).
+	searchTime := time.Unix(0, int64(w.state.Params[job.JobParam_Start].(float64))).Add(-30 * time.Second)
+	if workflowRunId, workflowRunUrl, err := w.r.FindMatchingWorkflowRun(w.workflow, w.state.JobId, searchTime); err != nil {
+		return w.advance(job.JobStage_Failed, now, err)
+	} else if workflowRunId != -1 {
+		// Record workflow details and advance the job
+		w.state.Params[job.JobParam_Id] = float64(workflowRunId)
+		w.state.Params[job.WorkflowJobParam_Url] = workflowRunUrl
+		return w.advance(job.JobStage_Waiting, now, nil)
+	} else if w.isTimedOut(manager.DefaultWaitTime) { // Workflow did not start in time
+		return w.advance(job.JobStage_Failed, now, manager.Error_StartupTimeout)
+	} else {
+		// Return so we come back again to check
+		return w.state, nil
+	}
+}
+
+// checkWorkflowRun checks the status of the workflow run, and calls the completion function once the run has succeeded
+func (w githubWorkflowJob) checkWorkflowRun(now time.Time, failureTime time.Duration, complete func() (job.JobState, error)) (job.JobState, error) {
+	// The workflow run ID should have been filled in by this point
+	workflowRunId, _ := w.state.Params[job.JobParam_Id].(float64)
+	if status, err := w.r.CheckWorkflowStatus(w.workflow, int64(workflowRunId)); err != nil {
+		return w.advance(job.JobStage_Failed, now, err)
+	} else if status == manager.WorkflowStatus_Success {
+		return complete()
+	} else if status == manager.WorkflowStatus_Failure {
+		return w.advance(job.JobStage_Failed, now, nil)
+	} else if status == manager.WorkflowStatus_Canceled {
+		return w.advance(job.JobStage_Canceled, now, nil)
+	} else if w.isTimedOut(failureTime) { // Workflow did not finish in time
+		return w.advance(job.JobStage_Failed, now, manager.Error_CompletionTimeout)
+	} else {
+		// Return so we come back again to check
+		return w.state, nil
+	}
+}
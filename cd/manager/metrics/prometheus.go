@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+var _ manager.Metrics = &Prometheus{}
+
+// The SLO name is substituted into the configured burn rate query, e.g. `slo:burn_rate:ratio_rate1h{slo="{slo}"}`
+const burnRateQuerySloPlaceholder = "{slo}"
+
+const (
+	prometheus_StatusSuccess      = "success"
+	prometheus_ResultTypeVector   = "vector"
+	prometheus_ResultTypeScalar   = "scalar"
+	prometheus_InstantQueryPath   = "/api/v1/query"
+	prometheus_AuthorizationType  = "Bearer"
+	prometheus_AuthorizationField = "Authorization"
+)
+
+type Prometheus struct {
+	client        *http.Client
+	baseUrl       string
+	token         string
+	burnRateQuery string
+}
+
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type prometheusSample struct {
+	Value [2]interface{} `json:"value"`
+}
+
+func NewPrometheus() manager.Metrics {
+	return &Prometheus{
+		&http.Client{},
+		strings.TrimSuffix(os.Getenv("PROMETHEUS_URL"), "/"),
+		os.Getenv("PROMETHEUS_BEARER_TOKEN"),
+		os.Getenv("SLO_BURN_RATE_QUERY"),
+	}
+}
+
+// BurnRate returns the current error budget burn rate for an SLO. If the query returns more than one series, e.g. one
+// per region, the highest burn rate is returned.
+func (p Prometheus) BurnRate(sloName string) (float64, error) {
+	if len(p.baseUrl) == 0 {
+		return 0, fmt.Errorf("burnRate: prometheus not configured")
+	} else if len(p.burnRateQuery) == 0 {
+		return 0, fmt.Errorf("burnRate: burn rate query not configured")
+	}
+	query := strings.ReplaceAll(p.burnRateQuery, burnRateQuerySloPlaceholder, sloName)
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseUrl+prometheus_InstantQueryPath+"?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(p.token) > 0 {
+		req.Header.Set(prometheus_AuthorizationField, prometheus_AuthorizationType+" "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var queryResp prometheusResponse
+	if err = json.NewDecoder(resp.Body).Decode(&queryResp); err != nil {
+		return 0, fmt.Errorf("burnRate: error decoding response: %s, %w", resp.Status, err)
+	} else if queryResp.Status != prometheus_StatusSuccess {
+		return 0, fmt.Errorf("burnRate: query failed: %s, %s", resp.Status, queryResp.Error)
+	}
+	samples := make([][2]interface{}, 0)
+	switch queryResp.Data.ResultType {
+	case prometheus_ResultTypeVector:
+		var vector []prometheusSample
+		if err = json.Unmarshal(queryResp.Data.Result, &vector); err != nil {
+			return 0, fmt.Errorf("burnRate: error decoding vector: %w", err)
+		}
+		for _, sample := range vector {
+			samples = append(samples, sample.Value)
+		}
+	case prometheus_ResultTypeScalar:
+		var scalar [2]interface{}
+		if err = json.Unmarshal(queryResp.Data.Result, &scalar); err != nil {
+			return 0, fmt.Errorf("burnRate: error decoding scalar: %w", err)
+		}
+		samples = append(samples, scalar)
+	default:
+		return 0, fmt.Errorf("burnRate: unsupported result type: %s", queryResp.Data.ResultType)
+	}
+	if len(samples) == 0 {
+		return 0, fmt.Errorf("burnRate: no data for slo: %s", sloName)
+	}
+	burnRate := 0.0
+	for i, sample := range samples {
+		// Sample values are returned as strings so that special values like "NaN" can be represented
+		valueStr, _ := sample[1].(string)
+		if value, err := strconv.ParseFloat(valueStr, 64); (err != nil) || math.IsNaN(value) {
+			// Don't let a missing burn rate pass for a low one
+			return 0, fmt.Errorf("burnRate: invalid sample value: %v", sample[1])
+		} else if (i == 0) || (value > burnRate) {
+			burnRate = value
+		}
+	}
+	return burnRate, nil
+}
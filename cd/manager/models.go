@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -51,8 +52,22 @@ const (
 )
 
 var (
-	Error_StartupTimeout    = fmt.Errorf("startup timeout")
-	Error_CompletionTimeout = fmt.Errorf("completion timeout")
+	Error_StartupTimeout       = fmt.Errorf("startup timeout")
+	Error_CompletionTimeout    = fmt.Errorf("completion timeout")
+	Error_Superseded           = fmt.Errorf("superseded")
+	Error_InvalidSha           = fmt.Errorf("invalid commit SHA")
+	Error_InvalidCursor        = fmt.Errorf("invalid cursor")
+	Error_ComponentFrozen      = fmt.Errorf("deploys frozen for component")
+	Error_JobNotFound          = fmt.Errorf("job not found")
+	Error_NotPendingApproval   = fmt.Errorf("job not pending approval")
+	Error_NotApprover          = fmt.Errorf("not an approver for job")
+	Error_Rejected             = fmt.Errorf("rejected")
+	Error_InvalidApprovalToken = fmt.Errorf("invalid approval token")
+	Error_ApprovalExpired      = fmt.Errorf("approval expired")
+	Error_DecisionLogDisabled  = fmt.Errorf("decision log not enabled")
+	Error_NotResponder         = fmt.Errorf("not a responder for alerts")
+	Error_NotAcknowledgeable   = fmt.Errorf("job has no alert to acknowledge")
+	Error_AlreadyAcknowledged  = fmt.Errorf("alert already acknowledged")
 )
 
 const (
@@ -74,7 +89,8 @@ const ServiceName = "cd-manager"
 // an orchestration service (e.g. AWS ECS).
 type Layout struct {
 	Clusters map[string]*Cluster `dynamodbav:"clusters,omitempty"`
-	Repo     *Repo               `dynamodbav:"repo,omitempty"` // Layout repo
+	Repo     *Repo               `dynamodbav:"repo,omitempty"`    // Layout repo
+	Digests  map[string]string   `dynamodbav:"digests,omitempty"` // Digests of the images to deploy, by repo name
 }
 
 type Repo struct {
@@ -100,6 +116,164 @@ type Task struct {
 	Name string `dynamodbav:"name,omitempty"` // Container name
 }
 
+// ServiceSpec describes a service to create when bootstrapping a new environment
+type ServiceSpec struct {
+	Name               string            `dynamodbav:"name"`
+	TaskDefinition     string            `dynamodbav:"taskDefinition"` // Task definition family or ARN
+	DesiredCount       int32             `dynamodbav:"desiredCount"`
+	NetworkConfigParam string            `dynamodbav:"networkConfigParam"` // Parameter holding the network configuration
+	LoadBalancer       *LoadBalancerSpec `dynamodbav:"loadBalancer,omitempty"`
+}
+
+type LoadBalancerSpec struct {
+	TargetGroupArn string `dynamodbav:"targetGroupArn"`
+	ContainerName  string `dynamodbav:"containerName"`
+	ContainerPort  int32  `dynamodbav:"containerPort"`
+}
+
+// NetworkConfig is the network configuration for a task, either read from the parameter store or given explicitly to
+// override it, e.g. to launch a task into an isolated network.
+type NetworkConfig struct {
+	Subnets        []string
+	SecurityGroups []string
+	AssignPublicIp bool
+}
+
+// ClusterInfo describes the current state of a cluster, e.g. for pre-flight checks before launching tasks
+type ClusterInfo struct {
+	Status              string
+	ActiveServicesCount int32
+	RunningTasksCount   int32
+}
+
+const ClusterStatus_Active = "ACTIVE"
+
+// RolloutProgress counts the service tasks running the new version of a layout, out of the total number of tasks
+// desired for the layout's services.
+type RolloutProgress struct {
+	UpdatedCount int32
+	DesiredCount int32
+}
+
+// TaskResult describes how a task that was run to completion exited, along with the last lines of its logs
+type TaskResult struct {
+	TaskId   string
+	ExitCode int
+	Logs     []string
+}
+
+// ServiceEvent is an event reported by the orchestration service for a service, e.g. a task failing to start
+type ServiceEvent struct {
+	Id        string
+	CreatedAt time.Time
+	Message   string
+}
+
+// SystemEvent describes an issue with the manager itself, as opposed to an issue with a job, or a change in its lifecycle
+type SystemEvent struct {
+	Kind     string
+	Message  string
+	Severity string
+	// Job the event is about, if any, e.g. a failed job whose alert was acknowledged
+	JobId string `json:",omitempty"`
+}
+
+const (
+	SystemEventKind_Database   = "database"
+	SystemEventKind_Deployment = "deployment"
+	SystemEventKind_Lifecycle  = "lifecycle"
+	SystemEventKind_Approval   = "approval"
+	SystemEventKind_Ack        = "acknowledgement"
+)
+
+const (
+	SystemEventSeverity_Info     = "info"
+	SystemEventSeverity_Warning  = "warning"
+	SystemEventSeverity_Critical = "critical"
+)
+
+// PendingNotif is a job notification that has not yet been confirmed as delivered to all of its channels. Channels that
+// the notification was delivered to are recorded so that it isn't sent to them again if it needs to be resent.
+type PendingNotif struct {
+	Id        string            `dynamodbav:"id"`
+	Job       job.JobState      `dynamodbav:"job"`
+	Delivered map[string]string `dynamodbav:"delivered"` // Channel ID to message ID
+	Ttl       time.Time         `dynamodbav:"ttl,unixtime"`
+}
+
+// BlockedJob is a dequeued job that could not be started, along with the reasons why
+type BlockedJob struct {
+	Job     job.JobState
+	Reasons []BlockReason
+}
+
+type BlockReason struct {
+	Kind           string
+	Message        string
+	BlockingJobIds []string `json:",omitempty"`
+}
+
+const (
+	BlockReasonKind_Paused           = "paused"
+	BlockReasonKind_JobsInProgress   = "jobs_in_progress"
+	BlockReasonKind_DeployInProgress = "deploy_in_progress"
+	BlockReasonKind_QueuedBehind     = "queued_behind"
+	BlockReasonKind_PendingApproval  = "pending_approval"
+	BlockReasonKind_CircuitOpen      = "circuit_open"
+)
+
+// DeployBreaker describes the circuit breaker that holds deployments after too many of them have failed in a short time,
+// e.g. because of a broken base image
+type DeployBreaker struct {
+	Enabled bool
+	State   DeployBreakerState
+	// Failures within the current window, while the breaker is closed
+	RecentFailures int
+	OpenedAt       *time.Time `json:",omitempty"`
+	// When a deployment will next be allowed through to probe whether deployments are working again
+	ProbeAt    *time.Time `json:",omitempty"`
+	ProbeJobId string     `json:",omitempty"`
+}
+
+type DeployBreakerState string
+
+const (
+	DeployBreakerState_Closed   DeployBreakerState = "closed"
+	DeployBreakerState_Open     DeployBreakerState = "open"
+	DeployBreakerState_HalfOpen DeployBreakerState = "half_open"
+)
+
+// DeployStatus describes where a commit is deployed in this environment, i.e. the components running it and the
+// deployments of it that are in flight.
+type DeployStatus struct {
+	Sha   string
+	Env   EnvType
+	State DeployState
+	// Human-readable summary of the state, e.g. "live in prod" or "deploying to qa"
+	Summary    string
+	Components []DeployComponent
+	Jobs       []job.JobState
+}
+
+type DeployState string
+
+const (
+	DeployState_Live        DeployState = "live"
+	DeployState_Deploying   DeployState = "deploying"
+	DeployState_NotDeployed DeployState = "not_deployed"
+)
+
+// JobStateDelta is a change in the state of a job. Before is the zero value for jobs that didn't previously exist.
+type JobStateDelta struct {
+	Before job.JobState
+	After  job.JobState
+}
+
+// Clock tells the time, so that job state machines can be replayed against the times at which they were advanced
+type Clock interface {
+	Now() time.Time
+}
+
 // JobSm represents job state machine objects processed by the job manager
 type JobSm interface {
 	Advance() (job.JobState, error)
@@ -111,6 +285,23 @@ type ApiGw interface {
 	Invoke(method, resourceId, restApiId, pathWithQueryString string) (string, error)
 }
 
+// Backup represents a backup service that can take on-demand backups of our data stores (e.g. AWS Backup)
+type Backup interface {
+	StartBackup(resourceArn string) (string, error)
+	CheckBackup(backupId string) (bool, error)
+}
+
+// Cdn represents a content delivery network whose caches can be invalidated (e.g. AWS CloudFront)
+type Cdn interface {
+	CreateInvalidation(distributionId string, paths []string) (string, error)
+	CheckInvalidation(distributionId, invalidationId string) (bool, error)
+}
+
+// Metrics represents a monitoring service that tracks service level objectives (e.g. Prometheus)
+type Metrics interface {
+	BurnRate(sloName string) (float64, error)
+}
+
 // Database represents a database service that can be used as a job queue (e.g. AWS DynamoDB). Most popular document
 // databases provide the primitives for them to be used in this fashion.
 type Database interface {
@@ -125,35 +316,106 @@ type Database interface {
 	UpdateDeployTag(DeployComponent, string) error
 	GetBuildTags() (map[DeployComponent]string, error)
 	GetDeployTags() (map[DeployComponent]string, error)
+	GetDeployTagByComponent(DeployComponent) (string, error)
+	GetChildJobs(parentId string) ([]job.JobState, error)
+	GetJobsByDateRange(start, end time.Time, stages ...job.JobStage) ([]job.JobState, error)
+	GetJobHistory(jobId string) ([]job.JobState, error)
+	PaginatedGetJobs(cursor string, limit int) ([]job.JobState, string, error)
+	WriteNotif(PendingNotif) error
+	PendingNotifs() ([]PendingNotif, error)
+	DeleteNotif(id string) error
+	PruneJobs(jobType job.JobType, before time.Time, prune func(jobState job.JobState, rank int) bool) (int, int, error)
+}
+
+// Secrets represents a secret store with versioned secrets (e.g. AWS Secrets Manager)
+type Secrets interface {
+	CreateSecretVersion(secretId string) (SecretVersion, error)
+	PromoteSecretVersion(secretId string, version SecretVersion) error
+	DeactivateSecretVersion(secretId, versionId string) error
+}
+
+// SecretVersion identifies a newly created version of a secret, as well as the version it will replace
+type SecretVersion struct {
+	Arn           string
+	VersionId     string
+	PrevVersionId string
 }
 
 // Cache represents an in-memory cache for job states
 type Cache interface {
 	WriteJob(job.JobState)
+	UpdateJobField(jobId, field string, value interface{}) error
 	DeleteJob(jobId string)
 	JobById(jobId string) (job.JobState, bool)
 	JobsByMatcher(func(job.JobState) bool) []job.JobState
+	JobsByStage(job.JobStage) []job.JobState
 }
 
 // Deployment represents a container orchestration service (e.g. AWS ECS)
 type Deployment interface {
 	LaunchServiceTask(cluster, service, family, container string, overrides map[string]string) (string, error)
-	LaunchTask(cluster, family, container, vpcConfigParam string, overrides map[string]string) (string, error)
+	LaunchTask(cluster, family, container, vpcConfigParam string, networkConfig *NetworkConfig, overrides map[string]string) (string, error)
 	CheckTask(cluster, taskDefId string, running, stable bool, taskIds ...string) (bool, *int32, error)
+	RunTaskAndWait(cluster, family, container, vpcConfigParam string, networkConfig *NetworkConfig, overrides map[string]string, timeout time.Duration) (TaskResult, error)
 	GetLayout(clusters []string) (*Layout, error)
-	UpdateLayout(*Layout, string) error
+	UpdateLayout(*Layout, string, map[string]string) error
 	CheckLayout(*Layout) (bool, error)
+	WaitForTaskRunning(ctx context.Context, cluster, taskId string) error
+	WaitForTaskStopped(ctx context.Context, cluster, taskId string) (int, error)
+	CheckTaskStopped(cluster, taskId string) (bool, int, error)
+	GetTaskDefinitionArn(family string) (string, error)
+	GetServiceTaskDefinitionFamily(cluster, service string) (string, error)
+	CheckServiceExists(cluster, service string) (bool, error)
+	CheckImageExists(repo Repo, tag string) (bool, error)
+	CreateService(cluster string, spec ServiceSpec) error
+	DescribeCluster(cluster string) (ClusterInfo, error)
+	UpdateServiceSecret(cluster, service, container, secretName, valueFrom string) (string, error)
+	CheckServiceStable(cluster, taskDefArn string) (bool, error)
+	GetRolloutProgress(*Layout) (RolloutProgress, error)
+	GetClusterList() ([]string, error)
+	ListServices(cluster string) ([]string, error)
+	GetImageDigest(repo Repo, tag string) (string, error)
+	GetECRImageTags(repo Repo, sha string) ([]string, error)
+	GetTaskLogs(cluster, taskId, container string) ([]string, error)
+	GetContainerImage(cluster, service, container string) (string, error)
+	GetServiceEvents(cluster, service string, limit int) ([]ServiceEvent, error)
+	GetVpcConfig(paramPath string) (NetworkConfig, error)
+	AssertTaskDefinitionHealthy(family, container, image string) error
 }
 
 // Notifs represents a notification service (e.g. Discord)
 type Notifs interface {
 	NotifyJob(...job.JobState)
+	NotifyJobDeferred(delay time.Duration, jobs ...job.JobState)
+	NotifySystem(event SystemEvent)
+	NotifyTest(channel string) error
+	FlushPending(ctx context.Context) error
 }
 
 // Manager represents the job manager, which is the central job orchestrator of this service.
 type Manager interface {
 	NewJob(job.JobState) (job.JobState, error)
 	CheckJob(jobId string) job.JobState
+	ChildJobs(jobId string) ([]job.JobState, error)
+	Jobs(cursor string, limit int) ([]job.JobState, string, error)
+	ComponentTaskDefinition(component DeployComponent) (string, error)
+	ComponentImage(component DeployComponent) (string, error)
+	DeployStatus(sha string) (DeployStatus, error)
+	BlockedJobs() []BlockedJob
+	JobSchedules() []JobSchedule
+	JobStateMachine(jobType job.JobType) (string, error)
+	JobTiming(jobId string) (JobTiming, error)
+	JobTimings(jobType job.JobType, since time.Time) (JobTimingSummary, error)
+	JobDecisions(jobId string) ([]Decision, error)
+	JobHistory(jobId string) ([]job.JobState, error)
+	TestNotification(channel string) error
+	ClusterServices(cluster string) ([]string, error)
+	DeployBreaker() DeployBreaker
+	ResetDeployBreaker()
+	ApproveJob(jobId, approverId string) error
+	RejectJob(jobId, approverId string) error
+	RecordRejectedApproval(target, approverId, action, source string, reason error)
+	AcknowledgeJob(jobId, responderId string) error
 	ProcessJobs(shutdownCh chan bool)
 	Pause()
 }
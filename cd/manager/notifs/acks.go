@@ -0,0 +1,245 @@
+package notifs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const (
+	notifField_Acknowledge    = "Acknowledge"
+	notifField_AcknowledgedBy = "Acknowledged By"
+)
+
+const (
+	pagerDuty_EventsUrl     = "https://events.pagerduty.com/v2/enqueue"
+	pagerDuty_ActionTrigger = "trigger"
+	pagerDuty_Severity      = "critical"
+)
+
+// alertAcks adds links to acknowledge alerts for failed jobs sent to the alerts channel, one per responder, and
+// escalates alerts that aren't acknowledged in time to PagerDuty, if configured. Acknowledgements are recorded by the
+// job manager, which sets them on the cached job.
+//
+// Escalations are only scheduled in memory, so alerts sent before a restart will not be escalated.
+type alertAcks struct {
+	responders   []string
+	baseUrl      string
+	key          []byte
+	alertChannel snowflake.ID
+	cache        manager.Cache
+	escalation   *ackEscalation
+}
+
+// ackEscalation triggers a PagerDuty incident for alerts that haven't been acknowledged within the timeout
+type ackEscalation struct {
+	timeout    time.Duration
+	routingKey string
+	client     *http.Client
+	mu         *sync.Mutex
+	timers     map[string]*time.Timer
+	inFlight   *sync.WaitGroup
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary  string `json:"summary"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+// newAlertAcks returns nil unless there are responders to acknowledge alerts, an alerts channel to send them to, and a
+// base URL and signing key for the links
+func newAlertAcks(cache manager.Cache, inFlight *sync.WaitGroup) (*alertAcks, error) {
+	responders := manager.AlertResponders()
+	baseUrl := strings.TrimSuffix(os.Getenv("APPROVAL_BASE_URL"), "/")
+	key := []byte(os.Getenv("APPROVAL_SIGNING_KEY"))
+	if (len(responders) == 0) || (len(baseUrl) == 0) || (len(key) == 0) {
+		return nil, nil
+	}
+	alertWebhook, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK")
+	if err != nil {
+		return nil, err
+	} else if alertWebhook == nil {
+		return nil, nil
+	}
+	escalation, err := newAckEscalation(inFlight)
+	if err != nil {
+		return nil, err
+	}
+	return &alertAcks{responders, baseUrl, key, alertWebhook.ID(), cache, escalation}, nil
+}
+
+// newAckEscalation returns nil if no escalation timeout or PagerDuty routing key has been configured
+func newAckEscalation(inFlight *sync.WaitGroup) (*ackEscalation, error) {
+	timeoutStr := os.Getenv("ALERT_ACK_TIMEOUT")
+	routingKey := os.Getenv("PAGERDUTY_ROUTING_KEY")
+	if (len(timeoutStr) == 0) || (len(routingKey) == 0) {
+		return nil, nil
+	}
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil {
+		return nil, fmt.Errorf("newAckEscalation: invalid timeout: %v", err)
+	} else if timeout <= 0 {
+		return nil, fmt.Errorf("newAckEscalation: invalid timeout: %s", timeoutStr)
+	}
+	return &ackEscalation{
+		timeout,
+		routingKey,
+		&http.Client{Timeout: manager.DefaultHttpWaitTime},
+		new(sync.Mutex),
+		make(map[string]*time.Timer),
+		inFlight,
+	}, nil
+}
+
+// isAlert returns true if the notification for a job is an alert, i.e. the job failed and is being notified to the
+// alerts channel
+func (a *alertAcks) isAlert(jobState job.JobState, channels []webhook.Client) bool {
+	if (a == nil) || (jobState.Stage != job.JobStage_Failed) {
+		return false
+	}
+	for _, channel := range channels {
+		if (channel != nil) && (channel.ID() == a.alertChannel) {
+			return true
+		}
+	}
+	return false
+}
+
+// getFields returns who acknowledged an alert, or the links to acknowledge it with if no one has yet
+func (a *alertAcks) getFields(jobState job.JobState, duration manager.DurationFormatter) []discord.EmbedField {
+	if ackedBy, found := jobState.Params[job.JobParam_AckedBy].(string); found {
+		ackedByMsg := prettyApprover(ackedBy)
+		if ackTs, found := jobState.Params[job.JobParam_AckTs].(float64); found {
+			if ackTime := duration(time.Unix(0, int64(ackTs)).Sub(jobState.Ts)); len(ackTime) > 0 {
+				ackedByMsg += fmt.Sprintf(" (after %s)", ackTime)
+			}
+		}
+		return []discord.EmbedField{{Name: notifField_AcknowledgedBy, Value: ackedByMsg}}
+	}
+	expiry := manager.AckExpiry(jobState)
+	links := make([]string, 0, len(a.responders))
+	for _, responder := range a.responders {
+		query := url.Values{}
+		query.Set("approver", responder)
+		query.Set("token", manager.ApprovalToken(a.key, jobState.JobId, manager.ApprovalAction_Acknowledge, responder, expiry))
+		links = append(links, fmt.Sprintf(
+			"%s: [acknowledge](%s/jobs/%s/%s?%s)",
+			prettyApprover(responder),
+			a.baseUrl,
+			url.PathEscape(jobState.JobId),
+			manager.ApprovalAction_Acknowledge,
+			query.Encode(),
+		))
+	}
+	return []discord.EmbedField{{Name: notifField_Acknowledge, Value: strings.Join(links, "\n")}}
+}
+
+// scheduleEscalation escalates an alert if it hasn't been acknowledged by the time the escalation timeout runs out. An
+// alert is only ever escalated once, however many times its notification is sent, and alerts that are already past the
+// timeout when they're sent, e.g. when resent after a restart, aren't escalated at all.
+func (a *alertAcks) scheduleEscalation(jobState job.JobState) {
+	if (a.escalation == nil) || manager.IsAcknowledged(jobState) {
+		return
+	}
+	e := a.escalation
+	delay := time.Until(jobState.Ts.Add(e.timeout))
+	if delay <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, found := e.timers[jobState.JobId]; found {
+		return
+	}
+	e.timers[jobState.JobId] = time.AfterFunc(delay, func() {
+		e.inFlight.Add(1)
+		defer e.inFlight.Done()
+		e.mu.Lock()
+		delete(e.timers, jobState.JobId)
+		e.mu.Unlock()
+		// Use the cached job since that's where acknowledgements are recorded
+		if cachedJob, found := a.cache.JobById(jobState.JobId); found && manager.IsAcknowledged(cachedJob) {
+			return
+		}
+		if err := e.trigger(jobState); err != nil {
+			log.Printf("escalateAlert: error triggering pagerduty incident: %v, %s", err, manager.PrintJob(jobState))
+		} else {
+			log.Printf("escalateAlert: alert not acknowledged within %s: %s", e.timeout, manager.PrintJob(jobState))
+		}
+	})
+}
+
+// stop cancels escalations that haven't fired yet
+func (a *alertAcks) stop() int {
+	if (a == nil) || (a.escalation == nil) {
+		return 0
+	}
+	e := a.escalation
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stopped := 0
+	for _, timer := range e.timers {
+		if timer.Stop() {
+			stopped++
+		}
+	}
+	return stopped
+}
+
+func (e *ackEscalation) trigger(jobState job.JobState) error {
+	body, err := json.Marshal(pagerDutyEvent{
+		e.routingKey,
+		pagerDuty_ActionTrigger,
+		// Retried escalations for the same job are folded into the same incident
+		jobState.JobId,
+		pagerDutyPayload{
+			fmt.Sprintf("%s job %s failed and was not acknowledged within %s", jobState.Type, jobState.JobId, e.timeout),
+			notifUsername(manager.EnvType(os.Getenv(manager.EnvVar_Env))),
+			pagerDuty_Severity,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pagerDuty_EventsUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("trigger: unexpected status: %s", resp.Status)
+	}
+	return nil
+}
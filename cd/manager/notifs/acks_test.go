@@ -0,0 +1,96 @@
+package notifs
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+func testAlertAcks(t *testing.T) *alertAcks {
+	t.Helper()
+	t.Setenv("ALERT_RESPONDERS", "alice, 1000000000000000005")
+	t.Setenv("APPROVAL_BASE_URL", "https://cd.example.com/")
+	t.Setenv("APPROVAL_SIGNING_KEY", "key")
+	t.Setenv("DISCORD_ALERT_WEBHOOK", testAlertWebhookUrl)
+	acks, err := newAlertAcks(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if acks == nil {
+		t.Fatal("expected alert acknowledgements to be configured")
+	}
+	return acks
+}
+
+func TestAlertAcksOnlyForFailedJobsInAlertChannel(t *testing.T) {
+	acks := testAlertAcks(t)
+	alerts := testWebhook(t, testAlertWebhookUrl)
+	deployments := testWebhook(t, testDeploymentsWebhookUrl)
+	if !acks.isAlert(job.JobState{Stage: job.JobStage_Failed}, []webhook.Client{deployments, alerts}) {
+		t.Fatal("failed job sent to the alerts channel not treated as an alert")
+	} else if acks.isAlert(job.JobState{Stage: job.JobStage_Failed}, []webhook.Client{deployments}) {
+		t.Fatal("failed job not sent to the alerts channel treated as an alert")
+	} else if acks.isAlert(job.JobState{Stage: job.JobStage_Completed}, []webhook.Client{alerts}) {
+		t.Fatal("completed job treated as an alert")
+	}
+}
+
+func TestAlertAckLinksVerify(t *testing.T) {
+	acks := testAlertAcks(t)
+	jobState := job.JobState{JobId: "job", Stage: job.JobStage_Failed, Ts: time.Now(), Params: map[string]interface{}{}}
+	fields := acks.getFields(jobState, manager.ConfiguredDurationFormatter())
+	if (len(fields) != 1) || (fields[0].Name != notifField_Acknowledge) {
+		t.Fatalf("expected acknowledgement links, got %v", fields)
+	}
+	links := regexp.MustCompile(`\((https://[^)]+)\)`).FindAllStringSubmatch(fields[0].Value, -1)
+	if len(links) != 2 {
+		t.Fatalf("expected a link per responder: %s", fields[0].Value)
+	}
+	for i, responder := range []string{"alice", "1000000000000000005"} {
+		link, err := url.Parse(links[i][1])
+		if err != nil {
+			t.Fatal(err)
+		} else if link.Path != "/jobs/job/"+manager.ApprovalAction_Acknowledge {
+			t.Fatalf("unexpected link path: %s", link.Path)
+		} else if approver := link.Query().Get("approver"); approver != responder {
+			t.Fatalf("expected link for %s, got %s", responder, approver)
+		} else if err = manager.VerifyApprovalToken([]byte("key"), link.Query().Get("token"), "job", manager.ApprovalAction_Acknowledge, responder, time.Now()); err != nil {
+			t.Fatalf("link token did not verify: %v", err)
+		}
+	}
+}
+
+func TestAlertAckShowsResponder(t *testing.T) {
+	acks := testAlertAcks(t)
+	now := time.Now()
+	jobState := job.JobState{JobId: "job", Stage: job.JobStage_Failed, Ts: now, Params: map[string]interface{}{
+		job.JobParam_AckedBy: "alice",
+		job.JobParam_AckTs:   float64(now.Add(5 * time.Minute).UnixNano()),
+	}}
+	fields := acks.getFields(jobState, manager.ConfiguredDurationFormatter())
+	if (len(fields) != 1) || (fields[0].Name != notifField_AcknowledgedBy) {
+		t.Fatalf("expected who acknowledged the alert, got %v", fields)
+	} else if !strings.HasPrefix(fields[0].Value, "alice") || strings.Contains(fields[0].Value, "http") {
+		t.Fatalf("unexpected acknowledgement: %s", fields[0].Value)
+	}
+}
+
+func TestAlertAcksNotConfigured(t *testing.T) {
+	t.Setenv("ALERT_RESPONDERS", "")
+	t.Setenv("APPROVAL_BASE_URL", "https://cd.example.com")
+	t.Setenv("APPROVAL_SIGNING_KEY", "key")
+	t.Setenv("DISCORD_ALERT_WEBHOOK", testAlertWebhookUrl)
+	if acks, err := newAlertAcks(nil, nil); err != nil {
+		t.Fatal(err)
+	} else if acks != nil {
+		t.Fatal("expected no acknowledgements without responders")
+	} else if acks.isAlert(job.JobState{Stage: job.JobStage_Failed}, nil) {
+		t.Fatal("expected no alerts without acknowledgements")
+	}
+}
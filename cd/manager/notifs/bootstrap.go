@@ -0,0 +1,71 @@
+package notifs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &bootstrapNotif{}
+
+const bootstrapNotifField_Cluster = "Cluster"
+
+type bootstrapNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+	env                manager.EnvType
+}
+
+func newBootstrapNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &bootstrapNotif{jobState, d, a, manager.EnvType(os.Getenv(manager.EnvVar_Env))}, nil
+	}
+}
+
+func (b bootstrapNotif) getChannels() []webhook.Client {
+	webhooks := []webhook.Client{b.deploymentsWebhook}
+	// Also send bootstrap failures to the alerts channel
+	if b.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, b.alertWebhook)
+	}
+	return webhooks
+}
+
+func (b bootstrapNotif) getTitle() string {
+	prettyStage := string(b.state.Stage)
+	if b.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("3Box Labs `%s` Environment Bootstrap %s", envName(b.env), strings.ToUpper(prettyStage))
+}
+
+func (b bootstrapNotif) getFields() []discord.EmbedField {
+	if cluster, found := b.state.Params[job.BootstrapJobParam_Cluster].(string); found {
+		return []discord.EmbedField{
+			{
+				Name:  bootstrapNotifField_Cluster,
+				Value: cluster,
+			},
+		}
+	}
+	return nil
+}
+
+func (b bootstrapNotif) getColor() discordColor {
+	return colorForStage(b.state.Stage)
+}
+
+func (b bootstrapNotif) getUrl() string {
+	return ""
+}
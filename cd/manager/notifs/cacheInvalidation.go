@@ -0,0 +1,96 @@
+package notifs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &cacheInvalidationNotif{}
+
+const (
+	cacheInvalidationNotifField_Distribution = "Distribution"
+	cacheInvalidationNotifField_Paths        = "Paths"
+)
+
+type cacheInvalidationNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+}
+
+func newCacheInvalidationNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &cacheInvalidationNotif{jobState, d, a}, nil
+	}
+}
+
+func (c cacheInvalidationNotif) getChannels() []webhook.Client {
+	// Caches are invalidated after deployments, so report invalidations alongside deployments.
+	webhooks := []webhook.Client{c.deploymentsWebhook}
+	// Also send invalidation failures to the alerts channel
+	if c.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, c.alertWebhook)
+	}
+	return webhooks
+}
+
+func (c cacheInvalidationNotif) getTitle() string {
+	prettyStage := string(c.state.Stage)
+	if c.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("Cache Invalidation %s", strings.ToUpper(prettyStage))
+}
+
+func (c cacheInvalidationNotif) getFields() []discord.EmbedField {
+	fields := make([]discord.EmbedField, 0)
+	if distributionId, found := c.state.Params[job.CacheInvalidationJobParam_DistributionId].(string); found {
+		fields = append(fields, discord.EmbedField{
+			Name:  cacheInvalidationNotifField_Distribution,
+			Value: distributionId,
+		})
+	}
+	// Paths are strings when set by the job, and generic values when loaded from the database
+	paths := make([]string, 0)
+	switch paramPaths := c.state.Params[job.CacheInvalidationJobParam_Paths].(type) {
+	case []string:
+		paths = paramPaths
+	case []interface{}:
+		for _, path := range paramPaths {
+			paths = append(paths, fmt.Sprintf("%v", path))
+		}
+	}
+	if len(paths) > 0 {
+		fields = append(fields, discord.EmbedField{
+			Name:  cacheInvalidationNotifField_Paths,
+			Value: strings.Join(paths, "\n"),
+		})
+	}
+	return fields
+}
+
+func (c cacheInvalidationNotif) getColor() discordColor {
+	return colorForStage(c.state.Stage)
+}
+
+func (c cacheInvalidationNotif) getUrl() string {
+	if distributionId, found := c.state.Params[job.CacheInvalidationJobParam_DistributionId].(string); found {
+		if invalidationId, found := c.state.Params[job.JobParam_Id].(string); found {
+			return fmt.Sprintf(
+				"https://console.aws.amazon.com/cloudfront/v4/home#/distributions/%s/invalidations/details/%s",
+				distributionId,
+				invalidationId,
+			)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package notifs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ manager.Notifs = &CompositeNotifs{}
+
+// CompositeNotifs fans notifications out to multiple notification services, in order
+type CompositeNotifs struct {
+	notifs []manager.Notifs
+}
+
+func NewCompositeNotifs(notifs ...manager.Notifs) manager.Notifs {
+	return &CompositeNotifs{notifs}
+}
+
+func (c CompositeNotifs) NotifyJob(jobs ...job.JobState) {
+	for _, n := range c.notifs {
+		n.NotifyJob(jobs...)
+	}
+}
+
+func (c CompositeNotifs) NotifyJobDeferred(delay time.Duration, jobs ...job.JobState) {
+	for _, n := range c.notifs {
+		n.NotifyJobDeferred(delay, jobs...)
+	}
+}
+
+func (c CompositeNotifs) NotifySystem(event manager.SystemEvent) {
+	for _, n := range c.notifs {
+		n.NotifySystem(event)
+	}
+}
+
+func (c CompositeNotifs) NotifyTest(channel string) error {
+	errs := make([]string, 0)
+	for _, n := range c.notifs {
+		if err := n.NotifyTest(channel); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("notifyTest: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (c CompositeNotifs) FlushPending(ctx context.Context) error {
+	errs := make([]string, 0)
+	for _, n := range c.notifs {
+		if err := n.FlushPending(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("flushPending: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
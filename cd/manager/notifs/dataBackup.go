@@ -0,0 +1,79 @@
+package notifs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &dataBackupNotif{}
+
+const dataBackupNotifField_Resource = "Resource"
+
+type dataBackupNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+	region             string
+}
+
+func newDataBackupNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &dataBackupNotif{jobState, d, a, os.Getenv("AWS_REGION")}, nil
+	}
+}
+
+func (b dataBackupNotif) getChannels() []webhook.Client {
+	// Backups are taken ahead of deployments, so report them alongside deployments.
+	webhooks := []webhook.Client{b.deploymentsWebhook}
+	// Also send backup failures to the alerts channel
+	if b.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, b.alertWebhook)
+	}
+	return webhooks
+}
+
+func (b dataBackupNotif) getTitle() string {
+	prettyStage := string(b.state.Stage)
+	if b.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("Data Backup %s", strings.ToUpper(prettyStage))
+}
+
+func (b dataBackupNotif) getFields() []discord.EmbedField {
+	if resourceArn, found := b.state.Params[job.DataBackupJobParam_ResourceArn].(string); found {
+		return []discord.EmbedField{
+			{
+				Name:  dataBackupNotifField_Resource,
+				Value: resourceArn,
+			},
+		}
+	}
+	return nil
+}
+
+func (b dataBackupNotif) getColor() discordColor {
+	return colorForStage(b.state.Stage)
+}
+
+func (b dataBackupNotif) getUrl() string {
+	if backupId, found := b.state.Params[job.JobParam_Id].(string); found {
+		return fmt.Sprintf(
+			"https://%s.console.aws.amazon.com/backup/home?region=%s#/jobs/backup/details/%s",
+			b.region,
+			b.region,
+			backupId,
+		)
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package notifs
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+type deferredNotif struct {
+	timer *time.Timer
+	stage job.JobStage
+}
+
+// deferredNotifs keeps track of notifications scheduled to be sent after a delay. A deferred notification is canceled
+// if its job moves to a different stage before the delay expires, so that notifications like "still queued" don't go
+// out for jobs that have since moved on.
+type deferredNotifs struct {
+	mu      *sync.Mutex
+	pending map[string]deferredNotif
+	cache   manager.Cache
+	notify  func(...job.JobState)
+}
+
+func newDeferredNotifs(cache manager.Cache, notify func(...job.JobState)) *deferredNotifs {
+	return &deferredNotifs{new(sync.Mutex), make(map[string]deferredNotif), cache, notify}
+}
+
+// schedule replaces any notification already scheduled for the same job
+func (d *deferredNotifs) schedule(delay time.Duration, jobs ...job.JobState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, jobState := range jobs {
+		jobState := jobState
+		if pending, found := d.pending[jobState.JobId]; found {
+			pending.timer.Stop()
+		}
+		var timer *time.Timer
+		timer = time.AfterFunc(delay, func() {
+			d.mu.Lock()
+			// Only clear the entry for this timer, and not one that replaced it after this timer had already fired.
+			if pending, found := d.pending[jobState.JobId]; found && (pending.timer == timer) {
+				delete(d.pending, jobState.JobId)
+			}
+			d.mu.Unlock()
+			// Check the cache in case the job moved on without a notification being sent. Queued jobs aren't cached, so
+			// the job is sent as it was scheduled if it isn't found.
+			if cachedJob, found := d.cache.JobById(jobState.JobId); found {
+				if cachedJob.Stage != jobState.Stage {
+					log.Printf("notifyJobDeferred: skipping notification for job in new stage: %s, %s", cachedJob.Stage, manager.PrintJob(jobState))
+					return
+				}
+				// Send the job as it is now, e.g. with parameters updated since the notification was scheduled
+				jobState = cachedJob
+			}
+			d.notify(jobState)
+		})
+		d.pending[jobState.JobId] = deferredNotif{timer, jobState.Stage}
+	}
+}
+
+// cancelTransitioned cancels notifications scheduled for jobs that have moved to a different stage
+func (d *deferredNotifs) cancelTransitioned(jobs ...job.JobState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, jobState := range jobs {
+		if pending, found := d.pending[jobState.JobId]; found && (pending.stage != jobState.Stage) {
+			pending.timer.Stop()
+			delete(d.pending, jobState.JobId)
+		}
+	}
+}
+
+// cancelAll cancels all scheduled notifications, e.g. when the manager is shutting down
+func (d *deferredNotifs) cancelAll() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	canceled := 0
+	for jobId, pending := range d.pending {
+		if pending.timer.Stop() {
+			canceled++
+		}
+		delete(d.pending, jobId)
+	}
+	return canceled
+}
@@ -0,0 +1,57 @@
+package notifs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+func TestDeferredNotifsSendCurrentJob(t *testing.T) {
+	cache := common.NewJobCache()
+	now := time.Now()
+	cache.WriteJob(job.JobState{JobId: "job", Stage: job.JobStage_Started, Ts: now, Params: map[string]interface{}{"attempt": 1.0}})
+	sent := make(chan job.JobState, 1)
+	d := newDeferredNotifs(cache, func(jobs ...job.JobState) { sent <- jobs[0] })
+	d.schedule(10*time.Millisecond, job.JobState{JobId: "job", Stage: job.JobStage_Started, Ts: now, Params: map[string]interface{}{}})
+	// Update the job without changing its stage after the notification was scheduled
+	cache.WriteJob(job.JobState{JobId: "job", Stage: job.JobStage_Started, Ts: now.Add(time.Second), Params: map[string]interface{}{"attempt": 2.0}})
+	select {
+	case jobState := <-sent:
+		if jobState.Params["attempt"] != 2.0 {
+			t.Fatalf("expected the current job to be sent, got %v", jobState.Params)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deferred notification not sent")
+	}
+}
+
+func TestDeferredNotifsSkipTransitionedJob(t *testing.T) {
+	cache := common.NewJobCache()
+	now := time.Now()
+	sent := make(chan job.JobState, 1)
+	d := newDeferredNotifs(cache, func(jobs ...job.JobState) { sent <- jobs[0] })
+	d.schedule(10*time.Millisecond, job.JobState{JobId: "job", Stage: job.JobStage_Queued, Ts: now})
+	cache.WriteJob(job.JobState{JobId: "job", Stage: job.JobStage_Dequeued, Ts: now.Add(time.Second)})
+	select {
+	case jobState := <-sent:
+		t.Fatalf("notification sent for a job that moved on: %s", jobState.Stage)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDeferredNotifsSendUncachedJob(t *testing.T) {
+	sent := make(chan job.JobState, 1)
+	d := newDeferredNotifs(common.NewJobCache(), func(jobs ...job.JobState) { sent <- jobs[0] })
+	// Queued jobs aren't cached
+	d.schedule(10*time.Millisecond, job.JobState{JobId: "job", Stage: job.JobStage_Queued, Ts: time.Now()})
+	select {
+	case jobState := <-sent:
+		if jobState.Stage != job.JobStage_Queued {
+			t.Fatalf("unexpected job sent: %s", jobState.Stage)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deferred notification not sent")
+	}
+}
@@ -1,15 +1,20 @@
 package notifs
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
 
 	"github.com/3box/pipeline-tools/cd/manager"
 	"github.com/3box/pipeline-tools/cd/manager/common/job"
@@ -23,8 +28,35 @@ type deployNotif struct {
 	communityWebhook   webhook.Client
 	alertWebhook       webhook.Client
 	env                manager.EnvType
+	// Stage of the last deployment of the same component to complete or fail, if any
+	previousOutcome job.JobStage
+	suppressRepeats bool
+	// Base URL of the manager's API and the key to sign approval links with, for links to approve or reject deployments
+	approvalBaseUrl string
+	approvalKey     []byte
 }
 
+const envDisplayNameMapEnv = "ENV_DISPLAY_NAME_MAP_JSON"
+
+const deployNotifField_Version = "Release Version"
+const deployNotifField_Regions = "Regions"
+const deployNotifField_Tests = "Tests"
+const deployNotifField_Rollout = "Rollout"
+const deployNotifField_Freeze = "Freeze"
+const deployNotifField_ServiceEvents = "Service Events"
+const deployNotifField_WorkflowRun = "Triggered By"
+const deployNotifField_Approvers = "Approvers"
+const deployNotifField_ApprovedBy = "Approved By"
+const deployNotifField_ApprovalLinks = "Approve / Reject"
+
+const deployNotifWarning_TestsSkipped = "⚠️ Tests skipped"
+const deployNotifWarning_Frozen = "⚠️ Deploys frozen for component"
+const deployNotifWarning_FreezeOverridden = "⚠️ Freeze overridden"
+
+const prettyStageRecovered = "✅ recovered"
+const prettyStageBaking = "🍞 baking"
+const prettyStagePendingApproval = "⏳ awaiting approval"
+
 const (
 	envName_Dev  string = "dev"
 	envName_Qa   string = "dev-qa"
@@ -32,7 +64,7 @@ const (
 	envName_Prod string = "mainnet"
 )
 
-func newDeployNotif(jobState job.JobState) (jobNotif, error) {
+func newDeployNotif(jobState job.JobState, cache manager.Cache) (jobNotif, error) {
 	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
 		return nil, err
 	} else if c, err := parseDiscordWebhookUrl("DISCORD_COMMUNITY_NODES_WEBHOOK"); err != nil {
@@ -40,15 +72,58 @@ func newDeployNotif(jobState job.JobState) (jobNotif, error) {
 	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
 		return nil, err
 	} else {
-		return &deployNotif{jobState, d, c, a, manager.EnvType(os.Getenv(manager.EnvVar_Env))}, nil
+		suppressRepeats, _ := strconv.ParseBool(os.Getenv("DISCORD_COMMUNITY_SUPPRESS_REPEATS"))
+		return &deployNotif{
+			jobState,
+			d,
+			c,
+			a,
+			manager.EnvType(os.Getenv(manager.EnvVar_Env)),
+			previousOutcome(jobState, cache),
+			suppressRepeats,
+			strings.TrimSuffix(os.Getenv("APPROVAL_BASE_URL"), "/"),
+			[]byte(os.Getenv("APPROVAL_SIGNING_KEY")),
+		}, nil
+	}
+}
+
+// previousOutcome returns the stage of the most recent deployment of the same component that either completed or
+// failed. Since there is one manager per environment, this is always for the same (component, env) pair. Only finished
+// jobs are looked up, through the cache's stage index, so this doesn't scan the whole cache.
+func previousOutcome(jobState job.JobState, cache manager.Cache) job.JobStage {
+	component, _ := jobState.Params[job.DeployJobParam_Component].(string)
+	var prevJob *job.JobState
+	for _, jobStage := range []job.JobStage{job.JobStage_Completed, job.JobStage_Failed} {
+		prevJobs := cache.JobsByStage(jobStage)
+		for i, js := range prevJobs {
+			if (js.Type != job.JobType_Deploy) || (js.JobId == jobState.JobId) || js.Ts.After(jobState.Ts) {
+				continue
+			} else if prevComponent, _ := js.Params[job.DeployJobParam_Component].(string); prevComponent != component {
+				continue
+			} else if (prevJob == nil) || js.Ts.After(prevJob.Ts) {
+				prevJob = &prevJobs[i]
+			}
+		}
 	}
+	if prevJob == nil {
+		return ""
+	}
+	return prevJob.Stage
+}
+
+func (d deployNotif) isRecovery() bool {
+	return (d.state.Stage == job.JobStage_Completed) && (d.previousOutcome == job.JobStage_Failed)
 }
 
 func (d deployNotif) getChannels() []webhook.Client {
 	webhooks := []webhook.Client{d.deploymentsWebhook}
-	// Don't send Dev/QA notifications to the community channel
-	if (d.env != manager.EnvType_Dev) && (d.env != manager.EnvType_Qa) {
-		webhooks = append(webhooks, d.communityWebhook)
+	// Don't send Dev/QA notifications to the community channel. If configured, also keep routine deployments off the
+	// community channel when the previous deployment succeeded, so that only failures are reported there. Approvals
+	// are internal, so deployments waiting for approval are also kept off the community channel.
+	if (d.env != manager.EnvType_Dev) && (d.env != manager.EnvType_Qa) && (d.state.Stage != job.JobStage_PendingApproval) {
+		if !d.suppressRepeats || (d.previousOutcome != job.JobStage_Completed) || (d.state.Stage == job.JobStage_Failed) {
+			webhooks = append(webhooks, d.communityWebhook)
+		}
 	}
 	// Also send deployment failures to the alerts channel
 	if d.state.Stage == job.JobStage_Failed {
@@ -71,11 +146,18 @@ func (d deployNotif) getTitle() string {
 	prettyStage := string(d.state.Stage)
 	if d.state.Stage == job.JobStage_Dequeued {
 		prettyStage = prettyStageDequeued
+	} else if d.state.Stage == job.JobStage_PendingApproval {
+		prettyStage = prettyStagePendingApproval
+	} else if _, baking := d.state.Params[job.DeployJobParam_BakeStart]; baking && (d.state.Stage == job.JobStage_Waiting) {
+		prettyStage = prettyStageBaking
+	} else if d.isRecovery() {
+		// Call out deployments that succeeded after the previous deployment of the component failed
+		prettyStage = prettyStageRecovered
 	}
 	return fmt.Sprintf(
 		"3Box Labs `%s` %s %s %s %s",
 		envName(d.env),
-		strings.ToUpper(component),
+		manager.ComponentDisplayName(manager.DeployComponent(component)),
 		cases.Title(language.English).String(qualifier),
 		"Deployment",
 		strings.ToUpper(prettyStage),
@@ -83,14 +165,154 @@ func (d deployNotif) getTitle() string {
 }
 
 func (d deployNotif) getFields() []discord.EmbedField {
-	return nil
+	var fields []discord.EmbedField
+	// Display the release version alongside the commit hash in the references, if one was specified for this deploy.
+	if version, found := d.state.Params[job.DeployJobParam_Version].(string); found {
+		fields = append(fields, discord.EmbedField{
+			Name:  deployNotifField_Version,
+			Value: version,
+		})
+	}
+	// Show the progress of each region for staggered multi-region deployments
+	if regionProgress := d.getRegionProgress(); len(regionProgress) > 0 {
+		fields = append(fields, discord.EmbedField{
+			Name:  deployNotifField_Regions,
+			Value: regionProgress,
+		})
+	}
+	// Show how far along the rollout is while the deployment is in progress
+	if d.state.Stage == job.JobStage_Started {
+		if updated, found := d.state.Params[job.DeployJobParam_RolloutUpdated].(float64); found {
+			desired, _ := d.state.Params[job.DeployJobParam_RolloutDesired].(float64)
+			fields = append(fields, discord.EmbedField{
+				Name:  deployNotifField_Rollout,
+				Value: fmt.Sprintf("%d of %d tasks updated", int(updated), int(desired)),
+			})
+		}
+	}
+	// Link back to the workflow run that triggered the deployment
+	if runUrl, err := manager.WorkflowRunUrl(d.state); (err == nil) && (len(runUrl) > 0) {
+		fields = append(fields, discord.EmbedField{
+			Name:  deployNotifField_WorkflowRun,
+			Value: fmt.Sprintf("[workflow run](%s)", runUrl),
+		})
+	}
+	// Show who can approve deployments that require approval, and who approved them
+	if approvers, _ := manager.JobApprovers(d.state); len(approvers) > 0 {
+		if approvedBy, found := d.state.Params[job.JobParam_ApprovedBy].(string); found {
+			fields = append(fields, discord.EmbedField{
+				Name:  deployNotifField_ApprovedBy,
+				Value: prettyApprover(approvedBy),
+			})
+		} else {
+			prettyApprovers := make([]string, 0, len(approvers))
+			for _, approver := range approvers {
+				prettyApprovers = append(prettyApprovers, prettyApprover(approver))
+			}
+			fields = append(fields, discord.EmbedField{
+				Name:  deployNotifField_Approvers,
+				Value: strings.Join(prettyApprovers, ", "),
+			})
+			if approvalLinks := d.getApprovalLinks(approvers); len(approvalLinks) > 0 {
+				fields = append(fields, discord.EmbedField{
+					Name:  deployNotifField_ApprovalLinks,
+					Value: approvalLinks,
+				})
+			}
+		}
+	}
+	// Explain why the deployment was skipped, or call out that it went ahead despite a freeze
+	if frozen, _ := d.state.Params[job.DeployJobParam_Frozen].(bool); frozen {
+		freezeStatus := deployNotifWarning_Frozen
+		if freezeOverride, _ := d.state.Params[job.DeployJobParam_FreezeOverride].(bool); freezeOverride {
+			freezeStatus = deployNotifWarning_FreezeOverridden
+		}
+		fields = append(fields, discord.EmbedField{
+			Name:  deployNotifField_Freeze,
+			Value: freezeStatus,
+		})
+	}
+	// Show what ECS was doing with the deployed services when the deployment failed
+	if d.state.Stage == job.JobStage_Failed {
+		if serviceEvents, _ := d.state.Params[job.DeployJobParam_ServiceEvents].([]interface{}); len(serviceEvents) > 0 {
+			lines := make([]string, 0, len(serviceEvents))
+			for _, serviceEvent := range serviceEvents {
+				lines = append(lines, fmt.Sprintf("%v", serviceEvent))
+			}
+			fields = append(fields, discord.EmbedField{
+				Name:  deployNotifField_ServiceEvents,
+				Value: "```\n" + strings.Join(lines, "\n") + "\n```",
+			})
+		}
+	}
+	// Make it obvious when a deployment was not followed by the usual tests
+	if skipTests, _ := d.state.Params[job.JobParam_SkipTests].(bool); skipTests {
+		fields = append(fields, discord.EmbedField{
+			Name:  deployNotifField_Tests,
+			Value: deployNotifWarning_TestsSkipped,
+		})
+	}
+	return fields
+}
+
+// getApprovalLinks returns a signed link per approver for deployments waiting for approval. Each link opens a page that
+// approves or rejects the deployment on behalf of that approver, and stops working once the approval expires.
+func (d deployNotif) getApprovalLinks(approvers []string) string {
+	if (d.state.Stage != job.JobStage_PendingApproval) || (len(d.approvalBaseUrl) == 0) || (len(d.approvalKey) == 0) {
+		return ""
+	}
+	expiry := manager.ApprovalExpiry(d.state)
+	links := make([]string, 0, len(approvers))
+	for _, approver := range approvers {
+		links = append(links, fmt.Sprintf(
+			"%s: [approve](%s) | [reject](%s)",
+			prettyApprover(approver),
+			d.approvalUrl(manager.ApprovalAction_Approve, approver, expiry),
+			d.approvalUrl(manager.ApprovalAction_Reject, approver, expiry),
+		))
+	}
+	return strings.Join(links, "\n")
+}
+
+func (d deployNotif) approvalUrl(action, approver string, expiry time.Time) string {
+	query := url.Values{}
+	query.Set("approver", approver)
+	query.Set("token", manager.ApprovalToken(d.approvalKey, d.state.JobId, action, approver, expiry))
+	return fmt.Sprintf("%s/jobs/%s/%s?%s", d.approvalBaseUrl, url.PathEscape(d.state.JobId), action, query.Encode())
+}
+
+// prettyApprover mentions approvers identified by their Discord user ID, and shows GitHub usernames as is
+func prettyApprover(approver string) string {
+	if _, err := snowflake.Parse(approver); err == nil {
+		return "<@" + approver + ">"
+	}
+	return approver
+}
+
+func (d deployNotif) getRegionProgress() string {
+	message := ""
+	if regions, found := d.state.Params[job.DeployJobParam_Regions].([]interface{}); found {
+		regionProgress, _ := d.state.Params[job.DeployJobParam_RegionProgress].(map[string]interface{})
+		for _, region := range regions {
+			r, _ := region.(string)
+			if status, found := regionProgress[r].(string); found {
+				message += fmt.Sprintf("%s: %s\n", region, status)
+			}
+		}
+	}
+	return message
 }
 
 func (d deployNotif) getColor() discordColor {
 	return colorForStage(d.state.Stage)
 }
 
+// envName returns the label shown for an environment in notification titles. Labels can be configured per environment,
+// e.g. `{"tnet": "Clay Testnet"}`, so that public notifications don't need to show internal environment names.
 func envName(env manager.EnvType) string {
+	if displayName, err := envDisplayName(envDisplayNameMapEnv, env); (err == nil) && (len(displayName) > 0) {
+		return displayName
+	}
 	switch env {
 	case manager.EnvType_Dev:
 		return envName_Dev
@@ -105,6 +327,19 @@ func envName(env manager.EnvType) string {
 	}
 }
 
+// envDisplayName returns the configured label for an environment, if any
+func envDisplayName(displayNameMapEnv string, env manager.EnvType) (string, error) {
+	displayNameMapJson, found := os.LookupEnv(displayNameMapEnv)
+	if !found {
+		return "", nil
+	}
+	displayNameMap := make(map[string]string)
+	if err := json.Unmarshal([]byte(displayNameMapJson), &displayNameMap); err != nil {
+		return "", fmt.Errorf("envDisplayName: invalid display name map: %v", err)
+	}
+	return strings.TrimSpace(displayNameMap[string(env)]), nil
+}
+
 func (d deployNotif) getUrl() string {
 	return ""
 }
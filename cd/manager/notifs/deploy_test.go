@@ -0,0 +1,103 @@
+package notifs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+func deployJob(jobId string, stage job.JobStage, component manager.DeployComponent) job.JobState {
+	return job.JobState{JobId: jobId, Type: job.JobType_Deploy, Stage: stage, Params: map[string]interface{}{
+		job.DeployJobParam_Component: string(component),
+	}}
+}
+
+func TestPreviousOutcome(t *testing.T) {
+	now := time.Now()
+	cache := common.NewJobCache()
+	writeDeploy := func(jobId string, stage job.JobStage, component manager.DeployComponent, ts time.Time) job.JobState {
+		jobState := deployJob(jobId, stage, component)
+		jobState.Ts = ts
+		cache.WriteJob(jobState)
+		return jobState
+	}
+	writeDeploy("completed", job.JobStage_Completed, manager.DeployComponent_Ceramic, now.Add(-2*time.Hour))
+	writeDeploy("failed", job.JobStage_Failed, manager.DeployComponent_Ceramic, now.Add(-time.Hour))
+	// Neither a later job for another component nor an unfinished job for the same one count as the previous outcome
+	writeDeploy("other", job.JobStage_Completed, manager.DeployComponent_Cas, now.Add(-time.Minute))
+	writeDeploy("started", job.JobStage_Started, manager.DeployComponent_Ceramic, now.Add(-30*time.Minute))
+
+	current := writeDeploy("current", job.JobStage_Completed, manager.DeployComponent_Ceramic, now)
+	if outcome := previousOutcome(current, cache); outcome != job.JobStage_Failed {
+		t.Fatalf("expected the previous deployment to have failed, got %q", outcome)
+	}
+	if outcome := previousOutcome(deployJob("first", job.JobStage_Completed, manager.DeployComponent_Ipfs), cache); outcome != "" {
+		t.Fatalf("expected no previous outcome, got %q", outcome)
+	}
+}
+
+func TestDeployNotifTitleComponentDisplayName(t *testing.T) {
+	t.Setenv("COMPONENT_DISPLAY_NAMES", `{"cas": "Anchor Service"}`)
+	d := deployNotif{state: deployJob("deploy", job.JobStage_Started, manager.DeployComponent_Cas), env: manager.EnvType_Dev}
+	if title := d.getTitle(); !strings.Contains(title, " Anchor Service ") {
+		t.Fatalf("mapped component name not in title: %s", title)
+	}
+	// Components without a display name fall back to the uppercased component name
+	d.state = deployJob("deploy", job.JobStage_Started, manager.DeployComponent_Ipfs)
+	if title := d.getTitle(); !strings.Contains(title, " IPFS ") {
+		t.Fatalf("uppercased component name not in title: %s", title)
+	}
+}
+
+func freezeField(d deployNotif) string {
+	for _, field := range d.getFields() {
+		if field.Name == deployNotifField_Freeze {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+func TestDeployNotifFreeze(t *testing.T) {
+	d := deployNotif{state: deployJob("deploy", job.JobStage_Skipped, manager.DeployComponent_Ceramic), env: manager.EnvType_Dev}
+	if value := freezeField(d); value != "" {
+		t.Fatalf("unexpected freeze field: %s", value)
+	}
+	d.state.Params[job.DeployJobParam_Frozen] = true
+	if value := freezeField(d); value != deployNotifWarning_Frozen {
+		t.Fatalf("frozen deploy not called out: %s", value)
+	} else if d.getColor() != discordColor_Warning {
+		t.Fatalf("unexpected color for frozen deploy: %x", d.getColor())
+	}
+	d.state.Stage = job.JobStage_Started
+	d.state.Params[job.DeployJobParam_FreezeOverride] = true
+	if value := freezeField(d); value != deployNotifWarning_FreezeOverridden {
+		t.Fatalf("overridden freeze not called out: %s", value)
+	}
+}
+
+func TestDeployNotifTitleEnvDisplayName(t *testing.T) {
+	t.Setenv(envDisplayNameMapEnv, `{"tnet": "Clay Testnet"}`)
+	d := deployNotif{state: deployJob("deploy", job.JobStage_Started, manager.DeployComponent_Ceramic), env: manager.EnvType_Tnet}
+	if title := d.getTitle(); !strings.Contains(title, "`Clay Testnet`") {
+		t.Fatalf("mapped environment label not in title: %s", title)
+	}
+	// Environments without a label fall back to the default name
+	d.env = manager.EnvType_Prod
+	if title := d.getTitle(); !strings.Contains(title, "`"+envName_Prod+"`") {
+		t.Fatalf("default environment name not in title: %s", title)
+	}
+}
+
+func TestEnvDisplayNameInvalid(t *testing.T) {
+	t.Setenv(envDisplayNameMapEnv, "not json")
+	if _, err := envDisplayName(envDisplayNameMapEnv, manager.EnvType_Tnet); err == nil {
+		t.Fatal("expected an invalid display name map to be rejected")
+	} else if name := envName(manager.EnvType_Tnet); name != envName_Tnet {
+		t.Fatalf("expected the default name for an invalid display name map, got %s", name)
+	}
+}
@@ -1,13 +1,19 @@
 package notifs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/rest"
 	"github.com/disgoorg/disgo/webhook"
@@ -28,21 +34,34 @@ const (
 )
 
 const (
-	notifField_References string = "References"
-	notifField_JobId      string = "Job ID"
-	notifField_RunTime    string = "Time Running"
-	notifField_WaitTime   string = "Time Waiting"
-	notifField_Deploy     string = "Deployment(s)"
-	notifField_Anchor     string = "Anchor Worker(s)"
-	notifField_TestE2E    string = "E2E Tests"
-	notifField_TestSmoke  string = "Smoke Tests"
-	notifField_Workflow   string = "Workflow(s)"
-	notifField_Logs       string = "Logs"
+	notifField_References   string = "References"
+	notifField_JobId        string = "Job ID"
+	notifField_ParentId     string = "Parent Job ID"
+	notifField_RunTime      string = "Time Running"
+	notifField_WaitTime     string = "Time Waiting"
+	notifField_Deploy       string = "Deployment(s)"
+	notifField_Anchor       string = "Anchor Worker(s)"
+	notifField_TestE2E      string = "E2E Tests"
+	notifField_TestSmoke    string = "Smoke Tests"
+	notifField_Workflow     string = "Workflow(s)"
+	notifField_DataBackup   string = "Backup(s)"
+	notifField_Task         string = "Task(s)"
+	notifField_Bootstrap    string = "Bootstrap(s)"
+	notifField_EnvBootstrap string = "Environment Provisioning"
+	notifField_Secrets      string = "Secrets Rotation(s)"
+	notifField_DockerBuild  string = "Image Build(s)"
+	notifField_Terraform    string = "Terraform Plan(s)"
+	notifField_Invalidation string = "Cache Invalidation(s)"
+	notifField_SloCheck     string = "SLO Check(s)"
+	notifField_HealthGate   string = "Health Gate(s)"
+	notifField_Logs         string = "Logs"
+	notifField_ChildJobs    string = "Child Jobs"
+	notifField_Message      string = "Message"
 )
 
 const discordPacing = 2 * time.Second
 
-const shaTagLength = 12
+const defaultMaxActiveJobs = 10
 
 // Show "queued" for "dequeued" jobs to make it more understandable
 const prettyStageDequeued = "queued"
@@ -50,9 +69,26 @@ const prettyStageDequeued = "queued"
 var _ manager.Notifs = &JobNotifs{}
 
 type JobNotifs struct {
-	db          manager.Database
-	cache       manager.Cache
-	testWebhook webhook.Client
+	db            manager.Database
+	cache         manager.Cache
+	testWebhook   webhook.Client
+	testExpiry    *messageExpiry
+	systemWebhook webhook.Client
+	username      string
+	inFlight      *sync.WaitGroup
+	duration      manager.DurationFormatter
+	sha           manager.ShaFormatter
+	themes        map[snowflake.ID]colorTheme
+	envColor      *discordColor
+	summaries     *notifSummaries
+	pager         *failurePager
+	deferred      *deferredNotifs
+	heartbeats    *heartbeats
+	maxActiveJobs int
+	ordering      *jobOrdering
+	routes        *outcomeRoutes
+	acks          *alertAcks
+	pins          *alertPins
 }
 
 type jobNotif interface {
@@ -63,16 +99,95 @@ type jobNotif interface {
 	getUrl() string
 }
 
-func NewJobNotifs(db manager.Database, cache manager.Cache) (manager.Notifs, error) {
-	if t, err := parseDiscordWebhookUrl("DISCORD_TEST_WEBHOOK"); err != nil {
+// Prod notifications are always labeled so that they can't be mistaken for notifications from other environments
+const prodUsernamePrefix = "[PROD]"
+
+func NewJobNotifs(cfg aws.Config, db manager.Database, cache manager.Cache) (manager.Notifs, error) {
+	// Configure networking before any webhook clients are created
+	if err := configureWebhookHttpClient(); err != nil {
+		return nil, err
+	} else if t, err := parseDiscordWebhookUrl("DISCORD_TEST_WEBHOOK"); err != nil {
+		return nil, err
+	} else if s, err := parseDiscordWebhookUrl("DISCORD_SYSTEM_WEBHOOK"); err != nil {
+		return nil, err
+	} else if themes, err := newColorThemes("DISCORD_COLOR_THEMES"); err != nil {
+		return nil, err
+	} else if envColor, err := newEnvColor("ENV_COLOR_MAP_JSON", manager.EnvType(os.Getenv(manager.EnvVar_Env))); err != nil {
+		return nil, err
+	} else if _, err := envDisplayName(envDisplayNameMapEnv, manager.EnvType(os.Getenv(manager.EnvVar_Env))); err != nil {
+		// Make sure that a misconfigured display name doesn't silently fall back to the default label
+		return nil, err
+	} else if summaries, err := newNotifSummaries(cfg); err != nil {
+		return nil, err
+	} else if pager, err := newFailurePager(); err != nil {
+		return nil, err
+	} else if routes, err := newOutcomeRoutes("DISCORD_OUTCOME_ROUTES_JSON", manager.EnvType(os.Getenv(manager.EnvVar_Env))); err != nil {
+		return nil, err
+	} else if pins, err := newAlertPins(); err != nil {
 		return nil, err
 	} else {
-		return &JobNotifs{db, cache, t}, nil
+		n := &JobNotifs{
+			db,
+			cache,
+			t,
+			newMessageExpiry("DISCORD_TEST_MESSAGE_MAX_AGE"),
+			s,
+			notifUsername(manager.EnvType(os.Getenv(manager.EnvVar_Env))),
+			new(sync.WaitGroup),
+			manager.ConfiguredDurationFormatter(),
+			manager.ConfiguredShaFormatter(),
+			themes,
+			envColor,
+			summaries,
+			pager,
+			nil,
+			nil,
+			maxActiveJobs("DISCORD_MAX_ACTIVE_JOBS"),
+			nil,
+			routes,
+			nil,
+			pins,
+		}
+		if n.acks, err = newAlertAcks(cache, n.inFlight); err != nil {
+			return nil, err
+		}
+		n.ordering = newJobOrdering(n.inFlight)
+		n.deferred = newDeferredNotifs(cache, func(jobs ...job.JobState) { n.NotifyJob(jobs...) })
+		if t != nil {
+			n.heartbeats = newHeartbeats("DISCORD_HEARTBEAT_INTERVAL", cache, func(jobState job.JobState) { n.sendHeartbeat(jobState) })
+		}
+		// Resend notifications that were not delivered before the manager last stopped. This is done before any new
+		// notifications are sent so that resent notifications don't overwrite newer ones.
+		n.resumePendingNotifs()
+		return n, nil
+	}
+}
+
+// maxActiveJobs returns how many active jobs of each type to list in a notification. Listing every active job during
+// busy periods would make notifications hard to read and push them past Discord's embed limits.
+func maxActiveJobs(maxEnv string) int {
+	if maxJobs, err := strconv.Atoi(os.Getenv(maxEnv)); (err == nil) && (maxJobs > 0) {
+		return maxJobs
+	}
+	return defaultMaxActiveJobs
+}
+
+func notifUsername(env manager.EnvType) string {
+	// The Prod prefix cannot be overridden, but other environments can optionally be configured with a prefix.
+	if env == manager.EnvType_Prod {
+		return prodUsernamePrefix + " " + manager.ServiceName
+	} else if prefix := os.Getenv("DISCORD_USERNAME_PREFIX"); len(prefix) > 0 {
+		return prefix + " " + manager.ServiceName
 	}
+	return manager.ServiceName
 }
 
 func parseDiscordWebhookUrl(urlEnv string) (webhook.Client, error) {
-	webhookUrl := os.Getenv(urlEnv)
+	return newDiscordWebhook(os.Getenv(urlEnv))
+}
+
+// newDiscordWebhook returns nil if the webhook URL is empty
+func newDiscordWebhook(webhookUrl string) (webhook.Client, error) {
 	if len(webhookUrl) > 0 {
 		if parsedUrl, err := url.Parse(webhookUrl); err != nil {
 			return nil, err
@@ -81,7 +196,7 @@ func parseDiscordWebhookUrl(urlEnv string) (webhook.Client, error) {
 			if id, err := snowflake.Parse(urlParts[len(urlParts)-2]); err != nil {
 				return nil, err
 			} else {
-				return webhook.New(id, urlParts[len(urlParts)-1]), nil
+				return webhook.New(id, urlParts[len(urlParts)-1], webhookOpts()...), nil
 			}
 		}
 	}
@@ -120,58 +235,266 @@ func webhooksForLabels(labels []string) ([]webhook.Client, []webhook.Client, err
 	return webhooks, failureWebhooks, nil
 }
 
+// NotifyJob sends notifications for job updates in the background. It can be called from any number of goroutines.
+// Notifications for the same job are delivered in order, and ones for updates older than an update already notified
+// are dropped.
 func (n JobNotifs) NotifyJob(jobs ...job.JobState) {
+	n.inFlight.Add(1)
+	defer n.inFlight.Done()
+	// Notifications for jobs that have moved on to a new stage supersede any deferred notifications for those jobs
+	n.deferred.cancelTransitioned(jobs...)
 	for _, jobState := range jobs {
-		if jn, err := n.getJobNotif(jobState); err != nil {
-			log.Printf("notifyJob: error creating job notification: %v, %s", err, manager.PrintJob(jobState))
-		} else {
-			// Send all notifications to the test webhook
-			channels := append(jn.getChannels(), n.testWebhook)
-			for _, channel := range channels {
-				if channel != nil {
-					n.sendNotif(
-						jn.getTitle(),
-						append(n.getNotifFields(jobState), jn.getFields()...),
-						jn.getColor(),
-						channel,
-					)
+		if manager.IsSilentJob(jobState) {
+			continue
+		}
+		// Record the notification as soon as it's accepted so that it can be resent if the manager stops before the
+		// notification is delivered, even if it's still queued behind earlier notifications for the same job.
+		notif := manager.PendingNotif{Id: pendingNotifId(jobState), Job: jobState, Delivered: map[string]string{}}
+		if err := n.db.WriteNotif(notif); err != nil {
+			log.Printf("notifyJob: error recording pending notification: %v, %s", err, manager.PrintJob(jobState))
+		}
+		if !n.ordering.deliver(jobState, func() { n.deliverNotif(notif) }) {
+			// A later update of the job was already notified, so this notification will never be sent
+			n.removeNotif(notif)
+		}
+	}
+	// Any update to a job restarts its heartbeat, so that heartbeats are only sent for jobs that have gone quiet
+	n.heartbeats.reset(jobs...)
+	if (n.testWebhook != nil) && (n.testExpiry != nil) {
+		n.testExpiry.sweep(n.testWebhook, n.inFlight)
+	}
+}
+
+// NotifyJobDeferred sends job notifications after a delay, unless the jobs move to a different stage before then.
+// Deferred notifications are not recorded, and so are lost if the manager stops before they are sent.
+func (n JobNotifs) NotifyJobDeferred(delay time.Duration, jobs ...job.JobState) {
+	n.deferred.schedule(delay, jobs...)
+}
+
+// deliverNotif sends a job notification to all of its channels, other than those it was already delivered to. The
+// record of the notification is only removed once it has been delivered to all channels.
+func (n JobNotifs) deliverNotif(notif manager.PendingNotif) {
+	jobState := notif.Job
+	jn, err := n.getJobNotif(jobState)
+	if err != nil {
+		log.Printf("notifyJob: error creating job notification: %v, %s", err, manager.PrintJob(jobState))
+		// This notification can never be sent, so there's no point in keeping it around.
+		n.removeNotif(notif)
+		return
+	}
+	channels, err := withDedicatedChannel(jobState, n.routes.route(jobState, jn.getChannels()))
+	if err != nil {
+		// Still send the notification to the job's usual channels
+		log.Printf("notifyJob: error adding dedicated channel: %v, %s", err, manager.PrintJob(jobState))
+	}
+	// Send all notifications to the test webhook
+	channels = append(channels, n.testWebhook)
+	messageIds := n.getMessageIds(jobState)
+	for channelId, messageId := range notif.Delivered {
+		messageIds[channelId] = messageId
+	}
+	title := jn.getTitle()
+	fields := append(n.getNotifFields(jobState), jn.getFields()...)
+	alert := n.acks.isAlert(jobState, channels)
+	if alert {
+		fields = append(fields, n.acks.getFields(jobState, n.duration)...)
+	}
+	// Post a compact notification with a link to the full details if the notification is too large
+	if n.summaries != nil {
+		fields = n.summaries.summarize(title, fields, jobState)
+	}
+	color := jn.getColor()
+	// Send to all channels in parallel so that a slow response for one channel doesn't hold up the others
+	sendWaitGroup := new(sync.WaitGroup)
+	sendMu := new(sync.Mutex)
+	errs := make([]string, 0)
+	for _, channel := range channels {
+		if channel != nil {
+			channelId := channel.ID().String()
+			if _, delivered := notif.Delivered[channelId]; delivered {
+				continue
+			}
+			sendWaitGroup.Add(1)
+			go func(channel webhook.Client, prevMessageId interface{}) {
+				defer sendWaitGroup.Done()
+				messageId, err := n.sendNotif(title, fields, n.channelColor(color, channel), jobState.Ts, channel, prevMessageId, n.pageContent(jobState, channel))
+				sendMu.Lock()
+				defer sendMu.Unlock()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", channelId, err))
+				} else {
+					messageIds[channelId] = messageId
+					notif.Delivered[channelId] = messageId
+					// Keep track of non-alert messages sent to the test channel so that they can be deleted later
+					if (channel == n.testWebhook) && (n.testExpiry != nil) {
+						n.testExpiry.track(messageId, color == discordColor_Alert)
+					}
 				}
+			}(channel, messageIds[channelId])
+		}
+	}
+	sendWaitGroup.Wait()
+	// Escalate alerts that aren't acknowledged in time, even if they couldn't be delivered to every channel
+	if alert {
+		n.acks.scheduleEscalation(jobState)
+	}
+	for _, channel := range channels {
+		if channel != nil {
+			if messageId, delivered := notif.Delivered[channel.ID().String()]; delivered {
+				n.pins.update(jobState, channel, messageId)
 			}
 		}
 	}
+	if len(errs) > 0 {
+		log.Printf("notifyJob: error sending discord notifications: %s, %s", strings.Join(errs, "; "), manager.PrintJob(jobState))
+		// Update the record with the channels the notification was delivered to so that they aren't sent duplicate
+		// messages when the notification is resent.
+		if err = n.db.WriteNotif(notif); err != nil {
+			log.Printf("notifyJob: error recording pending notification: %v, %s", err, manager.PrintJob(jobState))
+		}
+	} else {
+		n.removeNotif(notif)
+	}
+	n.recordMessageIds(jobState, messageIds)
 }
 
-func (n JobNotifs) getJobNotif(jobState job.JobState) (jobNotif, error) {
-	switch jobState.Type {
-	case job.JobType_Deploy:
-		return newDeployNotif(jobState)
-	case job.JobType_Anchor:
-		return newAnchorNotif(jobState)
-	case job.JobType_TestE2E:
-		return newE2eTestNotif(jobState)
-	case job.JobType_TestSmoke:
-		return newSmokeTestNotif(jobState)
-	case job.JobType_Workflow:
-		return newWorkflowNotif(jobState)
-	default:
-		return nil, fmt.Errorf("getJobNotif: unknown job type: %s", jobState.Type)
+// NotifySystem sends alerts about the manager itself to the system channel, if one is configured
+func (n JobNotifs) NotifySystem(event manager.SystemEvent) {
+	n.inFlight.Add(1)
+	defer n.inFlight.Done()
+	log.Printf("notifySystem: %s %s: %s", event.Severity, event.Kind, event.Message)
+	channel := n.systemWebhook
+	// Lifecycle notifications are only meant for operators, and so go to the test channel if there's no system channel
+	if (channel == nil) && (event.Kind == manager.SystemEventKind_Lifecycle) {
+		channel = n.testWebhook
+	}
+	if channel != nil {
+		if _, err := n.sendNotif(
+			fmt.Sprintf("%s %s", strings.ToUpper(event.Severity), event.Kind),
+			[]discord.EmbedField{{Name: notifField_Message, Value: event.Message}},
+			n.channelColor(colorForSeverity(event.Severity), channel),
+			time.Now(),
+			channel,
+			nil,
+			"",
+		); err != nil {
+			log.Printf("notifySystem: error sending discord notification: %v, %+v", err, event)
+		}
+	}
+	// Update the alert for an acknowledged job to show who acknowledged it
+	if (event.Kind == manager.SystemEventKind_Ack) && (len(event.JobId) > 0) {
+		if cachedJob, found := n.cache.JobById(event.JobId); found {
+			n.ordering.deliver(cachedJob, func() {
+				n.deliverNotif(manager.PendingNotif{Id: pendingNotifId(cachedJob), Job: cachedJob, Delivered: map[string]string{}})
+			})
+		}
+	}
+}
+
+// FlushPending waits for notifications that are still being sent to complete, or for the context to be canceled,
+// whichever comes first.
+func (n JobNotifs) FlushPending(ctx context.Context) error {
+	n.heartbeats.stop()
+	if canceled := n.deferred.cancelAll(); canceled > 0 {
+		log.Printf("flushPending: canceled %d deferred notifications", canceled)
+	}
+	if canceled := n.acks.stop(); canceled > 0 {
+		log.Printf("flushPending: canceled %d alert escalations", canceled)
+	}
+	flushed := make(chan struct{})
+	go func() {
+		n.inFlight.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flushPending: %v", ctx.Err())
+	}
+}
+
+// getMessageIds returns the messages sent for a job so far. The job state being notified might predate messages sent
+// for a later update, so the messages recorded for the cached job are included as well.
+func (n JobNotifs) getMessageIds(jobState job.JobState) map[string]interface{} {
+	messageIds := getMessageIds(jobState)
+	if cachedJob, found := n.cache.JobById(jobState.JobId); found {
+		for channelId, messageId := range getMessageIds(cachedJob) {
+			if _, found = messageIds[channelId]; !found {
+				messageIds[channelId] = messageId
+			}
+		}
+	}
+	return messageIds
+}
+
+// recordMessageIds records the messages sent for a job so that they can be edited for subsequent stages instead of
+// sending new messages. The IDs are set on the cached job, and so are written to the database along with the next job
+// update.
+func (n JobNotifs) recordMessageIds(jobState job.JobState, messageIds map[string]interface{}) {
+	if len(messageIds) == 0 {
+		return
+	}
+	// The cache might hold on to this map, so don't hand it one that the caller might still modify
+	recorded := make(map[string]interface{}, len(messageIds))
+	for channelId, messageId := range messageIds {
+		recorded[channelId] = messageId
+	}
+	// Jobs that are no longer cached won't be updated again, so there's nothing to record
+	if err := n.cache.UpdateJobField(jobState.JobId, job.JobParam_DiscordMessageId, recorded); (err != nil) && !errors.Is(err, manager.Error_JobNotFound) {
+		log.Printf("notifyJob: error recording message ids: %v, %s", err, manager.PrintJob(jobState))
 	}
 }
 
-func (n JobNotifs) sendNotif(title string, fields []discord.EmbedField, color discordColor, channel webhook.Client) {
+func getMessageIds(jobState job.JobState) map[string]interface{} {
+	messageIds := make(map[string]interface{})
+	if storedMessageIds, found := jobState.Params[job.JobParam_DiscordMessageId].(map[string]interface{}); found {
+		for channelId, messageId := range storedMessageIds {
+			messageIds[channelId] = messageId
+		}
+	}
+	return messageIds
+}
+
+func (n JobNotifs) sendNotif(title string, fields []discord.EmbedField, color discordColor, ts time.Time, channel webhook.Client, messageId interface{}, content string) (string, error) {
+	// Make sure that the embed can always be sent, however long the job details are
+	title, fields = clampEmbed(title, fields)
+	// Use the time of the job transition as the embed timestamp, which Discord renders relative to the current time.
 	messageEmbed := discord.Embed{
-		Title:  title,
-		Type:   discord.EmbedTypeRich,
-		Fields: fields,
-		Color:  int(color),
+		Title:     title,
+		Type:      discord.EmbedTypeRich,
+		Fields:    fields,
+		Color:     int(color),
+		Timestamp: &ts,
 	}
-	if _, err := channel.CreateMessage(discord.NewWebhookMessageCreateBuilder().
+	// Edit the original message for the job, if one was sent to this channel. Fall back to creating a new message if
+	// the original message could not be found or updated.
+	if id, found := messageId.(string); found {
+		if parsedId, err := snowflake.Parse(id); err != nil {
+			log.Printf("notifyJob: error parsing discord message id: %v, %s", err, id)
+		} else if _, err = channel.UpdateMessage(
+			parsedId,
+			discord.NewWebhookMessageUpdateBuilder().
+				SetEmbeds(messageEmbed).
+				Build(),
+			rest.WithDelay(discordPacing),
+		); err != nil {
+			log.Printf("notifyJob: error updating discord notification: %v, %s, %s, %v, %d", err, id, title, fields, color)
+		} else {
+			return id, nil
+		}
+	}
+	// Content is only used to mention people, which only notifies them when a message is created
+	if message, err := channel.CreateMessage(discord.NewWebhookMessageCreateBuilder().
+		SetContent(content).
 		SetEmbeds(messageEmbed).
-		SetUsername(manager.ServiceName).
+		SetUsername(n.username).
 		Build(),
 		rest.WithDelay(discordPacing),
 	); err != nil {
-		log.Printf("notifyJob: error sending discord notification: %v, %s, %v, %d", err, title, fields, color)
+		return "", err
+	} else {
+		return message.ID.String(), nil
 	}
 }
 
@@ -182,6 +505,13 @@ func (n JobNotifs) getNotifFields(jobState job.JobState) []discord.EmbedField {
 			Value: jobState.JobId,
 		},
 	}
+	// Allow jobs created by other jobs to be traced back to the job that created them
+	if len(jobState.ParentId) > 0 {
+		fields = append(fields, discord.EmbedField{
+			Name:  notifField_ParentId,
+			Value: jobState.ParentId,
+		})
+	}
 	// Return deploy tags for all jobs if we were able to retrieve them successfully.
 	if deployTags := n.getDeployTags(jobState); len(deployTags) > 0 {
 		fields = append(fields, discord.EmbedField{
@@ -193,7 +523,7 @@ func (n JobNotifs) getNotifFields(jobState job.JobState) []discord.EmbedField {
 	if jobState.Stage == job.JobStage_Started {
 		if waitTime, found := jobState.Params[job.JobParam_WaitTime].(string); found {
 			parsedWaitTime, _ := time.ParseDuration(waitTime)
-			prettyWaitTime := prettyDuration(parsedWaitTime)
+			prettyWaitTime := n.duration(parsedWaitTime)
 			if len(prettyWaitTime) > 0 {
 				fields = append(fields, discord.EmbedField{
 					Name:  notifField_WaitTime,
@@ -204,7 +534,7 @@ func (n JobNotifs) getNotifFields(jobState job.JobState) []discord.EmbedField {
 	} else
 	// Only need to display the run time once the job progresses beyond the "started" stage
 	if startTime, found := jobState.Params[job.JobParam_Start].(float64); found {
-		runTime := prettyDuration(time.Since(time.Unix(0, int64(startTime))))
+		runTime := n.duration(time.Since(time.Unix(0, int64(startTime))))
 		if len(runTime) > 0 {
 			fields = append(fields, discord.EmbedField{
 				Name:  notifField_RunTime,
@@ -212,6 +542,13 @@ func (n JobNotifs) getNotifFields(jobState job.JobState) []discord.EmbedField {
 			})
 		}
 	}
+	// Add the tree of jobs created by this job
+	if childJobs := n.getChildJobTree(jobState.JobId, ""); len(childJobs) > 0 {
+		fields = append(fields, discord.EmbedField{
+			Name:  notifField_ChildJobs,
+			Value: childJobs,
+		})
+	}
 	// Add the list of jobs in progress
 	if activeJobs := n.getActiveJobs(jobState); len(activeJobs) > 0 {
 		fields = append(fields, activeJobs...)
@@ -257,7 +594,7 @@ func (n JobNotifs) getComponentMsg(component manager.DeployComponent, deployTags
 			if (len(deployTagParts) > 1) && (deployTagParts[1] == job.DeployJobTarget_Release) {
 				return fmt.Sprintf("[%s (v%s)](https://github.com/%s/%s/releases/tag/v%s)", repo.Name, tagString, repo.Org, repo.Name, tagString)
 			} else if manager.IsValidSha(tagString) {
-				return fmt.Sprintf("[%s (%s)](https://github.com/%s/%s/commit/%s)", repo.Name, tagString[:shaTagLength], repo.Org, repo.Name, tagString)
+				return n.sha(repo, tagString)
 			}
 		}
 	}
@@ -277,58 +614,58 @@ func (n JobNotifs) combineComponentMsgs(msgs ...string) string {
 	return message
 }
 
-func (n JobNotifs) getActiveJobs(jobState job.JobState) []discord.EmbedField {
-	fields := make([]discord.EmbedField, 0, 0)
-	if field, found := n.getActiveJobsByType(jobState, job.JobType_Deploy); found {
-		fields = append(fields, field)
-	}
-	if field, found := n.getActiveJobsByType(jobState, job.JobType_TestE2E); found {
-		fields = append(fields, field)
-	}
-	if field, found := n.getActiveJobsByType(jobState, job.JobType_TestSmoke); found {
-		fields = append(fields, field)
-	}
-	if field, found := n.getActiveJobsByType(jobState, job.JobType_Workflow); found {
-		fields = append(fields, field)
+func (n JobNotifs) getChildJobTree(jobId, indent string) string {
+	childJobs := n.cache.JobsByMatcher(func(js job.JobState) bool {
+		return js.ParentId == jobId
+	})
+	sort.Slice(childJobs, func(i, j int) bool {
+		return childJobs[i].Ts.Before(childJobs[j].Ts)
+	})
+	tree := ""
+	for _, childJob := range childJobs {
+		tree += fmt.Sprintf("%s└ %s `%s` (%s)\n", indent, childJob.Type, childJob.JobId, childJob.Stage)
+		// Jobs created by child jobs are displayed further indented under their parent
+		tree += n.getChildJobTree(childJob.JobId, indent+"  ")
 	}
-	return fields
+	return tree
 }
 
-func (n JobNotifs) getActiveJobsByType(jobState job.JobState, jobType job.JobType) (discord.EmbedField, bool) {
-	activeJobs := n.cache.JobsByMatcher(func(js job.JobState) bool {
-		return job.IsActiveJob(js) && (js.Type == jobType)
-	})
-	message := ""
-	for _, activeJob := range activeJobs {
-		// Exclude job for which this notification is being generated
-		if activeJob.JobId != jobState.JobId {
-			if jn, err := n.getJobNotif(activeJob); (err == nil) && (len(jn.getUrl()) > 0) {
-				message += fmt.Sprintf("[%s](%s)\n", activeJob.JobId, jn.getUrl())
-			} else {
-				message += activeJob.JobId + "\n"
-			}
+// sortActiveJobs orders jobs by stage, then by when they started, with the job ID breaking any remaining ties
+func sortActiveJobs(jobs []job.JobState) {
+	stageRank := func(stage job.JobStage) int {
+		switch stage {
+		case job.JobStage_Started:
+			return 0
+		case job.JobStage_Waiting:
+			return 1
+		default:
+			return 2
 		}
 	}
-	return discord.EmbedField{
-		Name:  notifField(jobType) + " In Progress:",
-		Value: message,
-	}, len(message) > 0
+	startTime := func(jobState job.JobState) time.Time {
+		if s, found := jobState.Params[job.JobParam_Start].(float64); found {
+			return time.Unix(0, int64(s))
+		}
+		return jobState.Ts
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if rankI, rankJ := stageRank(jobs[i].Stage), stageRank(jobs[j].Stage); rankI != rankJ {
+			return rankI < rankJ
+		} else if startI, startJ := startTime(jobs[i]), startTime(jobs[j]); !startI.Equal(startJ) {
+			return startI.Before(startJ)
+		}
+		return jobs[i].JobId < jobs[j].JobId
+	})
 }
 
-func notifField(jt job.JobType) string {
-	switch jt {
-	case job.JobType_Deploy:
-		return notifField_Deploy
-	case job.JobType_Anchor:
-		return notifField_Anchor
-	case job.JobType_TestE2E:
-		return notifField_TestE2E
-	case job.JobType_TestSmoke:
-		return notifField_TestSmoke
-	case job.JobType_Workflow:
-		return notifField_Workflow
+func colorForSeverity(severity string) discordColor {
+	switch severity {
+	case manager.SystemEventSeverity_Info:
+		return discordColor_Info
+	case manager.SystemEventSeverity_Warning:
+		return discordColor_Warning
 	default:
-		return ""
+		return discordColor_Alert
 	}
 }
 
@@ -336,6 +673,8 @@ func colorForStage(jobStage job.JobStage) discordColor {
 	switch jobStage {
 	case job.JobStage_Dequeued:
 		return discordColor_Info
+	case job.JobStage_PendingApproval:
+		return discordColor_Warning
 	case job.JobStage_Skipped:
 		return discordColor_Warning
 	case job.JobStage_Started:
@@ -353,13 +692,3 @@ func colorForStage(jobStage job.JobStage) discordColor {
 		return discordColor_Alert
 	}
 }
-
-func prettyDuration(duration time.Duration) string {
-	hours := int(duration.Seconds() / 3600)
-	minutes := int(duration.Seconds()/60) % 60
-	seconds := int(duration.Seconds()) % 60
-	if (hours != 0) || (minutes != 0) || (seconds != 0) {
-		return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
-	}
-	return ""
-}
@@ -0,0 +1,210 @@
+package notifs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// testChannel records the messages sent to it instead of sending them to Discord
+type testChannel struct {
+	webhook.Client
+	id       snowflake.ID
+	mu       sync.Mutex
+	messages []discord.WebhookMessageCreate
+}
+
+func newTestChannel(id snowflake.ID) *testChannel {
+	return &testChannel{id: id}
+}
+
+func (c *testChannel) ID() snowflake.ID {
+	return c.id
+}
+
+func (c *testChannel) CreateMessage(messageCreate discord.WebhookMessageCreate, _ ...rest.RequestOpt) (*discord.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, messageCreate)
+	return &discord.Message{ID: snowflake.ID(uint64(c.id) + uint64(len(c.messages)))}, nil
+}
+
+func (c *testChannel) sent() []discord.WebhookMessageCreate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]discord.WebhookMessageCreate{}, c.messages...)
+}
+
+func TestNotifUsernameProdPrefix(t *testing.T) {
+	// The Prod prefix can't be overridden by the prefix configured for other environments
+	t.Setenv("DISCORD_USERNAME_PREFIX", "[DEV]")
+	if username := notifUsername(manager.EnvType_Prod); username != prodUsernamePrefix+" "+manager.ServiceName {
+		t.Fatalf("unexpected prod username: %s", username)
+	}
+	if username := notifUsername(manager.EnvType_Dev); username != "[DEV] "+manager.ServiceName {
+		t.Fatalf("unexpected dev username: %s", username)
+	}
+	t.Setenv("DISCORD_USERNAME_PREFIX", "")
+	if username := notifUsername(manager.EnvType_Qa); username != manager.ServiceName {
+		t.Fatalf("unexpected qa username: %s", username)
+	}
+}
+
+func TestSendNotifProdUsername(t *testing.T) {
+	t.Setenv("DISCORD_USERNAME_PREFIX", "")
+	n := JobNotifs{username: notifUsername(manager.EnvType_Prod)}
+	channel := newTestChannel(1000000000000000010)
+	for _, color := range []discordColor{discordColor_Info, discordColor_Alert} {
+		if _, err := n.sendNotif("title", nil, color, time.Now(), channel, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := channel.sent()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	for _, message := range messages {
+		if !strings.HasPrefix(message.Username, prodUsernamePrefix+" ") {
+			t.Fatalf("prod notification sent without the prod prefix: %q", message.Username)
+		}
+	}
+}
+
+// testDb only implements the database operations used to record jobs and notifications
+type testDb struct {
+	manager.Database
+	mu       sync.Mutex
+	advanced []job.JobState
+	notifs   []manager.PendingNotif
+	deleted  []string
+}
+
+func (db *testDb) AdvanceJob(jobState job.JobState) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.advanced = append(db.advanced, jobState)
+	return nil
+}
+
+func (db *testDb) GetDeployTags() (map[manager.DeployComponent]string, error) {
+	return map[manager.DeployComponent]string{}, nil
+}
+
+func (db *testDb) WriteNotif(notif manager.PendingNotif) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.notifs = append(db.notifs, notif)
+	return nil
+}
+
+func (db *testDb) PendingNotifs() ([]manager.PendingNotif, error) {
+	return nil, nil
+}
+
+func (db *testDb) DeleteNotif(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.deleted = append(db.deleted, id)
+	return nil
+}
+
+// testJobNotifs returns job notifications that are only sent to the test channel
+func testJobNotifs(t *testing.T) (*JobNotifs, *testDb, *testChannel) {
+	t.Helper()
+	db := new(testDb)
+	n, err := NewJobNotifs(aws.Config{}, db, common.NewJobCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel := newTestChannel(1000000000000000011)
+	jobNotifs := n.(*JobNotifs)
+	jobNotifs.testWebhook = channel
+	return jobNotifs, db, channel
+}
+
+func advanceTestJob(t *testing.T, n *JobNotifs, db *testDb, jobState job.JobState, jobStage job.JobStage) {
+	t.Helper()
+	if _, err := manager.AdvanceJob(jobState, jobStage, time.Now(), nil, db, n); err != nil {
+		t.Fatal(err)
+	} else if err = n.FlushPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSilentJobNotNotified(t *testing.T) {
+	n, db, channel := testJobNotifs(t)
+	silentJob := job.JobState{JobId: "silent", Type: job.JobType_Task, Ts: time.Now(), Params: map[string]interface{}{
+		job.JobParam_Silent: true,
+	}}
+	advanceTestJob(t, n, db, silentJob, job.JobStage_Started)
+	if sent := channel.sent(); len(sent) != 0 {
+		t.Fatalf("expected no messages for a silent job, got %d", len(sent))
+	} else if len(db.notifs) != 0 {
+		t.Fatalf("notification recorded for a silent job: %+v", db.notifs)
+	}
+	// The job is still recorded as usual
+	if (len(db.advanced) != 1) || (db.advanced[0].JobId != "silent") || (db.advanced[0].Stage != job.JobStage_Started) {
+		t.Fatalf("silent job not recorded: %v", manager.PrintJob(db.advanced...))
+	}
+	advanceTestJob(t, n, db, job.JobState{JobId: "job", Type: job.JobType_Task, Ts: time.Now()}, job.JobStage_Started)
+	if sent := channel.sent(); len(sent) != 1 {
+		t.Fatalf("expected 1 message for a job that isn't silent, got %d", len(sent))
+	}
+}
+
+func TestSilentJobFailureNotified(t *testing.T) {
+	t.Setenv("NOTIFY_SILENT_JOB_FAILURES", "true")
+	n, db, channel := testJobNotifs(t)
+	silentJob := job.JobState{JobId: "silent", Type: job.JobType_Task, Ts: time.Now(), Params: map[string]interface{}{
+		job.JobParam_Silent: true,
+	}}
+	advanceTestJob(t, n, db, silentJob, job.JobStage_Started)
+	if sent := channel.sent(); len(sent) != 0 {
+		t.Fatalf("expected no messages for a silent job, got %d", len(sent))
+	}
+	advanceTestJob(t, n, db, silentJob, job.JobStage_Failed)
+	if sent := channel.sent(); len(sent) != 1 {
+		t.Fatalf("expected the silent job's failure to be notified, got %d messages", len(sent))
+	}
+}
+
+func TestNotifyJobRecordsNotifsWhenAccepted(t *testing.T) {
+	n, db, _ := testJobNotifs(t)
+	now := time.Now()
+	started := job.JobState{JobId: "job", Type: job.JobType_Task, Stage: job.JobStage_Started, Ts: now}
+	completed := job.JobState{JobId: "job", Type: job.JobType_Task, Stage: job.JobStage_Completed, Ts: now.Add(time.Minute)}
+	n.NotifyJob(started, completed)
+	// Notifications are recorded before NotifyJob returns, even if they're still waiting to be sent
+	db.mu.Lock()
+	if (len(db.notifs) != 2) || (db.notifs[0].Id != pendingNotifId(started)) || (db.notifs[1].Id != pendingNotifId(completed)) {
+		t.Fatalf("notifications not recorded when accepted: %+v", db.notifs)
+	}
+	db.mu.Unlock()
+	// A notification for an older update is dropped, and so must not leave its record behind
+	n.NotifyJob(job.JobState{JobId: "job", Type: job.JobType_Task, Stage: job.JobStage_Started, Ts: now.Add(-time.Minute)})
+	if err := n.FlushPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	deleted := make(map[string]bool, len(db.deleted))
+	for _, id := range db.deleted {
+		deleted[id] = true
+	}
+	for _, notif := range db.notifs {
+		if !deleted[notif.Id] {
+			t.Fatalf("notification record left behind: %s", manager.PrintJob(notif.Job))
+		}
+	}
+}
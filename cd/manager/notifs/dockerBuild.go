@@ -0,0 +1,97 @@
+package notifs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &dockerBuildNotif{}
+
+const (
+	dockerBuildNotifField_Commit = "Commit"
+	dockerBuildNotifField_Digest = "Image Digest"
+)
+
+type dockerBuildNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+	env                manager.EnvType
+}
+
+func newDockerBuildNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &dockerBuildNotif{jobState, d, a, manager.EnvType(os.Getenv(manager.EnvVar_Env))}, nil
+	}
+}
+
+func (b dockerBuildNotif) getChannels() []webhook.Client {
+	webhooks := []webhook.Client{b.deploymentsWebhook}
+	// Also send build failures to the alerts channel
+	if b.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, b.alertWebhook)
+	}
+	return webhooks
+}
+
+func (b dockerBuildNotif) getTitle() string {
+	component, _ := b.state.Params[job.DockerBuildJobParam_Component].(string)
+	prettyStage := string(b.state.Stage)
+	if b.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf(
+		"3Box Labs `%s` %s Image Build %s",
+		envName(b.env),
+		manager.ComponentDisplayName(manager.DeployComponent(component)),
+		strings.ToUpper(prettyStage),
+	)
+}
+
+func (b dockerBuildNotif) getFields() []discord.EmbedField {
+	var fields []discord.EmbedField
+	component, _ := b.state.Params[job.DockerBuildJobParam_Component].(string)
+	if sha, found := b.state.Params[job.DockerBuildJobParam_Sha].(string); found {
+		if repo, err := manager.ComponentRepo(manager.DeployComponent(component)); err == nil {
+			fields = append(fields, discord.EmbedField{
+				Name:  dockerBuildNotifField_Commit,
+				Value: fmt.Sprintf("[%s (%s)](https://github.com/%s/%s/commit/%s)", repo.Name, sha[:12], repo.Org, repo.Name, sha),
+			})
+		}
+	}
+	if digests, found := b.state.Params[job.JobParam_ImageDigests].(map[string]interface{}); found {
+		repos := make([]string, 0, len(digests))
+		for repo := range digests {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+		for _, repo := range repos {
+			fields = append(fields, discord.EmbedField{
+				Name:  fmt.Sprintf("%s (%s)", dockerBuildNotifField_Digest, repo),
+				Value: fmt.Sprintf("%v", digests[repo]),
+			})
+		}
+	}
+	return fields
+}
+
+func (b dockerBuildNotif) getColor() discordColor {
+	return colorForStage(b.state.Stage)
+}
+
+func (b dockerBuildNotif) getUrl() string {
+	url, _ := b.state.Params[job.DockerBuildJobParam_Url].(string)
+	return url
+}
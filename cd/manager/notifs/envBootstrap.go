@@ -0,0 +1,78 @@
+package notifs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &envBootstrapNotif{}
+
+const envBootstrapNotifField_Steps = "Steps"
+
+type envBootstrapNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+	env                manager.EnvType
+}
+
+func newEnvBootstrapNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &envBootstrapNotif{jobState, d, a, manager.EnvType(os.Getenv(manager.EnvVar_Env))}, nil
+	}
+}
+
+func (e envBootstrapNotif) getChannels() []webhook.Client {
+	webhooks := []webhook.Client{e.deploymentsWebhook}
+	// Also send provisioning failures to the alerts channel
+	if e.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, e.alertWebhook)
+	}
+	return webhooks
+}
+
+func (e envBootstrapNotif) getTitle() string {
+	prettyStage := string(e.state.Stage)
+	if e.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("3Box Labs `%s` Environment Provisioning %s", envName(e.env), strings.ToUpper(prettyStage))
+}
+
+func (e envBootstrapNotif) getFields() []discord.EmbedField {
+	// List the child job types in the order they will be run
+	if steps, found := e.state.Params[job.EnvBootstrapJobParam_Steps].([]interface{}); found && (len(steps) > 0) {
+		stepTypes := make([]string, 0, len(steps))
+		for _, step := range steps {
+			if s, ok := step.(map[string]interface{}); ok {
+				stepTypes = append(stepTypes, fmt.Sprintf("%v", s["Type"]))
+			}
+		}
+		return []discord.EmbedField{
+			{
+				Name:  envBootstrapNotifField_Steps,
+				Value: strings.Join(stepTypes, " → "),
+			},
+		}
+	}
+	return nil
+}
+
+func (e envBootstrapNotif) getColor() discordColor {
+	return colorForStage(e.state.Stage)
+}
+
+func (e envBootstrapNotif) getUrl() string {
+	return ""
+}
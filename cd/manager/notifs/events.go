@@ -0,0 +1,149 @@
+package notifs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgeTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snsTypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const (
+	eventAttribute_EventType = "eventType"
+	eventAttribute_Env       = "env"
+)
+
+const snsAttributeType_String = "String"
+
+var _ manager.Notifs = &EventNotifs{}
+
+// EventNotifs publishes job lifecycle events to an SNS topic or an EventBridge bus so that other AWS services can react
+// to them, e.g. by triggering a Lambda when a deployment completes. The payload is the job state, and the event type
+// (e.g. "deploy.completed") and environment are included for filtering, as message attributes for SNS, and as the
+// detail type and source (e.g. "cd-manager.prod") for EventBridge.
+//
+// Publishing is best-effort and happens in the background so that it never holds up job processing.
+type EventNotifs struct {
+	publish   func(ctx context.Context, eventType string, payload []byte) error
+	env       manager.EnvType
+	allStages bool
+	inFlight  *sync.WaitGroup
+}
+
+// NewEventNotifs returns nil if no event target has been configured
+func NewEventNotifs(cfg aws.Config) (manager.Notifs, error) {
+	targetArn := os.Getenv("JOB_EVENTS_TARGET_ARN")
+	if len(targetArn) == 0 {
+		return nil, nil
+	}
+	// ARNs look like "arn:aws:sns:us-east-1:123456789012:topic" or "arn:aws:events:us-east-1:123456789012:event-bus/bus"
+	arnParts := strings.Split(targetArn, ":")
+	if len(arnParts) < 6 {
+		return nil, fmt.Errorf("newEventNotifs: invalid target arn: %s", targetArn)
+	}
+	// Publish to the target's region, which might not be the region the manager runs in
+	targetCfg := cfg.Copy()
+	if len(arnParts[3]) > 0 {
+		targetCfg.Region = arnParts[3]
+	}
+	env := manager.EnvType(os.Getenv(manager.EnvVar_Env))
+	allStages, _ := strconv.ParseBool(os.Getenv("JOB_EVENTS_ALL_STAGES"))
+	n := &EventNotifs{env: env, allStages: allStages, inFlight: new(sync.WaitGroup)}
+	switch arnParts[2] {
+	case "sns":
+		client := sns.NewFromConfig(targetCfg)
+		n.publish = func(ctx context.Context, eventType string, payload []byte) error {
+			_, err := client.Publish(ctx, &sns.PublishInput{
+				Message:  aws.String(string(payload)),
+				TopicArn: aws.String(targetArn),
+				MessageAttributes: map[string]snsTypes.MessageAttributeValue{
+					eventAttribute_EventType: {DataType: aws.String(snsAttributeType_String), StringValue: aws.String(eventType)},
+					eventAttribute_Env:       {DataType: aws.String(snsAttributeType_String), StringValue: aws.String(string(env))},
+				},
+			})
+			return err
+		}
+	case "events":
+		client := eventbridge.NewFromConfig(targetCfg)
+		n.publish = func(ctx context.Context, eventType string, payload []byte) error {
+			if output, err := client.PutEvents(ctx, &eventbridge.PutEventsInput{
+				Entries: []eventbridgeTypes.PutEventsRequestEntry{{
+					Detail:       aws.String(string(payload)),
+					DetailType:   aws.String(eventType),
+					EventBusName: aws.String(targetArn),
+					Source:       aws.String(manager.ServiceName + "." + string(env)),
+				}},
+			}); err != nil {
+				return err
+			} else if output.FailedEntryCount > 0 {
+				return fmt.Errorf("publish: %s", aws.ToString(output.Entries[0].ErrorMessage))
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("newEventNotifs: unsupported target: %s", targetArn)
+	}
+	return n, nil
+}
+
+func (e EventNotifs) NotifyJob(jobs ...job.JobState) {
+	for _, jobState := range jobs {
+		if !e.allStages && !job.IsFinishedJob(jobState) {
+			continue
+		}
+		// Marshal the job right away since its parameters might be modified by the time the event is published
+		if payload, err := json.Marshal(jobState); err != nil {
+			log.Printf("notifyJob: error marshaling job event: %v, %s", err, manager.PrintJob(jobState))
+		} else {
+			e.inFlight.Add(1)
+			go func(jobState job.JobState) {
+				defer e.inFlight.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+				defer cancel()
+
+				eventType := fmt.Sprintf("%s.%s", jobState.Type, jobState.Stage)
+				if err := e.publish(ctx, eventType, payload); err != nil {
+					log.Printf("notifyJob: error publishing job event: %v, %s", err, manager.PrintJob(jobState))
+				}
+			}(jobState)
+		}
+	}
+}
+
+// NotifyJobDeferred is a no-op since events are published for job updates as they happen
+func (e EventNotifs) NotifyJobDeferred(time.Duration, ...job.JobState) {}
+
+// NotifySystem is a no-op since only job lifecycle events are published
+func (e EventNotifs) NotifySystem(manager.SystemEvent) {}
+
+// NotifyTest is a no-op since test notifications are only meant for chat channels
+func (e EventNotifs) NotifyTest(string) error {
+	return nil
+}
+
+func (e EventNotifs) FlushPending(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		e.inFlight.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flushPending: %v", ctx.Err())
+	}
+}
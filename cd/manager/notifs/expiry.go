@@ -0,0 +1,82 @@
+package notifs
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Only look for expired messages once a minute, and only delete a few at a time so that we stay well within the
+// Discord rate limits.
+const expirySweepInterval = time.Minute
+const expiryMaxDeletes = 10
+
+// messageExpiry tracks the messages sent to a channel so that they can be deleted once they are older than the
+// configured age. Messages are only tracked in memory, so messages sent before a restart will not be deleted.
+type messageExpiry struct {
+	maxAge    time.Duration
+	mu        *sync.Mutex
+	sent      map[string]time.Time
+	kept      map[string]bool
+	lastSweep time.Time
+}
+
+// newMessageExpiry returns nil if messages should not expire
+func newMessageExpiry(maxAgeEnv string) *messageExpiry {
+	if maxAge, err := time.ParseDuration(os.Getenv(maxAgeEnv)); (err == nil) && (maxAge > 0) {
+		return &messageExpiry{maxAge, new(sync.Mutex), make(map[string]time.Time), make(map[string]bool), time.Now()}
+	}
+	return nil
+}
+
+// track records when a message was first sent. Messages for alerts are never deleted, even if the message was sent
+// before the job failed.
+func (e *messageExpiry) track(messageId string, alert bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if alert {
+		e.kept[messageId] = true
+		delete(e.sent, messageId)
+	} else if _, found := e.sent[messageId]; !found && !e.kept[messageId] {
+		e.sent[messageId] = time.Now()
+	}
+}
+
+// sweep deletes expired messages from the channel, at most once per sweep interval. Expired messages are picked right
+// away, but are deleted in the background so that the caller isn't held up by Discord's rate limits.
+func (e *messageExpiry) sweep(channel webhook.Client, inFlight *sync.WaitGroup) {
+	now := time.Now()
+	expired := make([]string, 0, expiryMaxDeletes)
+	e.mu.Lock()
+	if now.Sub(e.lastSweep) >= expirySweepInterval {
+		e.lastSweep = now
+		for messageId, ts := range e.sent {
+			if len(expired) == expiryMaxDeletes {
+				break
+			} else if now.Sub(ts) > e.maxAge {
+				expired = append(expired, messageId)
+				delete(e.sent, messageId)
+			}
+		}
+	}
+	e.mu.Unlock()
+	if len(expired) == 0 {
+		return
+	}
+	inFlight.Add(1)
+	go func() {
+		defer inFlight.Done()
+		for _, messageId := range expired {
+			if parsedId, err := snowflake.Parse(messageId); err != nil {
+				log.Printf("sweep: error parsing discord message id: %v, %s", err, messageId)
+			} else if err = channel.DeleteMessage(parsedId, rest.WithDelay(discordPacing)); err != nil {
+				log.Printf("sweep: error deleting discord message: %v, %s", err, messageId)
+			}
+		}
+	}()
+}
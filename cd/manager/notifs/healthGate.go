@@ -0,0 +1,82 @@
+package notifs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &healthGateNotif{}
+
+const (
+	healthGateNotifField_Endpoints = "Endpoints"
+	healthGateNotifField_Failing   = "Unhealthy"
+)
+
+type healthGateNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+}
+
+func newHealthGateNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &healthGateNotif{jobState, d, a}, nil
+	}
+}
+
+func (h healthGateNotif) getChannels() []webhook.Client {
+	// Health gates usually follow deployments, so report them alongside deployments.
+	webhooks := []webhook.Client{h.deploymentsWebhook}
+	// Also send gate failures to the alerts channel
+	if h.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, h.alertWebhook)
+	}
+	return webhooks
+}
+
+func (h healthGateNotif) getTitle() string {
+	prettyStage := string(h.state.Stage)
+	if h.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("Health Gate %s", strings.ToUpper(prettyStage))
+}
+
+func (h healthGateNotif) getFields() []discord.EmbedField {
+	fields := make([]discord.EmbedField, 0)
+	if urls, found := h.state.Params[job.HealthGateJobParam_Urls].([]interface{}); found {
+		fields = append(fields, discord.EmbedField{
+			Name:  healthGateNotifField_Endpoints,
+			Value: fmt.Sprintf("%d", len(urls)),
+		})
+	}
+	// Show which endpoints are still unhealthy while the gate is retrying them, or were when it gave up
+	if failing, found := h.state.Params[job.HealthGateJobParam_Failing].([]interface{}); found && (len(failing) > 0) {
+		failingUrls := make([]string, 0, len(failing))
+		for _, failingUrl := range failing {
+			failingUrls = append(failingUrls, fmt.Sprintf("%v", failingUrl))
+		}
+		fields = append(fields, discord.EmbedField{
+			Name:  healthGateNotifField_Failing,
+			Value: strings.Join(failingUrls, "\n"),
+		})
+	}
+	return fields
+}
+
+func (h healthGateNotif) getColor() discordColor {
+	return colorForStage(h.state.Stage)
+}
+
+func (h healthGateNotif) getUrl() string {
+	return ""
+}
@@ -0,0 +1,110 @@
+package notifs
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const notifField_Heartbeat = "Status"
+
+// Heartbeats are only meant to reassure operators that long-running jobs aren't stuck, and so shouldn't be any more
+// frequent than this.
+const heartbeatMinInterval = time.Minute
+
+// heartbeats updates the test channel message for a running job when the job hasn't had any other updates for a while.
+// Heartbeats repeat at the configured interval until the job moves to a different stage.
+type heartbeats struct {
+	interval time.Duration
+	deferred *deferredNotifs
+}
+
+// newHeartbeats returns nil if no heartbeat interval has been configured
+func newHeartbeats(intervalEnv string, cache manager.Cache, send func(job.JobState)) *heartbeats {
+	interval, err := time.ParseDuration(os.Getenv(intervalEnv))
+	if (err != nil) || (interval <= 0) {
+		return nil
+	}
+	if interval < heartbeatMinInterval {
+		log.Printf("newHeartbeats: using minimum heartbeat interval: %s", heartbeatMinInterval)
+		interval = heartbeatMinInterval
+	}
+	return &heartbeats{interval, newDeferredNotifs(cache, func(jobs ...job.JobState) {
+		for _, jobState := range jobs {
+			send(jobState)
+		}
+	})}
+}
+
+// reset restarts the heartbeat for running jobs, and stops it for jobs that are no longer running
+func (h *heartbeats) reset(jobs ...job.JobState) {
+	if h == nil {
+		return
+	}
+	h.deferred.cancelTransitioned(jobs...)
+	for _, jobState := range jobs {
+		if job.IsActiveJob(jobState) && !manager.IsSilentJob(jobState) {
+			h.deferred.schedule(h.interval, jobState)
+		}
+	}
+}
+
+func (h *heartbeats) stop() {
+	if h != nil {
+		h.deferred.cancelAll()
+	}
+}
+
+// sendHeartbeat edits the job's message in the test channel to show how long the job has been running, then schedules
+// the next heartbeat. Heartbeats never go to any other channel.
+func (n JobNotifs) sendHeartbeat(jobState job.JobState) {
+	if n.testWebhook == nil {
+		return
+	}
+	n.inFlight.Add(1)
+	defer n.inFlight.Done()
+	// Heartbeats edit the same message as the job's other notifications, and so must not overwrite newer ones
+	n.ordering.deliver(jobState, func() { n.deliverHeartbeat(jobState) })
+}
+
+func (n JobNotifs) deliverHeartbeat(jobState job.JobState) {
+	jn, err := n.getJobNotif(jobState)
+	if err != nil {
+		log.Printf("sendHeartbeat: error creating job notification: %v, %s", err, manager.PrintJob(jobState))
+		return
+	}
+	startTime := jobState.Ts
+	if s, found := jobState.Params[job.JobParam_Start].(float64); found {
+		startTime = time.Unix(0, int64(s))
+	}
+	title := jn.getTitle()
+	fields := append(n.getNotifFields(jobState), jn.getFields()...)
+	fields = append(fields, discord.EmbedField{
+		Name:  notifField_Heartbeat,
+		Value: fmt.Sprintf("still running (%s elapsed)", n.duration(time.Since(startTime).Truncate(time.Minute))),
+	})
+	if n.summaries != nil {
+		fields = n.summaries.summarize(title, fields, jobState)
+	}
+	channelId := n.testWebhook.ID().String()
+	messageIds := n.getMessageIds(jobState)
+	color := jn.getColor()
+	if messageId, err := n.sendNotif(title, fields, n.channelColor(color, n.testWebhook), jobState.Ts, n.testWebhook, messageIds[channelId], ""); err != nil {
+		log.Printf("sendHeartbeat: error sending discord notification: %v, %s", err, manager.PrintJob(jobState))
+	} else if messageId != messageIds[channelId] {
+		// A new message was sent because the original could not be edited, so make sure that later updates edit the
+		// new message instead of sending more new messages.
+		if n.testExpiry != nil {
+			n.testExpiry.track(messageId, color == discordColor_Alert)
+		}
+		messageIds[channelId] = messageId
+		n.recordMessageIds(jobState, messageIds)
+	}
+	n.heartbeats.reset(jobState)
+}
@@ -0,0 +1,102 @@
+package notifs
+
+import (
+	"fmt"
+
+	"github.com/disgoorg/disgo/discord"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// jobNotifType describes how notifications are generated for jobs of a particular type
+type jobNotifType struct {
+	jobType  job.JobType
+	newNotif func(jobState job.JobState, cache manager.Cache) (jobNotif, error)
+	// Name of the field listing jobs of this type that are in progress in notifications for other jobs, if they're listed
+	activeField string
+}
+
+// jobNotifTypes lists every type of job notifications are sent for, in the order in which jobs in progress are listed
+var jobNotifTypes = []jobNotifType{
+	{job.JobType_Deploy, newDeployNotif, notifField_Deploy},
+	{job.JobType_TestE2E, notifWithoutCache(newE2eTestNotif), notifField_TestE2E},
+	{job.JobType_TestSmoke, notifWithoutCache(newSmokeTestNotif), notifField_TestSmoke},
+	{job.JobType_Workflow, notifWithoutCache(newWorkflowNotif), notifField_Workflow},
+	{job.JobType_DataBackup, notifWithoutCache(newDataBackupNotif), notifField_DataBackup},
+	{job.JobType_Task, notifWithoutCache(newTaskNotif), notifField_Task},
+	{job.JobType_Bootstrap, notifWithoutCache(newBootstrapNotif), notifField_Bootstrap},
+	{job.JobType_EnvBootstrap, notifWithoutCache(newEnvBootstrapNotif), notifField_EnvBootstrap},
+	{job.JobType_SecretsRotation, notifWithoutCache(newSecretsRotationNotif), notifField_Secrets},
+	{job.JobType_DockerBuild, notifWithoutCache(newDockerBuildNotif), notifField_DockerBuild},
+	{job.JobType_TerraformPlan, notifWithoutCache(newTerraformPlanNotif), notifField_Terraform},
+	{job.JobType_CacheInvalidation, notifWithoutCache(newCacheInvalidationNotif), notifField_Invalidation},
+	{job.JobType_SloCheck, notifWithoutCache(newSloCheckNotif), notifField_SloCheck},
+	{job.JobType_HealthGate, notifWithoutCache(newHealthGateNotif), notifField_HealthGate},
+	// There are usually too many anchor workers running for them to be worth listing
+	{job.JobType_Anchor, notifWithoutCache(newAnchorNotif), ""},
+	{job.JobType_Notification, notifWithoutCache(newNotificationNotif), ""},
+}
+
+func notifWithoutCache(newNotif func(job.JobState) (jobNotif, error)) func(job.JobState, manager.Cache) (jobNotif, error) {
+	return func(jobState job.JobState, _ manager.Cache) (jobNotif, error) {
+		return newNotif(jobState)
+	}
+}
+
+func lookupJobNotifType(jobType job.JobType) (jobNotifType, bool) {
+	for _, jnt := range jobNotifTypes {
+		if jnt.jobType == jobType {
+			return jnt, true
+		}
+	}
+	return jobNotifType{}, false
+}
+
+func (n JobNotifs) getJobNotif(jobState job.JobState) (jobNotif, error) {
+	if jnt, found := lookupJobNotifType(jobState.Type); found {
+		return jnt.newNotif(jobState, n.cache)
+	}
+	return nil, fmt.Errorf("getJobNotif: unknown job type: %s", jobState.Type)
+}
+
+// getActiveJobs lists the other jobs in progress, grouped by type
+func (n JobNotifs) getActiveJobs(jobState job.JobState) []discord.EmbedField {
+	activeJobs := make(map[job.JobType][]job.JobState)
+	for _, activeJob := range n.cache.JobsByMatcher(func(js job.JobState) bool {
+		// Exclude job for which this notification is being generated
+		return job.IsActiveJob(js) && (js.JobId != jobState.JobId)
+	}) {
+		activeJobs[activeJob.Type] = append(activeJobs[activeJob.Type], activeJob)
+	}
+	fields := make([]discord.EmbedField, 0, 0)
+	for _, jnt := range jobNotifTypes {
+		if len(jnt.activeField) > 0 {
+			if field, found := n.getActiveJobsField(jnt.activeField, activeJobs[jnt.jobType]); found {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+func (n JobNotifs) getActiveJobsField(name string, activeJobs []job.JobState) (discord.EmbedField, bool) {
+	// Sort the jobs so that the same jobs are listed each time, even when some have to be left out
+	sortActiveJobs(activeJobs)
+	message := ""
+	for i, activeJob := range activeJobs {
+		if i == n.maxActiveJobs {
+			message += fmt.Sprintf("+%d more\n", len(activeJobs)-i)
+			break
+		}
+		if jn, err := n.getJobNotif(activeJob); (err == nil) && (len(jn.getUrl()) > 0) {
+			message += fmt.Sprintf("[%s](%s)\n", activeJob.JobId, jn.getUrl())
+		} else {
+			message += activeJob.JobId + "\n"
+		}
+	}
+	return discord.EmbedField{
+		Name:  name + " In Progress:",
+		Value: message,
+	}, len(message) > 0
+}
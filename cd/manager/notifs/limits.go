@@ -0,0 +1,75 @@
+package notifs
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/disgoorg/disgo/discord"
+)
+
+// Discord rejects embeds that exceed any of these limits, all of which are in characters.
+//
+// https://discord.com/developers/docs/resources/channel#embed-object-embed-limits
+const (
+	discordLimit_Title      = 256
+	discordLimit_FieldName  = 256
+	discordLimit_FieldValue = 1024
+	discordLimit_Fields     = 25
+	discordLimit_Total      = 6000
+)
+
+const truncationMarker = "…"
+
+const notifField_Omitted = "Omitted"
+
+// clampEmbed truncates the title and fields of an embed so that the embed is always within Discord's limits. Fields
+// beyond what can be sent are replaced by a single field saying how many were omitted.
+func clampEmbed(title string, fields []discord.EmbedField) (string, []discord.EmbedField) {
+	title = truncate(title, discordLimit_Title)
+	// Reserve enough room for the field reporting omitted fields, in case one is needed.
+	omittedField := func(numOmitted int) discord.EmbedField {
+		return discord.EmbedField{Name: notifField_Omitted, Value: fmt.Sprintf("%d more fields", numOmitted)}
+	}
+	reserved := embedFieldLength(omittedField(len(fields)))
+	budget := discordLimit_Total - utf8.RuneCountInString(title)
+	clampedFields := make([]discord.EmbedField, 0, len(fields))
+	for i, field := range fields {
+		field.Name = truncate(field.Name, discordLimit_FieldName)
+		field.Value = truncate(field.Value, discordLimit_FieldValue)
+		isLast := i == len(fields)-1
+		// The last field doesn't need room to be reserved for the omitted field if it fits in its entirety
+		available := budget - reserved
+		if (len(clampedFields) == discordLimit_Fields-1) && !isLast {
+			// No room for any more fields, other than the one reporting the rest as omitted
+			break
+		} else if fieldLength := embedFieldLength(field); (fieldLength <= available) || (isLast && (fieldLength <= budget)) {
+			clampedFields = append(clampedFields, field)
+			budget -= fieldLength
+		} else {
+			// Truncate the value of the first field that doesn't fit, if there's room for a meaningful part of it
+			if valueBudget := available - utf8.RuneCountInString(field.Name); valueBudget > utf8.RuneCountInString(truncationMarker) {
+				field.Value = truncate(field.Value, valueBudget)
+				clampedFields = append(clampedFields, field)
+				budget -= embedFieldLength(field)
+			}
+			break
+		}
+	}
+	if numOmitted := len(fields) - len(clampedFields); numOmitted > 0 {
+		clampedFields = append(clampedFields, omittedField(numOmitted))
+	}
+	return title, clampedFields
+}
+
+func embedFieldLength(field discord.EmbedField) int {
+	return utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+}
+
+// truncate shortens a string to the specified number of characters, including a marker showing that it was truncated
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-utf8.RuneCountInString(truncationMarker)]) + truncationMarker
+}
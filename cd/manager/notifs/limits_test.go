@@ -0,0 +1,109 @@
+package notifs
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/disgoorg/disgo/discord"
+)
+
+// checkEmbed fails the test if an embed exceeds any of Discord's limits
+func checkEmbed(t *testing.T, title string, fields []discord.EmbedField) {
+	t.Helper()
+	total := utf8.RuneCountInString(title)
+	if total > discordLimit_Title {
+		t.Fatalf("title too long: %d", total)
+	} else if len(fields) > discordLimit_Fields {
+		t.Fatalf("too many fields: %d", len(fields))
+	}
+	for _, field := range fields {
+		if n := utf8.RuneCountInString(field.Name); n > discordLimit_FieldName {
+			t.Fatalf("field name too long: %d", n)
+		} else if n = utf8.RuneCountInString(field.Value); n > discordLimit_FieldValue {
+			t.Fatalf("field value too long: %d", n)
+		}
+		total += embedFieldLength(field)
+	}
+	if total > discordLimit_Total {
+		t.Fatalf("embed too long: %d", total)
+	}
+}
+
+func randomString(r *rand.Rand, maxLength int) string {
+	// Include multi-byte characters so that limits are checked in characters rather than bytes
+	alphabet := []rune("abcdefghijklmnopqrstuvwxyz 0123456789✅⚠️🍞")
+	runes := make([]rune, r.Intn(maxLength+1))
+	for i := range runes {
+		runes[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(runes)
+}
+
+func TestClampEmbedWithinLimits(t *testing.T) {
+	title := "title"
+	fields := []discord.EmbedField{{Name: "Job ID", Value: "job"}, {Name: "Logs", Value: "logs"}}
+	clampedTitle, clampedFields := clampEmbed(title, fields)
+	if (clampedTitle != title) || (len(clampedFields) != len(fields)) {
+		t.Fatalf("embed within limits changed: %s, %v", clampedTitle, clampedFields)
+	}
+	for i, field := range clampedFields {
+		if field != fields[i] {
+			t.Fatalf("field changed: %v", field)
+		}
+	}
+}
+
+func TestClampEmbedTruncates(t *testing.T) {
+	title, fields := clampEmbed(strings.Repeat("t", 300), []discord.EmbedField{
+		{Name: strings.Repeat("n", 300), Value: strings.Repeat("v", 2000)},
+	})
+	checkEmbed(t, title, fields)
+	if !strings.HasSuffix(title, truncationMarker) {
+		t.Fatalf("title not marked as truncated: %s", title)
+	} else if !strings.HasSuffix(fields[0].Name, truncationMarker) || !strings.HasSuffix(fields[0].Value, truncationMarker) {
+		t.Fatal("field not marked as truncated")
+	}
+}
+
+func TestClampEmbedOmitsFields(t *testing.T) {
+	fields := make([]discord.EmbedField, 40)
+	for i := range fields {
+		fields[i] = discord.EmbedField{Name: fmt.Sprintf("field %d", i), Value: "value"}
+	}
+	title, clampedFields := clampEmbed("title", fields)
+	checkEmbed(t, title, clampedFields)
+	if omitted := clampedFields[len(clampedFields)-1]; (omitted.Name != notifField_Omitted) || (omitted.Value != "16 more fields") {
+		t.Fatalf("unexpected omitted field: %v", omitted)
+	}
+}
+
+func TestClampEmbedRandomInputs(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		fields := make([]discord.EmbedField, r.Intn(50))
+		for j := range fields {
+			fields[j] = discord.EmbedField{Name: randomString(r, 400), Value: randomString(r, 3000)}
+		}
+		title, clampedFields := clampEmbed(randomString(r, 400), fields)
+		checkEmbed(t, title, clampedFields)
+	}
+}
+
+func FuzzClampEmbed(f *testing.F) {
+	f.Add("title", "name", "value", 1)
+	f.Add(strings.Repeat("t", 300), strings.Repeat("n", 300), strings.Repeat("v", 2000), 30)
+	f.Fuzz(func(t *testing.T, title, name, value string, numFields int) {
+		if (numFields < 0) || (numFields > 100) {
+			t.Skip()
+		}
+		fields := make([]discord.EmbedField, numFields)
+		for i := range fields {
+			fields[i] = discord.EmbedField{Name: name, Value: value}
+		}
+		clampedTitle, clampedFields := clampEmbed(title, fields)
+		checkEmbed(t, clampedTitle, clampedFields)
+	})
+}
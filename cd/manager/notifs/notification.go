@@ -0,0 +1,161 @@
+package notifs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &notificationNotif{}
+
+const (
+	notificationNotifField_Totals     = "Totals"
+	notificationNotifField_Components = "By Component"
+	notificationNotifField_Releases   = "Releases"
+)
+
+// Stages in the order they're listed in a report
+var notificationNotifStages = []job.JobStage{job.JobStage_Completed, job.JobStage_Failed, job.JobStage_Skipped}
+
+type notificationNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+}
+
+func newNotificationNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &notificationNotif{jobState, d, a}, nil
+	}
+}
+
+func (n notificationNotif) getChannels() []webhook.Client {
+	// Only the finished report is worth posting, and failures to generate it are worth an alert.
+	switch n.state.Stage {
+	case job.JobStage_Completed:
+		return []webhook.Client{n.deploymentsWebhook}
+	case job.JobStage_Failed:
+		return []webhook.Client{n.alertWebhook}
+	default:
+		return nil
+	}
+}
+
+func (n notificationNotif) getTitle() string {
+	window := 24 * time.Hour
+	if windowSecs, found := n.state.Params[job.NotificationJobParam_Window].(float64); found {
+		window = time.Duration(windowSecs * float64(time.Second))
+	}
+	if n.state.Stage == job.JobStage_Completed {
+		return fmt.Sprintf("Job Summary (last %s)", prettyWindow(window))
+	}
+	prettyStage := string(n.state.Stage)
+	if n.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("Job Summary %s", strings.ToUpper(prettyStage))
+}
+
+// prettyWindow formats a summary window without zero units, e.g. "24h" instead of "24h0m0s", or "1h30m"
+func prettyWindow(window time.Duration) string {
+	hours := window / time.Hour
+	minutes := (window % time.Hour) / time.Minute
+	seconds := (window % time.Minute) / time.Second
+	pretty := ""
+	if hours > 0 {
+		pretty += fmt.Sprintf("%dh", hours)
+	}
+	if minutes > 0 {
+		pretty += fmt.Sprintf("%dm", minutes)
+	}
+	if (seconds > 0) || (len(pretty) == 0) {
+		pretty += fmt.Sprintf("%ds", seconds)
+	}
+	return pretty
+}
+
+func (n notificationNotif) getFields() []discord.EmbedField {
+	fields := make([]discord.EmbedField, 0)
+	counts, found := n.state.Params[job.NotificationJobParam_Counts].(map[string]interface{})
+	if !found {
+		return fields
+	}
+	fields = append(fields, discord.EmbedField{
+		Name:  notificationNotifField_Totals,
+		Value: prettyStageCounts(counts, true),
+	})
+	if components, _ := n.state.Params[job.NotificationJobParam_Components].(map[string]interface{}); len(components) > 0 {
+		names := make([]string, 0, len(components))
+		for name := range components {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			componentCounts, _ := components[name].(map[string]interface{})
+			lines = append(lines, fmt.Sprintf("`%s`: %s", name, prettyStageCounts(componentCounts, false)))
+		}
+		fields = append(fields, discord.EmbedField{
+			Name:  notificationNotifField_Components,
+			Value: strings.Join(lines, "\n"),
+		})
+	}
+	if releases, _ := n.state.Params[job.NotificationJobParam_Releases].(map[string]interface{}); len(releases) > 0 {
+		names := make([]string, 0, len(releases))
+		for name := range releases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			versions, _ := releases[name].([]interface{})
+			prettyVersions := make([]string, len(versions))
+			for i, version := range versions {
+				prettyVersions[i] = fmt.Sprint(version)
+			}
+			lines = append(lines, fmt.Sprintf("`%s`: %s", name, strings.Join(prettyVersions, ", ")))
+		}
+		fields = append(fields, discord.EmbedField{
+			Name:  notificationNotifField_Releases,
+			Value: strings.Join(lines, "\n"),
+		})
+	}
+	return fields
+}
+
+// prettyStageCounts lists the number of jobs per stage, e.g. "3 completed, 1 failed", optionally including stages
+// without any jobs
+func prettyStageCounts(counts map[string]interface{}, showEmpty bool) string {
+	parts := make([]string, 0, len(notificationNotifStages))
+	for _, stage := range notificationNotifStages {
+		if count, _ := counts[string(stage)].(float64); showEmpty || (count > 0) {
+			parts = append(parts, fmt.Sprintf("%d %s", int(count), stage))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (n notificationNotif) getColor() discordColor {
+	if n.state.Stage == job.JobStage_Completed {
+		// Call attention to the report if any jobs failed
+		if counts, _ := n.state.Params[job.NotificationJobParam_Counts].(map[string]interface{}); counts[string(job.JobStage_Failed)] != nil {
+			return discordColor_Warning
+		}
+		return discordColor_Info
+	}
+	return colorForStage(n.state.Stage)
+}
+
+func (n notificationNotif) getUrl() string {
+	return ""
+}
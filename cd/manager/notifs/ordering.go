@@ -0,0 +1,100 @@
+package notifs
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Delivery records are kept for as long as jobs are kept in the cache
+const jobOrderingRetention = manager.DefaultTtlDays * 24 * time.Hour
+
+const jobOrderingPruneInterval = time.Hour
+
+// jobOrdering guarantees that notifications for the same job are delivered one at a time, in the order of the job's
+// updates, no matter how many goroutines are sending notifications. Notifications for a job are queued, and each queue
+// is drained by its own goroutine, so that a notification can't overtake one sent earlier for the same job and callers
+// never wait for notifications to be sent. The mutex is only held while checking and updating the queues, never while
+// a notification is being sent, so a slow send only holds up later notifications for the same job.
+//
+// Since notifications for a job edit the same messages, a notification for an update older than one that was already
+// accepted is dropped instead of being sent, e.g. a "started" notification that was held up until after the
+// "completed" notification was queued. Notifications for different jobs are not ordered with respect to each other.
+type jobOrdering struct {
+	mu        *sync.Mutex
+	queues    map[string][]func()
+	delivered map[string]time.Time
+	lastPrune time.Time
+	inFlight  *sync.WaitGroup
+}
+
+func newJobOrdering(inFlight *sync.WaitGroup) *jobOrdering {
+	return &jobOrdering{
+		inFlight:  inFlight,
+		mu:        new(sync.Mutex),
+		queues:    make(map[string][]func()),
+		delivered: make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// deliver queues a job's notification to be sent by send, unless a notification for a later update of the job was
+// already queued. Returns whether the notification was queued.
+func (o *jobOrdering) deliver(jobState job.JobState, send func()) bool {
+	o.mu.Lock()
+	lastTs, found := o.delivered[jobState.JobId]
+	// Updates made in place, e.g. to show progress, keep the same timestamp and so are still delivered
+	if found && jobState.Ts.Before(lastTs) {
+		o.mu.Unlock()
+		log.Printf("deliver: skipping notification for older job update: %s, %s", lastTs, manager.PrintJob(jobState))
+		return false
+	}
+	o.delivered[jobState.JobId] = jobState.Ts
+	o.prune()
+	queue, draining := o.queues[jobState.JobId]
+	o.queues[jobState.JobId] = append(queue, send)
+	o.mu.Unlock()
+	// Notifications for this job are already being sent, and this one will be sent after the ones before it
+	if !draining {
+		o.inFlight.Add(1)
+		go func() {
+			defer o.inFlight.Done()
+			o.drain(jobState.JobId)
+		}()
+	}
+	return true
+}
+
+// drain sends the queued notifications for a job until there are none left
+func (o *jobOrdering) drain(jobId string) {
+	for {
+		o.mu.Lock()
+		queue := o.queues[jobId]
+		if len(queue) == 0 {
+			delete(o.queues, jobId)
+			o.mu.Unlock()
+			return
+		}
+		send := queue[0]
+		o.queues[jobId] = queue[1:]
+		o.mu.Unlock()
+		send()
+	}
+}
+
+// prune forgets about jobs that have aged out of the cache. Must be called with the mutex held.
+func (o *jobOrdering) prune() {
+	now := time.Now()
+	if now.Sub(o.lastPrune) < jobOrderingPruneInterval {
+		return
+	}
+	for jobId, ts := range o.delivered {
+		if now.Sub(ts) > jobOrderingRetention {
+			delete(o.delivered, jobId)
+		}
+	}
+	o.lastPrune = now
+}
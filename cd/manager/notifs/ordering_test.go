@@ -0,0 +1,96 @@
+package notifs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+func TestJobOrderingDropsOlderUpdates(t *testing.T) {
+	o := newJobOrdering(new(sync.WaitGroup))
+	now := time.Now()
+	sent := make([]job.JobStage, 0)
+	for i, jobState := range []job.JobState{
+		{JobId: "job", Stage: job.JobStage_Started, Ts: now},
+		{JobId: "job", Stage: job.JobStage_Completed, Ts: now.Add(time.Minute)},
+		{JobId: "job", Stage: job.JobStage_Started, Ts: now},
+	} {
+		jobState := jobState
+		if queued := o.deliver(jobState, func() { sent = append(sent, jobState.Stage) }); queued != (i < 2) {
+			t.Fatalf("unexpected result for notification %d: %v", i, queued)
+		}
+	}
+	o.inFlight.Wait()
+	if len(sent) != 2 || sent[0] != job.JobStage_Started || sent[1] != job.JobStage_Completed {
+		t.Fatalf("unexpected notifications sent: %v", sent)
+	}
+}
+
+func TestJobOrderingDeliversInPlaceUpdates(t *testing.T) {
+	o := newJobOrdering(new(sync.WaitGroup))
+	now := time.Now()
+	count := 0
+	for i := 0; i < 3; i++ {
+		o.deliver(job.JobState{JobId: "job", Ts: now}, func() { count++ })
+	}
+	o.inFlight.Wait()
+	if count != 3 {
+		t.Fatalf("expected 3 notifications, got %d", count)
+	}
+}
+
+func TestJobOrderingDoesNotHoldLockDuringSend(t *testing.T) {
+	o := newJobOrdering(new(sync.WaitGroup))
+	now := time.Now()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		o.deliver(job.JobState{JobId: "slow", Ts: now}, func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+	// A notification for another job must not wait for the slow send to finish
+	delivered := make(chan struct{})
+	go o.deliver(job.JobState{JobId: "fast", Ts: now}, func() { close(delivered) })
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("notification for another job was held up by a slow send")
+	}
+	// A notification for the same job is queued behind the slow send instead of blocking the caller
+	var mu sync.Mutex
+	sent := make([]job.JobStage, 0)
+	queued := make(chan struct{})
+	go func() {
+		o.deliver(job.JobState{JobId: "slow", Stage: job.JobStage_Completed, Ts: now.Add(time.Minute)}, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, job.JobStage_Completed)
+		})
+		close(queued)
+	}()
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("caller was blocked by a slow send for the same job")
+	}
+	mu.Lock()
+	if len(sent) != 0 {
+		t.Fatal("notification overtook an earlier one for the same job")
+	}
+	mu.Unlock()
+	close(release)
+	<-done
+	o.inFlight.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 {
+		t.Fatalf("queued notification was not sent: %v", sent)
+	}
+}
@@ -0,0 +1,84 @@
+package notifs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Which job failures page the on-call mention in the alerts channel
+const (
+	pagePolicy_Automated = "automated"
+	pagePolicy_Manual    = "manual"
+	pagePolicy_All       = "all"
+)
+
+// failurePager mentions whoever is on call when jobs fail. By default, only failures of automated jobs page since an
+// operator is already watching jobs they triggered manually. Manual failures are still notified as usual.
+type failurePager struct {
+	mention      string
+	alertChannel snowflake.ID
+	policy       string
+}
+
+// newFailurePager returns nil if no on-call mention (e.g. "<@&role-id>") or alerts channel has been configured
+func newFailurePager() (*failurePager, error) {
+	mention := os.Getenv("DISCORD_ONCALL_MENTION")
+	if len(mention) == 0 {
+		return nil, nil
+	}
+	policy := os.Getenv("DISCORD_PAGE_POLICY")
+	switch policy {
+	case "":
+		policy = pagePolicy_Automated
+	case pagePolicy_Automated, pagePolicy_Manual, pagePolicy_All:
+	default:
+		return nil, fmt.Errorf("newFailurePager: invalid page policy: %s", policy)
+	}
+	if alertWebhook, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else if alertWebhook == nil {
+		return nil, nil
+	} else {
+		return &failurePager{mention, alertWebhook.ID(), policy}, nil
+	}
+}
+
+// pageContent returns the mention to include in the notification of a failed job sent to the alerts channel, if the
+// failure should page according to the configured policy.
+func (n JobNotifs) pageContent(jobState job.JobState, channel webhook.Client) string {
+	if (n.pager == nil) || (jobState.Stage != job.JobStage_Failed) || (channel.ID() != n.pager.alertChannel) {
+		return ""
+	}
+	manual := isManualJob(jobState)
+	switch n.pager.policy {
+	case pagePolicy_All:
+		return n.pager.mention
+	case pagePolicy_Manual:
+		if manual {
+			return n.pager.mention
+		}
+	default:
+		if !manual {
+			return n.pager.mention
+		}
+	}
+	return ""
+}
+
+func isManualJob(jobState job.JobState) bool {
+	if manual, _ := jobState.Params[job.JobParam_Manual].(bool); manual {
+		return true
+	}
+	// A non-rollback force deployment is always manual
+	if jobState.Type == job.JobType_Deploy {
+		rollback, _ := jobState.Params[job.DeployJobParam_Rollback].(bool)
+		force, _ := jobState.Params[job.DeployJobParam_Force].(bool)
+		return force && !rollback
+	}
+	return false
+}
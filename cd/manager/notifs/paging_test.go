@@ -0,0 +1,81 @@
+package notifs
+
+import (
+	"testing"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const testOncallMention = "<@&1000000000000000007>"
+
+func testPager(t *testing.T, policy string) JobNotifs {
+	t.Helper()
+	t.Setenv("DISCORD_ONCALL_MENTION", testOncallMention)
+	t.Setenv("DISCORD_PAGE_POLICY", policy)
+	t.Setenv("DISCORD_ALERT_WEBHOOK", testAlertWebhookUrl)
+	pager, err := newFailurePager()
+	if err != nil {
+		t.Fatal(err)
+	} else if pager == nil {
+		t.Fatal("expected paging to be configured")
+	}
+	return JobNotifs{pager: pager}
+}
+
+func failedJob(manual bool) job.JobState {
+	return job.JobState{JobId: "job", Type: job.JobType_Task, Stage: job.JobStage_Failed, Params: map[string]interface{}{
+		job.JobParam_Manual: manual,
+	}}
+}
+
+func TestPageContentAutomatedFailures(t *testing.T) {
+	n := testPager(t, "")
+	alerts := testWebhook(t, testAlertWebhookUrl)
+	if content := n.pageContent(failedJob(false), alerts); content != testOncallMention {
+		t.Fatalf("automated failure didn't page: %q", content)
+	} else if content = n.pageContent(failedJob(true), alerts); content != "" {
+		t.Fatalf("manual failure paged: %q", content)
+	}
+	// Force deployments are manual, but rollbacks aren't
+	force := deployJob("force", job.JobStage_Failed, manager.DeployComponent_Ceramic)
+	force.Params[job.DeployJobParam_Force] = true
+	if content := n.pageContent(force, alerts); content != "" {
+		t.Fatalf("force deployment failure paged: %q", content)
+	}
+	force.Params[job.DeployJobParam_Rollback] = true
+	if content := n.pageContent(force, alerts); content != testOncallMention {
+		t.Fatalf("rollback failure didn't page: %q", content)
+	}
+}
+
+func TestPageContentOnlyFailuresInAlertChannel(t *testing.T) {
+	n := testPager(t, pagePolicy_All)
+	if content := n.pageContent(failedJob(false), testWebhook(t, testDeploymentsWebhookUrl)); content != "" {
+		t.Fatalf("failure paged outside the alerts channel: %q", content)
+	}
+	completed := failedJob(false)
+	completed.Stage = job.JobStage_Completed
+	if content := n.pageContent(completed, testWebhook(t, testAlertWebhookUrl)); content != "" {
+		t.Fatalf("completed job paged: %q", content)
+	}
+}
+
+func TestPageContentPolicies(t *testing.T) {
+	alerts := testWebhook(t, testAlertWebhookUrl)
+	for policy, expected := range map[string][2]string{
+		pagePolicy_Manual: {"", testOncallMention},
+		pagePolicy_All:    {testOncallMention, testOncallMention},
+	} {
+		n := testPager(t, policy)
+		if content := n.pageContent(failedJob(false), alerts); content != expected[0] {
+			t.Fatalf("unexpected page for automated failure with %s policy: %q", policy, content)
+		} else if content = n.pageContent(failedJob(true), alerts); content != expected[1] {
+			t.Fatalf("unexpected page for manual failure with %s policy: %q", policy, content)
+		}
+	}
+	t.Setenv("DISCORD_PAGE_POLICY", "never")
+	if _, err := newFailurePager(); err == nil {
+		t.Fatal("expected an invalid policy to be rejected")
+	}
+}
@@ -0,0 +1,49 @@
+package notifs
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// There is one notification per job update, and so the job ID and timestamp identify a notification. Updates to a job
+// that don't change its timestamp replace the previous notification for that update.
+func pendingNotifId(jobState job.JobState) string {
+	return fmt.Sprintf("%s_%d", jobState.JobId, jobState.Ts.UnixNano())
+}
+
+func (n JobNotifs) removeNotif(notif manager.PendingNotif) {
+	if err := n.db.DeleteNotif(notif.Id); err != nil {
+		log.Printf("notifyJob: error removing delivered notification: %v, %s", err, manager.PrintJob(notif.Job))
+	}
+}
+
+// resumePendingNotifs resends notifications that were not delivered to all of their channels before the manager last
+// stopped. Since notifications for a job update its messages in place, only the latest notification for each job needs
+// to be resent, and only if the job hasn't been updated since.
+func (n JobNotifs) resumePendingNotifs() {
+	notifs, err := n.db.PendingNotifs()
+	if err != nil {
+		log.Printf("resumePendingNotifs: error loading pending notifications: %v", err)
+		return
+	}
+	// Notifications are ordered by job timestamp, so the last notification for each job is its latest
+	latest := make(map[string]string, len(notifs))
+	for _, notif := range notifs {
+		latest[notif.Job.JobId] = notif.Id
+	}
+	for _, notif := range notifs {
+		cachedJob, found := n.cache.JobById(notif.Job.JobId)
+		if (latest[notif.Job.JobId] != notif.Id) || (found && cachedJob.Ts.After(notif.Job.Ts)) {
+			log.Printf("resumePendingNotifs: skipping superseded notification: %s", manager.PrintJob(notif.Job))
+			n.removeNotif(notif)
+			continue
+		}
+		log.Printf("resumePendingNotifs: resending notification: %v, %s", notif.Delivered, manager.PrintJob(notif.Job))
+		// Delivering the notification records the messages sent for the job on the cached job, so that they're edited
+		// for subsequent stages.
+		n.deliverNotif(notif)
+	}
+}
@@ -0,0 +1,180 @@
+package notifs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Only alerts for failed jobs are pinned unless configured otherwise
+const defaultPinSeverities = manager.SystemEventSeverity_Critical
+
+// Alerts are only pinned in the alerts channel unless configured otherwise
+const defaultPinChannels = "DISCORD_ALERT_WEBHOOK"
+
+// alertPins pins alerts in the configured channels so that ongoing incidents stay visible, and unpins them once a later
+// job for the same component completes. Webhooks can't pin messages, so this needs a bot token with permission to
+// manage messages in those channels.
+//
+// One message is pinned per component and channel. Jobs without a component are tracked by job type. Each manager only
+// runs jobs for its own environment, so pins for different environments sharing a channel don't collide. Pinned
+// messages are only tracked in memory, so messages pinned before a restart will not be unpinned.
+type alertPins struct {
+	channels   rest.Channels
+	webhookIds map[snowflake.ID]bool
+	severities map[string]bool
+	mu         *sync.Mutex
+	// Channel IDs by webhook ID, looked up from the webhook the first time a message is pinned in the channel
+	channelIds map[snowflake.ID]snowflake.ID
+	pinned     map[string]pinnedMessage
+}
+
+type pinnedMessage struct {
+	channelId snowflake.ID
+	messageId snowflake.ID
+}
+
+// newAlertPins returns nil if no bot token has been configured
+func newAlertPins() (*alertPins, error) {
+	botToken := os.Getenv("DISCORD_BOT_TOKEN")
+	if len(botToken) == 0 {
+		return nil, nil
+	}
+	webhookIds := make(map[snowflake.ID]bool)
+	channelEnvs := os.Getenv("DISCORD_PIN_CHANNELS")
+	if len(channelEnvs) == 0 {
+		channelEnvs = defaultPinChannels
+	}
+	for _, channelEnv := range strings.Split(channelEnvs, ",") {
+		if channel, err := parseDiscordWebhookUrl(strings.TrimSpace(channelEnv)); err != nil {
+			return nil, fmt.Errorf("newAlertPins: invalid channel: %s, %v", channelEnv, err)
+		} else if channel == nil {
+			return nil, fmt.Errorf("newAlertPins: channel not configured: %s", channelEnv)
+		} else {
+			webhookIds[channel.ID()] = true
+		}
+	}
+	severities := make(map[string]bool)
+	severityList := os.Getenv("DISCORD_PIN_SEVERITIES")
+	if len(severityList) == 0 {
+		severityList = defaultPinSeverities
+	}
+	for _, severity := range strings.Split(severityList, ",") {
+		switch severity = strings.TrimSpace(severity); severity {
+		case manager.SystemEventSeverity_Warning, manager.SystemEventSeverity_Critical:
+			severities[severity] = true
+		default:
+			return nil, fmt.Errorf("newAlertPins: invalid severity: %s", severity)
+		}
+	}
+	return &alertPins{
+		rest.NewChannels(rest.NewClient(botToken, restOpts()...)),
+		webhookIds,
+		severities,
+		new(sync.Mutex),
+		make(map[snowflake.ID]snowflake.ID),
+		make(map[string]pinnedMessage),
+	}, nil
+}
+
+// jobSeverity returns how severe a job update is for the purposes of pinning, i.e. critical for failed jobs, and warning
+// for jobs that were canceled or skipped
+func jobSeverity(jobStage job.JobStage) string {
+	switch jobStage {
+	case job.JobStage_Failed:
+		return manager.SystemEventSeverity_Critical
+	case job.JobStage_Canceled, job.JobStage_Skipped:
+		return manager.SystemEventSeverity_Warning
+	default:
+		return manager.SystemEventSeverity_Info
+	}
+}
+
+func pinKey(jobState job.JobState, channel webhook.Client) string {
+	subject := string(jobState.Type)
+	if component, found := jobState.Params[job.DeployJobParam_Component].(string); found && (len(component) > 0) {
+		subject = component
+	}
+	return subject + "/" + channel.ID().String()
+}
+
+// update pins the message for a job update that's severe enough, replacing any message already pinned for the same
+// component in the channel, and unpins that message once a job for the component completes
+func (p *alertPins) update(jobState job.JobState, channel webhook.Client, messageId string) {
+	if (p == nil) || (channel == nil) || !p.webhookIds[channel.ID()] {
+		return
+	}
+	pin := p.severities[jobSeverity(jobState.Stage)]
+	if !pin && (jobState.Stage != job.JobStage_Completed) {
+		return
+	}
+	key := pinKey(jobState, channel)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prevPinned, found := p.pinned[key]
+	if !pin {
+		if found {
+			p.unpin(prevPinned)
+			delete(p.pinned, key)
+		}
+		return
+	}
+	parsedId, err := snowflake.Parse(messageId)
+	if err != nil {
+		log.Printf("pinAlert: error parsing discord message id: %v, %s", err, messageId)
+		return
+	} else if found && (prevPinned.messageId == parsedId) {
+		// Don't pin the same message again, e.g. when it's edited, in case it was unpinned manually
+		return
+	}
+	channelId, err := p.channelId(channel)
+	if err != nil {
+		log.Printf("pinAlert: error looking up discord channel: %v, %s", err, manager.PrintJob(jobState))
+		return
+	}
+	if found {
+		p.unpin(prevPinned)
+		delete(p.pinned, key)
+	}
+	if err = p.channels.PinMessage(channelId, parsedId, rest.WithDelay(discordPacing)); err != nil {
+		log.Printf("pinAlert: error pinning discord message: %v, %s", err, manager.PrintJob(jobState))
+		return
+	}
+	p.pinned[key] = pinnedMessage{channelId, parsedId}
+}
+
+// unpin treats messages that are no longer pinned, e.g. because they were unpinned or deleted manually, as unpinned
+func (p *alertPins) unpin(pinned pinnedMessage) {
+	if err := p.channels.UnpinMessage(pinned.channelId, pinned.messageId, rest.WithDelay(discordPacing)); err != nil {
+		var restErr *rest.Error
+		if errors.As(err, &restErr) && (restErr.Response != nil) && (restErr.Response.StatusCode == http.StatusNotFound) {
+			return
+		}
+		log.Printf("unpinAlert: error unpinning discord message: %v, %s", err, pinned.messageId)
+	}
+}
+
+// channelId returns the ID of the channel a webhook posts to, which is needed to pin messages with the bot. This must be
+// called with the lock held.
+func (p *alertPins) channelId(channel webhook.Client) (snowflake.ID, error) {
+	if channelId, found := p.channelIds[channel.ID()]; found {
+		return channelId, nil
+	}
+	w, err := channel.GetWebhook(rest.WithDelay(discordPacing))
+	if err != nil {
+		return 0, err
+	}
+	p.channelIds[channel.ID()] = w.ChannelID
+	return w.ChannelID, nil
+}
@@ -0,0 +1,113 @@
+package notifs
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const testPinChannelId = snowflake.ID(2000000000000000001)
+
+// testChannels only implements the channel operations used to pin messages
+type testChannels struct {
+	rest.Channels
+	pinned       map[snowflake.ID]bool
+	unpinMissing bool
+}
+
+func (c *testChannels) PinMessage(channelId snowflake.ID, messageId snowflake.ID, _ ...rest.RequestOpt) error {
+	c.pinned[messageId] = true
+	return nil
+}
+
+func (c *testChannels) UnpinMessage(channelId snowflake.ID, messageId snowflake.ID, _ ...rest.RequestOpt) error {
+	if c.unpinMissing {
+		return rest.NewError(nil, nil, &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found"}, nil)
+	}
+	delete(c.pinned, messageId)
+	return nil
+}
+
+func testAlertPins(t *testing.T, channel webhook.Client, severities ...string) (*alertPins, *testChannels) {
+	t.Helper()
+	channels := &testChannels{pinned: make(map[snowflake.ID]bool)}
+	pinSeverities := make(map[string]bool)
+	for _, severity := range severities {
+		pinSeverities[severity] = true
+	}
+	return &alertPins{
+		channels,
+		map[snowflake.ID]bool{channel.ID(): true},
+		pinSeverities,
+		new(sync.Mutex),
+		map[snowflake.ID]snowflake.ID{channel.ID(): testPinChannelId},
+		make(map[string]pinnedMessage),
+	}, channels
+}
+
+func TestAlertPinsPinAndUnpinOnRecovery(t *testing.T) {
+	alerts := testWebhook(t, testAlertWebhookUrl)
+	pins, channels := testAlertPins(t, alerts, manager.SystemEventSeverity_Critical)
+	pins.update(deployJob("failed", job.JobStage_Failed, manager.DeployComponent_Ceramic), alerts, "3000000000000000001")
+	if !channels.pinned[3000000000000000001] {
+		t.Fatal("alert not pinned")
+	}
+	// A job for a different component completing doesn't resolve the incident
+	pins.update(deployJob("other", job.JobStage_Completed, manager.DeployComponent_Cas), alerts, "3000000000000000002")
+	if !channels.pinned[3000000000000000001] {
+		t.Fatal("alert unpinned by a job for another component")
+	}
+	pins.update(deployJob("recovered", job.JobStage_Completed, manager.DeployComponent_Ceramic), alerts, "3000000000000000003")
+	if len(channels.pinned) != 0 {
+		t.Fatalf("alert not unpinned on recovery: %v", channels.pinned)
+	}
+}
+
+func TestAlertPinsReplaceEarlierAlert(t *testing.T) {
+	alerts := testWebhook(t, testAlertWebhookUrl)
+	pins, channels := testAlertPins(t, alerts, manager.SystemEventSeverity_Critical)
+	pins.update(deployJob("first", job.JobStage_Failed, manager.DeployComponent_Ceramic), alerts, "3000000000000000001")
+	pins.update(deployJob("second", job.JobStage_Failed, manager.DeployComponent_Ceramic), alerts, "3000000000000000002")
+	if channels.pinned[3000000000000000001] || !channels.pinned[3000000000000000002] {
+		t.Fatalf("expected only the latest alert to be pinned: %v", channels.pinned)
+	}
+}
+
+func TestAlertPinsGatedBySeverityAndChannel(t *testing.T) {
+	alerts := testWebhook(t, testAlertWebhookUrl)
+	deployments := testWebhook(t, testDeploymentsWebhookUrl)
+	pins, channels := testAlertPins(t, alerts, manager.SystemEventSeverity_Critical)
+	pins.update(deployJob("canceled", job.JobStage_Canceled, manager.DeployComponent_Ceramic), alerts, "3000000000000000001")
+	pins.update(deployJob("failed", job.JobStage_Failed, manager.DeployComponent_Ceramic), deployments, "3000000000000000002")
+	if len(channels.pinned) != 0 {
+		t.Fatalf("unexpected messages pinned: %v", channels.pinned)
+	}
+}
+
+func TestAlertPinsAlreadyUnpinned(t *testing.T) {
+	alerts := testWebhook(t, testAlertWebhookUrl)
+	pins, channels := testAlertPins(t, alerts, manager.SystemEventSeverity_Critical)
+	pins.update(deployJob("failed", job.JobStage_Failed, manager.DeployComponent_Ceramic), alerts, "3000000000000000001")
+	// The message was unpinned by hand, so Discord no longer knows it as pinned
+	channels.unpinMissing = true
+	pins.update(deployJob("recovered", job.JobStage_Completed, manager.DeployComponent_Ceramic), alerts, "3000000000000000002")
+	if len(pins.pinned) != 0 {
+		t.Fatalf("manually unpinned alert still tracked: %v", pins.pinned)
+	}
+}
+
+func TestNewAlertPinsInvalidSeverity(t *testing.T) {
+	t.Setenv("DISCORD_BOT_TOKEN", "token")
+	t.Setenv("DISCORD_ALERT_WEBHOOK", testAlertWebhookUrl)
+	t.Setenv("DISCORD_PIN_SEVERITIES", "critical,urgent")
+	if _, err := newAlertPins(); err == nil {
+		t.Fatal("expected an error for an invalid severity")
+	}
+}
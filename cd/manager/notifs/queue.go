@@ -0,0 +1,44 @@
+package notifs
+
+import "sync"
+
+// notifQueue runs notification sends one at a time, in the order they were queued, in the background. The queue is
+// drained by a goroutine that is started when the first send is queued and exits once the queue is empty. Sends that
+// are queued or running are tracked by the wait group so that they can be flushed.
+type notifQueue struct {
+	mu       *sync.Mutex
+	sends    []func()
+	draining bool
+	inFlight *sync.WaitGroup
+}
+
+func newNotifQueue(inFlight *sync.WaitGroup) *notifQueue {
+	return &notifQueue{mu: new(sync.Mutex), inFlight: inFlight}
+}
+
+func (q *notifQueue) push(send func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sends = append(q.sends, send)
+	if !q.draining {
+		q.draining = true
+		q.inFlight.Add(1)
+		go q.drain()
+	}
+}
+
+func (q *notifQueue) drain() {
+	defer q.inFlight.Done()
+	for {
+		q.mu.Lock()
+		if len(q.sends) == 0 {
+			q.draining = false
+			q.mu.Unlock()
+			return
+		}
+		send := q.sends[0]
+		q.sends = q.sends[1:]
+		q.mu.Unlock()
+		send()
+	}
+}
@@ -0,0 +1,103 @@
+package notifs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// Dedicated channel names become part of an environment variable name
+var dedicatedChannelRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// outcomeRoutes also sends the final notification for a job to a channel that depends on whether the job succeeded or
+// failed, e.g. so that routine successes go to a quiet channel and failures go to a louder one.
+type outcomeRoutes struct {
+	success webhook.Client
+	failure webhook.Client
+}
+
+type outcomeRoutesConfig struct {
+	Success string `json:"success"`
+	Failure string `json:"failure"`
+}
+
+// newOutcomeRoutes parses the outcome channels for an environment from a map of environment names to webhook URLs, e.g.
+// `{"prod": {"success": "https://discord.com/api/webhooks/...", "failure": "https://discord.com/api/webhooks/..."}}`.
+// Returns nil if no outcome channels are configured for the environment.
+func newOutcomeRoutes(routesEnv string, env manager.EnvType) (*outcomeRoutes, error) {
+	routesJson, found := os.LookupEnv(routesEnv)
+	if !found {
+		return nil, nil
+	}
+	routesMap := make(map[string]outcomeRoutesConfig)
+	if err := json.Unmarshal([]byte(routesJson), &routesMap); err != nil {
+		return nil, fmt.Errorf("newOutcomeRoutes: invalid routes: %v", err)
+	} else if config, found := routesMap[string(env)]; !found {
+		return nil, nil
+	} else if s, err := newDiscordWebhook(config.Success); err != nil {
+		return nil, fmt.Errorf("newOutcomeRoutes: invalid success webhook: %s, %v", env, err)
+	} else if f, err := newDiscordWebhook(config.Failure); err != nil {
+		return nil, fmt.Errorf("newOutcomeRoutes: invalid failure webhook: %s, %v", env, err)
+	} else if (s == nil) && (f == nil) {
+		return nil, nil
+	} else {
+		return &outcomeRoutes{s, f}, nil
+	}
+}
+
+// route returns the channels to send a job notification to. Notifications for completed jobs also go to the success
+// channel, and those for failed jobs also go to the failure channel, in addition to the job's usual channels.
+func (o *outcomeRoutes) route(jobState job.JobState, channels []webhook.Client) []webhook.Client {
+	if o == nil {
+		return channels
+	}
+	var outcomeChannel webhook.Client
+	switch jobState.Stage {
+	case job.JobStage_Completed:
+		outcomeChannel = o.success
+	case job.JobStage_Failed:
+		outcomeChannel = o.failure
+	}
+	if outcomeChannel == nil {
+		return channels
+	}
+	// Don't send the notification twice if the outcome channel is also one of the job's usual channels
+	for _, channel := range channels {
+		if (channel != nil) && (channel.ID() == outcomeChannel.ID()) {
+			return channels
+		}
+	}
+	return append(channels, outcomeChannel)
+}
+
+// withDedicatedChannel adds the dedicated channel requested by a job, if any, to the channels its notifications are sent
+// to, e.g. so that a team can follow deployments of its own components in its own channel. A job with the
+// "discordChannel" parameter set to "cas" is also sent to the `DISCORD_CAS_WEBHOOK` channel.
+func withDedicatedChannel(jobState job.JobState, channels []webhook.Client) ([]webhook.Client, error) {
+	channel, _ := jobState.Params[job.JobParam_DiscordChannel].(string)
+	if len(channel) == 0 {
+		return channels, nil
+	} else if !dedicatedChannelRegex.MatchString(channel) {
+		return channels, fmt.Errorf("withDedicatedChannel: invalid channel: %s", channel)
+	}
+	dedicatedWebhook, err := parseDiscordWebhookUrl("DISCORD_" + strings.ToUpper(channel) + "_WEBHOOK")
+	if err != nil {
+		return channels, fmt.Errorf("withDedicatedChannel: invalid webhook: %s, %v", channel, err)
+	} else if dedicatedWebhook == nil {
+		return channels, fmt.Errorf("withDedicatedChannel: channel not configured: %s", channel)
+	}
+	// Don't send the same notification to a channel twice
+	for _, c := range channels {
+		if (c != nil) && (c.ID() == dedicatedWebhook.ID()) {
+			return channels, nil
+		}
+	}
+	return append(channels, dedicatedWebhook), nil
+}
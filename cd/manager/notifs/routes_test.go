@@ -0,0 +1,92 @@
+package notifs
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const (
+	testSuccessWebhookUrl  = "https://discord.com/api/webhooks/1000000000000000002/success"
+	testIncidentWebhookUrl = "https://discord.com/api/webhooks/1000000000000000003/incidents"
+)
+
+func testOutcomeRoutes(t *testing.T) *outcomeRoutes {
+	t.Helper()
+	t.Setenv("DISCORD_OUTCOME_ROUTES_JSON", `{"prod": {"success": "`+testSuccessWebhookUrl+`", "failure": "`+testIncidentWebhookUrl+`"}}`)
+	routes, err := newOutcomeRoutes("DISCORD_OUTCOME_ROUTES_JSON", manager.EnvType_Prod)
+	if err != nil {
+		t.Fatal(err)
+	} else if routes == nil {
+		t.Fatal("expected outcome routes to be configured")
+	}
+	return routes
+}
+
+func hasChannel(channels []webhook.Client, channel webhook.Client) bool {
+	for _, c := range channels {
+		if (c != nil) && (c.ID() == channel.ID()) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOutcomeRoutesFailedJob(t *testing.T) {
+	routes := testOutcomeRoutes(t)
+	deployments := testWebhook(t, testDeploymentsWebhookUrl)
+	channels := routes.route(job.JobState{Stage: job.JobStage_Failed}, []webhook.Client{deployments})
+	if !hasChannel(channels, routes.failure) {
+		t.Fatal("failed job not routed to the incident channel")
+	} else if hasChannel(channels, routes.success) {
+		t.Fatal("failed job routed to the success channel")
+	} else if !hasChannel(channels, deployments) {
+		t.Fatal("failed job no longer routed to its usual channel")
+	}
+}
+
+func TestOutcomeRoutesCompletedJob(t *testing.T) {
+	routes := testOutcomeRoutes(t)
+	deployments := testWebhook(t, testDeploymentsWebhookUrl)
+	channels := routes.route(job.JobState{Stage: job.JobStage_Completed}, []webhook.Client{deployments})
+	if hasChannel(channels, routes.failure) {
+		t.Fatal("completed job routed to the incident channel")
+	} else if !hasChannel(channels, routes.success) {
+		t.Fatal("completed job not routed to the success channel")
+	} else if !hasChannel(channels, deployments) {
+		t.Fatal("completed job no longer routed to its usual channel")
+	}
+}
+
+func TestOutcomeRoutesOtherStages(t *testing.T) {
+	routes := testOutcomeRoutes(t)
+	deployments := testWebhook(t, testDeploymentsWebhookUrl)
+	for _, stage := range []job.JobStage{job.JobStage_Started, job.JobStage_Skipped, job.JobStage_Canceled} {
+		if channels := routes.route(job.JobState{Stage: stage}, []webhook.Client{deployments}); len(channels) != 1 {
+			t.Fatalf("%s job routed to %d channels", stage, len(channels))
+		}
+	}
+}
+
+func TestOutcomeRoutesNoDuplicates(t *testing.T) {
+	routes := testOutcomeRoutes(t)
+	incidents := testWebhook(t, testIncidentWebhookUrl)
+	if channels := routes.route(job.JobState{Stage: job.JobStage_Failed}, []webhook.Client{incidents}); len(channels) != 1 {
+		t.Fatalf("expected the incident channel once, got %d channels", len(channels))
+	}
+}
+
+func TestOutcomeRoutesNotConfigured(t *testing.T) {
+	t.Setenv("DISCORD_OUTCOME_ROUTES_JSON", `{"dev": {"failure": "`+testIncidentWebhookUrl+`"}}`)
+	routes, err := newOutcomeRoutes("DISCORD_OUTCOME_ROUTES_JSON", manager.EnvType_Prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments := testWebhook(t, testDeploymentsWebhookUrl)
+	if channels := routes.route(job.JobState{Stage: job.JobStage_Failed}, []webhook.Client{deployments}); len(channels) != 1 {
+		t.Fatalf("expected only the usual channel, got %d channels", len(channels))
+	}
+}
@@ -0,0 +1,72 @@
+package notifs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &secretsRotationNotif{}
+
+const secretsRotationNotifField_Service = "Service"
+
+type secretsRotationNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+	env                manager.EnvType
+}
+
+func newSecretsRotationNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &secretsRotationNotif{jobState, d, a, manager.EnvType(os.Getenv(manager.EnvVar_Env))}, nil
+	}
+}
+
+func (s secretsRotationNotif) getChannels() []webhook.Client {
+	webhooks := []webhook.Client{s.deploymentsWebhook}
+	// Also send rotation failures to the alerts channel
+	if s.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, s.alertWebhook)
+	}
+	return webhooks
+}
+
+func (s secretsRotationNotif) getTitle() string {
+	prettyStage := string(s.state.Stage)
+	if s.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("3Box Labs `%s` Secrets Rotation %s", envName(s.env), strings.ToUpper(prettyStage))
+}
+
+func (s secretsRotationNotif) getFields() []discord.EmbedField {
+	// Only identify where the secret is used, never anything about the secret itself
+	cluster, _ := s.state.Params[job.SecretsRotationJobParam_Cluster].(string)
+	service, _ := s.state.Params[job.SecretsRotationJobParam_Service].(string)
+	secretName, _ := s.state.Params[job.SecretsRotationJobParam_SecretName].(string)
+	return []discord.EmbedField{
+		{
+			Name:  secretsRotationNotifField_Service,
+			Value: fmt.Sprintf("%s/%s (%s)", cluster, service, secretName),
+		},
+	}
+}
+
+func (s secretsRotationNotif) getColor() discordColor {
+	return colorForStage(s.state.Stage)
+}
+
+func (s secretsRotationNotif) getUrl() string {
+	return ""
+}
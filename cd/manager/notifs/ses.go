@@ -0,0 +1,207 @@
+package notifs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+	"github.com/disgoorg/disgo/discord"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const sesCharset = "UTF-8"
+
+// The email body mirrors the layout of Discord embeds, i.e. a colored title followed by a table of fields.
+var sesEmailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<div style="border-left: 4px solid {{.Color}}; padding-left: 12px;">
+<h2>{{if .Url}}<a href="{{.Url}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h2>
+<table style="border-collapse: collapse;">
+{{range .Fields}}<tr>
+<th style="text-align: left; vertical-align: top; padding: 4px 12px 4px 0;">{{.Name}}</th>
+<td style="white-space: pre-wrap; padding: 4px 0;">{{.Value}}</td>
+</tr>
+{{end}}</table>
+<p style="color: #888888;">{{.Ts}}</p>
+</div>
+</body>
+</html>
+`))
+
+var _ manager.Notifs = &SesNotifs{}
+
+// SesNotifs emails notifications via AWS SES for stakeholders who don't follow Discord. Only terminal job stages are
+// emailed, since emails, unlike Discord messages, can't be updated in place as jobs progress.
+type SesNotifs struct {
+	client   *ses.Client
+	from     string
+	to       []string
+	env      manager.EnvType
+	embeds   JobNotifs
+	inFlight *sync.WaitGroup
+}
+
+type sesEmail struct {
+	Title  string
+	Url    string
+	Color  string
+	Fields []discord.EmbedField
+	Ts     string
+}
+
+// NewSesNotifs returns nil if no email addresses have been configured
+func NewSesNotifs(cfg aws.Config, db manager.Database, cache manager.Cache) (manager.Notifs, error) {
+	from := os.Getenv("SES_FROM_ADDRESS")
+	toAddresses := os.Getenv("SES_TO_ADDRESSES")
+	if (len(from) == 0) && (len(toAddresses) == 0) {
+		return nil, nil
+	}
+	to := make([]string, 0)
+	for _, address := range strings.Split(toAddresses, ",") {
+		if address = strings.TrimSpace(address); len(address) > 0 {
+			to = append(to, address)
+		}
+	}
+	if len(from) == 0 {
+		return nil, fmt.Errorf("newSesNotifs: missing from address")
+	} else if len(to) == 0 {
+		return nil, fmt.Errorf("newSesNotifs: missing to addresses")
+	}
+	// SES might not be available in the region the manager runs in
+	sesCfg := cfg.Copy()
+	if region := os.Getenv("SES_REGION"); len(region) > 0 {
+		sesCfg.Region = region
+	}
+	return &SesNotifs{
+		ses.NewFromConfig(sesCfg),
+		from,
+		to,
+		manager.EnvType(os.Getenv(manager.EnvVar_Env)),
+		// Reuse the Discord embed content so that emails contain the same information
+		JobNotifs{
+			db:            db,
+			cache:         cache,
+			duration:      manager.ConfiguredDurationFormatter(),
+			sha:           manager.ConfiguredShaFormatter(),
+			maxActiveJobs: maxActiveJobs("DISCORD_MAX_ACTIVE_JOBS"),
+		},
+		new(sync.WaitGroup),
+	}, nil
+}
+
+// NotifyJob emails notifications in the background, like events are published, so that SES doesn't hold up the caller
+func (s SesNotifs) NotifyJob(jobs ...job.JobState) {
+	for _, jobState := range jobs {
+		if manager.IsSilentJob(jobState) {
+			continue
+		}
+		switch jobState.Stage {
+		case job.JobStage_Completed, job.JobStage_Failed, job.JobStage_Canceled:
+		default:
+			continue
+		}
+		if jn, err := s.embeds.getJobNotif(jobState); err != nil {
+			log.Printf("notifyJob: error creating job notification: %v, %s", err, manager.PrintJob(jobState))
+		} else {
+			jobState := jobState
+			s.sendAsync(sesEmail{
+				jn.getTitle(),
+				jn.getUrl(),
+				htmlColor(jn.getColor()),
+				append(s.embeds.getNotifFields(jobState), jn.getFields()...),
+				jobState.Ts.Format(time.RFC1123),
+			}, func(err error) {
+				log.Printf("notifyJob: error sending email notification: %v, %s", err, manager.PrintJob(jobState))
+			})
+		}
+	}
+}
+
+// NotifyJobDeferred is a no-op since emails are only sent for finished jobs, which aren't sent deferred notifications
+func (s SesNotifs) NotifyJobDeferred(time.Duration, ...job.JobState) {}
+
+func (s SesNotifs) NotifySystem(event manager.SystemEvent) {
+	// Stakeholders following by email don't need to know when the manager restarts
+	if event.Kind == manager.SystemEventKind_Lifecycle {
+		return
+	}
+	s.sendAsync(sesEmail{
+		fmt.Sprintf("%s %s", strings.ToUpper(event.Severity), event.Kind),
+		"",
+		htmlColor(colorForSeverity(event.Severity)),
+		[]discord.EmbedField{{Name: notifField_Message, Value: event.Message}},
+		time.Now().Format(time.RFC1123),
+	}, func(err error) {
+		log.Printf("notifySystem: error sending email notification: %v, %+v", err, event)
+	})
+}
+
+// NotifyTest is a no-op since test notifications are only meant for chat channels
+func (s SesNotifs) NotifyTest(string) error {
+	return nil
+}
+
+func (s SesNotifs) FlushPending(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flushPending: %v", ctx.Err())
+	}
+}
+
+// sendAsync sends an email in the background, calling onErr if it couldn't be sent
+func (s SesNotifs) sendAsync(email sesEmail, onErr func(error)) {
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		if err := s.send(email); err != nil {
+			onErr(err)
+		}
+	}()
+}
+
+func (s SesNotifs) send(email sesEmail) error {
+	var body bytes.Buffer
+	if err := sesEmailTemplate.Execute(&body, email); err != nil {
+		return fmt.Errorf("send: error rendering email: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	_, err := s.client.SendEmail(ctx, &ses.SendEmailInput{
+		Destination: &types.Destination{ToAddresses: s.to},
+		Message: &types.Message{
+			Body: &types.Body{
+				Html: &types.Content{Data: aws.String(body.String()), Charset: aws.String(sesCharset)},
+			},
+			Subject: &types.Content{
+				Data:    aws.String(fmt.Sprintf("[%s] %s", strings.ToUpper(string(s.env)), email.Title)),
+				Charset: aws.String(sesCharset),
+			},
+		},
+		Source: aws.String(s.from),
+	})
+	return err
+}
+
+func htmlColor(color discordColor) string {
+	return fmt.Sprintf("#%06x", int(color))
+}
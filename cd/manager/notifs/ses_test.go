@@ -0,0 +1,66 @@
+package notifs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/3box/pipeline-tools/cd/manager/common"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+func TestSesNotifsListActiveJobs(t *testing.T) {
+	t.Setenv("SES_FROM_ADDRESS", "cd@example.com")
+	t.Setenv("SES_TO_ADDRESSES", "team@example.com")
+	t.Setenv("DISCORD_MAX_ACTIVE_JOBS", "2")
+	cache := common.NewJobCache()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		cache.WriteJob(job.JobState{
+			JobId: fmt.Sprintf("task-%d", i),
+			Type:  job.JobType_Task,
+			Stage: job.JobStage_Started,
+			Ts:    now.Add(time.Duration(i) * time.Second),
+		})
+	}
+	n, err := NewSesNotifs(aws.Config{}, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := n.(*SesNotifs)
+	fields := s.embeds.getActiveJobs(job.JobState{JobId: "deploy", Type: job.JobType_Deploy})
+	if len(fields) != 1 {
+		t.Fatalf("expected 1 active jobs field, got %d", len(fields))
+	}
+	field := fields[0]
+	if field.Name != notifField_Task+" In Progress:" {
+		t.Fatalf("unexpected active jobs field: %s", field.Name)
+	}
+	if listed := strings.Count(field.Value, "task-"); listed != 2 {
+		t.Fatalf("expected 2 active jobs to be listed, got %d: %s", listed, field.Value)
+	}
+	if !strings.Contains(field.Value, "+1 more") {
+		t.Fatalf("expected remaining active jobs to be counted: %s", field.Value)
+	}
+}
+
+func TestNewSesNotifsNotConfigured(t *testing.T) {
+	t.Setenv("SES_FROM_ADDRESS", "")
+	t.Setenv("SES_TO_ADDRESSES", "")
+	if n, err := NewSesNotifs(aws.Config{}, nil, nil); err != nil {
+		t.Fatal(err)
+	} else if n != nil {
+		t.Fatal("expected no notifier without addresses")
+	}
+}
+
+func TestNewSesNotifsMissingTo(t *testing.T) {
+	t.Setenv("SES_FROM_ADDRESS", "cd@example.com")
+	t.Setenv("SES_TO_ADDRESSES", " , ")
+	if _, err := NewSesNotifs(aws.Config{}, nil, nil); err == nil {
+		t.Fatal("expected an error without to addresses")
+	}
+}
@@ -0,0 +1,194 @@
+package notifs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/syslog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+type sinkProtocol string
+
+const (
+	sinkProtocol_SyslogUdp  sinkProtocol = "syslog-udp"
+	sinkProtocol_SyslogTcp  sinkProtocol = "syslog-tcp"
+	sinkProtocol_FluentdUdp sinkProtocol = "fluentd-udp"
+	sinkProtocol_FluentdTcp sinkProtocol = "fluentd-tcp"
+)
+
+var _ manager.Notifs = &SinkNotifs{}
+
+// SinkNotifs writes a structured event for every job update to a log pipeline so that all CD events are durably
+// recorded and searchable.
+//
+// Syslog events are sent as RFC 3164 messages with a JSON payload. Fluentd events are sent as newline-delimited JSON,
+// which is what the Fluentd "tcp" and "udp" inputs expect when configured with the "json" parser.
+type SinkNotifs struct {
+	protocol sinkProtocol
+	addr     string
+	env      manager.EnvType
+	mu       *sync.Mutex
+	w        io.WriteCloser
+	inFlight *sync.WaitGroup
+	queue    *notifQueue
+}
+
+// sinkEvent is the event written to the sink for each job update
+type sinkEvent struct {
+	Service string       `json:"service"`
+	Env     string       `json:"env"`
+	Ts      time.Time    `json:"ts"`
+	Job     job.JobState `json:"job"`
+}
+
+// sinkSystemEvent is the event written to the sink for each system event
+type sinkSystemEvent struct {
+	Service string              `json:"service"`
+	Env     string              `json:"env"`
+	Ts      time.Time           `json:"ts"`
+	System  manager.SystemEvent `json:"system"`
+}
+
+// NewSinkNotifs returns nil if no sink has been configured
+func NewSinkNotifs() (manager.Notifs, error) {
+	addr := os.Getenv("NOTIF_SINK_ADDR")
+	if len(addr) == 0 {
+		return nil, nil
+	}
+	protocol := sinkProtocol(os.Getenv("NOTIF_SINK_PROTOCOL"))
+	switch protocol {
+	case sinkProtocol_SyslogUdp, sinkProtocol_SyslogTcp, sinkProtocol_FluentdUdp, sinkProtocol_FluentdTcp:
+	case "":
+		protocol = sinkProtocol_SyslogUdp
+	default:
+		return nil, fmt.Errorf("newSinkNotifs: unknown protocol: %s", protocol)
+	}
+	inFlight := new(sync.WaitGroup)
+	return &SinkNotifs{
+		protocol,
+		addr,
+		manager.EnvType(os.Getenv(manager.EnvVar_Env)),
+		new(sync.Mutex),
+		nil,
+		inFlight,
+		newNotifQueue(inFlight),
+	}, nil
+}
+
+// NotifyJob records job updates in the background so that a slow or unreachable sink doesn't hold up the caller.
+// Events are written in the order they were recorded.
+func (s *SinkNotifs) NotifyJob(jobs ...job.JobState) {
+	for _, jobState := range jobs {
+		// Marshal the event right away so that it captures the job as it was when it was notified
+		if eventBytes, err := json.Marshal(sinkEvent{manager.ServiceName, string(s.env), time.Now(), jobState}); err != nil {
+			log.Printf("notifyJob: error marshaling sink event: %v, %s", err, manager.PrintJob(jobState))
+		} else {
+			jobState := jobState
+			s.queue.push(func() {
+				if err := s.write(eventBytes, jobState.Stage == job.JobStage_Failed); err != nil {
+					log.Printf("notifyJob: error writing sink event: %v, %s", err, manager.PrintJob(jobState))
+				}
+			})
+		}
+	}
+}
+
+// NotifyJobDeferred is a no-op since the sink records job updates as they happen, and deferred notifications are only
+// reminders about updates that were already recorded.
+func (s *SinkNotifs) NotifyJobDeferred(time.Duration, ...job.JobState) {}
+
+func (s *SinkNotifs) NotifySystem(event manager.SystemEvent) {
+	if eventBytes, err := json.Marshal(sinkSystemEvent{manager.ServiceName, string(s.env), time.Now(), event}); err != nil {
+		log.Printf("notifySystem: error marshaling sink event: %v, %+v", err, event)
+	} else {
+		s.queue.push(func() {
+			if err := s.write(eventBytes, event.Severity == manager.SystemEventSeverity_Critical); err != nil {
+				log.Printf("notifySystem: error writing sink event: %v, %+v", err, event)
+			}
+		})
+	}
+}
+
+// NotifyTest is a no-op since test notifications are only meant for chat channels
+func (s *SinkNotifs) NotifyTest(string) error {
+	return nil
+}
+
+func (s *SinkNotifs) FlushPending(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.w != nil {
+			s.w.Close()
+			s.w = nil
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flushPending: %v", ctx.Err())
+	}
+}
+
+func (s *SinkNotifs) write(eventBytes []byte, failed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Reconnect once if the write fails in case the connection was dropped since the last event
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.w == nil {
+			if s.w, err = s.dial(); err != nil {
+				return err
+			}
+		}
+		if err = s.writeEvent(eventBytes, failed); err == nil {
+			return nil
+		}
+		s.w.Close()
+		s.w = nil
+	}
+	return err
+}
+
+func (s *SinkNotifs) dial() (io.WriteCloser, error) {
+	switch s.protocol {
+	case sinkProtocol_SyslogUdp:
+		return syslog.Dial("udp", s.addr, syslog.LOG_INFO|syslog.LOG_DAEMON, manager.ServiceName)
+	case sinkProtocol_SyslogTcp:
+		return syslog.Dial("tcp", s.addr, syslog.LOG_INFO|syslog.LOG_DAEMON, manager.ServiceName)
+	case sinkProtocol_FluentdUdp:
+		return net.DialTimeout("udp", s.addr, manager.DefaultHttpWaitTime)
+	default:
+		return net.DialTimeout("tcp", s.addr, manager.DefaultHttpWaitTime)
+	}
+}
+
+func (s *SinkNotifs) writeEvent(eventBytes []byte, failed bool) error {
+	if sw, ok := s.w.(*syslog.Writer); ok {
+		// Use a higher severity for failures so that they can be alerted on by the log pipeline
+		if failed {
+			return sw.Err(string(eventBytes))
+		}
+		return sw.Info(string(eventBytes))
+	}
+	if conn, ok := s.w.(net.Conn); ok {
+		if err := conn.SetWriteDeadline(time.Now().Add(manager.DefaultHttpWaitTime)); err != nil {
+			return err
+		}
+	}
+	_, err := s.w.Write(append(eventBytes, '\n'))
+	return err
+}
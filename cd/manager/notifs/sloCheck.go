@@ -0,0 +1,86 @@
+package notifs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &sloCheckNotif{}
+
+const (
+	sloCheckNotifField_Slo      = "SLO"
+	sloCheckNotifField_BurnRate = "Burn Rate"
+	sloCheckNotifField_Deploy   = "Deployment"
+)
+
+type sloCheckNotif struct {
+	state              job.JobState
+	deploymentsWebhook webhook.Client
+	alertWebhook       webhook.Client
+}
+
+func newSloCheckNotif(jobState job.JobState) (jobNotif, error) {
+	if d, err := parseDiscordWebhookUrl("DISCORD_DEPLOYMENTS_WEBHOOK"); err != nil {
+		return nil, err
+	} else if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &sloCheckNotif{jobState, d, a}, nil
+	}
+}
+
+func (s sloCheckNotif) getChannels() []webhook.Client {
+	// SLOs are checked before deployments, so report checks alongside deployments.
+	webhooks := []webhook.Client{s.deploymentsWebhook}
+	// Also send check failures to the alerts channel
+	if s.state.Stage == job.JobStage_Failed {
+		webhooks = append(webhooks, s.alertWebhook)
+	}
+	return webhooks
+}
+
+func (s sloCheckNotif) getTitle() string {
+	prettyStage := string(s.state.Stage)
+	if s.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("SLO Check %s", strings.ToUpper(prettyStage))
+}
+
+func (s sloCheckNotif) getFields() []discord.EmbedField {
+	fields := make([]discord.EmbedField, 0)
+	if name, found := s.state.Params[job.SloCheckJobParam_Name].(string); found {
+		fields = append(fields, discord.EmbedField{
+			Name:  sloCheckNotifField_Slo,
+			Value: name,
+		})
+	}
+	if burnRate, found := s.state.Params[job.SloCheckJobParam_BurnRate].(float64); found {
+		maxBurnRate, _ := s.state.Params[job.SloCheckJobParam_MaxBurnRate].(float64)
+		fields = append(fields, discord.EmbedField{
+			Name:  sloCheckNotifField_BurnRate,
+			Value: fmt.Sprintf("%.2f (max %.2f)", burnRate, maxBurnRate),
+		})
+	}
+	// Show which deployment is waiting on the check
+	if deployParams, found := s.state.Params[job.SloCheckJobParam_Deploy].(map[string]interface{}); found {
+		fields = append(fields, discord.EmbedField{
+			Name:  sloCheckNotifField_Deploy,
+			Value: fmt.Sprintf("%v @ %v", deployParams[job.DeployJobParam_Component], deployParams[job.DeployJobParam_Sha]),
+		})
+	}
+	return fields
+}
+
+func (s sloCheckNotif) getColor() discordColor {
+	return colorForStage(s.state.Stage)
+}
+
+func (s sloCheckNotif) getUrl() string {
+	return ""
+}
@@ -14,6 +14,13 @@ import (
 
 var _ jobNotif = &smokeTestNotif{}
 
+const (
+	smokeTestNotifField_Retries = "Retries"
+	smokeTestNotifField_Tests   = "Tests"
+)
+
+const smokeTestFullSuite = "full suite"
+
 type smokeTestNotif struct {
 	state  job.JobState
 	region string
@@ -33,10 +40,43 @@ func (s smokeTestNotif) getTitle() string {
 }
 
 func (s smokeTestNotif) getFields() []discord.EmbedField {
-	return nil
+	// Show which tests ran
+	tests := smokeTestFullSuite
+	if selector, found := s.state.Params[job.SmokeTestJobParam_TestSelector].(string); found && (len(selector) > 0) {
+		tests = selector
+	} else if component, found := s.state.Params[job.SmokeTestJobParam_Component].(string); found && (len(component) > 0) {
+		// The selector for the component is only recorded once the tests are launched
+		tests = component
+	}
+	fields := []discord.EmbedField{
+		{
+			Name:  smokeTestNotifField_Tests,
+			Value: tests,
+		},
+	}
+	// Show how many times flaky tests have been retried
+	if attempt, found := s.state.Params[job.SmokeTestJobParam_Attempt].(float64); found {
+		retries, _ := s.state.Params[job.SmokeTestJobParam_Retries].(float64)
+		value := fmt.Sprintf("%d", int(attempt))
+		if retries > 0 {
+			value += fmt.Sprintf("/%d", int(retries))
+		}
+		if exitCode, found := s.state.Params[job.SmokeTestJobParam_ExitCode].(float64); found {
+			value += fmt.Sprintf(" (last exit code %d)", int(exitCode))
+		}
+		fields = append(fields, discord.EmbedField{
+			Name:  smokeTestNotifField_Retries,
+			Value: value,
+		})
+	}
+	return fields
 }
 
 func (s smokeTestNotif) getColor() discordColor {
+	// Warn when tests are being retried after a failure
+	if (s.state.Stage == job.JobStage_Started) && (s.state.Params[job.SmokeTestJobParam_Attempt] != nil) {
+		return discordColor_Warning
+	}
 	return colorForStage(s.state.Stage)
 }
 
@@ -0,0 +1,140 @@
+package notifs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/disgoorg/disgo/discord"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const notifField_FullDetails = "Full Details"
+
+// Presigned links can't be valid for longer than a week
+const summaryLinkExpiry = 7 * 24 * time.Hour
+
+const summaryContentType = "text/markdown; charset=utf-8"
+
+// notifSummaries writes the full content of notifications that are too large to post inline to S3, so that a compact
+// notification with a link to the full details can be posted instead of truncating the notification.
+type notifSummaries struct {
+	client    *s3.Client
+	bucket    string
+	baseUrl   string
+	env       manager.EnvType
+	maxSize   int
+	maxFields int
+}
+
+// newNotifSummaries returns nil if no bucket has been configured. Links are built from the base URL, if one is
+// configured (e.g. for a CloudFront distribution in front of the bucket), and are presigned otherwise. Presigned links
+// expire after a week, or sooner if the manager is using temporary credentials.
+func newNotifSummaries(cfg aws.Config) (*notifSummaries, error) {
+	bucket := os.Getenv("NOTIF_SUMMARY_BUCKET")
+	if len(bucket) == 0 {
+		return nil, nil
+	}
+	// Notifications are offloaded instead of being truncated by default
+	maxSize := discordLimit_Total
+	if maxSizeStr, found := os.LookupEnv("NOTIF_SUMMARY_MAX_SIZE"); found {
+		var err error
+		if maxSize, err = strconv.Atoi(maxSizeStr); (err != nil) || (maxSize <= 0) {
+			return nil, fmt.Errorf("newNotifSummaries: invalid max size: %s", maxSizeStr)
+		}
+	}
+	maxFields := discordLimit_Fields
+	if maxFieldsStr, found := os.LookupEnv("NOTIF_SUMMARY_MAX_FIELDS"); found {
+		var err error
+		if maxFields, err = strconv.Atoi(maxFieldsStr); (err != nil) || (maxFields <= 1) {
+			return nil, fmt.Errorf("newNotifSummaries: invalid max fields: %s", maxFieldsStr)
+		}
+	}
+	return &notifSummaries{
+		s3.NewFromConfig(cfg),
+		bucket,
+		strings.TrimSuffix(os.Getenv("NOTIF_SUMMARY_BASE_URL"), "/"),
+		manager.EnvType(os.Getenv(manager.EnvVar_Env)),
+		maxSize,
+		maxFields,
+	}, nil
+}
+
+// summarize returns the fields to post for a notification. Notifications over the size or field count thresholds are
+// written in full to S3, and as many fields as fit within the thresholds are posted along with a link to the full
+// details. The original fields are returned if the notification is within the thresholds, or couldn't be written.
+func (s notifSummaries) summarize(title string, fields []discord.EmbedField, jobState job.JobState) []discord.EmbedField {
+	size := utf8.RuneCountInString(title)
+	for _, field := range fields {
+		size += embedFieldLength(field)
+	}
+	if (size <= s.maxSize) && (len(fields) <= s.maxFields) {
+		return fields
+	}
+	link, err := s.write(title, fields, jobState)
+	if err != nil {
+		log.Printf("notifyJob: error writing notification summary: %v, %s", err, manager.PrintJob(jobState))
+		return fields
+	} else if utf8.RuneCountInString(link) > discordLimit_FieldValue {
+		// Presigned links with temporary credentials can be too long to post, and a truncated link is of no use
+		log.Printf("notifyJob: notification summary link too long: %d, %s", len(link), manager.PrintJob(jobState))
+		return fields
+	}
+	linkField := discord.EmbedField{Name: notifField_FullDetails, Value: link}
+	budget := s.maxSize - utf8.RuneCountInString(title) - embedFieldLength(linkField)
+	compactFields := make([]discord.EmbedField, 0, s.maxFields)
+	for _, field := range fields {
+		if len(compactFields) == s.maxFields-1 {
+			break
+		}
+		// Skip fields that don't fit, but keep going in case later, smaller fields do
+		if fieldLength := embedFieldLength(field); fieldLength <= budget {
+			compactFields = append(compactFields, field)
+			budget -= fieldLength
+		}
+	}
+	return append(compactFields, linkField)
+}
+
+func (s notifSummaries) write(title string, fields []discord.EmbedField, jobState job.JobState) (string, error) {
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("# %s\n\n", title))
+	for _, field := range fields {
+		content.WriteString(fmt.Sprintf("## %s\n\n%s\n\n", field.Name, field.Value))
+	}
+	content.WriteString(jobState.Ts.Format(time.RFC1123) + "\n")
+	// There is one notification per job update, so the job ID and timestamp identify the content
+	key := fmt.Sprintf("%s/%s/%d.md", s.env, jobState.JobId, jobState.Ts.UnixNano())
+
+	ctx, cancel := context.WithTimeout(context.Background(), manager.DefaultHttpWaitTime)
+	defer cancel()
+
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(content.String()),
+		ContentType: aws.String(summaryContentType),
+	}); err != nil {
+		return "", err
+	}
+	if len(s.baseUrl) > 0 {
+		return s.baseUrl + "/" + key, nil
+	}
+	if request, err := s3.NewPresignClient(s.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(summaryLinkExpiry)); err != nil {
+		return "", err
+	} else {
+		return request.URL, nil
+	}
+}
@@ -0,0 +1,60 @@
+package notifs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &taskNotif{}
+
+type taskNotif struct {
+	state        job.JobState
+	alertWebhook webhook.Client
+	infoWebhook  webhook.Client
+}
+
+func newTaskNotif(jobState job.JobState) (jobNotif, error) {
+	if a, err := parseDiscordWebhookUrl("DISCORD_ALERT_WEBHOOK"); err != nil {
+		return nil, err
+	} else if i, err := parseDiscordWebhookUrl("DISCORD_INFO_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &taskNotif{jobState, a, i}, nil
+	}
+}
+
+func (t taskNotif) getChannels() []webhook.Client {
+	webhooks := make([]webhook.Client, 0, 1)
+	switch t.state.Stage {
+	case job.JobStage_Started:
+		webhooks = append(webhooks, t.infoWebhook)
+	case job.JobStage_Completed:
+		webhooks = append(webhooks, t.infoWebhook)
+	case job.JobStage_Failed:
+		webhooks = append(webhooks, t.alertWebhook)
+	}
+	return webhooks
+}
+
+func (t taskNotif) getTitle() string {
+	// Use the name supplied by the caller, which is guaranteed to be present for queued tasks.
+	name, _ := t.state.Params[job.TaskJobParam_Name].(string)
+	return fmt.Sprintf("%s %s", name, strings.ToUpper(string(t.state.Stage)))
+}
+
+func (t taskNotif) getFields() []discord.EmbedField {
+	return nil
+}
+
+func (t taskNotif) getColor() discordColor {
+	return colorForStage(t.state.Stage)
+}
+
+func (t taskNotif) getUrl() string {
+	return ""
+}
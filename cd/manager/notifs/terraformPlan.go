@@ -0,0 +1,69 @@
+package notifs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var _ jobNotif = &terraformPlanNotif{}
+
+const terraformPlanNotifField_Changes = "Resource Changes"
+
+type terraformPlanNotif struct {
+	state        job.JobState
+	infraWebhook webhook.Client
+	env          manager.EnvType
+}
+
+func newTerraformPlanNotif(jobState job.JobState) (jobNotif, error) {
+	if i, err := parseDiscordWebhookUrl("DISCORD_INFRA_WEBHOOK"); err != nil {
+		return nil, err
+	} else {
+		return &terraformPlanNotif{jobState, i, manager.EnvType(os.Getenv(manager.EnvVar_Env))}, nil
+	}
+}
+
+func (t terraformPlanNotif) getChannels() []webhook.Client {
+	return []webhook.Client{t.infraWebhook}
+}
+
+func (t terraformPlanNotif) getTitle() string {
+	prettyStage := string(t.state.Stage)
+	if t.state.Stage == job.JobStage_Dequeued {
+		prettyStage = prettyStageDequeued
+	}
+	return fmt.Sprintf("3Box Labs `%s` Terraform Plan %s", envName(t.env), strings.ToUpper(prettyStage))
+}
+
+func (t terraformPlanNotif) getFields() []discord.EmbedField {
+	add, addFound := t.state.Params[job.TerraformPlanJobParam_Add].(float64)
+	change, changeFound := t.state.Params[job.TerraformPlanJobParam_Change].(float64)
+	destroy, destroyFound := t.state.Params[job.TerraformPlanJobParam_Destroy].(float64)
+	if !addFound || !changeFound || !destroyFound {
+		return nil
+	}
+	changes := "No changes"
+	if (add + change + destroy) > 0 {
+		changes = fmt.Sprintf("%d to add, %d to change, %d to destroy", int(add), int(change), int(destroy))
+	}
+	return []discord.EmbedField{{Name: terraformPlanNotifField_Changes, Value: changes}}
+}
+
+func (t terraformPlanNotif) getColor() discordColor {
+	// Highlight plans that would destroy resources
+	if destroy, _ := t.state.Params[job.TerraformPlanJobParam_Destroy].(float64); (t.state.Stage == job.JobStage_Completed) && (destroy > 0) {
+		return discordColor_Warning
+	}
+	return colorForStage(t.state.Stage)
+}
+
+func (t terraformPlanNotif) getUrl() string {
+	return ""
+}
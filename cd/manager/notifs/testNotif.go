@@ -0,0 +1,78 @@
+package notifs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+// Webhooks for all the Discord channels that notifications can be sent to
+var discordChannelWebhooks = []string{
+	"DISCORD_TEST_WEBHOOK",
+	"DISCORD_TESTS_WEBHOOK",
+	"DISCORD_TEST_FAILURES_WEBHOOK",
+	"DISCORD_DEPLOYMENTS_WEBHOOK",
+	"DISCORD_DEPLOYMENT_FAILURES_WEBHOOK",
+	"DISCORD_COMMUNITY_NODES_WEBHOOK",
+	"DISCORD_ALERT_WEBHOOK",
+	"DISCORD_INFO_WEBHOOK",
+	"DISCORD_SYSTEM_WEBHOOK",
+	"DISCORD_INFRA_WEBHOOK",
+}
+
+const testNotifTitle = "🧪 TEST NOTIFICATION - NOT A REAL EVENT"
+
+const (
+	testNotifField_Channel = "Channel"
+	testNotifField_Sample  = "Sample Field"
+)
+
+// NotifyTest sends a clearly labeled test notification to a channel, identified by the environment variable of its
+// webhook, or to all configured channels if no channel is specified. Test notifications go through the same path as job
+// notifications so that operators can check delivery and formatting without creating a real job.
+func (n JobNotifs) NotifyTest(channel string) error {
+	n.inFlight.Add(1)
+	defer n.inFlight.Done()
+	webhookEnvs := discordChannelWebhooks
+	if len(channel) > 0 {
+		webhookEnvs = []string{channel}
+	}
+	errs := make([]string, 0)
+	numSent := 0
+	for _, webhookEnv := range webhookEnvs {
+		if w, err := parseDiscordWebhookUrl(webhookEnv); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", webhookEnv, err))
+		} else if w == nil {
+			// It's only an error for a channel that was explicitly requested to not be configured
+			if len(channel) > 0 {
+				errs = append(errs, fmt.Sprintf("%s: not configured", webhookEnv))
+			}
+		} else if _, err = n.sendNotif(
+			testNotifTitle,
+			[]discord.EmbedField{
+				{Name: notifField_Message, Value: "This is a test of the notification system, no action is needed."},
+				{Name: testNotifField_Channel, Value: webhookEnv},
+				{Name: testNotifField_Sample, Value: "`" + manager.ServiceName + "` [link](https://github.com/3box/pipeline-tools)"},
+			},
+			n.channelColor(discordColor_Info, w),
+			time.Now(),
+			w,
+			nil,
+			"",
+		); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", webhookEnv, err))
+		} else {
+			numSent++
+		}
+	}
+	log.Printf("notifyTest: sent %d test notifications", numSent)
+	if len(errs) > 0 {
+		return fmt.Errorf("notifyTest: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package notifs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/disgo/webhook"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+// Names of the colors that can be overridden by a channel's theme
+var themeColors = map[string]discordColor{
+	"info":    discordColor_Info,
+	"ok":      discordColor_Ok,
+	"warning": discordColor_Warning,
+	"alert":   discordColor_Alert,
+}
+
+// colorTheme maps the default notification colors to the colors a channel should use instead
+type colorTheme map[discordColor]discordColor
+
+// newColorThemes parses per-channel color themes, e.g. `{"DISCORD_COMMUNITY_NODES_WEBHOOK": {"ok": "#00ff7f"}}`. Themes
+// are keyed by the environment variable of the channel's webhook, and only the colors being overridden need to be
+// specified. Channels without a theme use the default colors.
+func newColorThemes(themesEnv string) (map[snowflake.ID]colorTheme, error) {
+	themes := make(map[snowflake.ID]colorTheme)
+	themesJson, found := os.LookupEnv(themesEnv)
+	if !found {
+		return themes, nil
+	}
+	themeConfigs := make(map[string]map[string]string)
+	if err := json.Unmarshal([]byte(themesJson), &themeConfigs); err != nil {
+		return nil, fmt.Errorf("newColorThemes: invalid themes: %v", err)
+	}
+	for webhookEnv, themeConfig := range themeConfigs {
+		channel, err := parseDiscordWebhookUrl(webhookEnv)
+		if err != nil {
+			return nil, err
+		} else if channel == nil {
+			// Ignore themes for channels that aren't configured in this environment
+			continue
+		}
+		theme := make(colorTheme, len(themeConfig))
+		for colorName, colorValue := range themeConfig {
+			if defaultColor, found := themeColors[colorName]; !found {
+				return nil, fmt.Errorf("newColorThemes: unknown color: %s, %s", webhookEnv, colorName)
+			} else if color, err := strconv.ParseInt(strings.TrimPrefix(colorValue, "#"), 16, 32); err != nil {
+				return nil, fmt.Errorf("newColorThemes: invalid color: %s, %s, %s", webhookEnv, colorName, colorValue)
+			} else {
+				theme[defaultColor] = discordColor(color)
+			}
+		}
+		themes[channel.ID()] = theme
+	}
+	return themes, nil
+}
+
+// How much of the environment color to blend into notification colors, so that notifications from different
+// environments are distinguishable while the stage of the job remains recognizable.
+const envColorWeight = 0.3
+
+// newEnvColor parses the base color for an environment from a map of environment names to colors, e.g.
+// `{"prod": "#ff0000", "dev": "#0000ff"}`. Returns nil if no color is configured for the environment.
+func newEnvColor(colorMapEnv string, env manager.EnvType) (*discordColor, error) {
+	colorMapJson, found := os.LookupEnv(colorMapEnv)
+	if !found {
+		return nil, nil
+	}
+	colorMap := make(map[string]string)
+	if err := json.Unmarshal([]byte(colorMapJson), &colorMap); err != nil {
+		return nil, fmt.Errorf("newEnvColor: invalid color map: %v", err)
+	} else if colorValue, found := colorMap[string(env)]; !found {
+		return nil, nil
+	} else if color, err := strconv.ParseInt(strings.TrimPrefix(colorValue, "#"), 16, 32); err != nil {
+		return nil, fmt.Errorf("newEnvColor: invalid color: %s, %s", env, colorValue)
+	} else {
+		envColor := discordColor(color)
+		return &envColor, nil
+	}
+}
+
+// channelColor returns the color to use for a notification sent to the specified channel, i.e. the color from the
+// channel's theme, if any, tinted with the environment color, if any.
+func (n JobNotifs) channelColor(color discordColor, channel webhook.Client) discordColor {
+	// Notifications without a color stay that way
+	if color == discordColor_None {
+		return color
+	}
+	if themeColor, found := n.themes[channel.ID()][color]; found {
+		color = themeColor
+	}
+	if n.envColor != nil {
+		color = blendColors(color, *n.envColor, envColorWeight)
+	}
+	return color
+}
+
+// blendColors mixes the second color into the first, by weight
+func blendColors(color, tint discordColor, weight float64) discordColor {
+	blend := func(shift int) int {
+		c := float64((int(color) >> shift) & 0xff)
+		t := float64((int(tint) >> shift) & 0xff)
+		return int(c*(1-weight)+t*weight+0.5) << shift
+	}
+	return discordColor(blend(16) | blend(8) | blend(0))
+}
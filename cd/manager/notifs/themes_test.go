@@ -0,0 +1,64 @@
+package notifs
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgo/webhook"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const (
+	testDeploymentsWebhookUrl = "https://discord.com/api/webhooks/1000000000000000001/deployments"
+	testAlertWebhookUrl       = "https://discord.com/api/webhooks/1000000000000000004/alerts"
+	testCommunityWebhookUrl   = "https://discord.com/api/webhooks/1000000000000000006/community"
+)
+
+func testWebhook(t *testing.T, webhookUrl string) webhook.Client {
+	t.Helper()
+	w, err := newDiscordWebhook(webhookUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestChannelColorThemes(t *testing.T) {
+	t.Setenv("DISCORD_DEPLOYMENTS_WEBHOOK", testDeploymentsWebhookUrl)
+	t.Setenv("DISCORD_COMMUNITY_NODES_WEBHOOK", testCommunityWebhookUrl)
+	t.Setenv("DISCORD_COLOR_THEMES", `{"DISCORD_DEPLOYMENTS_WEBHOOK": {"ok": "#00ff7f"}, "DISCORD_COMMUNITY_NODES_WEBHOOK": {"ok": "7b68ee", "alert": "#ff69b4"}}`)
+	themes, err := newColorThemes("DISCORD_COLOR_THEMES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := JobNotifs{themes: themes}
+	deployments := testWebhook(t, testDeploymentsWebhookUrl)
+	community := testWebhook(t, testCommunityWebhookUrl)
+	// The same job is rendered in each channel's colors
+	color := colorForStage(job.JobStage_Completed)
+	if deploymentsColor := n.channelColor(color, deployments); deploymentsColor != 0x00ff7f {
+		t.Fatalf("unexpected deployments channel color: %x", deploymentsColor)
+	} else if communityColor := n.channelColor(color, community); communityColor != 0x7b68ee {
+		t.Fatalf("unexpected community channel color: %x", communityColor)
+	}
+	// Colors that aren't overridden by a channel's theme, and channels without a theme, use the default colors
+	if warningColor := n.channelColor(discordColor_Warning, community); warningColor != discordColor_Warning {
+		t.Fatalf("unexpected warning color: %x", warningColor)
+	} else if alertColor := n.channelColor(discordColor_Alert, testWebhook(t, testAlertWebhookUrl)); alertColor != discordColor_Alert {
+		t.Fatalf("unexpected alert color for channel without a theme: %x", alertColor)
+	}
+}
+
+func TestColorThemesInvalid(t *testing.T) {
+	t.Setenv("DISCORD_DEPLOYMENTS_WEBHOOK", testDeploymentsWebhookUrl)
+	for _, themesJson := range []string{
+		`{"DISCORD_DEPLOYMENTS_WEBHOOK": {"purple": "#800080"}}`,
+		`{"DISCORD_DEPLOYMENTS_WEBHOOK": {"ok": "green"}}`,
+		`not json`,
+	} {
+		t.Setenv("DISCORD_COLOR_THEMES", themesJson)
+		if _, err := newColorThemes("DISCORD_COLOR_THEMES"); err == nil {
+			t.Fatalf("expected invalid themes to be rejected: %s", themesJson)
+		}
+	}
+}
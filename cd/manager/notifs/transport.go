@@ -0,0 +1,76 @@
+package notifs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/disgo/webhook"
+)
+
+// Same as the default timeout of the Discord REST client
+const webhookHttpTimeout = 20 * time.Second
+
+// webhookHttpClient is the HTTP client shared by all Discord webhook clients, if one has been configured. Webhook clients
+// use standard networking otherwise.
+var webhookHttpClient *http.Client
+
+// configureWebhookHttpClient configures outbound Discord traffic to go through a proxy and/or to trust a custom CA
+// bundle, e.g. for networks where traffic is intercepted by a TLS-inspecting proxy. Without a dedicated proxy, the
+// standard proxy environment variables (e.g. HTTPS_PROXY) are still honored.
+func configureWebhookHttpClient() error {
+	proxyUrl := os.Getenv("DISCORD_PROXY_URL")
+	caFile := os.Getenv("DISCORD_CA_FILE")
+	if (len(proxyUrl) == 0) && (len(caFile) == 0) {
+		webhookHttpClient = nil
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(proxyUrl) > 0 {
+		if parsedUrl, err := url.Parse(proxyUrl); err != nil {
+			return fmt.Errorf("configureWebhookHttpClient: invalid proxy url: %v", err)
+		} else if (len(parsedUrl.Host) == 0) ||
+			((parsedUrl.Scheme != "http") && (parsedUrl.Scheme != "https") && (parsedUrl.Scheme != "socks5")) {
+			return fmt.Errorf("configureWebhookHttpClient: invalid proxy url: %s", parsedUrl.Redacted())
+		} else {
+			transport.Proxy = http.ProxyURL(parsedUrl)
+		}
+	}
+	if len(caFile) > 0 {
+		caPem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("configureWebhookHttpClient: could not read ca file: %v", err)
+		}
+		// Trust the custom CA in addition to the system CAs
+		caPool, err := x509.SystemCertPool()
+		if err != nil {
+			caPool = x509.NewCertPool()
+		}
+		if !caPool.AppendCertsFromPEM(caPem) {
+			return fmt.Errorf("configureWebhookHttpClient: no certificates found in ca file: %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: caPool, MinVersion: tls.VersionTLS12}
+	}
+	webhookHttpClient = &http.Client{Transport: transport, Timeout: webhookHttpTimeout}
+	return nil
+}
+
+func webhookOpts() []webhook.ConfigOpt {
+	if webhookHttpClient == nil {
+		return nil
+	}
+	return []webhook.ConfigOpt{webhook.WithRestClientConfigOpts(restOpts()...)}
+}
+
+// restOpts configures REST clients that aren't tied to a webhook, e.g. the bot client, the same way as webhook clients
+func restOpts() []rest.ConfigOpt {
+	if webhookHttpClient == nil {
+		return nil
+	}
+	return []rest.ConfigOpt{rest.WithHTTPClient(webhookHttpClient)}
+}
@@ -0,0 +1,126 @@
+package replay
+
+import (
+	"fmt"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+)
+
+// Task identifier returned for tasks launched during replay, since the job only records it for later checks
+const replayedTaskId = "replayed-task"
+
+// scriptedDeployment answers the calls a job makes to check on its tasks with the observations recorded in a decision,
+// in the order they were recorded. Deployment methods that aren't overridden here panic, which is reported as a step
+// that can't be replayed.
+type scriptedDeployment struct {
+	manager.Deployment
+	observations []manager.DecisionCheck
+	next         int
+	// Why the decision failed the job, returned by the call that made the last observation or, if no observation was
+	// recorded, by the first call made
+	err    error
+	failAt int
+	// Set if the job made a check whose result wasn't recorded
+	missing bool
+}
+
+// isObservation returns true for checks whose results came from the outside world, as opposed to ones the job derives
+// from its own state and the time
+func isObservation(name string) bool {
+	switch name {
+	case manager.DecisionCheck_StartupTimedOut, manager.DecisionCheck_CompletionTimedOut:
+		return false
+	default:
+		return true
+	}
+}
+
+func newScriptedDeployment(decision manager.Decision, failure string) *scriptedDeployment {
+	d := &scriptedDeployment{failAt: -1}
+	for _, check := range decision.Checks {
+		if isObservation(check.Name) {
+			d.observations = append(d.observations, check)
+		}
+	}
+	if len(failure) > 0 {
+		d.err = fmt.Errorf("%s", failure)
+		if len(decision.Checks) == 0 {
+			d.failAt = 0
+		} else if isObservation(decision.Checks[len(decision.Checks)-1].Name) {
+			d.failAt = len(d.observations)
+		}
+		// Otherwise a derived check, e.g. a timeout, made after the last observation explains the failure, so the job
+		// will reach it on its own.
+	}
+	return d
+}
+
+// failed returns the recorded error if it was returned without an observation, i.e. by the first call made
+func (d *scriptedDeployment) failed() error {
+	if (d.failAt == 0) && (d.err != nil) {
+		err := d.err
+		d.err = nil
+		return err
+	}
+	return nil
+}
+
+// observe returns the next recorded observation if it's one of the named checks, along with the recorded error if
+// that observation was made by the call that failed
+func (d *scriptedDeployment) observe(names ...string) (bool, bool, error) {
+	if err := d.failed(); err != nil {
+		return false, true, err
+	}
+	if d.next >= len(d.observations) {
+		return false, false, nil
+	}
+	check := d.observations[d.next]
+	for _, name := range names {
+		if check.Name == name {
+			result, ok := check.Result.(bool)
+			if !ok {
+				return false, true, fmt.Errorf("observe: unexpected result for %s: %v", check.Name, check.Result)
+			}
+			d.next++
+			if d.next == d.failAt {
+				return result, true, d.err
+			}
+			return result, true, nil
+		}
+	}
+	return false, false, nil
+}
+
+func (d *scriptedDeployment) LaunchServiceTask(_, _, _, _ string, _ map[string]string) (string, error) {
+	if err := d.failed(); err != nil {
+		return "", err
+	}
+	return replayedTaskId, nil
+}
+
+func (d *scriptedDeployment) LaunchTask(_, _, _, _ string, _ *manager.NetworkConfig, _ map[string]string) (string, error) {
+	if err := d.failed(); err != nil {
+		return "", err
+	}
+	return replayedTaskId, nil
+}
+
+func (d *scriptedDeployment) CheckTask(_, _ string, _, _ bool, _ ...string) (bool, *int32, error) {
+	if status, found, err := d.observe(
+		manager.DecisionCheck_TaskRunning,
+		manager.DecisionCheck_WorkerInExpectedState,
+		manager.DecisionCheck_TestsInExpectedState,
+	); !found {
+		d.missing = true
+		return false, nil, fmt.Errorf("checkTask: %w", Error_NotRecorded)
+	} else {
+		return status, nil, err
+	}
+}
+
+// CheckTaskStopped reports tasks that weren't recorded as stopped as still running. Jobs only check whether a task
+// stopped without recording it while checking whether it started, which is recorded as a single observation.
+func (d *scriptedDeployment) CheckTaskStopped(_, _ string) (bool, int, error) {
+	stopped, _, err := d.observe(manager.DecisionCheck_TaskStopped)
+	return stopped, 0, err
+}
@@ -0,0 +1,199 @@
+// Package replay re-runs the decisions recorded for a job against the job's state machine, so that a job that behaved
+// oddly can be reproduced deterministically while debugging it.
+//
+// The job's history, i.e. the states recorded for it in the database, provides the state the job was in when each
+// decision was made, and the decision log provides what the job observed while making it. Each decision is replayed
+// with a clock stopped at the time the decision was made and a deployment that answers with the recorded observations.
+package replay
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+	"github.com/3box/pipeline-tools/cd/manager/jobs"
+)
+
+var (
+	Error_Unsupported = fmt.Errorf("job type cannot be replayed")
+	Error_NotRecorded = fmt.Errorf("observation not recorded")
+)
+
+type jobSmFn func(job.JobState, manager.Database, manager.Notifs, *manager.DecisionLog, manager.Clock, manager.Deployment) (manager.JobSm, error)
+
+// Only jobs that record every observation they make while advancing can be replayed
+var replayableJobs = map[job.JobType]jobSmFn{
+	job.JobType_Task: jobs.TaskJob,
+	job.JobType_Anchor: func(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) (manager.JobSm, error) {
+		return jobs.AnchorJob(jobState, db, notifs, decisions, clock, d), nil
+	},
+	job.JobType_TestE2E: func(jobState job.JobState, db manager.Database, notifs manager.Notifs, decisions *manager.DecisionLog, clock manager.Clock, d manager.Deployment) (manager.JobSm, error) {
+		return jobs.E2eTestJob(jobState, db, notifs, decisions, clock, d), nil
+	},
+}
+
+// Step is the outcome of replaying a single recorded decision
+type Step struct {
+	Ts       time.Time
+	Stage    job.JobStage
+	Recorded manager.Decision
+	Replayed *manager.Decision `json:",omitempty"`
+	// Why the job failed, if the decision failed it
+	RecordedReason string `json:",omitempty"`
+	ReplayedReason string `json:",omitempty"`
+	// True if the replayed decision made the same checks with the same results, and led to the same stage
+	Matches bool
+	// Why the decision couldn't be replayed, e.g. because the job made a call whose result wasn't recorded
+	Error string `json:",omitempty"`
+}
+
+// fixedClock is stopped at the time a decision was made
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// replayDb keeps the last job update instead of writing it. Database methods that aren't overridden here panic.
+type replayDb struct {
+	manager.Database
+	jobState *job.JobState
+}
+
+func (db *replayDb) AdvanceJob(jobState job.JobState) error {
+	db.jobState = &jobState
+	return nil
+}
+
+func (db *replayDb) WriteJob(jobState job.JobState) error {
+	db.jobState = &jobState
+	return nil
+}
+
+// replayNotifs drops job notifications. Notifs methods that aren't overridden here panic.
+type replayNotifs struct {
+	manager.Notifs
+}
+
+func (replayNotifs) NotifyJob(...job.JobState) {}
+
+// Replay re-runs each recorded decision for a job, starting from the latest state recorded for the job before the
+// decision was made. Decisions that failed the job are replayed with the reason recorded in the state the job was
+// advanced to. The decision log only keeps the most recent decisions, and history only has the states the job was
+// advanced to, so steps where the state a decision started from doesn't match the stage it recorded are reported
+// rather than replayed.
+func Replay(history []job.JobState, decisions []manager.Decision) ([]Step, error) {
+	if len(history) == 0 {
+		return nil, fmt.Errorf("replay: %w", manager.Error_JobNotFound)
+	}
+	history = append([]job.JobState{}, history...)
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Ts.Before(history[j].Ts)
+	})
+	jobType := history[0].Type
+	newJobSm, found := replayableJobs[jobType]
+	if !found {
+		return nil, fmt.Errorf("replay: %w: %s", Error_Unsupported, jobType)
+	}
+	decisions = append([]manager.Decision{}, decisions...)
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Ts.Before(decisions[j].Ts)
+	})
+	steps := make([]Step, 0, len(decisions))
+	for _, decision := range decisions {
+		step := Step{Ts: decision.Ts, Stage: decision.Stage, Recorded: decision}
+		if jobState, found := stateAt(history, decision.Ts); !found {
+			step.Error = fmt.Sprintf("no job state recorded before %s", decision.Ts)
+		} else if jobState.Stage != decision.Stage {
+			step.Error = fmt.Sprintf("job state recorded before the decision was %s", jobState.Stage)
+		} else {
+			step.RecordedReason = failureReason(history, decision)
+			if replayed, reason, err := replayDecision(newJobSm, jobState, decision, step.RecordedReason); err != nil {
+				step.Error = err.Error()
+			} else {
+				step.Replayed = &replayed
+				step.ReplayedReason = reason
+				step.Matches = matches(decision, replayed)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// stateAt returns a copy of the latest state recorded at or before a particular time
+func stateAt(history []job.JobState, ts time.Time) (job.JobState, bool) {
+	idx := sort.Search(len(history), func(i int) bool {
+		return history[i].Ts.After(ts)
+	})
+	if idx == 0 {
+		return job.JobState{}, false
+	}
+	return manager.CopyJob(history[idx-1]), true
+}
+
+// failureReason returns the error recorded in the state a decision failed the job with. Failures are recorded in the
+// job rather than returned while advancing it, so they aren't part of the decision.
+func failureReason(history []job.JobState, decision manager.Decision) string {
+	if decision.NextStage != job.JobStage_Failed {
+		return ""
+	}
+	idx := sort.Search(len(history), func(i int) bool {
+		return history[i].Ts.After(decision.Ts)
+	})
+	if (idx < len(history)) && (history[idx].Stage == job.JobStage_Failed) {
+		if reason, found := history[idx].Params[job.JobParam_Error].(string); found {
+			return reason
+		}
+	}
+	return decision.Error
+}
+
+func replayDecision(newJobSm jobSmFn, jobState job.JobState, decision manager.Decision, failure string) (replayed manager.Decision, reason string, err error) {
+	defer func() {
+		// Jobs that make calls the harness doesn't provide panic on the missing method
+		if r := recover(); r != nil {
+			err = fmt.Errorf("replayDecision: job made a call that can't be replayed: %v", r)
+		}
+	}()
+	decisionLog := manager.NewDecisionLogOfSize(1)
+	db := new(replayDb)
+	d := newScriptedDeployment(decision, failure)
+	jobSm, err := newJobSm(jobState, db, replayNotifs{}, decisionLog, fixedClock(decision.Ts), d)
+	if err != nil {
+		return manager.Decision{}, "", err
+	}
+	decisionLog.Begin(jobState)
+	nextJobState, err := jobSm.Advance()
+	decisionLog.End(jobState.JobId, nextJobState.Stage, err)
+	if d.missing {
+		return manager.Decision{}, "", fmt.Errorf("replayDecision: %w", Error_NotRecorded)
+	}
+	jobDecisions, _ := decisionLog.JobDecisions(jobState.JobId)
+	if len(jobDecisions) == 0 {
+		return manager.Decision{}, "", fmt.Errorf("replayDecision: no decision recorded")
+	}
+	replayed = jobDecisions[0]
+	// The replayed decision was made at the same time as the recorded one, however long it took to replay
+	replayed.Ts = decision.Ts
+	replayed.Elapsed = 0
+	if (db.jobState != nil) && (db.jobState.Stage == job.JobStage_Failed) {
+		reason, _ = db.jobState.Params[job.JobParam_Error].(string)
+	}
+	return replayed, reason, nil
+}
+
+func matches(recorded, replayed manager.Decision) bool {
+	if (recorded.NextStage != replayed.NextStage) || (len(recorded.Checks) != len(replayed.Checks)) {
+		return false
+	}
+	for i, check := range recorded.Checks {
+		// Recorded results have been through JSON, so compare them as text
+		if (check.Name != replayed.Checks[i].Name) || (fmt.Sprint(check.Result) != fmt.Sprint(replayed.Checks[i].Result)) {
+			return false
+		}
+	}
+	return true
+}
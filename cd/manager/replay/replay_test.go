@@ -0,0 +1,195 @@
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager"
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+var testStart = time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+func testTaskState(stage job.JobStage, ts time.Time, params map[string]interface{}) job.JobState {
+	jobParams := map[string]interface{}{
+		job.TaskJobParam_Name:              "migration",
+		job.TaskJobParam_Cluster:           "ceramic-dev-ops",
+		job.TaskJobParam_Family:            "ceramic-dev-ops-migration",
+		job.TaskJobParam_Container:         "migration",
+		job.TaskJobParam_NetworkConfig:     "/ceramic-dev-ops/network_configuration",
+		job.TaskJobParam_StartupTimeout:    "5m",
+		job.TaskJobParam_CompletionTimeout: "30m",
+	}
+	for k, v := range params {
+		jobParams[k] = v
+	}
+	return job.JobState{JobId: "job", Type: job.JobType_Task, Stage: stage, Ts: ts, Params: jobParams}
+}
+
+func check(name string, result bool) manager.DecisionCheck {
+	return manager.DecisionCheck{Name: name, Result: result}
+}
+
+// roundTrip passes history and decisions through JSON, the way they're read from the manager's endpoints
+func roundTrip(t *testing.T, history []job.JobState, decisions []manager.Decision) ([]job.JobState, []manager.Decision) {
+	t.Helper()
+	var decodedHistory []job.JobState
+	var decodedDecisions []manager.Decision
+	if data, err := json.Marshal(history); err != nil {
+		t.Fatal(err)
+	} else if err = json.Unmarshal(data, &decodedHistory); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := json.Marshal(decisions); err != nil {
+		t.Fatal(err)
+	} else if err = json.Unmarshal(data, &decodedDecisions); err != nil {
+		t.Fatal(err)
+	}
+	return decodedHistory, decodedDecisions
+}
+
+func testReplay(t *testing.T, history []job.JobState, decisions []manager.Decision) []Step {
+	t.Helper()
+	history, decisions = roundTrip(t, history, decisions)
+	steps, err := Replay(history, decisions)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(steps) != len(decisions) {
+		t.Fatalf("expected %d steps, got %d", len(decisions), len(steps))
+	}
+	return steps
+}
+
+func TestReplayReproducesTaskJob(t *testing.T) {
+	started := testStart.Add(time.Second)
+	running := map[string]interface{}{job.JobParam_Id: "task", job.JobParam_Start: float64(started.UnixNano())}
+	history := []job.JobState{
+		testTaskState(job.JobStage_Dequeued, testStart, nil),
+		testTaskState(job.JobStage_Started, started, running),
+		testTaskState(job.JobStage_Waiting, testStart.Add(2*time.Minute), running),
+		testTaskState(job.JobStage_Completed, testStart.Add(10*time.Minute), running),
+	}
+	decisions := []manager.Decision{
+		{Ts: started.Add(-time.Millisecond), Stage: job.JobStage_Dequeued, NextStage: job.JobStage_Started},
+		{Ts: testStart.Add(time.Minute), Stage: job.JobStage_Started, Checks: []manager.DecisionCheck{
+			check(manager.DecisionCheck_TaskRunning, false),
+			check(manager.DecisionCheck_StartupTimedOut, false),
+		}, NextStage: job.JobStage_Started},
+		{Ts: testStart.Add(2*time.Minute - time.Millisecond), Stage: job.JobStage_Started, Checks: []manager.DecisionCheck{
+			check(manager.DecisionCheck_TaskRunning, true),
+		}, NextStage: job.JobStage_Waiting},
+		{Ts: testStart.Add(5 * time.Minute), Stage: job.JobStage_Waiting, Checks: []manager.DecisionCheck{
+			check(manager.DecisionCheck_TaskStopped, false),
+			check(manager.DecisionCheck_CompletionTimedOut, false),
+		}, NextStage: job.JobStage_Waiting},
+		{Ts: testStart.Add(10*time.Minute - time.Millisecond), Stage: job.JobStage_Waiting, Checks: []manager.DecisionCheck{
+			check(manager.DecisionCheck_TaskStopped, true),
+		}, NextStage: job.JobStage_Completed},
+	}
+	for i, step := range testReplay(t, history, decisions) {
+		if len(step.Error) > 0 {
+			t.Fatalf("step %d not replayed: %s", i, step.Error)
+		} else if !step.Matches {
+			t.Fatalf("step %d not reproduced: recorded %+v, replayed %+v", i, step.Recorded, *step.Replayed)
+		}
+	}
+}
+
+func TestReplayUsesRecordedTime(t *testing.T) {
+	running := map[string]interface{}{job.JobParam_Id: "task", job.JobParam_Start: float64(testStart.UnixNano())}
+	history := []job.JobState{
+		testTaskState(job.JobStage_Waiting, testStart, running),
+		testTaskState(job.JobStage_Failed, testStart.Add(31*time.Minute), map[string]interface{}{
+			job.JobParam_Error: manager.Error_CompletionTimeout.Error(),
+		}),
+	}
+	decisions := []manager.Decision{{Ts: testStart.Add(31*time.Minute - time.Millisecond), Stage: job.JobStage_Waiting, Checks: []manager.DecisionCheck{
+		check(manager.DecisionCheck_TaskStopped, false),
+		check(manager.DecisionCheck_CompletionTimedOut, true),
+	}, NextStage: job.JobStage_Failed}}
+	step := testReplay(t, history, decisions)[0]
+	if !step.Matches {
+		t.Fatalf("timeout not reproduced: %+v", *step.Replayed)
+	} else if step.ReplayedReason != manager.Error_CompletionTimeout.Error() {
+		t.Fatalf("unexpected failure reason: %s", step.ReplayedReason)
+	}
+}
+
+func TestReplayReturnsRecordedFailure(t *testing.T) {
+	running := map[string]interface{}{job.JobParam_Id: "task", job.JobParam_Start: float64(testStart.UnixNano())}
+	history := []job.JobState{
+		testTaskState(job.JobStage_Waiting, testStart, running),
+		testTaskState(job.JobStage_Failed, testStart.Add(time.Minute), map[string]interface{}{
+			job.JobParam_Error: "task exited with code 1",
+		}),
+	}
+	decisions := []manager.Decision{{Ts: testStart.Add(time.Minute - time.Millisecond), Stage: job.JobStage_Waiting, Checks: []manager.DecisionCheck{
+		check(manager.DecisionCheck_TaskStopped, false),
+	}, NextStage: job.JobStage_Failed}}
+	step := testReplay(t, history, decisions)[0]
+	if !step.Matches {
+		t.Fatalf("failure not reproduced: %+v", *step.Replayed)
+	} else if (step.RecordedReason != "task exited with code 1") || (step.ReplayedReason != step.RecordedReason) {
+		t.Fatalf("unexpected failure reasons: recorded %s, replayed %s", step.RecordedReason, step.ReplayedReason)
+	}
+}
+
+func TestReplayDetectsDivergence(t *testing.T) {
+	running := map[string]interface{}{job.JobParam_Id: "task", job.JobParam_Start: float64(testStart.UnixNano())}
+	history := []job.JobState{
+		testTaskState(job.JobStage_Started, testStart, running),
+		testTaskState(job.JobStage_Failed, testStart.Add(time.Minute), map[string]interface{}{
+			job.JobParam_Error: manager.Error_StartupTimeout.Error(),
+		}),
+	}
+	// The job was recorded timing out a minute after it started, well within its five minute startup timeout
+	decisions := []manager.Decision{{Ts: testStart.Add(time.Minute - time.Millisecond), Stage: job.JobStage_Started, Checks: []manager.DecisionCheck{
+		check(manager.DecisionCheck_TaskRunning, false),
+		check(manager.DecisionCheck_StartupTimedOut, true),
+	}, NextStage: job.JobStage_Failed}}
+	step := testReplay(t, history, decisions)[0]
+	if step.Matches {
+		t.Fatal("divergent decision reported as reproduced")
+	} else if step.Replayed.NextStage != job.JobStage_Started {
+		t.Fatalf("expected the job to keep waiting for the task to start, got %s", step.Replayed.NextStage)
+	}
+}
+
+func TestReplayAnchorJob(t *testing.T) {
+	running := map[string]interface{}{job.JobParam_Id: "task", job.JobParam_Start: float64(testStart.UnixNano())}
+	history := []job.JobState{
+		{JobId: "job", Type: job.JobType_Anchor, Stage: job.JobStage_Waiting, Ts: testStart, Params: running},
+	}
+	decisions := []manager.Decision{{Ts: testStart.Add(time.Minute), Stage: job.JobStage_Waiting, Checks: []manager.DecisionCheck{
+		check(manager.DecisionCheck_WorkerInExpectedState, true),
+	}, NextStage: job.JobStage_Completed}}
+	if step := testReplay(t, history, decisions)[0]; !step.Matches {
+		t.Fatalf("anchor decision not reproduced: %+v", step)
+	}
+}
+
+func TestReplayMissingObservation(t *testing.T) {
+	running := map[string]interface{}{job.JobParam_Id: "task", job.JobParam_Start: float64(testStart.UnixNano())}
+	history := []job.JobState{testTaskState(job.JobStage_Started, testStart, running)}
+	decisions := []manager.Decision{{Ts: testStart.Add(time.Minute), Stage: job.JobStage_Started, NextStage: job.JobStage_Started}}
+	if step := testReplay(t, history, decisions)[0]; step.Matches || (len(step.Error) == 0) {
+		t.Fatalf("expected a check without a recorded result not to be replayed: %+v", step)
+	}
+}
+
+func TestReplayStageMismatch(t *testing.T) {
+	history := []job.JobState{testTaskState(job.JobStage_Waiting, testStart, nil)}
+	decisions := []manager.Decision{{Ts: testStart.Add(time.Minute), Stage: job.JobStage_Started, NextStage: job.JobStage_Waiting}}
+	if step := testReplay(t, history, decisions)[0]; len(step.Error) == 0 {
+		t.Fatal("expected a decision made from a different stage not to be replayed")
+	}
+}
+
+func TestReplayUnsupportedJobType(t *testing.T) {
+	history := []job.JobState{{JobId: "job", Type: job.JobType_Deploy, Stage: job.JobStage_Queued, Ts: testStart}}
+	if _, err := Replay(history, nil); !errors.Is(err, Error_Unsupported) {
+		t.Fatalf("expected unsupported job type, got %v", err)
+	}
+}
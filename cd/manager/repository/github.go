@@ -39,13 +39,15 @@ const (
 
 const imageVerificationStatusCheck = "ci/image: verify"
 
+// NewRepository creates the GitHub client shared by everything in the manager that talks to GitHub, so that all
+// requests count against (and respect) the same rate limits, and share the same response cache.
 func NewRepository() manager.Repository {
-	var httpClient *http.Client = nil
+	httpClient := &http.Client{Transport: newCachingTransport(nil)}
 	if accessToken, found := os.LookupEnv("GITHUB_ACCESS_TOKEN"); found {
 		ts := oauth2.StaticTokenSource(
 			&oauth2.Token{AccessToken: accessToken},
 		)
-		httpClient = oauth2.NewClient(context.Background(), ts)
+		httpClient = oauth2.NewClient(context.WithValue(context.Background(), oauth2.HTTPClient, httpClient), ts)
 	}
 	return &Github{github.NewClient(httpClient)}
 }
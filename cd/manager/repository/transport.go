@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"bytes"
+	"expvar"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Bound the number of cached responses. Most GitHub requests made by the manager are for a handful of branches,
+// commits, and workflow runs, so this should be plenty.
+const maxCachedResponses = 500
+
+const (
+	gitHubHeader_ETag        = "ETag"
+	gitHubHeader_IfNoneMatch = "If-None-Match"
+	gitHubHeader_Remaining   = "X-RateLimit-Remaining"
+)
+
+// Expose GitHub API usage at `/debug/vars` alongside the other process metrics
+var gitHubMetrics = expvar.NewMap("github")
+
+type cachedResponse struct {
+	etag     string
+	header   http.Header
+	body     []byte
+	status   int
+	proto    string
+	protoMaj int
+	protoMin int
+}
+
+// cachingTransport makes conditional requests for GitHub API responses that have been seen before. GitHub does not
+// count "304 Not Modified" responses against the rate limit, so repeatedly polling the same resource (e.g. a commit's
+// status, or a workflow run) is nearly free once the response has been cached.
+//
+// Rate limits themselves are enforced by the GitHub client, which stops making requests once a primary or secondary
+// rate limit has been hit until it resets.
+type cachingTransport struct {
+	base      http.RoundTripper
+	responses map[string]cachedResponse
+	mu        *sync.Mutex
+}
+
+func newCachingTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cachingTransport{base, make(map[string]cachedResponse), new(sync.Mutex)}
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only GET requests can be cached
+	if req.Method != http.MethodGet {
+		return t.roundTrip(req)
+	}
+	key := req.URL.String()
+	t.mu.Lock()
+	cached, found := t.responses[key]
+	t.mu.Unlock()
+	if found {
+		// Requests must not be modified by round trippers, so add the condition to a copy of the request.
+		req = req.Clone(req.Context())
+		req.Header.Set(gitHubHeader_IfNoneMatch, cached.etag)
+	}
+	resp, err := t.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if found && (resp.StatusCode == http.StatusNotModified) {
+		gitHubMetrics.Add("cacheHits", 1)
+		resp.Body.Close()
+		return cached.response(req, resp.Header), nil
+	}
+	gitHubMetrics.Add("cacheMisses", 1)
+	if etag := resp.Header.Get(gitHubHeader_ETag); (resp.StatusCode == http.StatusOK) && (len(etag) > 0) {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, found = t.responses[key]; !found && (len(t.responses) >= maxCachedResponses) {
+			// Evict an arbitrary response to make room
+			for evictKey := range t.responses {
+				delete(t.responses, evictKey)
+				break
+			}
+		}
+		t.responses[key] = cachedResponse{etag, resp.Header.Clone(), body, resp.StatusCode, resp.Proto, resp.ProtoMajor, resp.ProtoMinor}
+	}
+	return resp, nil
+}
+
+func (t *cachingTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		if remaining, err := strconv.ParseInt(resp.Header.Get(gitHubHeader_Remaining), 10, 64); err == nil {
+			remainingVar := new(expvar.Int)
+			remainingVar.Set(remaining)
+			gitHubMetrics.Set("rateLimitRemaining", remainingVar)
+		}
+	}
+	return resp, err
+}
+
+// response rebuilds the cached response, using the latest headers so that the GitHub client sees up-to-date rate
+// limits.
+func (c cachedResponse) response(req *http.Request, header http.Header) *http.Response {
+	respHeader := c.header.Clone()
+	for name, values := range header {
+		respHeader[name] = values
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(c.status) + " " + http.StatusText(c.status),
+		StatusCode:    c.status,
+		Proto:         c.proto,
+		ProtoMajor:    c.protoMaj,
+		ProtoMinor:    c.protoMin,
+		Header:        respHeader,
+		Body:          io.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+		Request:       req,
+	}
+}
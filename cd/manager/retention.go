@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+const defaultRetentionInterval = time.Hour
+
+// Finished jobs are kept in the cache for a while, so they're never pruned from the database before they age out of it
+const minRetentionAge = DefaultTtlDays * 24 * time.Hour
+
+// RetentionPolicy limits the job history kept in the database. Finished jobs are pruned once they're older than the
+// maximum age, or once there are more than the maximum count of more recently finished jobs of the same type. A zero
+// limit disables that limit.
+//
+// Deployment history is used for rollbacks, and so is limited separately, and is typically kept for longer.
+type RetentionPolicy struct {
+	MaxAge         time.Duration
+	MaxCount       int
+	DeployMaxAge   time.Duration
+	DeployMaxCount int
+	Interval       time.Duration
+}
+
+// ConfiguredRetentionPolicy returns nil if no retention limits have been configured for this environment
+func ConfiguredRetentionPolicy() (*RetentionPolicy, error) {
+	policy := RetentionPolicy{Interval: defaultRetentionInterval}
+	configured := false
+	for envVar, limit := range map[string]*time.Duration{
+		"JOB_RETENTION_DAYS":    &policy.MaxAge,
+		"DEPLOY_RETENTION_DAYS": &policy.DeployMaxAge,
+	} {
+		if daysStr, found := os.LookupEnv(envVar); found {
+			if days, err := strconv.Atoi(daysStr); (err != nil) || (days < 0) {
+				return nil, fmt.Errorf("configuredRetentionPolicy: invalid %s: %s", envVar, daysStr)
+			} else {
+				*limit = time.Duration(days) * 24 * time.Hour
+				configured = configured || (days > 0)
+			}
+		}
+	}
+	for envVar, limit := range map[string]*int{
+		"JOB_RETENTION_MAX_COUNT":    &policy.MaxCount,
+		"DEPLOY_RETENTION_MAX_COUNT": &policy.DeployMaxCount,
+	} {
+		if countStr, found := os.LookupEnv(envVar); found {
+			if count, err := strconv.Atoi(countStr); (err != nil) || (count < 0) {
+				return nil, fmt.Errorf("configuredRetentionPolicy: invalid %s: %s", envVar, countStr)
+			} else {
+				*limit = count
+				configured = configured || (count > 0)
+			}
+		}
+	}
+	if !configured {
+		return nil, nil
+	}
+	if intervalStr, found := os.LookupEnv("JOB_RETENTION_INTERVAL"); found {
+		if interval, err := time.ParseDuration(intervalStr); (err != nil) || (interval <= 0) {
+			return nil, fmt.Errorf("configuredRetentionPolicy: invalid interval: %s", intervalStr)
+		} else {
+			policy.Interval = interval
+		}
+	}
+	return &policy, nil
+}
+
+// Limits returns true if the policy limits the history of the job type, in which case pruning, not record expiration,
+// decides how long the job type's history is kept.
+func (p RetentionPolicy) Limits(jobType job.JobType) bool {
+	maxAge, maxCount := p.limits(jobType)
+	return (maxAge > 0) || (maxCount > 0)
+}
+
+// PruneBefore returns the time before which a job of the specified type must have finished to be pruned
+func (p RetentionPolicy) PruneBefore(jobType job.JobType, now time.Time) time.Time {
+	maxAge, maxCount := p.limits(jobType)
+	if (maxCount > 0) || (maxAge < minRetentionAge) {
+		return now.Add(-minRetentionAge)
+	}
+	return now.Add(-maxAge)
+}
+
+// ShouldPrune returns true if a finished job should be pruned, given how many more recently finished jobs of the same
+// type there are.
+func (p RetentionPolicy) ShouldPrune(jobState job.JobState, rank int, now time.Time) bool {
+	maxAge, maxCount := p.limits(jobState.Type)
+	age := now.Sub(jobState.Ts)
+	if !job.IsFinishedJob(jobState) || (age < minRetentionAge) {
+		return false
+	}
+	return ((maxAge > 0) && (age > maxAge)) || ((maxCount > 0) && (rank >= maxCount))
+}
+
+func (p RetentionPolicy) limits(jobType job.JobType) (time.Duration, int) {
+	if jobType == job.JobType_Deploy {
+		return p.DeployMaxAge, p.DeployMaxCount
+	}
+	return p.MaxAge, p.MaxCount
+}
@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+func TestRetentionPolicyLimits(t *testing.T) {
+	policy := RetentionPolicy{DeployMaxAge: 90 * 24 * time.Hour}
+	if !policy.Limits(job.JobType_Deploy) {
+		t.Fatal("expected deploy history to be limited")
+	} else if policy.Limits(job.JobType_Anchor) {
+		t.Fatal("expected anchor history to be left to record expiration")
+	}
+}
+
+func TestRetentionPolicyPruneBefore(t *testing.T) {
+	now := time.Now()
+	policy := RetentionPolicy{MaxAge: 30 * 24 * time.Hour, DeployMaxAge: 90 * 24 * time.Hour, DeployMaxCount: 10}
+	if before := policy.PruneBefore(job.JobType_Anchor, now); !before.Equal(now.Add(-policy.MaxAge)) {
+		t.Fatalf("expected age limited jobs to be pruned from %s, got %s", now.Add(-policy.MaxAge), before)
+	}
+	// Count limited jobs can be pruned as soon as they're out of the cache, so all their history needs to be considered
+	if before := policy.PruneBefore(job.JobType_Deploy, now); !before.Equal(now.Add(-minRetentionAge)) {
+		t.Fatalf("expected count limited jobs to be pruned from %s, got %s", now.Add(-minRetentionAge), before)
+	}
+}
+
+func TestRetentionPolicyShouldPrune(t *testing.T) {
+	now := time.Now()
+	policy := RetentionPolicy{MaxAge: 30 * 24 * time.Hour, DeployMaxCount: 2}
+	old := now.Add(-31 * 24 * time.Hour)
+	if !policy.ShouldPrune(job.JobState{Type: job.JobType_Anchor, Stage: job.JobStage_Completed, Ts: old}, 0, now) {
+		t.Fatal("expected an old finished job to be pruned")
+	} else if policy.ShouldPrune(job.JobState{Type: job.JobType_Anchor, Stage: job.JobStage_Started, Ts: old}, 0, now) {
+		t.Fatal("expected an unfinished job to be kept")
+	} else if policy.ShouldPrune(job.JobState{Type: job.JobType_Deploy, Stage: job.JobStage_Completed, Ts: old}, 1, now) {
+		t.Fatal("expected a deploy within the count limit to be kept")
+	} else if !policy.ShouldPrune(job.JobState{Type: job.JobType_Deploy, Stage: job.JobStage_Completed, Ts: old}, 2, now) {
+		t.Fatal("expected a deploy beyond the count limit to be pruned")
+	}
+}
@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// JobSchedule queues a job built from a template whenever its cron expression (e.g. "0 6 * * *" or "@daily") fires
+type JobSchedule struct {
+	Name       string
+	Expression string
+	Type       job.JobType
+	Params     map[string]interface{}
+	// Last time the schedule queued a job, if it has since the manager started
+	LastRun  time.Time
+	schedule cron.Schedule
+}
+
+// scheduleConfig is the configuration for a single job schedule
+type scheduleConfig struct {
+	Name       string                 `json:"name"`
+	Expression string                 `json:"expression"`
+	Type       job.JobType            `json:"type"`
+	Params     map[string]interface{} `json:"params"`
+}
+
+func NewJobSchedule(name, expression string, jobType job.JobType, params map[string]interface{}) (*JobSchedule, error) {
+	if len(name) == 0 {
+		return nil, fmt.Errorf("newJobSchedule: missing name")
+	} else if len(jobType) == 0 {
+		return nil, fmt.Errorf("newJobSchedule: missing job type: %s", name)
+	} else if schedule, err := cron.ParseStandard(expression); err != nil {
+		return nil, fmt.Errorf("newJobSchedule: invalid expression: %s, %s, %v", name, expression, err)
+	} else {
+		return &JobSchedule{name, expression, jobType, params, time.Time{}, schedule}, nil
+	}
+}
+
+// NextRun returns the first time the schedule fires after the specified time
+func (s JobSchedule) NextRun(after time.Time) time.Time {
+	return s.schedule.Next(after)
+}
+
+// NewJob creates a job from the schedule's template, marking it as having been queued by the schedule
+func (s JobSchedule) NewJob() job.JobState {
+	params := make(map[string]interface{}, len(s.Params)+1)
+	for k, v := range s.Params {
+		params[k] = v
+	}
+	params[job.JobParam_Source] = ServiceName
+	params[job.JobParam_Schedule] = s.Name
+	return job.JobState{Type: s.Type, Params: params}
+}
+
+// ConfiguredJobSchedules returns the job schedules configured for this environment, if any
+func ConfiguredJobSchedules() ([]*JobSchedule, error) {
+	schedules := make([]*JobSchedule, 0)
+	if schedulesJson, found := os.LookupEnv("JOB_SCHEDULES"); found {
+		var configs []scheduleConfig
+		if err := json.Unmarshal([]byte(schedulesJson), &configs); err != nil {
+			return nil, fmt.Errorf("configuredJobSchedules: invalid configuration: %v", err)
+		}
+		for _, config := range configs {
+			if schedule, err := NewJobSchedule(config.Name, config.Expression, config.Type, config.Params); err != nil {
+				return nil, err
+			} else {
+				schedules = append(schedules, schedule)
+			}
+		}
+	}
+	return schedules, nil
+}
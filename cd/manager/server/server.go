@@ -3,9 +3,14 @@ package server
 import (
 	"encoding/json"
 	"errors"
+	"expvar"
+	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/3box/pipeline-tools/cd/manager"
@@ -16,9 +21,18 @@ func Setup(addr string, m manager.Manager) http.Server {
 	logger := log.New(os.Stdout, "http: ", log.LstdFlags)
 	mux := http.NewServeMux()
 	mux.Handle("/healthcheck", healthcheckHandler())
-	mux.Handle("/time", timeHandler(time.RFC1123))
+	mux.Handle("/time", timeHandler(manager.ConfiguredTimeFormatter()))
 	mux.Handle("/job", jobHandler(m))
+	mux.Handle("/jobs", jobListHandler(m))
+	mux.Handle("/jobs/", jobsHandler(m, []byte(os.Getenv("APPROVAL_SIGNING_KEY"))))
+	mux.Handle("/components/", componentsHandler(m))
+	mux.Handle("/clusters/", clustersHandler(m))
+	mux.Handle("/deploys/", deploysHandler(m, []byte(os.Getenv("APPROVAL_SIGNING_KEY"))))
+	mux.Handle("/schedules", schedulesHandler(m))
 	mux.Handle("/pause", pauseHandler(m))
+	mux.Handle("/notifs/test", testNotifHandler(m))
+	mux.Handle("/config", configHandler())
+	mux.Handle("/debug/vars", expvar.Handler())
 	return http.Server{
 		Addr:     addr,
 		Handler:  logging(logger)(mux),
@@ -32,15 +46,42 @@ func healthcheckHandler() http.HandlerFunc {
 	}
 }
 
+func configHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(manager.ConfigJson()))
+	}
+}
+
 func pauseHandler(m manager.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		m.Pause()
 	}
 }
 
-func timeHandler(format string) http.HandlerFunc {
+// testNotifHandler sends a test notification, i.e. `POST /notifs/test?channel=DISCORD_ALERT_WEBHOOK`, to the specified
+// channel, or to all configured channels if no channel is specified.
+func testNotifHandler(m manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		if r.Method != http.MethodPost {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else if err := m.TestNotification(r.URL.Query().Get("channel")); err != nil {
+			body = "could not send test notification: " + err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			body = "test notification sent"
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
+func timeHandler(format manager.TimeFormatter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tm := time.Now().Format(format)
+		now := time.Now()
+		tm := format(now, now)
 		status := http.StatusOK
 		message := "The time is " + tm
 		writeJsonResponse(w, message, status)
@@ -82,6 +123,384 @@ func jobHandler(m manager.Manager) http.HandlerFunc {
 	}
 }
 
+const (
+	defaultJobPageSize = 100
+	maxJobPageSize     = 1000
+)
+
+// Job timings are aggregated over the last week by default, and over at most a month, so that a query never has to
+// read every job of a type
+const (
+	defaultJobTimingsDays = 7
+	maxJobTimingsDays     = 30
+)
+
+// jobPage is a page of job states, along with the cursor to pass to fetch the next page, if there is one
+type jobPage struct {
+	Jobs       []job.JobState
+	NextCursor string `json:",omitempty"`
+}
+
+// jobListHandler serves paginated job queries, i.e. `GET /jobs?cursor=...&limit=N`
+func jobListHandler(m manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		limit := defaultJobPageSize
+		var err error
+		if limitParam := r.URL.Query().Get("limit"); len(limitParam) > 0 {
+			limit, err = strconv.Atoi(limitParam)
+		}
+		if r.Method != http.MethodGet {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else if (err != nil) || (limit <= 0) || (limit > maxJobPageSize) {
+			body = fmt.Sprintf("bad request: limit must be between 1 and %d", maxJobPageSize)
+			status = http.StatusBadRequest
+		} else if jobs, nextCursor, err := m.Jobs(r.URL.Query().Get("cursor"), limit); errors.Is(err, manager.Error_InvalidCursor) {
+			body = "bad request: " + err.Error()
+			status = http.StatusBadRequest
+		} else if err != nil {
+			body = "could not get jobs: " + err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			body = jobPage{jobs, nextCursor}
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
+// jobsHandler serves job tree queries, i.e. `GET /jobs/{id}/children`, blocked job queries, i.e. `GET /jobs/blocked`,
+// job state machine diagrams, i.e. `GET /jobs/{type}/state-machine`, stage timings for a job, i.e.
+// `GET /jobs/{id}/timing`, and aggregated across the jobs of a type queued in the last N days, i.e.
+// `GET /jobs/{type}/timings?days=N`, the decisions made while advancing a job, if the decision log is enabled, i.e.
+// `GET /jobs/{id}/decisions`, and approval decisions, i.e. `POST /jobs/{id}/approve?approver=...&token=...` and
+// `POST /jobs/{id}/reject?approver=...&token=...`, and alert acknowledgements for failed jobs, i.e.
+// `POST /jobs/{id}/acknowledge?approver=...&token=...`, along with pages to confirm them, i.e. the same paths with GET.
+func jobsHandler(m manager.Manager, approvalKey []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		pathParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/"), "/")
+		if (len(pathParts) == 2) && (len(pathParts[0]) > 0) && ((pathParts[1] == manager.ApprovalAction_Approve) || (pathParts[1] == manager.ApprovalAction_Reject) || (pathParts[1] == manager.ApprovalAction_Acknowledge)) {
+			approvalHandler(m, approvalKey, pathParts[0], pathParts[1])(w, r)
+			return
+		} else if r.Method != http.MethodGet {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else if (len(pathParts) == 1) && (pathParts[0] == "blocked") {
+			body = m.BlockedJobs()
+		} else if (len(pathParts) == 2) && (pathParts[1] == "state-machine") {
+			if diagram, err := m.JobStateMachine(job.JobType(pathParts[0])); err != nil {
+				body = "not found: " + err.Error()
+				status = http.StatusNotFound
+			} else {
+				// Return the diagram as is so that it can be pasted directly into a Mermaid renderer
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(diagram))
+				return
+			}
+		} else if (len(pathParts) == 2) && (len(pathParts[0]) > 0) && (pathParts[1] == "timing") {
+			if timing, err := m.JobTiming(pathParts[0]); errors.Is(err, manager.Error_JobNotFound) {
+				body = "not found: " + err.Error()
+				status = http.StatusNotFound
+			} else if err != nil {
+				body = "could not get job timing: " + err.Error()
+				status = http.StatusInternalServerError
+			} else {
+				body = timing
+			}
+		} else if (len(pathParts) == 2) && (len(pathParts[0]) > 0) && (pathParts[1] == "timings") {
+			days := defaultJobTimingsDays
+			var err error
+			if daysParam := r.URL.Query().Get("days"); len(daysParam) > 0 {
+				days, err = strconv.Atoi(daysParam)
+			}
+			if (err != nil) || (days <= 0) || (days > maxJobTimingsDays) {
+				body = fmt.Sprintf("bad request: days must be between 1 and %d", maxJobTimingsDays)
+				status = http.StatusBadRequest
+			} else if summary, err := m.JobTimings(job.JobType(pathParts[0]), time.Now().AddDate(0, 0, -days)); err != nil {
+				body = "could not get job timings: " + err.Error()
+				status = http.StatusInternalServerError
+			} else {
+				body = summary
+			}
+		} else if (len(pathParts) == 2) && (len(pathParts[0]) > 0) && (pathParts[1] == "decisions") {
+			if decisions, err := m.JobDecisions(pathParts[0]); errors.Is(err, manager.Error_DecisionLogDisabled) {
+				body = "decision log disabled: set DEBUG_DECISION_LOG_SIZE to enable it"
+				status = http.StatusServiceUnavailable
+			} else if err != nil {
+				body = "could not get job decisions: " + err.Error()
+				status = http.StatusInternalServerError
+			} else {
+				body = decisions
+			}
+		} else if (len(pathParts) == 2) && (len(pathParts[0]) > 0) && (pathParts[1] == "history") {
+			if history, err := m.JobHistory(pathParts[0]); errors.Is(err, manager.Error_JobNotFound) {
+				body = "not found: " + err.Error()
+				status = http.StatusNotFound
+			} else if err != nil {
+				body = "could not get job history: " + err.Error()
+				status = http.StatusInternalServerError
+			} else {
+				body = history
+			}
+		} else if (len(pathParts) != 2) || (len(pathParts[0]) == 0) || (pathParts[1] != "children") {
+			body = "not found: " + r.URL.Path
+			status = http.StatusNotFound
+		} else if childJobs, err := m.ChildJobs(pathParts[0]); err != nil {
+			body = "could not get child jobs: " + err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			body = childJobs
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
+// Links in notifications can only be opened with a GET request, so approval links open a page that asks the approver to
+// confirm their decision, which then makes the same request as a POST. This also keeps link previews and crawlers from
+// approving jobs.
+var approvalConfirmTemplate = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<h2>{{.Title}} job {{.JobId}}?</h2>
+<p>You are about to {{.Action}} this job as <b>{{.ApproverId}}</b>.</p>
+<form method="post" action="{{.Url}}">
+<button type="submit">{{.Title}}</button>
+</form>
+</body>
+</html>
+`))
+
+type approvalConfirm struct {
+	Title      string
+	Action     string
+	JobId      string
+	ApproverId string
+	Url        string
+}
+
+// approvalHandler approves or rejects a job waiting for approval on behalf of one of the job's approvers, or acknowledges
+// the alert for a failed job on behalf of one of the alert responders. A GET request returns a page to confirm the
+// decision with, and a POST request makes the decision.
+//
+// The request must carry a token signed with the approval signing key for the same job, action, and approver, e.g.
+// minted by the bot or workflow that the approver authenticated with, since the approver named in the request can't
+// otherwise be trusted. Approvals are disabled if no signing key has been configured.
+func approvalHandler(m manager.Manager, approvalKey []byte, jobId, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		approverId := r.URL.Query().Get("approver")
+		if (r.Method != http.MethodPost) && (r.Method != http.MethodGet) {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else if len(approvalKey) == 0 {
+			body = "approvals disabled: no signing key configured"
+			status = http.StatusServiceUnavailable
+		} else if len(approverId) == 0 {
+			body = "bad request: missing approver"
+			status = http.StatusBadRequest
+		} else if err := verifyApproval(approvalKey, r.URL.Query().Get("token"), jobId, action, approverId); err != nil {
+			m.RecordRejectedApproval("job "+jobId, approverId, action, r.RemoteAddr, err)
+			body = "forbidden: " + err.Error()
+			status = http.StatusForbidden
+		} else if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err = approvalConfirmTemplate.Execute(w, approvalConfirm{
+				strings.ToUpper(action[:1]) + action[1:],
+				action,
+				jobId,
+				approverId,
+				r.URL.RequestURI(),
+			}); err != nil {
+				log.Printf("approvalHandler: error rendering confirmation page: %v", err)
+			}
+			return
+		} else {
+			switch action {
+			case manager.ApprovalAction_Approve:
+				err = m.ApproveJob(jobId, approverId)
+			case manager.ApprovalAction_Reject:
+				err = m.RejectJob(jobId, approverId)
+			default:
+				err = m.AcknowledgeJob(jobId, approverId)
+			}
+			switch {
+			case err == nil:
+				body = m.CheckJob(jobId)
+			case errors.Is(err, manager.Error_JobNotFound):
+				body = "not found: " + err.Error()
+				status = http.StatusNotFound
+			case errors.Is(err, manager.Error_NotApprover), errors.Is(err, manager.Error_NotResponder):
+				m.RecordRejectedApproval("job "+jobId, approverId, action, r.RemoteAddr, err)
+				body = "forbidden: " + err.Error()
+				status = http.StatusForbidden
+			case errors.Is(err, manager.Error_NotPendingApproval), errors.Is(err, manager.Error_ApprovalExpired),
+				errors.Is(err, manager.Error_NotAcknowledgeable), errors.Is(err, manager.Error_AlreadyAcknowledged):
+				body = "conflict: " + err.Error()
+				status = http.StatusConflict
+			default:
+				body = "could not update job: " + err.Error()
+				status = http.StatusInternalServerError
+			}
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
+// verifyApproval fails closed, i.e. no request can be verified without a signing key
+func verifyApproval(approvalKey []byte, token, jobId, action, approverId string) error {
+	if len(approvalKey) == 0 {
+		return fmt.Errorf("verifyApproval: %w: no signing key configured", manager.Error_InvalidApprovalToken)
+	} else if len(token) == 0 {
+		return fmt.Errorf("verifyApproval: %w: missing token", manager.Error_InvalidApprovalToken)
+	}
+	return manager.VerifyApprovalToken(approvalKey, token, jobId, action, approverId, time.Now())
+}
+
+// clustersHandler serves cluster queries, i.e. `GET /clusters/{cluster}/services`
+func clustersHandler(m manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		pathParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/clusters/"), "/"), "/")
+		if r.Method != http.MethodGet {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else if (len(pathParts) != 2) || (len(pathParts[0]) == 0) || (pathParts[1] != "services") {
+			body = "not found: " + r.URL.Path
+			status = http.StatusNotFound
+		} else if services, err := m.ClusterServices(pathParts[0]); err != nil {
+			body = "could not list services: " + err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			body = services
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
+// componentsHandler serves component queries, i.e. `GET /components/{component}/task-def` and
+// `GET /components/{component}/current-image`
+func componentsHandler(m manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		pathParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/components/"), "/"), "/")
+		if r.Method != http.MethodGet {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else if (len(pathParts) == 2) && (len(pathParts[0]) > 0) && (pathParts[1] == "current-image") {
+			if image, err := m.ComponentImage(manager.DeployComponent(pathParts[0])); err != nil {
+				body = "could not get current image: " + err.Error()
+				status = http.StatusInternalServerError
+			} else {
+				body = image
+			}
+		} else if (len(pathParts) != 2) || (len(pathParts[0]) == 0) || (pathParts[1] != "task-def") {
+			body = "not found: " + r.URL.Path
+			status = http.StatusNotFound
+		} else if taskDefArn, err := m.ComponentTaskDefinition(manager.DeployComponent(pathParts[0])); err != nil {
+			body = "could not get task definition: " + err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			body = taskDefArn
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
+// deploysHandler serves deployment status queries for a commit, i.e. `GET /deploys/{sha}`, and the state of the deploy
+// circuit breaker, i.e. `GET /deploys/breaker`, which can be reset with
+// `POST /deploys/breaker/reset?operator=...&token=...`. Resetting the breaker lets through deployments that it would
+// otherwise hold, and so needs a token signed with the approval signing key, like approvals do.
+func deploysHandler(m manager.Manager, approvalKey []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		sha := strings.Trim(strings.TrimPrefix(r.URL.Path, "/deploys/"), "/")
+		if sha == "breaker/reset" {
+			operatorId := r.URL.Query().Get("operator")
+			if r.Method != http.MethodPost {
+				body = "unsupported method: " + r.Method
+				status = http.StatusMethodNotAllowed
+			} else if len(approvalKey) == 0 {
+				body = "breaker reset disabled: no signing key configured"
+				status = http.StatusServiceUnavailable
+			} else if len(operatorId) == 0 {
+				body = "bad request: missing operator"
+				status = http.StatusBadRequest
+			} else if err := verifyApproval(approvalKey, r.URL.Query().Get("token"), manager.ApprovalTarget_DeployBreaker, manager.ApprovalAction_Reset, operatorId); err != nil {
+				m.RecordRejectedApproval(manager.ApprovalTarget_DeployBreaker, operatorId, manager.ApprovalAction_Reset, r.RemoteAddr, err)
+				body = "forbidden: " + err.Error()
+				status = http.StatusForbidden
+			} else {
+				log.Printf("deploysHandler: deploy breaker reset by %s", operatorId)
+				m.ResetDeployBreaker()
+				body = m.DeployBreaker()
+			}
+		} else if r.Method != http.MethodGet {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else if sha == "breaker" {
+			body = m.DeployBreaker()
+		} else if (len(sha) == 0) || strings.Contains(sha, "/") {
+			body = "not found: " + r.URL.Path
+			status = http.StatusNotFound
+		} else if deployStatus, err := m.DeployStatus(sha); errors.Is(err, manager.Error_InvalidSha) {
+			body = "bad request: " + err.Error()
+			status = http.StatusBadRequest
+		} else if err != nil {
+			body = "could not get deployment status: " + err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			body = deployStatus
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
+// scheduleStatus describes a job schedule, i.e. its expression, when it last queued a job, and when it will next do so
+type scheduleStatus struct {
+	Name       string
+	Expression string
+	Type       job.JobType
+	LastRun    *time.Time `json:",omitempty"`
+	NextRun    time.Time
+}
+
+// schedulesHandler serves job schedule queries, i.e. `GET /schedules`
+func schedulesHandler(m manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		var body any
+		if r.Method != http.MethodGet {
+			body = "unsupported method: " + r.Method
+			status = http.StatusMethodNotAllowed
+		} else {
+			now := time.Now()
+			schedules := make([]scheduleStatus, 0)
+			for _, schedule := range m.JobSchedules() {
+				s := scheduleStatus{
+					Name:       schedule.Name,
+					Expression: schedule.Expression,
+					Type:       schedule.Type,
+					NextRun:    schedule.NextRun(now),
+				}
+				if !schedule.LastRun.IsZero() {
+					lastRun := schedule.LastRun
+					s.LastRun = &lastRun
+				}
+				schedules = append(schedules, s)
+			}
+			body = schedules
+		}
+		writeJsonResponse(w, body, status)
+	}
+}
+
 func writeJsonResponse(w http.ResponseWriter, body any, httpStatusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpStatusCode)
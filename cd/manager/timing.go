@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// JobTiming breaks down how long a job spent in each stage before it finished, or so far, if it's still in progress.
+// Times are in seconds so that they can be charted directly.
+//
+// Jobs are moved to "dequeued" with the same timestamp they were queued with, so time spent waiting in the queue shows
+// up as time spent "dequeued".
+type JobTiming struct {
+	JobId  string
+	Type   job.JobType
+	Stage  job.JobStage
+	Stages map[job.JobStage]float64
+	Total  float64
+}
+
+// JobTimingSummary aggregates the stage timings of finished jobs of a particular type
+type JobTimingSummary struct {
+	Type   job.JobType
+	Jobs   int
+	Stages map[job.JobStage]StageTiming
+	Total  StageTiming
+}
+
+// StageTiming summarizes how long jobs spent in a stage, in seconds
+type StageTiming struct {
+	Count int
+	Mean  float64
+	P50   float64
+	P90   float64
+	Max   float64
+}
+
+// NewJobTiming computes a job's stage timings from its recorded states, in ascending order of timestamp
+func NewJobTiming(history []job.JobState, now time.Time) JobTiming {
+	timing := JobTiming{Stages: make(map[job.JobStage]float64)}
+	for i, jobState := range history {
+		timing.JobId = jobState.JobId
+		timing.Type = jobState.Type
+		timing.Stage = jobState.Stage
+		if job.IsFinishedJob(jobState) {
+			break
+		}
+		// A job stays in a stage until its next recorded state, or until now if this is its latest state. A job can
+		// have more than one state recorded for the same stage, e.g. when it updates its progress while waiting.
+		until := now
+		if i+1 < len(history) {
+			until = history[i+1].Ts
+		}
+		if elapsed := until.Sub(jobState.Ts).Seconds(); elapsed > 0 {
+			timing.Stages[jobState.Stage] += elapsed
+			timing.Total += elapsed
+		}
+	}
+	return timing
+}
+
+// SummarizeJobTimings aggregates the timings of finished jobs, ignoring jobs that are still in progress so that they
+// don't skew the results.
+func SummarizeJobTimings(jobType job.JobType, timings []JobTiming) JobTimingSummary {
+	stageSamples := make(map[job.JobStage][]float64)
+	totalSamples := make([]float64, 0, len(timings))
+	for _, timing := range timings {
+		if !job.IsFinishedJob(job.JobState{Stage: timing.Stage}) {
+			continue
+		}
+		for stage, seconds := range timing.Stages {
+			stageSamples[stage] = append(stageSamples[stage], seconds)
+		}
+		totalSamples = append(totalSamples, timing.Total)
+	}
+	summary := JobTimingSummary{
+		Type:   jobType,
+		Jobs:   len(totalSamples),
+		Stages: make(map[job.JobStage]StageTiming, len(stageSamples)),
+		Total:  newStageTiming(totalSamples),
+	}
+	for stage, samples := range stageSamples {
+		summary.Stages[stage] = newStageTiming(samples)
+	}
+	return summary
+}
+
+func newStageTiming(samples []float64) StageTiming {
+	if len(samples) == 0 {
+		return StageTiming{}
+	}
+	sort.Float64s(samples)
+	sum := 0.0
+	for _, sample := range samples {
+		sum += sample
+	}
+	return StageTiming{
+		Count: len(samples),
+		Mean:  sum / float64(len(samples)),
+		P50:   percentile(samples, 0.5),
+		P90:   percentile(samples, 0.9),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+// percentile uses the nearest-rank method on sorted samples
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
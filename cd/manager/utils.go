@@ -3,16 +3,47 @@ package manager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
 	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
+
 	"github.com/3box/pipeline-tools/cd/manager/common/job"
 )
 
 const commitHashRegex = "[0-9a-f]{40}"
+
+// Abbreviated commit hashes are at least 7 characters long, like those shown by git and GitHub
+const commitHashPrefixRegex = "^[0-9a-f]{7,40}$"
 const casV5Version = "5"
 
+// Deploy environment variables with values starting with this prefix are read from the SSM parameter that follows
+const secretEnvVarPrefix = "ssm:"
+
+// Environment variables with these prefixes are set by AWS and ECS for every task, and so can't be overridden by jobs
+var reservedEnvVarPrefixes = []string{"AWS_", "ECS_"}
+
+const (
+	subnetIdPrefix        = "subnet-"
+	securityGroupIdPrefix = "sg-"
+)
+
+// SystemClock tells the actual time
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
 func PrintJob(jobStates ...job.JobState) string {
 	prettyString := ""
 	for _, jobState := range jobStates {
@@ -42,11 +73,228 @@ func ComponentRepo(component DeployComponent) (DeployRepo, error) {
 	}
 }
 
+// ComponentDisplayName returns the configured human-readable name for a component, falling back to the uppercased
+// component name. This is only meant for presentation, e.g. in notifications.
+func ComponentDisplayName(component DeployComponent) string {
+	if displayNamesJson, found := os.LookupEnv("COMPONENT_DISPLAY_NAMES"); found {
+		displayNames := make(map[DeployComponent]string)
+		if err := json.Unmarshal([]byte(displayNamesJson), &displayNames); err != nil {
+			log.Printf("componentDisplayName: invalid configuration: %v", err)
+		} else if displayName, found := displayNames[component]; found && (len(displayName) > 0) {
+			return displayName
+		}
+	}
+	return strings.ToUpper(string(component))
+}
+
+// DeployRegions returns the configured order of regions for staggered multi-region deployments, if any
+func DeployRegions() []string {
+	regions := make([]string, 0)
+	for _, region := range strings.Split(os.Getenv("DEPLOY_REGIONS"), ",") {
+		if region = strings.TrimSpace(region); len(region) > 0 {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// DeployEnvVars returns the environment variables configured for deployments of a component in this environment
+func DeployEnvVars(component DeployComponent) (map[string]string, error) {
+	envVars := make(map[string]map[string]string)
+	if envVarsJson := os.Getenv("DEPLOY_ENV_VARS"); len(envVarsJson) > 0 {
+		if err := json.Unmarshal([]byte(envVarsJson), &envVars); err != nil {
+			return nil, fmt.Errorf("deployEnvVars: invalid configuration: %v", err)
+		}
+	}
+	return envVars[string(component)], nil
+}
+
+// SecretEnvVarParam returns the SSM parameter to read a secret environment variable from, and whether the value refers
+// to a secret at all.
+func SecretEnvVarParam(value string) (string, bool) {
+	if strings.HasPrefix(value, secretEnvVarPrefix) {
+		return strings.TrimPrefix(value, secretEnvVarPrefix), true
+	}
+	return "", false
+}
+
+// DecodeLayout converts the layout of a deploy job read back from storage, which comes back as a generic map, into a
+// `Layout` structure
+func DecodeLayout(jobState job.JobState) error {
+	if jobState.Type == job.JobType_Deploy {
+		if layout, found := jobState.Params[job.DeployJobParam_Layout].(map[string]interface{}); found {
+			var marshaledLayout Layout
+			if err := mapstructure.Decode(layout, &marshaledLayout); err != nil {
+				return err
+			}
+			jobState.Params[job.DeployJobParam_Layout] = marshaledLayout
+		}
+	}
+	return nil
+}
+
+// NetworkOverride returns the explicit network configuration requested for a job, if any
+func NetworkOverride(jobState job.JobState) (*NetworkConfig, error) {
+	paramOverride, found := jobState.Params[job.JobParam_NetworkOverride]
+	if !found {
+		return nil, nil
+	}
+	var networkConfig NetworkConfig
+	if err := mapstructure.Decode(paramOverride, &networkConfig); err != nil {
+		return nil, fmt.Errorf("networkOverride: invalid network configuration: %v", err)
+	} else if err = ValidateNetworkConfig(networkConfig); err != nil {
+		return nil, err
+	}
+	return &networkConfig, nil
+}
+
+// WorkflowRunUrl returns the URL of the workflow run that triggered a job, if any. The URL must look like a GitHub
+// Actions run URL, e.g. `https://github.com/3box/ceramic-tests/actions/runs/123`, since it is shown as a link.
+func WorkflowRunUrl(jobState job.JobState) (string, error) {
+	paramUrl, found := jobState.Params[job.JobParam_WorkflowRunUrl]
+	if !found {
+		return "", nil
+	}
+	runUrl, _ := paramUrl.(string)
+	if parsedUrl, err := url.Parse(runUrl); (err != nil) || (parsedUrl.Scheme != "https") || (len(parsedUrl.Host) == 0) || !strings.Contains(parsedUrl.Path, "/actions/runs/") {
+		return "", fmt.Errorf("workflowRunUrl: invalid workflow run url: %v", paramUrl)
+	}
+	return runUrl, nil
+}
+
+// DeployVersion returns the release version (e.g. "v2.14.0") a deploy job is tagged with, if any. The version is only
+// used for display and history, so it is validated loosely.
+func DeployVersion(jobState job.JobState) (string, error) {
+	paramVersion, found := jobState.Params[job.DeployJobParam_Version]
+	if !found {
+		return "", nil
+	}
+	version, _ := paramVersion.(string)
+	if len(strings.TrimSpace(version)) == 0 {
+		return "", fmt.Errorf("deployVersion: invalid release version: %v", paramVersion)
+	}
+	return version, nil
+}
+
+// EnvOverrides returns the environment variables requested for the tasks launched by a job, if any
+func EnvOverrides(jobState job.JobState) (map[string]string, error) {
+	paramOverrides, found := jobState.Params[job.JobParam_EnvOverrides]
+	if !found {
+		return nil, nil
+	}
+	var envOverrides map[string]string
+	if err := mapstructure.Decode(paramOverrides, &envOverrides); err != nil {
+		return nil, fmt.Errorf("envOverrides: invalid environment overrides: %v", err)
+	}
+	for name := range envOverrides {
+		if len(name) == 0 {
+			return nil, fmt.Errorf("envOverrides: missing environment variable name")
+		}
+		for _, prefix := range reservedEnvVarPrefixes {
+			if strings.HasPrefix(strings.ToUpper(name), prefix) {
+				return nil, fmt.Errorf("envOverrides: reserved environment variable: %s", name)
+			}
+		}
+	}
+	return envOverrides, nil
+}
+
+// IsSilentJob returns true if notifications shouldn't be sent for a job. Failures of silent jobs can optionally still be
+// notified so that genuine problems aren't hidden.
+func IsSilentJob(jobState job.JobState) bool {
+	if silent, _ := jobState.Params[job.JobParam_Silent].(bool); !silent {
+		return false
+	} else if jobState.Stage == job.JobStage_Failed {
+		notifyFailures, _ := strconv.ParseBool(os.Getenv("NOTIFY_SILENT_JOB_FAILURES"))
+		return !notifyFailures
+	}
+	return true
+}
+
+// JobApprovers returns the people who can approve a job, if the job requires approval
+func JobApprovers(jobState job.JobState) ([]string, error) {
+	paramApprovers, found := jobState.Params[job.JobParam_Approvers]
+	if !found {
+		return nil, nil
+	}
+	var approvers []string
+	if err := mapstructure.Decode(paramApprovers, &approvers); err != nil {
+		return nil, fmt.Errorf("jobApprovers: invalid approvers: %v", err)
+	}
+	for _, approver := range approvers {
+		if len(strings.TrimSpace(approver)) == 0 {
+			return nil, fmt.Errorf("jobApprovers: missing approver")
+		}
+	}
+	return approvers, nil
+}
+
+// NeedsApproval returns true if a job requires approval and hasn't been approved yet
+func NeedsApproval(jobState job.JobState) bool {
+	approvers, _ := JobApprovers(jobState)
+	approvedBy, _ := jobState.Params[job.JobParam_ApprovedBy].(string)
+	return (len(approvers) > 0) && (len(approvedBy) == 0)
+}
+
+// TaskOverrides returns the environment overrides for a task launched by a job, i.e. the environment variables requested
+// for the job along with those the job sets itself, which take precedence.
+func TaskOverrides(jobState job.JobState, overrides map[string]string) (map[string]string, error) {
+	envOverrides, err := EnvOverrides(jobState)
+	if err != nil {
+		return nil, err
+	} else if len(envOverrides) == 0 {
+		return overrides, nil
+	}
+	for name, value := range overrides {
+		envOverrides[name] = value
+	}
+	return envOverrides, nil
+}
+
+// ValidateNetworkConfig makes sure that a network configuration refers to valid subnets and security groups
+func ValidateNetworkConfig(networkConfig NetworkConfig) error {
+	if len(networkConfig.Subnets) == 0 {
+		return fmt.Errorf("validateNetworkConfig: missing subnets")
+	} else if len(networkConfig.SecurityGroups) == 0 {
+		return fmt.Errorf("validateNetworkConfig: missing security groups")
+	}
+	for _, subnet := range networkConfig.Subnets {
+		if !strings.HasPrefix(subnet, subnetIdPrefix) {
+			return fmt.Errorf("validateNetworkConfig: invalid subnet: %s", subnet)
+		}
+	}
+	for _, securityGroup := range networkConfig.SecurityGroups {
+		if !strings.HasPrefix(securityGroup, securityGroupIdPrefix) {
+			return fmt.Errorf("validateNetworkConfig: invalid security group: %s", securityGroup)
+		}
+	}
+	return nil
+}
+
+// Version returns the configured version of the manager, or the commit it was built from, if known
+func Version() string {
+	if version := os.Getenv("MANAGER_VERSION"); len(version) > 0 {
+		return version
+	} else if buildInfo, found := debug.ReadBuildInfo(); found {
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
 func IsValidSha(sha string) bool {
 	isValidSha, err := regexp.MatchString(commitHashRegex, sha)
 	return err == nil && isValidSha
 }
 
+func IsValidShaPrefix(sha string) bool {
+	isValidShaPrefix, err := regexp.MatchString(commitHashPrefixRegex, sha)
+	return err == nil && isValidShaPrefix
+}
+
 func IsV5WorkerJob(jobState job.JobState) bool {
 	if jobState.Type == job.JobType_Anchor {
 		if version, found := jobState.Params[job.AnchorJobParam_Version].(string); found && (version == casV5Version) {
@@ -70,6 +318,11 @@ func AdvanceJob(jobState job.JobState, jobStage job.JobStage, ts time.Time, err
 	jobState.Ts = ts
 	if err != nil {
 		jobState.Params[job.JobParam_Error] = err.Error()
+		if cause := jobErrorCause(err); cause != nil {
+			jobState.Params[job.JobParam_ErrorCause] = cause.Error()
+		} else {
+			delete(jobState.Params, job.JobParam_ErrorCause)
+		}
 	}
 	if err = db.AdvanceJob(jobState); err == nil {
 		// Only send a notification if the DB update was successful
@@ -78,6 +331,92 @@ func AdvanceJob(jobState job.JobState, jobStage job.JobStage, ts time.Time, err
 	return jobState, err
 }
 
+// Errors that callers might want to check a job's error for, e.g. to tell timeouts apart from other failures
+var jobErrorCauses = []error{
+	Error_StartupTimeout,
+	Error_CompletionTimeout,
+	Error_Superseded,
+	Error_ComponentFrozen,
+	Error_Rejected,
+	Error_ApprovalExpired,
+}
+
+func jobErrorCause(err error) error {
+	for _, cause := range jobErrorCauses {
+		if errors.Is(err, cause) {
+			return cause
+		}
+	}
+	return nil
+}
+
+// jobError is the error recorded for a job, which unwraps to the well-known cause of the error, if any
+type jobError struct {
+	message string
+	cause   error
+}
+
+func (e jobError) Error() string {
+	return e.message
+}
+
+func (e jobError) Unwrap() error {
+	return e.cause
+}
+
+// JobError returns the error recorded for a job, or nil if there isn't one. Jobs only store the text of their errors, so
+// the returned error only wraps the error's well-known cause, if any, e.g. so that
+// `errors.Is(JobError(jobState), Error_CompletionTimeout)` is true for jobs that timed out.
+func JobError(jobState job.JobState) error {
+	message, found := jobState.Params[job.JobParam_Error].(string)
+	if !found {
+		return nil
+	}
+	var cause error
+	if causeMessage, found := jobState.Params[job.JobParam_ErrorCause].(string); found {
+		for _, c := range jobErrorCauses {
+			if c.Error() == causeMessage {
+				cause = c
+				break
+			}
+		}
+	}
+	return jobError{message, cause}
+}
+
+// CopyJob returns a copy of a job state that doesn't share its top-level parameters with the original, so that it can be
+// compared with the original after the latter has been updated in place.
+func CopyJob(jobState job.JobState) job.JobState {
+	if jobState.Params != nil {
+		params := make(map[string]interface{}, len(jobState.Params))
+		for k, v := range jobState.Params {
+			params[k] = v
+		}
+		jobState.Params = params
+	}
+	return jobState
+}
+
+// Diff returns the jobs whose states differ between two sets of job states, matched by job ID. Jobs that are missing
+// from the latter set are not considered changed.
+func Diff(before, after []job.JobState) []JobStateDelta {
+	beforeById := make(map[string]job.JobState, len(before))
+	for _, jobState := range before {
+		beforeById[jobState.JobId] = jobState
+	}
+	deltas := make([]JobStateDelta, 0)
+	for _, afterState := range after {
+		beforeState, found := beforeById[afterState.JobId]
+		if !found ||
+			(beforeState.Stage != afterState.Stage) ||
+			!beforeState.Ts.Equal(afterState.Ts) ||
+			!reflect.DeepEqual(beforeState.Params, afterState.Params) {
+			deltas = append(deltas, JobStateDelta{beforeState, afterState})
+		}
+	}
+	return deltas
+}
+
 func RetryWithResultAndError[R any](parentCtx context.Context, timeout time.Duration, numRetries int, fn func(context.Context, ...interface{}) (R, error), args ...interface{}) (R, error) {
 	retry := func() (R, error) {
 		ctx, cancel := context.WithTimeout(parentCtx, timeout)
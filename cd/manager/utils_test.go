@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/3box/pipeline-tools/cd/manager/common/job"
+)
+
+// testDb only implements the database operations used by AdvanceJob
+type testDb struct {
+	Database
+	advanced []job.JobState
+}
+
+func (db *testDb) AdvanceJob(jobState job.JobState) error {
+	db.advanced = append(db.advanced, jobState)
+	return nil
+}
+
+// testNotifs only implements the notifications used by AdvanceJob
+type testNotifs struct {
+	Notifs
+	notified []job.JobState
+}
+
+func (n *testNotifs) NotifyJob(jobs ...job.JobState) {
+	n.notified = append(n.notified, jobs...)
+}
+
+func TestJobErrorWrapsCause(t *testing.T) {
+	for _, cause := range []error{Error_StartupTimeout, Error_CompletionTimeout, Error_Superseded, Error_Rejected} {
+		err := fmt.Errorf("taskJob: %w", cause)
+		jobState, advanceErr := AdvanceJob(job.JobState{JobId: "job", Stage: job.JobStage_Started, Ts: time.Now()}, job.JobStage_Failed, time.Now(), err, &testDb{}, &testNotifs{})
+		if advanceErr != nil {
+			t.Fatal(advanceErr)
+		}
+		jobErr := JobError(jobState)
+		if !errors.Is(jobErr, cause) {
+			t.Fatalf("expected job error to wrap %q: %v", cause, jobErr)
+		} else if jobErr.Error() != err.Error() {
+			t.Fatalf("expected job error message %q, got %q", err.Error(), jobErr.Error())
+		}
+	}
+}
+
+func TestJobErrorWithoutCause(t *testing.T) {
+	jobState, err := AdvanceJob(job.JobState{JobId: "job", Stage: job.JobStage_Started, Ts: time.Now()}, job.JobStage_Failed, time.Now(), fmt.Errorf("task failed"), &testDb{}, &testNotifs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobErr := JobError(jobState)
+	if jobErr == nil {
+		t.Fatal("expected a job error")
+	} else if errors.Is(jobErr, Error_CompletionTimeout) || errors.Is(jobErr, Error_StartupTimeout) {
+		t.Fatalf("job error matched an unrelated cause: %v", jobErr)
+	}
+}
+
+func TestJobErrorCauseReplaced(t *testing.T) {
+	jobState := job.JobState{JobId: "job", Stage: job.JobStage_Started, Ts: time.Now(), Params: map[string]interface{}{}}
+	jobState, _ = AdvanceJob(jobState, job.JobStage_Waiting, time.Now(), Error_StartupTimeout, &testDb{}, &testNotifs{})
+	jobState, _ = AdvanceJob(jobState, job.JobStage_Failed, time.Now(), fmt.Errorf("task failed"), &testDb{}, &testNotifs{})
+	if errors.Is(JobError(jobState), Error_StartupTimeout) {
+		t.Fatal("job error still matched a previous cause")
+	}
+}
+
+func TestJobErrorNone(t *testing.T) {
+	db := &testDb{}
+	notifs := &testNotifs{}
+	jobState, err := AdvanceJob(job.JobState{JobId: "job", Stage: job.JobStage_Started, Ts: time.Now()}, job.JobStage_Completed, time.Now(), nil, db, notifs)
+	if err != nil {
+		t.Fatal(err)
+	} else if JobError(jobState) != nil {
+		t.Fatal("expected no job error")
+	} else if (len(db.advanced) != 1) || (len(notifs.notified) != 1) {
+		t.Fatal("expected the job to be written and notified once")
+	}
+}
+
+func TestNetworkOverride(t *testing.T) {
+	if networkConfig, err := NetworkOverride(job.JobState{Params: map[string]interface{}{}}); (err != nil) || (networkConfig != nil) {
+		t.Fatalf("expected no override, got %+v, %v", networkConfig, err)
+	}
+	// Params read back from the database are generic maps and slices
+	networkConfig, err := NetworkOverride(job.JobState{Params: map[string]interface{}{
+		job.JobParam_NetworkOverride: map[string]interface{}{
+			"Subnets":        []interface{}{"subnet-preview"},
+			"SecurityGroups": []interface{}{"sg-preview"},
+			"AssignPublicIp": true,
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	} else if (len(networkConfig.Subnets) != 1) || (networkConfig.Subnets[0] != "subnet-preview") || !networkConfig.AssignPublicIp {
+		t.Fatalf("unexpected override: %+v", networkConfig)
+	}
+	if _, err = NetworkOverride(job.JobState{Params: map[string]interface{}{
+		job.JobParam_NetworkOverride: map[string]interface{}{"Subnets": []interface{}{"subnet-preview"}},
+	}}); err == nil {
+		t.Fatal("expected an override without security groups to be rejected")
+	}
+}